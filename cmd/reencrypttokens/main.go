@@ -0,0 +1,34 @@
+// Command reencrypttokens seals every stored Deriv API token with the current
+// TOKEN_ENCRYPTION_KEY_ID. Run it after adding a key, and once after enabling
+// encryption to seal tokens saved in plaintext; retire the old key only after
+// it reports no failures.
+package main
+
+import (
+	"log"
+
+	"github.com/keyadaniel56/algocdk/internal/config"
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/secrets"
+	services "github.com/keyadaniel56/algocdk/service"
+)
+
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("%v", err.Error())
+	}
+	if err := secrets.Configure(cfg.TokenEncryptionKeys, cfg.TokenEncryptionKeyID); err != nil {
+		log.Fatalf("invalid TOKEN_ENCRYPTION_KEYS: %v", err)
+	}
+
+	database.InitDB()
+	updated, failed, err := services.ReencryptDerivTokens()
+	if err != nil {
+		log.Fatalf("re-encryption stopped after %d tokens: %v", updated, err)
+	}
+	log.Printf("re-encrypted %d Deriv tokens with key %q, %d failed", updated, secrets.CurrentKeyID(), failed)
+	if failed > 0 {
+		log.Fatalf("%d tokens are sealed with a key that is not configured; keep the old keys until they are resolved", failed)
+	}
+}
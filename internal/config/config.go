@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -17,6 +19,49 @@ type Config struct {
 	Port       string
 	JWT_SECRET string
 	BASE_URL   string
+
+	// MarketDataSource selects the feed behind /ws/market: "deriv" (default)
+	// or "synthetic" for a random walk that needs no network access
+	MarketDataSource string
+
+	// RecorderSymbols are the symbols whose ticks and candles are recorded
+	// (comma separated in RECORDER_SYMBOLS); empty disables the recorder.
+	// Raw ticks are kept for TickRetentionDays, candles forever.
+	RecorderSymbols   []string
+	TickRetentionDays int
+
+	// TokenEncryptionKeys are the master keys stored Deriv tokens are sealed
+	// with, as comma separated id:base64key pairs (TOKEN_ENCRYPTION_KEYS).
+	// New tokens use TokenEncryptionKeyID, by default the first key listed.
+	TokenEncryptionKeys  string
+	TokenEncryptionKeyID string
+
+	// AppEnv is "development" (default), "staging" or "production" and
+	// picks the Deriv defaults below
+	AppEnv string
+
+	// DerivAppID is the app registered with Deriv whose OAuth redirect URL
+	// points at /api/deriv/oauth/callback. Development defaults to Deriv's
+	// public test app 1089; staging and production must set their own.
+	DerivAppID    string
+	DerivEndpoint string // WebSocket endpoint, without query string
+	DerivLanguage string
+	DerivBrand    string
+	DerivOAuthURL string // Deriv's authorization page, or a local stub
+
+	// DerivAllowedAppIDs are the app IDs uploaded bots may use (comma
+	// separated in DERIV_ALLOWED_APP_IDS); DerivAppID is always allowed
+	DerivAllowedAppIDs []string
+}
+
+// derivDefaults are the Deriv settings for each AppEnv, overridden by the
+// DERIV_* variables
+var derivDefaults = map[string]struct {
+	AppID, Endpoint, Language, Brand, OAuthURL string
+}{
+	"development": {"1089", "wss://ws.derivws.com/websockets/v3", "EN", "deriv", "https://oauth.deriv.com/oauth2/authorize"},
+	"staging":     {"", "wss://ws.derivws.com/websockets/v3", "EN", "deriv", "https://oauth.deriv.com/oauth2/authorize"},
+	"production":  {"", "wss://ws.derivws.com/websockets/v3", "EN", "deriv", "https://oauth.deriv.com/oauth2/authorize"},
 }
 
 func Load() (*Config, error) {
@@ -33,6 +78,29 @@ func Load() (*Config, error) {
 		DBName:     os.Getenv("DB_NAME"),
 		Port:       os.Getenv("PORT"),
 		JWT_SECRET: os.Getenv("JWT_SECRET"),
+
+		MarketDataSource: os.Getenv("MARKET_DATA_SOURCE"),
+
+		TokenEncryptionKeys:  os.Getenv("TOKEN_ENCRYPTION_KEYS"),
+		TokenEncryptionKeyID: os.Getenv("TOKEN_ENCRYPTION_KEY_ID"),
+
+		AppEnv:        strings.ToLower(os.Getenv("APP_ENV")),
+		DerivAppID:    os.Getenv("DERIV_APP_ID"),
+		DerivEndpoint: os.Getenv("DERIV_ENDPOINT"),
+		DerivLanguage: os.Getenv("DERIV_LANGUAGE"),
+		DerivBrand:    os.Getenv("DERIV_BRAND"),
+		DerivOAuthURL: os.Getenv("DERIV_OAUTH_URL"),
+	}
+
+	for _, symbol := range strings.Split(os.Getenv("RECORDER_SYMBOLS"), ",") {
+		if symbol = strings.TrimSpace(symbol); symbol != "" {
+			config.RecorderSymbols = append(config.RecorderSymbols, symbol)
+		}
+	}
+	config.TickRetentionDays, _ = strconv.Atoi(os.Getenv("TICK_RETENTION_DAYS"))
+
+	if err := config.loadDerivDefaults(); err != nil {
+		return nil, err
 	}
 
 	// Set defaults if not provided
@@ -42,10 +110,52 @@ func Load() (*Config, error) {
 	if config.DBPort == "" {
 		config.DBPort = "5433"
 	}
+	if config.MarketDataSource == "" {
+		config.MarketDataSource = "deriv"
+	}
+	if config.TickRetentionDays <= 0 {
+		config.TickRetentionDays = 7
+	}
 
 	return config, nil
 }
 
+// loadDerivDefaults fills unset Deriv settings from the AppEnv defaults
+func (c *Config) loadDerivDefaults() error {
+	if c.AppEnv == "" {
+		c.AppEnv = "development"
+	}
+	defaults, ok := derivDefaults[c.AppEnv]
+	if !ok {
+		return fmt.Errorf("APP_ENV must be development, staging or production, got %q", c.AppEnv)
+	}
+
+	setDefault := func(value *string, def string) {
+		if *value == "" {
+			*value = def
+		}
+	}
+	setDefault(&c.DerivAppID, defaults.AppID)
+	setDefault(&c.DerivEndpoint, defaults.Endpoint)
+	setDefault(&c.DerivLanguage, defaults.Language)
+	setDefault(&c.DerivBrand, defaults.Brand)
+	setDefault(&c.DerivOAuthURL, defaults.OAuthURL)
+	if c.DerivAppID == "" {
+		return fmt.Errorf("DERIV_APP_ID is required when APP_ENV is %s", c.AppEnv)
+	}
+	if _, err := strconv.Atoi(c.DerivAppID); err != nil {
+		return fmt.Errorf("DERIV_APP_ID must be numeric, got %q", c.DerivAppID)
+	}
+
+	c.DerivAllowedAppIDs = []string{c.DerivAppID}
+	for _, id := range strings.Split(os.Getenv("DERIV_ALLOWED_APP_IDS"), ",") {
+		if id = strings.TrimSpace(id); id != "" && id != c.DerivAppID {
+			c.DerivAllowedAppIDs = append(c.DerivAllowedAppIDs, id)
+		}
+	}
+	return nil
+}
+
 // GetDSN returns the PostgreSQL connection string
 func (c *Config) GetDSN() string {
 	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s",
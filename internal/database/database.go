@@ -17,7 +17,15 @@ func InitDB() {
 	if err != nil {
 		log.Fatalf("%v", err.Error())
 	}
-	DB.AutoMigrate(
+	if err := Migrate(DB); err != nil {
+		log.Printf("migration failed: %v", err)
+	}
+	fmt.Println("database connected")
+}
+
+// Migrate creates or updates the tables of every model in db
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(
 		&models.User{},
 		&models.Bot{},
 		&models.Favorite{},
@@ -27,11 +35,39 @@ func InitDB() {
 		&models.Site{},
 		&models.SiteUser{},
 		&models.Transaction{},
+		&models.PaymentSettlement{},
+		&models.WebhookEvent{},
+		&models.Refund{},
+		&models.Dispute{},
+		&models.TransactionEvent{},
+		&models.CommissionRule{},
+		&models.ExchangeRate{},
+		&models.BotPrice{},
 		&models.SalesHistory{},
 		&models.UserBot{},
+		&models.LicenseListing{},
+		&models.RentalPlan{},
+		&models.BillingPlan{},
+		&models.Subscription{},
+		&models.LedgerEntry{},
+		&models.Withdrawal{},
 		&models.Sale{},
 		&models.DerivCredentials{},
+		&models.DerivOAuthState{},
 		&models.SuperAdmin{},
+		&models.Trade{},
+		&models.PaperAccount{},
+		&models.PaperLedgerEntry{},
+		&models.PaperTrade{},
+		&models.Candle{},
+		&models.TickRecord{},
+		&models.CandleCoverage{},
+		&models.BacktestReport{},
+		&models.BotRun{},
+		&models.BotRunLog{},
+		&models.RiskProfile{},
+		&models.BlockedOrder{},
+		&models.CopySubscription{},
+		&models.CopyTrade{},
 	)
-	fmt.Println("database connected")
 }
@@ -527,13 +527,16 @@ func UpdateAdminBankDetails(ctx *gin.Context) {
 		return
 	}
 
-	adminID := ctx.GetUint("admin_id") // Assuming middleware provides admin_id
 	var admin models.Admin
-	if err := database.DB.First(&admin, adminID).Error; err != nil {
+	if err := database.DB.Where("person_id = ?", ctx.GetUint("user_id")).First(&admin).Error; err != nil {
 		ctx.JSON(http.StatusNotFound, gin.H{"message": "Admin not found"})
 		return
 	}
 
+	if admin.BankCode != input.BankCode || admin.AccountNumber != input.AccountNumber || admin.AccountName != input.AccountName {
+		// Payouts go to a transfer recipient made from the new details
+		admin.PaystackRecipientCode = ""
+	}
 	admin.BankCode = input.BankCode
 	admin.AccountNumber = input.AccountNumber
 	admin.AccountName = input.AccountName
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	services "github.com/keyadaniel56/algocdk/service"
+)
+
+var backtester = services.NewBacktester(candleStore)
+
+// BacktestRequest is the body of a backtest run. Start and end are epoch
+// seconds and default to the last 24 hours.
+type BacktestRequest struct {
+	Start          int64   `json:"start"`
+	End            int64   `json:"end"`
+	InitialBalance float64 `json:"initial_balance"`
+}
+
+// ownedBot loads the bot in the :id param and checks that the caller owns it
+func ownedBot(c *gin.Context) (*models.Bot, bool) {
+	var bot models.Bot
+	if err := database.DB.First(&bot, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "bot not found"})
+		return nil, false
+	}
+	if bot.OwnerID != c.GetUint("user_id") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "not your bot"})
+		return nil, false
+	}
+	return &bot, true
+}
+
+// SetBotStrategyHandler godoc
+// @Summary Set a bot's strategy definition
+// @Description Validates and stores the declarative strategy definition used to backtest the bot
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "Bot ID"
+// @Param strategy body models.StrategyDefinition true "Strategy definition"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/admin/bots/{id}/strategy [put]
+func SetBotStrategyHandler(c *gin.Context) {
+	bot, ok := ownedBot(c)
+	if !ok {
+		return
+	}
+
+	var def models.StrategyDefinition
+	if err := c.ShouldBindJSON(&def); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+	if err := def.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid strategy definition", "details": err.Error()})
+		return
+	}
+
+	data, _ := json.Marshal(def)
+	if err := database.DB.Model(bot).Update("strategy_definition", string(data)).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save strategy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "strategy updated", "strategy": def})
+}
+
+// RunBotBacktestHandler godoc
+// @Summary Backtest a bot
+// @Description Runs the bot's strategy definition over historical ticks in the background and returns the pending report
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "Bot ID"
+// @Param request body BacktestRequest false "Backtest period and starting balance"
+// @Security ApiKeyAuth
+// @Success 202 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/admin/bots/{id}/backtests [post]
+func RunBotBacktestHandler(c *gin.Context) {
+	bot, ok := ownedBot(c)
+	if !ok {
+		return
+	}
+
+	var req BacktestRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+			return
+		}
+	}
+
+	report, err := backtester.StartBotBacktest(*bot, c.GetUint("user_id"), req.Start, req.End, req.InitialBalance)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to start backtest", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "backtest started", "report": report})
+}
+
+// ListBotBacktestsHandler godoc
+// @Summary List a bot's backtests
+// @Description Lists the backtest reports of a bot, newest first, without their equity curves
+// @Tags admin
+// @Produce json
+// @Param id path int true "Bot ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/admin/bots/{id}/backtests [get]
+func ListBotBacktestsHandler(c *gin.Context) {
+	bot, ok := ownedBot(c)
+	if !ok {
+		return
+	}
+
+	var reports []models.BacktestReport
+	if err := database.DB.Omit("equity_curve").Where("bot_id = ?", bot.ID).
+		Order("created_at desc").Limit(100).Find(&reports).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load backtests"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"backtests": reports, "latest_backtest_id": bot.LatestBacktestID})
+}
+
+// GetBacktestHandler godoc
+// @Summary Get a backtest report
+// @Description Retrieves a full backtest report, including its equity curve
+// @Tags admin
+// @Produce json
+// @Param id path int true "Backtest report ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} models.BacktestReport
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/admin/backtests/{id} [get]
+func GetBacktestHandler(c *gin.Context) {
+	var report models.BacktestReport
+	if err := database.DB.First(&report, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "backtest not found"})
+		return
+	}
+
+	var bot models.Bot
+	if err := database.DB.First(&bot, report.BotID).Error; err != nil || bot.OwnerID != c.GetUint("user_id") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "not your bot"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// MarketplaceBotBacktestHandler godoc
+// @Summary Get a marketplace bot's backtest
+// @Description Retrieves the latest completed backtest report of a bot, including its equity curve
+// @Tags marketplace
+// @Produce json
+// @Param id path int true "Bot ID"
+// @Success 200 {object} models.BacktestReport
+// @Failure 404 {object} map[string]string
+// @Router /api/marketplace/bots/{id}/backtest [get]
+func MarketplaceBotBacktestHandler(c *gin.Context) {
+	var bot models.Bot
+	if err := database.DB.First(&bot, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "bot not found"})
+		return
+	}
+	if bot.LatestBacktestID == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "bot has not been backtested"})
+		return
+	}
+
+	var report models.BacktestReport
+	if err := database.DB.First(&report, *bot.LatestBacktestID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "backtest not found"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// backtestSummary is the part of a report shown next to marketplace listings
+func backtestSummary(r models.BacktestReport) gin.H {
+	return gin.H{
+		"id":               r.ID,
+		"symbol":           r.Symbol,
+		"start_epoch":      r.StartEpoch,
+		"end_epoch":        r.EndEpoch,
+		"trades":           r.Trades,
+		"win_rate":         r.WinRate,
+		"net_profit":       r.NetProfit,
+		"initial_balance":  r.InitialBalance,
+		"max_drawdown_pct": r.MaxDrawdownPct,
+		"completed_at":     r.CompletedAt,
+	}
+}
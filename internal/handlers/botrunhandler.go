@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	services "github.com/keyadaniel56/algocdk/service"
+)
+
+var botRunner = services.NewBotRunner(derivService, tickHub, candleStore, paperEngine, contractTracker)
+
+// RestoreBotRuns relaunches bot runs that were active when the server last
+// stopped. Call after database.InitDB.
+func RestoreBotRuns() {
+	botRunner.Restore()
+}
+
+// StartBotRunHandler godoc
+// @Summary Run a bot on the server
+// @Description Starts executing a bot the user owns or rents against live ticks. The mode defaults to the user's trading mode.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path int true "Bot ID"
+// @Param request body object false "{\"mode\": \"live\" or \"paper\"}"
+// @Security ApiKeyAuth
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/user/bots/{id}/run [post]
+func StartBotRunHandler(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	botID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid bot id"})
+		return
+	}
+
+	var req struct {
+		Mode string `json:"mode"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+			return
+		}
+	}
+	mode, err := tradingMode(userID, req.Mode)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	run, err := botRunner.Start(userID, uint(botID), mode)
+	if err != nil {
+		var violation *services.RiskViolation
+		status := http.StatusBadRequest
+		switch {
+		case errors.As(err, &violation), errors.Is(err, services.ErrNoBotAccess):
+			status = http.StatusForbidden
+		case errors.Is(err, services.ErrRunActive):
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": "Bot was not started", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "run": run})
+}
+
+// GetBotRunsHandler godoc
+// @Summary List bot runs
+// @Description Lists the user's server-side bot runs, newest first
+// @Tags user
+// @Produce json
+// @Param status query string false "Filter by status"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /api/user/runs [get]
+func GetBotRunsHandler(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	query := database.DB.Where("user_id = ?", userID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var runs []models.BotRun
+	if err := query.Order("id DESC").Limit(100).Find(&runs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch bot runs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "runs": runs})
+}
+
+// GetBotRunHandler godoc
+// @Summary Get a bot run
+// @Description Returns a bot run with its most recent log entries
+// @Tags user
+// @Produce json
+// @Param id path int true "Run ID"
+// @Param limit query int false "Number of log entries (default 100)"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Router /api/user/runs/{id} [get]
+func GetBotRunHandler(c *gin.Context) {
+	var run models.BotRun
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), c.GetUint("user_id")).
+		First(&run).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "bot run not found"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	var logs []models.BotRunLog
+	database.DB.Where("run_id = ?", run.ID).Order("id DESC").Limit(limit).Find(&logs)
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "run": run, "logs": logs})
+}
+
+// PauseBotRunHandler godoc
+// @Summary Pause a bot run
+// @Description Stops the run from buying new contracts until it is resumed
+// @Tags user
+// @Produce json
+// @Param id path int true "Run ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/user/runs/{id}/pause [post]
+func PauseBotRunHandler(c *gin.Context) {
+	controlBotRun(c, botRunner.Pause)
+}
+
+// ResumeBotRunHandler godoc
+// @Summary Resume a bot run
+// @Description Lets a paused run buy contracts again
+// @Tags user
+// @Produce json
+// @Param id path int true "Run ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/user/runs/{id}/resume [post]
+func ResumeBotRunHandler(c *gin.Context) {
+	controlBotRun(c, botRunner.Resume)
+}
+
+// StopBotRunHandler godoc
+// @Summary Stop a bot run
+// @Description Ends the run; a contract already open still settles
+// @Tags user
+// @Produce json
+// @Param id path int true "Run ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/user/runs/{id}/stop [post]
+func StopBotRunHandler(c *gin.Context) {
+	controlBotRun(c, botRunner.Stop)
+}
+
+func controlBotRun(c *gin.Context, action func(userID, runID uint) (*models.BotRun, error)) {
+	runID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid run id"})
+		return
+	}
+
+	run, err := action(c.GetUint("user_id"), uint(runID))
+	if err != nil {
+		var violation *services.RiskViolation
+		status := http.StatusConflict
+		switch {
+		case errors.Is(err, services.ErrRunNotFound):
+			status = http.StatusNotFound
+		case errors.As(err, &violation):
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "run": run})
+}
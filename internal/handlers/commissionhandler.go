@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	services "github.com/keyadaniel56/algocdk/service"
+)
+
+type commissionRuleRequest struct {
+	Name           string     `json:"name"`
+	Scope          string     `json:"scope" binding:"required"`
+	PaymentType    string     `json:"payment_type"`
+	AdminID        *uint      `json:"admin_id"`
+	BotID          *uint      `json:"bot_id"`
+	MinSalesVolume float64    `json:"min_sales_volume"`
+	Rate           float64    `json:"rate"`
+	StartsAt       *time.Time `json:"starts_at"`
+	EndsAt         *time.Time `json:"ends_at"`
+}
+
+func (req commissionRuleRequest) apply(rule *models.CommissionRule) {
+	rule.Name = req.Name
+	rule.Scope = req.Scope
+	rule.PaymentType = req.PaymentType
+	rule.AdminID = req.AdminID
+	rule.BotID = req.BotID
+	rule.MinSalesVolume = req.MinSalesVolume
+	rule.Rate = req.Rate
+	rule.StartsAt = req.StartsAt
+	rule.EndsAt = req.EndsAt
+}
+
+// GetCommissionRulesHandler godoc
+// @Summary List commission rules
+// @Description Lists the platform's commission rules, including inactive ones
+// @Tags superadmin
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /api/superadmin/commission-rules [get]
+func GetCommissionRulesHandler(c *gin.Context) {
+	var rules []models.CommissionRule
+	if err := database.DB.Order("active DESC, scope ASC, id ASC").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch commission rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "rules": rules})
+}
+
+// CreateCommissionRuleHandler godoc
+// @Summary Add a commission rule
+// @Description Adds a platform commission rule. Scope is global, tier (admins whose sales over the last 30 days reach min_sales_volume), admin (admin_id) or bot (bot_id); rate is the platform's share, 0.25 for 25%. Setting starts_at and ends_at makes it a promotion. The most specific rule in force applies to new payments.
+// @Tags superadmin
+// @Accept json
+// @Produce json
+// @Param request body object true "{\"scope\": \"bot\", \"bot_id\": 3, \"payment_type\": \"rent\", \"rate\": 0.15}"
+// @Security ApiKeyAuth
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Router /api/superadmin/commission-rules [post]
+func CreateCommissionRuleHandler(c *gin.Context) {
+	var req commissionRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	rule := models.CommissionRule{Active: true, CreatedBy: c.GetUint("user_id")}
+	req.apply(&rule)
+	if err := services.NormalizeCommissionRule(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule", "details": err.Error()})
+		return
+	}
+	if err := database.DB.Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save rule"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "rule": rule})
+}
+
+// UpdateCommissionRuleHandler godoc
+// @Summary Update a commission rule
+// @Description Changes a commission rule. Payments already started keep the rate they were charged at.
+// @Tags superadmin
+// @Accept json
+// @Produce json
+// @Param id path int true "Rule ID"
+// @Param request body object true "{\"scope\": \"global\", \"payment_type\": \"purchase\", \"rate\": 0.28}"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/superadmin/commission-rules/{id} [put]
+func UpdateCommissionRuleHandler(c *gin.Context) {
+	var rule models.CommissionRule
+	if err := database.DB.First(&rule, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "rule not found"})
+		return
+	}
+
+	var req commissionRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	req.apply(&rule)
+	rule.Active = true
+	if err := services.NormalizeCommissionRule(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule", "details": err.Error()})
+		return
+	}
+	if err := database.DB.Save(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save rule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "rule": rule})
+}
+
+// DeleteCommissionRuleHandler godoc
+// @Summary Retire a commission rule
+// @Description Stops applying a commission rule to new payments. It is kept for the transactions it priced.
+// @Tags superadmin
+// @Produce json
+// @Param id path int true "Rule ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Router /api/superadmin/commission-rules/{id} [delete]
+func DeleteCommissionRuleHandler(c *gin.Context) {
+	var rule models.CommissionRule
+	if err := database.DB.First(&rule, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "rule not found"})
+		return
+	}
+	if err := database.DB.Model(&rule).Update("active", false).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retire rule"})
+		return
+	}
+	rule.Active = false
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "rule": rule})
+}
+
+// PreviewCommissionHandler godoc
+// @Summary Preview a commission
+// @Description Shows the rate and rule that would apply to a payment for a bot right now
+// @Tags superadmin
+// @Produce json
+// @Param bot_id query int true "Bot ID"
+// @Param payment_type query string true "purchase, rent or resale"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/superadmin/commission-rules/preview [get]
+func PreviewCommissionHandler(c *gin.Context) {
+	botID, _ := strconv.ParseUint(c.Query("bot_id"), 10, 64)
+	var bot models.Bot
+	if err := database.DB.First(&bot, botID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "bot not found"})
+		return
+	}
+	var admin models.Admin
+	database.DB.Where("person_id = ?", bot.OwnerID).Limit(1).Find(&admin)
+
+	commission, err := services.CommissionFor(database.DB, c.Query("payment_type"), admin.ID, bot.ID, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not price commission", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "admin_id": admin.ID, "commission": commission})
+}
+
+// GetAdminCommissionHandler godoc
+// @Summary Get my commission rates
+// @Description Returns the platform's current share of the admin's purchases and rentals, with their sales volume over the last 30 days. Individual bots may have their own rates.
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Router /api/admin/commission [get]
+func GetAdminCommissionHandler(c *gin.Context) {
+	admin, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+
+	rates := gin.H{}
+	for _, paymentType := range []string{"purchase", "rent"} {
+		commission, err := services.CommissionFor(database.DB, paymentType, admin.ID, 0, time.Now())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up commission"})
+			return
+		}
+		rates[paymentType] = commission
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "commission": rates})
+}
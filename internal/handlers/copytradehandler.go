@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	services "github.com/keyadaniel56/algocdk/service"
+)
+
+var copyTrader = services.NewCopyTrader(derivService, contractTracker)
+
+// SetBotCopyTradingHandler godoc
+// @Summary Offer copy trading through a bot
+// @Description Enables or disables copy trading on a bot. Users who rent the bot can then follow the owner's live trades; disabling it stops all followers.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "Bot ID"
+// @Param request body object true "{\"enabled\": true}"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/admin/bots/{id}/copy-trading [put]
+func SetBotCopyTradingHandler(c *gin.Context) {
+	bot, ok := ownedBot(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	if req.Enabled && bot.RentPrice <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "set a rent price before offering copy trading"})
+		return
+	}
+
+	if err := database.DB.Model(bot).Update("copy_trading", req.Enabled).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update bot", "details": err.Error()})
+		return
+	}
+	if !req.Enabled {
+		database.DB.Model(&models.CopySubscription{}).
+			Where("bot_id = ? AND active = ?", bot.ID, true).Update("active", false)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "bot_id": bot.ID, "copy_trading": req.Enabled})
+}
+
+// GetCopyFollowersHandler godoc
+// @Summary List copy-trading followers
+// @Description Lists the users subscribed to the admin's trades
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /api/admin/copy/followers [get]
+func GetCopyFollowersHandler(c *gin.Context) {
+	var subs []models.CopySubscription
+	if err := database.DB.Where("leader_id = ?", c.GetUint("user_id")).
+		Order("id DESC").Find(&subs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch followers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "followers": subs})
+}
+
+// FollowLeaderHandler godoc
+// @Summary Copy a leader's trades
+// @Description Subscribes the user to the live trades of a copy-trading bot's owner, or updates the stake settings. The bot must be rented first through the rent payment.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param bot_id path int true "Copy-trading bot ID"
+// @Param request body object true "{\"stake_mode\": \"multiplier\" or \"fixed\", \"stake_value\": 1.5, \"max_stake\": 20}"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /api/user/copy/{bot_id} [post]
+func FollowLeaderHandler(c *gin.Context) {
+	botID, err := strconv.ParseUint(c.Param("bot_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid bot id"})
+		return
+	}
+
+	var req struct {
+		StakeMode  string  `json:"stake_mode" binding:"required"`
+		StakeValue float64 `json:"stake_value" binding:"required"`
+		MaxStake   float64 `json:"max_stake"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	sub, err := services.Follow(c.GetUint("user_id"), uint(botID), req.StakeMode, req.StakeValue, req.MaxStake)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrNoBotAccess) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{"error": "Could not follow this leader", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "subscription": sub})
+}
+
+// GetCopySubscriptionsHandler godoc
+// @Summary List copy-trading subscriptions
+// @Description Lists the leaders the user copies
+// @Tags user
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /api/user/copy [get]
+func GetCopySubscriptionsHandler(c *gin.Context) {
+	var subs []models.CopySubscription
+	if err := database.DB.Where("follower_id = ?", c.GetUint("user_id")).
+		Order("id DESC").Find(&subs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch subscriptions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "subscriptions": subs})
+}
+
+// UnfollowLeaderHandler godoc
+// @Summary Stop copying a leader
+// @Description Deactivates a copy-trading subscription; trades already copied still settle
+// @Tags user
+// @Produce json
+// @Param id path int true "Subscription ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Router /api/user/copy/{id} [delete]
+func UnfollowLeaderHandler(c *gin.Context) {
+	var sub models.CopySubscription
+	if err := database.DB.Where("id = ? AND follower_id = ?", c.Param("id"), c.GetUint("user_id")).
+		First(&sub).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "subscription not found"})
+		return
+	}
+
+	if err := database.DB.Model(&sub).Update("active", false).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update subscription"})
+		return
+	}
+	sub.Active = false
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "subscription": sub})
+}
+
+// GetCopyTradesHandler godoc
+// @Summary List copied trades
+// @Description Lists the user's copies of leader trades, including those that were blocked or failed
+// @Tags user
+// @Produce json
+// @Param status query string false "Filter by status"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /api/user/copy/trades [get]
+func GetCopyTradesHandler(c *gin.Context) {
+	query := database.DB.Where("follower_id = ?", c.GetUint("user_id"))
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var trades []models.CopyTrade
+	if err := query.Order("id DESC").Limit(100).Find(&trades).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch copied trades"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "trades": trades})
+}
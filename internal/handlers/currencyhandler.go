@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	services "github.com/keyadaniel56/algocdk/service"
+	"gorm.io/gorm/clause"
+)
+
+// GetCurrenciesHandler godoc
+// @Summary List payment currencies
+// @Description Returns the base currency bots are priced in and the exchange rates of the other currencies payments are accepted in
+// @Tags payment
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/currencies [get]
+func GetCurrenciesHandler(c *gin.Context) {
+	var rates []models.ExchangeRate
+	if err := database.DB.Order("currency ASC").Find(&rates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch exchange rates"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "base_currency": services.BaseCurrency(), "rates": rates})
+}
+
+// SetPreferredCurrencyHandler godoc
+// @Summary Set my payment currency
+// @Description Sets the currency the user pays in. An empty currency goes back to the currency of their country.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param request body object true "{\"currency\": \"NGN\"}"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Router /api/user/currency [put]
+func SetPreferredCurrencyHandler(c *gin.Context) {
+	var req struct {
+		Currency string `json:"currency"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	currency := services.NormalizeCurrency(req.Currency)
+	if currency != "" {
+		if _, err := services.ExchangeRateFor(database.DB, currency); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported currency", "details": err.Error()})
+			return
+		}
+	}
+
+	if err := database.DB.Model(&models.User{}).Where("id = ?", c.GetUint("user_id")).
+		Update("preferred_currency", currency).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save currency"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "preferred_currency": currency})
+}
+
+// GetBotPricesHandler godoc
+// @Summary Get a bot's prices in my currency
+// @Description Returns a bot's purchase price and rental plan prices in the currency the user would pay in, or the one asked for
+// @Tags user
+// @Produce json
+// @Param id path int true "Bot ID"
+// @Param currency query string false "Currency code, defaults to the user's"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/user/bots/{id}/prices [get]
+func GetBotPricesHandler(c *gin.Context) {
+	var bot models.Bot
+	if err := database.DB.First(&bot, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "bot not found"})
+		return
+	}
+	var user models.User
+	if err := database.DB.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	currency, err := services.PaymentCurrency(database.DB, user, c.Query("currency"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported currency", "details": err.Error()})
+		return
+	}
+
+	result := gin.H{"success": true, "currency": currency}
+	if bot.Price > 0 {
+		price, err := services.QuotePrice(database.DB, currency, bot.Price, bot.ID, "purchase", 0, bot.Price)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not price this bot", "details": err.Error()})
+			return
+		}
+		result["purchase"] = price
+	}
+
+	plans, err := services.RentalPlans(bot)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch plans"})
+		return
+	}
+	rentals := make([]gin.H, 0, len(plans))
+	for _, plan := range plans {
+		price, err := services.QuotePrice(database.DB, currency, plan.Price, bot.ID, "rent", plan.ID, plan.Price)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not price this bot", "details": err.Error()})
+			return
+		}
+		rentals = append(rentals, gin.H{"plan": plan, "price": price})
+	}
+	result["rent"] = rentals
+
+	c.JSON(http.StatusOK, result)
+}
+
+// SetExchangeRateHandler godoc
+// @Summary Set an exchange rate
+// @Description Sets how many units of a currency one unit of the base currency buys, accepting payments in it. Payments already started keep the rate they were charged at.
+// @Tags superadmin
+// @Accept json
+// @Produce json
+// @Param request body object true "{\"currency\": \"NGN\", \"rate\": 11.5}"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Router /api/superadmin/exchange-rates [put]
+func SetExchangeRateHandler(c *gin.Context) {
+	var req struct {
+		Currency string  `json:"currency" binding:"required"`
+		Rate     float64 `json:"rate" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	rate := models.ExchangeRate{Currency: services.NormalizeCurrency(req.Currency), Rate: req.Rate, UpdatedBy: c.GetUint("user_id")}
+	if len(rate.Currency) != 3 || rate.Currency == services.BaseCurrency() || rate.Rate <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rate", "details": "currency must be a 3-letter code other than the base currency and rate must be positive"})
+		return
+	}
+
+	if err := database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "currency"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "updated_by", "updated_at"}),
+	}).Create(&rate).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save rate"})
+		return
+	}
+	database.DB.Where("currency = ?", rate.Currency).First(&rate)
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "rate": rate})
+}
+
+// DeleteExchangeRateHandler godoc
+// @Summary Stop accepting a currency
+// @Description Removes a currency's exchange rate so new payments can no longer be made in it
+// @Tags superadmin
+// @Produce json
+// @Param currency path string true "Currency code"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Router /api/superadmin/exchange-rates/{currency} [delete]
+func DeleteExchangeRateHandler(c *gin.Context) {
+	deleted := database.DB.Where("currency = ?", services.NormalizeCurrency(c.Param("currency"))).Delete(&models.ExchangeRate{})
+	if deleted.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete rate"})
+		return
+	}
+	if deleted.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "rate not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// ListBotPricesHandler godoc
+// @Summary List a bot's price list
+// @Description Lists the fixed prices the admin set for their bot in other currencies
+// @Tags admin
+// @Produce json
+// @Param id path int true "Bot ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]string
+// @Router /api/admin/bots/{id}/prices [get]
+func ListBotPricesHandler(c *gin.Context) {
+	bot, ok := ownedBot(c)
+	if !ok {
+		return
+	}
+
+	var prices []models.BotPrice
+	if err := database.DB.Where("bot_id = ?", bot.ID).Order("currency ASC, payment_type ASC, rental_plan_id ASC").Find(&prices).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch prices"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "base_currency": services.BaseCurrency(), "prices": prices})
+}
+
+// SetBotPriceHandler godoc
+// @Summary Set a bot price in a currency
+// @Description Fixes what the bot's purchase or one of its rental plans costs in a currency, instead of converting its base price at the exchange rate. Prorated rentals are scaled from it.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "Bot ID"
+// @Param request body object true "{\"payment_type\": \"rent\", \"plan_id\": 2, \"currency\": \"NGN\", \"amount\": 3500}"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /api/admin/bots/{id}/prices [put]
+func SetBotPriceHandler(c *gin.Context) {
+	bot, ok := ownedBot(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		PaymentType string  `json:"payment_type" binding:"required"`
+		PlanID      uint    `json:"plan_id"`
+		Currency    string  `json:"currency" binding:"required"`
+		Amount      float64 `json:"amount"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	price := models.BotPrice{BotID: bot.ID, PaymentType: req.PaymentType, RentalPlanID: req.PlanID, Currency: req.Currency, Amount: req.Amount}
+	if err := services.NormalizeBotPrice(database.DB, &price); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid price", "details": err.Error()})
+		return
+	}
+
+	if err := database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "bot_id"}, {Name: "payment_type"}, {Name: "rental_plan_id"}, {Name: "currency"}},
+		DoUpdates: clause.AssignmentColumns([]string{"amount", "updated_at"}),
+	}).Create(&price).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save price"})
+		return
+	}
+	database.DB.Where("bot_id = ? AND payment_type = ? AND rental_plan_id = ? AND currency = ?",
+		price.BotID, price.PaymentType, price.RentalPlanID, price.Currency).First(&price)
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "price": price})
+}
+
+// DeleteBotPriceHandler godoc
+// @Summary Remove a bot price
+// @Description Removes a fixed price so the bot is charged at the exchange rate in that currency again
+// @Tags admin
+// @Produce json
+// @Param id path int true "Bot ID"
+// @Param price_id path int true "Price ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/admin/bots/{id}/prices/{price_id} [delete]
+func DeleteBotPriceHandler(c *gin.Context) {
+	bot, ok := ownedBot(c)
+	if !ok {
+		return
+	}
+
+	deleted := database.DB.Where("id = ? AND bot_id = ?", c.Param("price_id"), bot.ID).Delete(&models.BotPrice{})
+	if deleted.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete price"})
+		return
+	}
+	if deleted.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "price not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -14,6 +16,32 @@ import (
 
 var derivService = services.NewDerivService()
 
+// ConfigureDeriv points every Deriv integration at the given app and server.
+// Call at startup, before trading resumes.
+func ConfigureDeriv(config services.DerivConfig) {
+	derivService.Configure(config)
+}
+
+// GetDerivConfig returns the Deriv app and server browsers should connect to
+func GetDerivConfig(c *gin.Context) {
+	config := derivService.Config()
+	c.JSON(http.StatusOK, gin.H{
+		"success":       true,
+		"app_id":        config.AppID,
+		"websocket_url": config.WebSocketURL(),
+		"language":      config.Language,
+		"brand":         config.Brand,
+	})
+}
+
+var contractTracker = services.NewContractTracker(derivService)
+
+// ResumeContractTracking picks up settlement tracking for trades that were
+// still open when the server last stopped. Call after database.InitDB.
+func ResumeContractTracking() {
+	contractTracker.Resume()
+}
+
 // ============================================
 // PUBLIC DERIV HANDLERS (No Auth Required)
 // ============================================
@@ -294,33 +322,46 @@ func SaveDerivToken(c *gin.Context) {
 		return
 	}
 
-	// Deactivate existing tokens
-	database.DB.Model(&models.DerivCredentials{}).
-		Where("user_id = ?", userID).
-		Update("is_active", false)
-
-	// Save demo token if provided
+	// Seal tokens before anything is stored
+	var saved []models.DerivCredentials
 	if req.DemoToken != "" {
-		credentials := models.DerivCredentials{
+		saved = append(saved, models.DerivCredentials{
 			UserID:      userID.(uint),
-			APIToken:    req.DemoToken,
 			LoginID:     "demo_default",
 			AccountType: "demo",
 			IsActive:    true,
+		})
+		if err := services.SealDerivToken(&saved[len(saved)-1], req.DemoToken); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to encrypt token",
+				"details": err.Error(),
+			})
+			return
 		}
-		database.DB.Create(&credentials)
 	}
-
-	// Save real token if provided
 	if req.RealToken != "" {
-		credentials := models.DerivCredentials{
+		saved = append(saved, models.DerivCredentials{
 			UserID:      userID.(uint),
-			APIToken:    req.RealToken,
 			LoginID:     "real_default",
 			AccountType: "real",
 			IsActive:    true,
+		})
+		if err := services.SealDerivToken(&saved[len(saved)-1], req.RealToken); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to encrypt token",
+				"details": err.Error(),
+			})
+			return
 		}
-		database.DB.Create(&credentials)
+	}
+
+	// Deactivate existing tokens
+	database.DB.Model(&models.DerivCredentials{}).
+		Where("user_id = ?", userID).
+		Update("is_active", false)
+
+	for i := range saved {
+		database.DB.Create(&saved[i])
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -329,7 +370,8 @@ func SaveDerivToken(c *gin.Context) {
 	})
 }
 
-// GetUserDerivToken retrieves user's saved Deriv token
+// GetUserDerivToken reports whether the user has a saved Deriv token; the
+// token itself is only returned masked
 func GetUserDerivToken(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -364,7 +406,7 @@ func GetUserDerivToken(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"success":   true,
 		"has_token": true,
-		"token":     credentials.APIToken,
+		"token":     credentials.TokenHint,
 		"data": gin.H{
 			"loginid":      credentials.LoginID,
 			"account_type": credentials.AccountType,
@@ -416,14 +458,28 @@ func UpdateDerivAccountPreference(c *gin.Context) {
 		return
 	}
 
-	result := database.DB.Model(&models.DerivCredentials{}).
-		Where("user_id = ? AND is_active = ?", userID, true).
-		Updates(map[string]interface{}{
-			"loginid":      req.LoginID,
-			"account_type": req.AccountType,
+	// Accounts linked through OAuth have their own token; make that one active
+	var linked models.DerivCredentials
+	var err error
+	if database.DB.Where("user_id = ? AND login_id = ?", userID, req.LoginID).
+		First(&linked).Error == nil {
+		err = database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.DerivCredentials{}).Where("user_id = ?", userID).
+				Update("is_active", false).Error; err != nil {
+				return err
+			}
+			return tx.Model(&linked).Update("is_active", true).Error
 		})
+	} else {
+		err = database.DB.Model(&models.DerivCredentials{}).
+			Where("user_id = ? AND is_active = ?", userID, true).
+			Updates(map[string]interface{}{
+				"login_id":     req.LoginID,
+				"account_type": req.AccountType,
+			}).Error
+	}
 
-	if result.Error != nil {
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to update preference",
 		})
@@ -638,8 +694,8 @@ func SwitchDerivAccountWithStoredToken(c *gin.Context) {
 	})
 }
 
-// PlaceDerivTrade places a trade using stored token
-func PlaceDerivTrade(c *gin.Context) {
+// GetDerivProposal prices a contract with the stored token without buying it
+func GetDerivProposal(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{
@@ -648,14 +704,7 @@ func PlaceDerivTrade(c *gin.Context) {
 		return
 	}
 
-	var req struct {
-		Symbol    string  `json:"symbol" binding:"required"`
-		TradeType string  `json:"trade_type" binding:"required"`
-		Stake     float64 `json:"amount" binding:"required"`
-		Duration  int     `json:"duration" binding:"required"`
-		BotID     uint    `json:"bot_id,omitempty"`
-	}
-
+	var req models.DerivContractRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":   "Invalid request",
@@ -664,6 +713,14 @@ func PlaceDerivTrade(c *gin.Context) {
 		return
 	}
 
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid contract parameters",
+			"details": err.Error(),
+		})
+		return
+	}
+
 	var credentials models.DerivCredentials
 	if err := database.DB.Where("user_id = ? AND is_active = ?", userID, true).
 		First(&credentials).Error; err != nil {
@@ -673,62 +730,233 @@ func PlaceDerivTrade(c *gin.Context) {
 		return
 	}
 
-	// Place trade using Deriv service
-	tradeResult, err := derivService.PlaceTrade(credentials.APIToken, req.Symbol, req.TradeType, req.Stake, req.Duration)
+	proposal, err := derivService.GetProposal(credentials.APIToken, req)
 	if err != nil {
-		// If real trade fails, create simulated trade for demo purposes
-		contractID := fmt.Sprintf("SIM_%d_%d", userID, time.Now().Unix())
-		payout := req.Stake * 1.85 // 85% payout simulation
-
-		// Record simulated trade in database
-		trade := models.Trade{
-			UserID:       userID.(uint),
-			BotID:        req.BotID,
-			DerivTradeID: contractID,
-			Symbol:       req.Symbol,
-			TradeType:    req.TradeType,
-			Stake:        req.Stake,
-			Payout:       payout,
-			Status:       "open",
-			OpenTime:     time.Now(),
-			CreatedAt:    time.Now(),
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":   "Failed to get proposal",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    proposal,
+	})
+}
+
+// PlaceDerivTrade places a trade using stored token
+func PlaceDerivTrade(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	var req models.DerivTradeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	// Paper trades are simulated against tick data and never reach Deriv
+	mode, err := tradingMode(userID.(uint), req.Mode)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if mode == "paper" {
+		if req.ProposalID == "" && !checkTradeRisk(c, userID.(uint), mode, req.DerivContractRequest, req.Amount) {
+			return
+		}
+		placePaperTrade(c, userID.(uint), req)
+		return
+	}
+
+	if req.ProposalID == "" {
+		if err := req.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid contract parameters",
+				"details": err.Error(),
+			})
+			return
 		}
+	}
+
+	var credentials models.DerivCredentials
+	if err := database.DB.Where("user_id = ? AND is_active = ?", userID, true).
+		First(&credentials).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "No Deriv token found",
+		})
+		return
+	}
 
-		database.DB.Create(&trade)
+	// Check risk limits against what is about to be bought
+	riskContract, riskStake := req.DerivContractRequest, req.Amount
+	if req.ProposalID != "" {
+		proposal, ok := derivService.PeekProposal(credentials.APIToken, req.ProposalID)
+		if !ok {
+			c.JSON(tradeErrorStatus(services.ErrProposalNotFound), gin.H{
+				"error":   "Trade was not placed",
+				"details": services.ErrProposalNotFound.Error(),
+			})
+			return
+		}
+		riskContract, riskStake = proposal.Contract, proposal.AskPrice
+		if req.MaxPrice > riskStake {
+			riskStake = req.MaxPrice
+		}
+		if req.BotID != 0 {
+			riskContract.BotID = req.BotID
+		}
+	}
+	if !checkTradeRisk(c, userID.(uint), mode, riskContract, riskStake) {
+		return
+	}
 
-		c.JSON(http.StatusOK, gin.H{
-			"success":     true,
-			"message":     "Trade placed (simulated - API error: " + err.Error() + ")",
-			"contract_id": contractID,
-			"payout":      payout,
-			"trade_id":    trade.ID,
-			"simulated":   true,
+	// Place trade using Deriv service, either against a quoted proposal or at market
+	var tradeResult *models.DerivTradeResult
+	if req.ProposalID != "" {
+		var contract *models.DerivContractRequest
+		tradeResult, contract, err = derivService.BuyProposal(credentials.APIToken, req.ProposalID, req.MaxPrice)
+		if contract != nil {
+			botID := req.BotID
+			req.DerivContractRequest = *contract
+			if botID != 0 {
+				req.BotID = botID
+			}
+		}
+	} else {
+		tradeResult, err = derivService.PlaceTrade(credentials.APIToken, req.DerivContractRequest)
+	}
+	if err != nil {
+		// Nothing was bought; report the failure as is
+		c.JSON(tradeErrorStatus(err), gin.H{
+			"error":   "Trade was not placed",
+			"details": err.Error(),
 		})
 		return
 	}
 
+	// For payout-based contracts the amount is the payout; the stake is what was paid
+	stake := req.Amount
+	if req.Basis == "payout" {
+		stake = tradeResult.BuyPrice
+	}
+
 	// Record real trade in database
 	trade := models.Trade{
 		UserID:       userID.(uint),
 		BotID:        req.BotID,
 		DerivTradeID: tradeResult.ContractID,
+		CredentialID: credentials.ID,
 		Symbol:       req.Symbol,
-		TradeType:    req.TradeType,
-		Stake:        req.Stake,
+		TradeType:    req.ContractType,
+		Stake:        stake,
+		BuyPrice:     tradeResult.BuyPrice,
 		Payout:       tradeResult.Payout,
 		Status:       "open",
-		OpenTime:     time.Now(),
+		OpenTime:     tradeResult.PurchaseTime,
 		CreatedAt:    time.Now(),
 	}
 
-	database.DB.Create(&trade)
+	if err := database.DB.Create(&trade).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":       "Trade was placed but could not be recorded",
+			"contract_id": tradeResult.ContractID,
+		})
+		return
+	}
+
+	// Settle the row once Deriv reports the outcome
+	contractTracker.Track(trade, credentials.APIToken)
+
+	// Replicate the trade to the user's copy-trading followers
+	copyTrader.Mirror(trade, req.DerivContractRequest)
 
 	c.JSON(http.StatusOK, gin.H{
-		"success":     true,
-		"message":     "Trade placed successfully",
-		"contract_id": tradeResult.ContractID,
-		"payout":      tradeResult.Payout,
-		"trade_id":    trade.ID,
-		"simulated":   false,
+		"success":        true,
+		"message":        "Trade placed successfully",
+		"contract_id":    tradeResult.ContractID,
+		"transaction_id": tradeResult.TransactionID,
+		"buy_price":      tradeResult.BuyPrice,
+		"payout":         tradeResult.Payout,
+		"balance_after":  tradeResult.BalanceAfter,
+		"longcode":       tradeResult.Longcode,
+		"trade_id":       trade.ID,
+		"mode":           "live",
+	})
+}
+
+// tradingMode resolves the mode for a trade: the request's own mode wins,
+// otherwise the user's saved preference applies.
+func tradingMode(userID uint, requested string) (string, error) {
+	mode := strings.ToLower(strings.TrimSpace(requested))
+	if mode == "" {
+		var user models.User
+		if err := database.DB.Select("trading_mode").First(&user, userID).Error; err == nil {
+			mode = user.TradingMode
+		}
+	}
+	switch mode {
+	case "", "live":
+		return "live", nil
+	case "paper":
+		return "paper", nil
+	}
+	return "", fmt.Errorf("mode must be 'live' or 'paper', got %q", requested)
+}
+
+// checkTradeRisk applies the user's risk limits to a manual trade. It writes
+// a 403 response and returns false when the trade is blocked.
+func checkTradeRisk(c *gin.Context, userID uint, mode string, contract models.DerivContractRequest, stake float64) bool {
+	err := services.CheckOrder(services.RiskOrder{
+		UserID:   userID,
+		BotID:    contract.BotID,
+		Source:   "manual",
+		Mode:     mode,
+		Contract: contract,
+		Stake:    stake,
+	})
+	if err == nil {
+		return true
+	}
+
+	var violation *services.RiskViolation
+	if errors.As(err, &violation) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Trade blocked by risk limits",
+			"rule":    violation.Rule,
+			"details": violation.Reason,
+		})
+		return false
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error":   "Failed to check risk limits",
+		"details": err.Error(),
 	})
+	return false
+}
+
+// tradeErrorStatus maps a failed buy to an HTTP status. Deriv's own
+// rejections are for the client to fix; anything else is an upstream failure.
+func tradeErrorStatus(err error) int {
+	var apiErr *services.DerivAPIError
+	switch {
+	case errors.Is(err, services.ErrProposalNotFound):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrPriceMoved):
+		return http.StatusConflict
+	case errors.As(err, &apiErr):
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusBadGateway
 }
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	services "github.com/keyadaniel56/algocdk/service"
+)
+
+const (
+	derivOAuthCookie   = "deriv_oauth_state"
+	derivOAuthRedirect = "/settings"
+)
+
+// DerivOAuthAuthorize sends the user to Deriv's login page for our app.
+// Browsers pass the JWT as the token query parameter.
+func DerivOAuthAuthorize(c *gin.Context) {
+	state, err := services.NewDerivOAuthState(c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start Deriv login"})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(derivOAuthCookie, state, 600, "/api/deriv/oauth", "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, derivService.Config().AuthorizeURL())
+}
+
+// DerivOAuthCallback receives Deriv's acct1/token1/cur1... redirect, stores
+// one set of credentials per account and sends the user back to settings
+func DerivOAuthCallback(c *gin.Context) {
+	state, _ := c.Cookie(derivOAuthCookie)
+	c.SetCookie(derivOAuthCookie, "", -1, "/api/deriv/oauth", "", c.Request.TLS != nil, true)
+
+	fail := func(reason string) {
+		c.Redirect(http.StatusFound, derivOAuthRedirect+"?deriv=error&reason="+url.QueryEscape(reason))
+	}
+
+	userID, err := services.ConsumeDerivOAuthState(state)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	if reason := c.Query("error"); reason != "" {
+		fail(reason)
+		return
+	}
+
+	accounts, err := services.ParseDerivOAuthAccounts(c.Request.URL.Query())
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	linked, err := services.LinkDerivOAuthAccounts(userID, accounts)
+	if err != nil {
+		log.Printf("[Deriv] failed to link OAuth accounts for user %d: %v", userID, err)
+		fail("failed to save Deriv accounts")
+		return
+	}
+
+	c.Redirect(http.StatusFound, derivOAuthRedirect+"?deriv=linked&accounts="+strconv.Itoa(len(linked)))
+}
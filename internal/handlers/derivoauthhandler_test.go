@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	"github.com/keyadaniel56/algocdk/internal/secrets"
+	services "github.com/keyadaniel56/algocdk/service"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupDB gives the test an empty in-memory database
+func setupDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: is a database of its own
+	sqlDB.SetMaxOpenConns(1)
+	if err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = previous
+		sqlDB.Close()
+	})
+}
+
+// derivOAuthFlow serves the authorize and callback routes as userID behind
+// a stub of Deriv's OAuth page, which sends the browser back with redirect
+// as the query string. It returns a browser that stops at the settings page
+// and the app's URL.
+func derivOAuthFlow(t *testing.T, userID uint, redirect *url.Values) (*http.Client, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/deriv/oauth/authorize", func(c *gin.Context) {
+		c.Set("user_id", userID)
+		DerivOAuthAuthorize(c)
+	})
+	router.GET("/api/deriv/oauth/callback", DerivOAuthCallback)
+	app := httptest.NewServer(router)
+	t.Cleanup(app.Close)
+
+	oauth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("app_id") == "" {
+			t.Errorf("authorize URL %s has no app_id", r.URL)
+		}
+		http.Redirect(w, r, app.URL+"/api/deriv/oauth/callback?"+redirect.Encode(), http.StatusFound)
+	}))
+	t.Cleanup(oauth.Close)
+
+	previous := derivService.Config()
+	config := services.DefaultDerivConfig()
+	config.OAuthURL = oauth.URL
+	ConfigureDeriv(config)
+	t.Cleanup(func() { ConfigureDeriv(previous) })
+
+	jar, _ := cookiejar.New(nil)
+	browser := &http.Client{Jar: jar, CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if req.URL.Path == derivOAuthRedirect {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	}}
+	return browser, app.URL
+}
+
+// landing follows target to the settings page and returns its query
+func landing(t *testing.T, browser *http.Client, target string) url.Values {
+	t.Helper()
+	resp, err := browser.Get(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	location, err := resp.Location()
+	if err != nil {
+		t.Fatalf("%s did not end in a redirect: %d", target, resp.StatusCode)
+	}
+	if location.Path != derivOAuthRedirect {
+		t.Fatalf("landed on %s, want %s", location, derivOAuthRedirect)
+	}
+	return location.Query()
+}
+
+func TestDerivOAuthLinksEveryAccount(t *testing.T) {
+	setupDB(t)
+	user := models.User{Name: "Trader", Email: "trader@example.com", Role: "user"}
+	database.DB.Create(&user)
+	// A token linked before is replaced, not duplicated
+	database.DB.Create(&models.DerivCredentials{UserID: user.ID, LoginID: "VRTC2", APIToken: "old", AccountType: "demo", IsActive: true})
+
+	redirect := url.Values{
+		"acct1": {"CR1"}, "token1": {"a1-real"}, "cur1": {"usd"},
+		"acct2": {"VRTC2"}, "token2": {"a1-demo"}, "cur2": {"USD"},
+	}
+	browser, app := derivOAuthFlow(t, user.ID, &redirect)
+
+	got := landing(t, browser, app+"/api/deriv/oauth/authorize")
+	if got.Get("deriv") != "linked" || got.Get("accounts") != "2" {
+		t.Fatalf("landed with %v, want 2 linked accounts", got)
+	}
+
+	var linked []models.DerivCredentials
+	database.DB.Where("user_id = ?", user.ID).Order("login_id").Find(&linked)
+	if len(linked) != 2 {
+		t.Fatalf("%d credentials stored, want 2", len(linked))
+	}
+	want := map[string]struct {
+		token, accountType string
+		active             bool
+	}{
+		"CR1":   {"a1-real", "real", true},
+		"VRTC2": {"a1-demo", "demo", false},
+	}
+	for _, credentials := range linked {
+		expected := want[credentials.LoginID]
+		token, err := secrets.Open(credentials.APIToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != expected.token || credentials.AccountType != expected.accountType ||
+			credentials.IsActive != expected.active || credentials.Currency != "USD" {
+			t.Errorf("%s stored as %+v (token %q)", credentials.LoginID, credentials, token)
+		}
+	}
+}
+
+func TestDerivOAuthCallbackRejectsBadRedirects(t *testing.T) {
+	setupDB(t)
+	user := models.User{Name: "Trader", Email: "trader@example.com", Role: "user"}
+	database.DB.Create(&user)
+
+	redirect := url.Values{"acct1": {"CR1"}, "cur1": {"USD"}}
+	browser, app := derivOAuthFlow(t, user.ID, &redirect)
+	if got := landing(t, browser, app+"/api/deriv/oauth/authorize"); got.Get("deriv") != "error" {
+		t.Errorf("account without a token landed with %v", got)
+	}
+
+	// The state of a finished login cannot be used again
+	redirect = url.Values{"acct1": {"CR1"}, "token1": {"a1-real"}}
+	state, err := services.NewDerivOAuthState(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := services.ConsumeDerivOAuthState(state); err != nil {
+		t.Fatal(err)
+	}
+	appURL, _ := url.Parse(app + "/api/deriv/oauth")
+	browser.Jar.SetCookies(appURL, []*http.Cookie{{Name: derivOAuthCookie, Value: state, Path: "/api/deriv/oauth"}})
+	if got := landing(t, browser, app+"/api/deriv/oauth/callback?"+redirect.Encode()); got.Get("deriv") != "error" {
+		t.Errorf("replayed state landed with %v", got)
+	}
+
+	var stored int64
+	database.DB.Model(&models.DerivCredentials{}).Count(&stored)
+	if stored != 0 {
+		t.Errorf("%d credentials stored from rejected redirects", stored)
+	}
+}
+
+func TestParseDerivOAuthAccounts(t *testing.T) {
+	accounts, err := services.ParseDerivOAuthAccounts(url.Values{
+		"acct1": {" CR1 "}, "token1": {"a1-real"}, "cur1": {"usd"},
+		"acct2": {"VRTC2"}, "token2": {"a1-demo"},
+		"acct4": {"CR4"}, "token4": {"skipped"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 2 || accounts[0].LoginID != "CR1" || accounts[0].Currency != "USD" ||
+		accounts[0].AccountType() != "real" || accounts[1].AccountType() != "demo" {
+		t.Errorf("parsed %+v", accounts)
+	}
+
+	for name, query := range map[string]url.Values{
+		"no accounts":   {},
+		"missing token": {"acct1": {"CR1"}},
+		"missing login": {"token1": {"a1-real"}},
+	} {
+		if _, err := services.ParseDerivOAuthAccounts(query); err == nil {
+			t.Errorf("%s: parsed without an error", name)
+		}
+	}
+}
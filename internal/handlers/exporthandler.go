@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	services "github.com/keyadaniel56/algocdk/service"
+)
+
+const maxExportRows = 100000
+
+var marketRecorder *services.MarketRecorder
+
+// StartMarketRecorder records ticks and candles for symbols in the
+// background, keeping raw ticks for tickRetention. Call after database.InitDB.
+func StartMarketRecorder(symbols []string, tickRetention time.Duration) {
+	marketRecorder = services.NewMarketRecorder(tickHub, symbols)
+	marketRecorder.TickRetention = tickRetention
+	marketRecorder.Start()
+}
+
+// ExportMarketData exports recorded ticks or candles for a symbol as CSV or
+// JSON. Query parameters: type ("ticks" or "candles"), timeframe (candles
+// only, default 1m), start and end (epoch seconds, default the last 24
+// hours) and format ("csv" or "json").
+func ExportMarketData(c *gin.Context) {
+	symbol := c.Param("symbol")
+	dataType := c.DefaultQuery("type", "candles")
+	format := c.DefaultQuery("format", "json")
+
+	if format != "csv" && format != "json" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "format must be 'csv' or 'json'",
+		})
+		return
+	}
+
+	end, _ := strconv.ParseInt(c.Query("end"), 10, 64)
+	if end <= 0 {
+		end = time.Now().Unix()
+	}
+	start, _ := strconv.ParseInt(c.Query("start"), 10, 64)
+	if start <= 0 {
+		start = end - 86400
+	}
+	if start > end {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "start must be before end",
+		})
+		return
+	}
+
+	switch dataType {
+	case "ticks":
+		var ticks []models.TickRecord
+		if err := database.DB.Where("symbol = ? AND epoch BETWEEN ? AND ?", symbol, start, end).
+			Order("epoch").Limit(maxExportRows).Find(&ticks).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to load ticks",
+			})
+			return
+		}
+
+		if format == "json" {
+			c.JSON(http.StatusOK, gin.H{
+				"symbol": symbol,
+				"start":  start,
+				"end":    end,
+				"ticks":  ticks,
+			})
+			return
+		}
+
+		rows := make([][]string, 0, len(ticks)+1)
+		rows = append(rows, []string{"epoch", "quote", "bid", "ask"})
+		for _, t := range ticks {
+			rows = append(rows, []string{
+				strconv.FormatInt(t.Epoch, 10),
+				strconv.FormatFloat(t.Quote, 'f', -1, 64),
+				strconv.FormatFloat(t.Bid, 'f', -1, 64),
+				strconv.FormatFloat(t.Ask, 'f', -1, 64),
+			})
+		}
+		writeCSV(c, fmt.Sprintf("%s_ticks_%d_%d.csv", symbol, start, end), rows)
+
+	case "candles":
+		timeframe := c.DefaultQuery("timeframe", "1m")
+		granularity, err := services.ParseTimeframe(timeframe)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		var candles []models.Candle
+		if err := database.DB.Where("symbol = ? AND granularity = ? AND epoch BETWEEN ? AND ?", symbol, granularity, start, end).
+			Order("epoch").Limit(maxExportRows).Find(&candles).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to load candles",
+			})
+			return
+		}
+
+		// Timeframes that are not recorded are rolled up from stored ticks
+		if len(candles) == 0 {
+			var records []models.TickRecord
+			database.DB.Where("symbol = ? AND epoch BETWEEN ? AND ?", symbol, start, end).
+				Order("epoch").Find(&records)
+			ticks := make([]services.Tick, len(records))
+			for i, r := range records {
+				ticks[i] = services.Tick{Epoch: r.Epoch, Quote: r.Quote}
+			}
+			candles = services.AggregateTicks(symbol, ticks, granularity)
+		}
+
+		if format == "json" {
+			c.JSON(http.StatusOK, gin.H{
+				"symbol":      symbol,
+				"timeframe":   timeframe,
+				"granularity": granularity,
+				"start":       start,
+				"end":         end,
+				"candles":     candles,
+			})
+			return
+		}
+
+		rows := make([][]string, 0, len(candles)+1)
+		rows = append(rows, []string{"time", "open", "high", "low", "close"})
+		for _, k := range candles {
+			rows = append(rows, []string{
+				strconv.FormatInt(k.Epoch, 10),
+				strconv.FormatFloat(k.Open, 'f', -1, 64),
+				strconv.FormatFloat(k.High, 'f', -1, 64),
+				strconv.FormatFloat(k.Low, 'f', -1, 64),
+				strconv.FormatFloat(k.Close, 'f', -1, 64),
+			})
+		}
+		writeCSV(c, fmt.Sprintf("%s_%s_%d_%d.csv", symbol, timeframe, start, end), rows)
+
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "type must be 'ticks' or 'candles'",
+		})
+	}
+}
+
+func writeCSV(c *gin.Context, filename string, rows [][]string) {
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.WriteAll(rows)
+}
@@ -0,0 +1,395 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	services "github.com/keyadaniel56/algocdk/service"
+)
+
+// GetAdminLedgerHandler godoc
+// @Summary Get earnings balance
+// @Description Returns what the platform owes the admin, their withdrawals in progress and their latest ledger entries
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Router /api/admin/ledger [get]
+func GetAdminLedgerHandler(c *gin.Context) {
+	admin, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+
+	balance, err := services.AccountBalance(database.DB, services.AdminAccount(admin.ID), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute balance"})
+		return
+	}
+	var pending float64
+	database.DB.Model(&models.Withdrawal{}).
+		Where("admin_id = ? AND status IN ?", admin.ID, []string{"pending", "processing"}).
+		Select("COALESCE(SUM(amount), 0)").Scan(&pending)
+
+	var entries []models.LedgerEntry
+	if err := database.DB.Where("account = ?", services.AdminAccount(admin.ID)).
+		Order("created_at DESC, id DESC").Limit(50).Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ledger"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":             true,
+		"available_balance":   balance,
+		"pending_withdrawals": pending,
+		"entries":             entries,
+	})
+}
+
+// GetAdminStatementHandler godoc
+// @Summary Download a monthly statement
+// @Description Returns the admin's ledger for one month with opening and closing balances, as JSON or, with format=csv, as a CSV download
+// @Tags admin
+// @Produce json
+// @Produce text/csv
+// @Param month query string false "Month as YYYY-MM, defaults to the current month"
+// @Param format query string false "json or csv"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Router /api/admin/ledger/statement [get]
+func GetAdminStatementHandler(c *gin.Context) {
+	admin, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+
+	month := time.Now().UTC()
+	if m := c.Query("month"); m != "" {
+		parsed, err := time.Parse("2006-01", m)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "month must be YYYY-MM"})
+			return
+		}
+		month = parsed
+	}
+
+	statement, err := services.AdminStatement(admin.ID, month)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build statement", "details": err.Error()})
+		return
+	}
+	if c.Query("format") != "csv" {
+		c.JSON(http.StatusOK, gin.H{"success": true, "statement": statement})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=statement-%s.csv", statement.Month))
+	c.Header("Content-Type", "text/csv")
+	w := csv.NewWriter(c.Writer)
+	money := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	w.Write([]string{"date", "type", "description", "debit", "credit", "balance"})
+	w.Write([]string{"", "opening", "Opening balance", "", "", money(statement.OpeningBalance)})
+	balance := statement.OpeningBalance
+	for _, entry := range statement.Entries {
+		balance += entry.Credit - entry.Debit
+		w.Write([]string{entry.CreatedAt.Format(time.RFC3339), entry.EntryType, entry.Description, money(entry.Debit), money(entry.Credit), money(balance)})
+	}
+	w.Write([]string{"", "closing", "Closing balance", money(statement.Debits), money(statement.Credits), money(statement.ClosingBalance)})
+	w.Flush()
+}
+
+// RequestWithdrawalHandler godoc
+// @Summary Request a withdrawal
+// @Description Asks for part of the admin's balance to be paid to their bank account through Paystack, or to their phone through M-Pesa. The amount is held until a superadmin approves or rejects it.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body object true "{\"amount\": 1500, \"channel\": \"mpesa\"}"
+// @Security ApiKeyAuth
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Router /api/admin/withdrawals [post]
+func RequestWithdrawalHandler(c *gin.Context) {
+	admin, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Amount  float64 `json:"amount" binding:"required"`
+		Channel string  `json:"channel"` // "paystack" (the default) or "mpesa"
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	withdrawal, err := services.RequestWithdrawal(*admin, req.Amount, req.Channel)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not request withdrawal", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "withdrawal": withdrawal})
+}
+
+// GetAdminWithdrawalsHandler godoc
+// @Summary List withdrawals
+// @Description Lists the admin's withdrawal requests
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /api/admin/withdrawals [get]
+func GetAdminWithdrawalsHandler(c *gin.Context) {
+	admin, ok := currentAdmin(c)
+	if !ok {
+		return
+	}
+
+	var withdrawals []models.Withdrawal
+	if err := database.DB.Where("admin_id = ?", admin.ID).Order("created_at DESC").Find(&withdrawals).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch withdrawals"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "withdrawals": withdrawals})
+}
+
+// GetWithdrawalsHandler godoc
+// @Summary List withdrawal requests
+// @Description Lists withdrawal requests of admins and resale sellers, optionally by status
+// @Tags superadmin
+// @Produce json
+// @Param status query string false "pending, processing, paid, rejected or failed"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /api/superadmin/withdrawals [get]
+func GetWithdrawalsHandler(c *gin.Context) {
+	query := database.DB.Order("created_at ASC")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var withdrawals []models.Withdrawal
+	if err := query.Limit(200).Find(&withdrawals).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch withdrawals"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "withdrawals": withdrawals})
+}
+
+// RejectWithdrawalHandler godoc
+// @Summary Reject a withdrawal
+// @Description Turns down a pending withdrawal and returns the amount to the balance it came from
+// @Tags superadmin
+// @Accept json
+// @Produce json
+// @Param id path int true "Withdrawal ID"
+// @Param request body object false "{\"note\": \"bank details do not match\"}"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/superadmin/withdrawals/{id}/reject [post]
+func RejectWithdrawalHandler(c *gin.Context) {
+	withdrawalID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid withdrawal id"})
+		return
+	}
+	var req struct {
+		Note string `json:"note"`
+	}
+	c.ShouldBindJSON(&req)
+
+	withdrawal, err := services.RejectWithdrawal(uint(withdrawalID), c.GetUint("user_id"), req.Note)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrWithdrawalNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, services.ErrWithdrawalReviewed):
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "withdrawal": withdrawal})
+}
+
+// GetUserEarningsHandler godoc
+// @Summary Get resale earnings
+// @Description Returns what the platform owes the user for the licenses they resold, after its commission, their withdrawals in progress and their latest ledger entries
+// @Tags user
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /api/user/earnings [get]
+func GetUserEarningsHandler(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	account := services.UserAccount(userID)
+
+	balance, err := services.AccountBalance(database.DB, account, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute balance"})
+		return
+	}
+	var pending float64
+	database.DB.Model(&models.Withdrawal{}).
+		Where("user_id = ? AND status IN ?", userID, []string{"pending", "processing"}).
+		Select("COALESCE(SUM(amount), 0)").Scan(&pending)
+
+	var entries []models.LedgerEntry
+	if err := database.DB.Where("account = ?", account).
+		Order("created_at DESC, id DESC").Limit(50).Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ledger"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":             true,
+		"available_balance":   balance,
+		"pending_withdrawals": pending,
+		"entries":             entries,
+	})
+}
+
+// UpdatePayoutDetailsHandler godoc
+// @Summary Set payout details
+// @Description Sets the bank account resale earnings are paid to through Paystack, or the phone they are paid to through M-Pesa. Omitted fields are left unchanged.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param request body object true "{\"bank_code\": \"01\", \"account_number\": \"0123456789\", \"account_name\": \"Jane Doe\", \"phone_number\": \"0712345678\"}"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Router /api/user/payout-details [put]
+func UpdatePayoutDetailsHandler(c *gin.Context) {
+	var req struct {
+		BankCode      *string `json:"bank_code"`
+		AccountNumber *string `json:"account_number"`
+		AccountName   *string `json:"account_name"`
+		PhoneNumber   *string `json:"phone_number"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	for column, value := range map[string]*string{
+		"bank_code":      req.BankCode,
+		"account_number": req.AccountNumber,
+		"account_name":   req.AccountName,
+		"phone_number":   req.PhoneNumber,
+	} {
+		if value != nil {
+			updates[column] = strings.TrimSpace(*value)
+		}
+	}
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nothing to update"})
+		return
+	}
+	if req.BankCode != nil || req.AccountNumber != nil || req.AccountName != nil {
+		// A new bank account needs a new Paystack transfer recipient
+		updates["paystack_recipient_code"] = ""
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if err := database.DB.Model(&user).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update payout details", "details": err.Error()})
+		return
+	}
+	database.DB.First(&user, user.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":        true,
+		"bank_code":      user.BankCode,
+		"account_number": user.AccountNumber,
+		"account_name":   user.AccountName,
+		"phone_number":   user.PhoneNumber,
+	})
+}
+
+// RequestUserWithdrawalHandler godoc
+// @Summary Withdraw resale earnings
+// @Description Asks for part of the user's resale earnings to be paid to their bank account through Paystack, or to their phone through M-Pesa. The amount is held until a superadmin approves or rejects it.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param request body object true "{\"amount\": 1500, \"channel\": \"mpesa\"}"
+// @Security ApiKeyAuth
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Router /api/user/withdrawals [post]
+func RequestUserWithdrawalHandler(c *gin.Context) {
+	var req struct {
+		Amount  float64 `json:"amount" binding:"required"`
+		Channel string  `json:"channel"` // "paystack" (the default) or "mpesa"
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	withdrawal, err := services.RequestUserWithdrawal(user, req.Amount, req.Channel)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not request withdrawal", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "withdrawal": withdrawal})
+}
+
+// GetUserWithdrawalsHandler godoc
+// @Summary List withdrawals of resale earnings
+// @Description Lists the user's withdrawal requests
+// @Tags user
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /api/user/withdrawals [get]
+func GetUserWithdrawalsHandler(c *gin.Context) {
+	var withdrawals []models.Withdrawal
+	if err := database.DB.Where("user_id = ?", c.GetUint("user_id")).Order("created_at DESC").Find(&withdrawals).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch withdrawals"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "withdrawals": withdrawals})
+}
+
+// currentAdmin loads the Admin record of the calling user, writing the
+// error response when they have none
+func currentAdmin(c *gin.Context) (*models.Admin, bool) {
+	var admin models.Admin
+	if err := database.DB.Where("person_id = ?", c.GetUint("user_id")).First(&admin).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "admin not found"})
+		return nil, false
+	}
+	return &admin, true
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	services "github.com/keyadaniel56/algocdk/service"
+)
+
+// SetBotLicensingHandler godoc
+// @Summary Configure how a bot is sold
+// @Description Sets the license limit (0 for unlimited), whether licensees may resell their license, and whether the bot itself is on exclusive sale to a single buyer who becomes its owner. Omitted fields are left unchanged.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "Bot ID"
+// @Param request body object true "{\"max_licenses\": 50, \"resale_allowed\": true, \"exclusive_sale\": false}"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/admin/bots/{id}/licensing [put]
+func SetBotLicensingHandler(c *gin.Context) {
+	bot, ok := ownedBot(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		MaxLicenses   *int  `json:"max_licenses"`
+		ResaleAllowed *bool `json:"resale_allowed"`
+		ExclusiveSale *bool `json:"exclusive_sale"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	issued, err := services.LicensesIssued(database.DB, *bot)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count licenses"})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.MaxLicenses != nil {
+		if *req.MaxLicenses < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_licenses cannot be negative"})
+			return
+		}
+		if *req.MaxLicenses > 0 && int64(*req.MaxLicenses) < issued {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_licenses is below the licenses already sold", "details": strconv.FormatInt(issued, 10) + " sold"})
+			return
+		}
+		updates["max_licenses"] = *req.MaxLicenses
+	}
+	if req.ResaleAllowed != nil {
+		updates["resale_allowed"] = *req.ResaleAllowed
+	}
+	if req.ExclusiveSale != nil {
+		// Selling the bot outright would take it away from its licensees
+		if *req.ExclusiveSale && issued > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "a bot with licensees cannot be sold exclusively"})
+			return
+		}
+		updates["exclusive_sale"] = *req.ExclusiveSale
+	}
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nothing to update"})
+		return
+	}
+
+	if err := database.DB.Model(bot).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update bot", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":         true,
+		"bot_id":          bot.ID,
+		"max_licenses":    bot.MaxLicenses,
+		"resale_allowed":  bot.ResaleAllowed,
+		"exclusive_sale":  bot.ExclusiveSale,
+		"licenses_issued": issued,
+	})
+}
+
+// GetResaleListingsHandler godoc
+// @Summary List licenses for resale
+// @Description Lists licenses other users are reselling, optionally for one bot. Buy one through /api/payment/initialize with payment_type "resale" and its listing_id.
+// @Tags user
+// @Produce json
+// @Param bot_id query int false "Bot ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /api/user/resale [get]
+func GetResaleListingsHandler(c *gin.Context) {
+	query := database.DB.Where("status = ?", "listed")
+	if botID := c.Query("bot_id"); botID != "" {
+		query = query.Where("bot_id = ?", botID)
+	}
+
+	var listings []models.LicenseListing
+	if err := query.Order("price ASC").Limit(100).Find(&listings).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch listings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "listings": listings})
+}
+
+// ListLicenseForResaleHandler godoc
+// @Summary Resell a license
+// @Description Lists one of the user's purchased licenses for resale, if the bot allowed resale when it was bought
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param request body object true "{\"user_bot_id\": 3, \"price\": 40}"
+// @Security ApiKeyAuth
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /api/user/resale [post]
+func ListLicenseForResaleHandler(c *gin.Context) {
+	var req struct {
+		UserBotID uint    `json:"user_bot_id" binding:"required"`
+		Price     float64 `json:"price" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	listing, err := services.ListLicenseForResale(c.GetUint("user_id"), req.UserBotID, req.Price)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrNoBotAccess) || errors.Is(err, services.ErrResaleNotAllowed) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{"error": "Could not list license", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "listing": listing})
+}
+
+// CancelResaleListingHandler godoc
+// @Summary Withdraw a resale listing
+// @Description Cancels one of the user's open resale listings
+// @Tags user
+// @Produce json
+// @Param id path int true "Listing ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Router /api/user/resale/{id} [delete]
+func CancelResaleListingHandler(c *gin.Context) {
+	listingID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid listing id"})
+		return
+	}
+
+	if err := services.CancelResaleListing(c.GetUint("user_id"), uint(listingID)); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrListingNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
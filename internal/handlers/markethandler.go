@@ -3,12 +3,27 @@ package handlers
 import (
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"github.com/keyadaniel56/algocdk/internal/indicators"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	services "github.com/keyadaniel56/algocdk/service"
 )
 
+var tickHub = services.NewTickHub(services.NewDerivMarketSource(derivService))
+var candleStore = services.NewCandleStore(derivService)
+
+// UseMarketDataSource replaces the feed behind /ws/market, e.g. with a
+// synthetic or recorded source for development and tests.
+func UseMarketDataSource(source services.MarketDataSource) {
+	tickHub.SetSource(source)
+}
+
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true
@@ -48,56 +63,169 @@ func GetMarketData(c *gin.Context) {
 	})
 }
 
-// GetChartData returns chart data for a specific symbol
+// GetChartData returns OHLC candles for a symbol. Query parameters:
+// timeframe ("1m", "15m", "1h", ... or seconds), count, start and end (epoch
+// seconds). Closed candles are cached locally after the first load.
 func GetChartData(c *gin.Context) {
 	symbol := c.Param("symbol")
 	timeframe := c.DefaultQuery("timeframe", "1m")
 
-	// Generate sample chart data
-	data := generateSampleChartData(symbol, timeframe)
+	granularity, err := services.ParseTimeframe(timeframe)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	count, _ := strconv.Atoi(c.DefaultQuery("count", "100"))
+	start, _ := strconv.ParseInt(c.Query("start"), 10, 64)
+	end, _ := strconv.ParseInt(c.Query("end"), 10, 64)
+
+	candles, err := candleStore.Candles(symbol, granularity, start, end, count)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":   "Failed to load candles",
+			"details": err.Error(),
+		})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"symbol":    symbol,
-		"timeframe": timeframe,
-		"candles":   data,
+		"symbol":      symbol,
+		"timeframe":   timeframe,
+		"granularity": granularity,
+		"candles":     candles,
 	})
 }
 
-func generateSampleChartData(symbol, timeframe string) []map[string]interface{} {
-	data := make([]map[string]interface{}, 100)
-	basePrice := 1.0850
-	if symbol == "BTC/USD" {
-		basePrice = 43250.0
-	} else if symbol == "ETH/USD" {
-		basePrice = 2650.0
+const (
+	maxIndicatorPoints = 1000
+	maxDigitTicks      = 5000
+)
+
+// GetIndicators computes technical indicators over a symbol's candles.
+// Query parameters: indicators (comma separated, e.g.
+// "rsi:14,macd:12:26:9,bollinger:20:2"), timeframe and count as for
+// GetChartData, and digits, the number of recent ticks to compute
+// last-digit statistics over.
+func GetIndicators(c *gin.Context) {
+	symbol := c.Param("symbol")
+	timeframe := c.DefaultQuery("timeframe", "1m")
+
+	specs, err := indicators.ParseSpecs(c.Query("indicators"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	digitTicks, _ := strconv.Atoi(c.Query("digits"))
+	if len(specs) == 0 && digitTicks <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "indicators or digits is required, e.g. indicators=rsi:14,sma:50",
+		})
+		return
 	}
 
-	currentTime := time.Now().Unix() - 86400
-	price := basePrice
-
-	for i := 0; i < 100; i++ {
-		open := price
-		change := (float64(i%10) - 5) * 0.001 * basePrice
-		close := open + change
-		high := maxFloat(open, close) + (float64(i%3) * 0.0005 * basePrice)
-		low := minFloat(open, close) - (float64(i%3) * 0.0005 * basePrice)
-
-		data[i] = map[string]interface{}{
-			"time":  currentTime,
-			"open":  round(open, 4),
-			"high":  round(high, 4),
-			"low":   round(low, 4),
-			"close": round(close, 4),
+	granularity, err := services.ParseTimeframe(timeframe)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	count, _ := strconv.Atoi(c.DefaultQuery("count", "100"))
+	if count <= 0 {
+		count = 100
+	}
+	if count > maxIndicatorPoints {
+		count = maxIndicatorPoints
+	}
+
+	response := gin.H{
+		"symbol":      symbol,
+		"timeframe":   timeframe,
+		"granularity": granularity,
+	}
+
+	if len(specs) > 0 {
+		// Load extra candles so the first returned values are warmed up
+		candles, err := candleStore.Candles(symbol, granularity, 0, 0, count+indicators.MaxLookback(specs))
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{
+				"error":   "Failed to load candles",
+				"details": err.Error(),
+			})
+			return
 		}
 
-		currentTime += 900 // 15 minutes
-		price = close
+		from := len(candles) - count
+		values := make(map[string]map[string][]indicators.Point, len(specs))
+		for _, spec := range specs {
+			lines, err := indicators.Compute(spec, candles)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+			points := make(map[string][]indicators.Point, len(lines))
+			for output, series := range lines {
+				points[output] = indicators.Points(candles, series, from)
+			}
+			values[spec.Key()] = points
+		}
+		response["indicators"] = values
+	}
+
+	if digitTicks > 0 {
+		if digitTicks > maxDigitTicks {
+			digitTicks = maxDigitTicks
+		}
+		ticks, pipSize, err := derivService.TickHistory(symbol, 0, 0, digitTicks)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{
+				"error":   "Failed to load ticks",
+				"details": err.Error(),
+			})
+			return
+		}
+		quotes := make([]float64, len(ticks))
+		for i, t := range ticks {
+			quotes[i] = t.Quote
+		}
+		response["digits"] = indicators.Digits(quotes, pipSize)
 	}
 
-	return data
+	c.JSON(http.StatusOK, response)
 }
 
-// WebSocket handler for real-time market data
+// marketClientMessage is what clients send on /ws/market, e.g.
+// {"action": "subscribe", "symbols": ["R_10", "frxEURUSD"]}
+//
+// Subscribing with indicators, e.g. "indicators": ["rsi:14", "sma:50"] and
+// "timeframe": "1m", also streams their values on the forming candle with
+// every tick.
+type marketClientMessage struct {
+	Action     string   `json:"action"` // "subscribe", "unsubscribe" or "ping"
+	Symbol     string   `json:"symbol"`
+	Symbols    []string `json:"symbols"`
+	Indicators []string `json:"indicators"`
+	Timeframe  string   `json:"timeframe"`
+}
+
+const (
+	marketWriteWait  = 10 * time.Second
+	marketPongWait   = 60 * time.Second
+	marketPingPeriod = 50 * time.Second
+	maxClientSymbols = 50
+)
+
+// WebSocket handler for real-time market data. Clients subscribe and
+// unsubscribe to symbols; every symbol is streamed from a single upstream
+// subscription shared by all connected clients.
 func MarketWebSocket(c *gin.Context) {
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
@@ -108,76 +236,230 @@ func MarketWebSocket(c *gin.Context) {
 
 	log.Println("WebSocket client connected")
 
-	// Send initial market data
-	markets := []MarketData{
-		{Symbol: "EUR/USD", Price: 1.0850, Change: 0.0012, ChangePercent: 0.11, Volume: 1250000, Type: "forex", High: 1.0875, Low: 1.0820},
-		{Symbol: "GBP/USD", Price: 1.2650, Change: -0.0025, ChangePercent: -0.20, Volume: 980000, Type: "forex", High: 1.2680, Low: 1.2630},
-		{Symbol: "USD/JPY", Price: 149.85, Change: 0.45, ChangePercent: 0.30, Volume: 1100000, Type: "forex", High: 150.20, Low: 149.40},
-		{Symbol: "BTC/USD", Price: 43250.00, Change: 1250.00, ChangePercent: 2.98, Volume: 45000, Type: "crypto", High: 44100, Low: 42800},
-		{Symbol: "ETH/USD", Price: 2650.00, Change: -85.00, ChangePercent: -3.11, Volume: 125000, Type: "crypto", High: 2720, Low: 2580},
-		{Symbol: "XAU/USD", Price: 2025.50, Change: 12.30, ChangePercent: 0.61, Volume: 85000, Type: "metals", High: 2035, Low: 2010},
-	}
+	ticks := make(chan services.MarketTick, 256)
+	outgoing := make(chan WebSocketMessage, 16)
+	done := make(chan struct{})
+	subscribed := map[string]bool{}
 
-	initialMsg := WebSocketMessage{
-		Type: "initial_data",
-		Data: markets,
-	}
+	// Indicator streams by symbol, shared with the writer goroutine
+	var streamsMu sync.Mutex
+	streams := map[string]*indicators.Stream{}
 
-	if err := conn.WriteJSON(initialMsg); err != nil {
-		log.Printf("WebSocket write error: %v", err)
-		return
+	defer func() {
+		close(done)
+		for symbol := range subscribed {
+			tickHub.Unsubscribe(symbol, ticks)
+		}
+	}()
+
+	// All writes happen on this goroutine
+	go func() {
+		ping := time.NewTicker(marketPingPeriod)
+		defer ping.Stop()
+
+		write := func(msgs ...WebSocketMessage) bool {
+			for _, msg := range msgs {
+				conn.SetWriteDeadline(time.Now().Add(marketWriteWait))
+				if err := conn.WriteJSON(msg); err != nil {
+					log.Printf("WebSocket write error: %v", err)
+					conn.Close()
+					return false
+				}
+			}
+			return true
+		}
+
+		for {
+			var msgs []WebSocketMessage
+			select {
+			case <-done:
+				return
+			case tick := <-ticks:
+				msgs = append(msgs, WebSocketMessage{Type: "tick", Data: tick})
+
+				streamsMu.Lock()
+				if stream, ok := streams[tick.Symbol]; ok {
+					msgs = append(msgs, WebSocketMessage{Type: "indicators", Data: gin.H{
+						"symbol":      tick.Symbol,
+						"epoch":       tick.Epoch,
+						"granularity": stream.Granularity,
+						"values":      stream.Update(tick.Epoch, tick.Quote),
+					}})
+				}
+				streamsMu.Unlock()
+			case m := <-outgoing:
+				msgs = append(msgs, m)
+			case <-ping.C:
+				conn.SetWriteDeadline(time.Now().Add(marketWriteWait))
+				if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+					conn.Close()
+					return
+				}
+				continue
+			}
+			if !write(msgs...) {
+				return
+			}
+		}
+	}()
+
+	send := func(msgType string, data interface{}) {
+		select {
+		case outgoing <- WebSocketMessage{Type: msgType, Data: data}:
+		case <-done:
+		}
 	}
 
-	// Send periodic updates
-	ticker := time.NewTicker(2 * time.Second)
-	defer ticker.Stop()
+	conn.SetReadDeadline(time.Now().Add(marketPongWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(marketPongWait))
+		return nil
+	})
 
 	for {
-		select {
-		case <-ticker.C:
-			// Simulate market updates
-			for i := range markets {
-				change := (float64(time.Now().Unix()%10) - 5) * 0.0001 * markets[i].Price
-				markets[i].Price += change
-				markets[i].Change = change
-				markets[i].ChangePercent = (change / markets[i].Price) * 100
+		var msg marketClientMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("WebSocket error: %v", err)
 			}
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(marketPongWait))
 
-			updateMsg := WebSocketMessage{
-				Type: "market_update",
-				Data: markets,
-			}
+		symbols := msg.Symbols
+		if msg.Symbol != "" {
+			symbols = append(symbols, msg.Symbol)
+		}
 
-			if err := conn.WriteJSON(updateMsg); err != nil {
-				log.Printf("WebSocket write error: %v", err)
-				return
+		switch strings.ToLower(msg.Action) {
+		case "subscribe":
+			specs, granularity, err := parseStreamIndicators(msg)
+			if err != nil {
+				send("error", gin.H{"message": err.Error()})
+				continue
 			}
 
-		default:
-			// Check for client messages
-			_, _, err := conn.ReadMessage()
-			if err != nil {
-				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-					log.Printf("WebSocket error: %v", err)
+			for _, symbol := range symbols {
+				symbol = strings.TrimSpace(symbol)
+				if symbol == "" {
+					continue
 				}
-				return
+				if len(specs) > 0 {
+					history, err := candleStore.Candles(symbol, granularity, 0, 0, indicators.MaxLookback(specs)+1)
+					if err != nil {
+						send("error", gin.H{"symbol": symbol, "message": err.Error()})
+						continue
+					}
+					streamsMu.Lock()
+					streams[symbol] = indicators.NewStream(granularity, specs, history)
+					streamsMu.Unlock()
+				}
+				if subscribed[symbol] {
+					continue
+				}
+				if len(subscribed) >= maxClientSymbols {
+					send("error", gin.H{"symbol": symbol, "message": "too many subscriptions"})
+					continue
+				}
+				if err := tickHub.Subscribe(symbol, ticks); err != nil {
+					tickHub.Unsubscribe(symbol, ticks)
+					send("error", gin.H{"symbol": symbol, "message": err.Error()})
+					continue
+				}
+				subscribed[symbol] = true
+				send("subscribed", gin.H{"symbol": symbol})
+			}
+		case "unsubscribe":
+			for _, symbol := range symbols {
+				symbol = strings.TrimSpace(symbol)
+				if !subscribed[symbol] {
+					continue
+				}
+				tickHub.Unsubscribe(symbol, ticks)
+				delete(subscribed, symbol)
+				streamsMu.Lock()
+				delete(streams, symbol)
+				streamsMu.Unlock()
+				send("unsubscribed", gin.H{"symbol": symbol})
 			}
+		case "ping":
+			send("pong", gin.H{"time": time.Now().Unix()})
+		default:
+			send("error", gin.H{"message": "unknown action, use subscribe, unsubscribe or ping"})
 		}
 	}
 }
 
-// GetDerivMarketData integrates with Deriv API for real market data
+// parseStreamIndicators reads the indicators and timeframe of a subscribe
+// message. Without a timeframe indicators are computed on 1m candles.
+func parseStreamIndicators(msg marketClientMessage) ([]models.IndicatorSpec, int, error) {
+	specs, err := indicators.ParseSpecs(strings.Join(msg.Indicators, ","))
+	if err != nil || len(specs) == 0 {
+		return nil, 0, err
+	}
+	timeframe := msg.Timeframe
+	if timeframe == "" {
+		timeframe = "1m"
+	}
+	granularity, err := services.ParseTimeframe(timeframe)
+	if err != nil {
+		return nil, 0, err
+	}
+	return specs, granularity, nil
+}
+
+// derivMarkets are the symbols summarised by GetDerivMarketData
+var derivMarkets = []struct {
+	Symbol string
+	Type   string
+}{
+	{"R_10", "synthetic"},
+	{"R_25", "synthetic"},
+	{"R_50", "synthetic"},
+	{"R_75", "synthetic"},
+	{"R_100", "synthetic"},
+	{"BOOM1000", "crash_boom"},
+	{"CRASH1000", "crash_boom"},
+}
+
+// GetDerivMarketData returns today's price, change and range for the main
+// Deriv synthetic indices, using the live tick where one is being streamed.
 func GetDerivMarketData(c *gin.Context) {
-	// This would integrate with Deriv's WebSocket API
-	// For now, return enhanced sample data
-	markets := []MarketData{
-		{Symbol: "R_10", Price: 1234.56, Change: 12.34, ChangePercent: 1.01, Volume: 500000, Type: "synthetic", High: 1245.67, Low: 1220.45},
-		{Symbol: "R_25", Price: 2345.67, Change: -23.45, ChangePercent: -0.99, Volume: 750000, Type: "synthetic", High: 2370.12, Low: 2320.34},
-		{Symbol: "R_50", Price: 3456.78, Change: 34.56, ChangePercent: 1.01, Volume: 600000, Type: "synthetic", High: 3490.34, Low: 3420.12},
-		{Symbol: "R_75", Price: 4567.89, Change: -45.67, ChangePercent: -0.99, Volume: 450000, Type: "synthetic", High: 4612.56, Low: 4520.23},
-		{Symbol: "R_100", Price: 5678.90, Change: 56.78, ChangePercent: 1.01, Volume: 800000, Type: "synthetic", High: 5734.68, Low: 5620.12},
-		{Symbol: "BOOM1000", Price: 12345.67, Change: 123.45, ChangePercent: 1.01, Volume: 300000, Type: "crash_boom", High: 12468.12, Low: 12220.23},
-		{Symbol: "CRASH1000", Price: 23456.78, Change: -234.56, ChangePercent: -0.99, Volume: 350000, Type: "crash_boom", High: 23690.34, Low: 23220.12},
+	markets := make([]MarketData, 0, len(derivMarkets))
+	for _, m := range derivMarkets {
+		candles, err := derivService.Candles(m.Symbol, 86400, 0, 0, 1)
+		if err != nil || len(candles) == 0 {
+			log.Printf("[Market] no daily candle for %s: %v", m.Symbol, err)
+			continue
+		}
+		day := candles[len(candles)-1]
+
+		price := day.Close
+		if tick, ok := tickHub.Latest(m.Symbol); ok {
+			price = tick.Quote
+		}
+		change := price - day.Open
+		changePercent := 0.0
+		if day.Open != 0 {
+			changePercent = change / day.Open * 100
+		}
+
+		markets = append(markets, MarketData{
+			Symbol:        m.Symbol,
+			Price:         price,
+			Change:        round(change, 4),
+			ChangePercent: round(changePercent, 2),
+			Type:          m.Type,
+			High:          maxFloat(day.High, price),
+			Low:           minFloat(day.Low, price),
+		})
+	}
+
+	if len(markets) == 0 {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error": "Deriv market data is unavailable",
+		})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
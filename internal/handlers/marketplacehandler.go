@@ -75,6 +75,26 @@ func MarketplaceHandler(c *gin.Context) {
 		}
 	}
 
+	// Attach the latest backtest of each bot, if any
+	var reportIDs []uint
+	for _, b := range bots {
+		if b.LatestBacktestID != nil {
+			reportIDs = append(reportIDs, *b.LatestBacktestID)
+		}
+	}
+	backtests := make(map[uint]gin.H)
+	if len(reportIDs) > 0 {
+		var reports []models.BacktestReport
+		if err := database.DB.Omit("equity_curve", "strategy").
+			Where("id IN ?", reportIDs).
+			Find(&reports).Error; err == nil {
+
+			for _, r := range reports {
+				backtests[r.BotID] = backtestSummary(r)
+			}
+		}
+	}
+
 	var botList []gin.H
 	for _, b := range bots {
 		baseURL := os.Getenv("BASE_URL")
@@ -86,15 +106,18 @@ func MarketplaceHandler(c *gin.Context) {
 		botLink := fmt.Sprintf("%s/uploads/%s", baseURL, botPath)
 
 		botList = append(botList, gin.H{
-			"id":          b.ID,
-			"name":        b.Name,
-			"image":       b.Image,
-			"price":       b.Price,
-			"rent_price":  b.RentPrice,
-			"strategy":    b.Strategy,
-			"status":      b.Status,
-			"bot_link":    botLink,
-			"is_favorite": favoriteMap[b.ID],
+			"id":             b.ID,
+			"name":           b.Name,
+			"image":          b.Image,
+			"price":          b.Price,
+			"rent_price":     b.RentPrice,
+			"max_licenses":   b.MaxLicenses,
+			"exclusive_sale": b.ExclusiveSale,
+			"strategy":       b.Strategy,
+			"status":         b.Status,
+			"bot_link":       botLink,
+			"is_favorite":    favoriteMap[b.ID],
+			"backtest":       backtests[b.ID],
 			"creator": gin.H{
 				"id":   b.Owner.ID,
 				"name": b.Owner.Name,
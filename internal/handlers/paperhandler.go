@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	services "github.com/keyadaniel56/algocdk/service"
+)
+
+var paperEngine = services.NewPaperEngine(derivService)
+
+// ResumePaperTrades restarts settlement of paper trades that were still open
+// when the server last stopped. Call after database.InitDB.
+func ResumePaperTrades() {
+	paperEngine.Resume()
+}
+
+// placePaperTrade opens a simulated trade against the user's paper balance
+func placePaperTrade(c *gin.Context, userID uint, req models.DerivTradeRequest) {
+	if req.ProposalID != "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "proposal_id cannot be used in paper mode, send the contract instead",
+		})
+		return
+	}
+
+	trade, err := paperEngine.PlaceTrade(userID, req.DerivContractRequest)
+	if err != nil {
+		status := http.StatusBadGateway
+		switch {
+		case errors.Is(err, services.ErrInsufficientPaperBalance):
+			status = http.StatusPaymentRequired
+		case errors.Is(err, services.ErrSimulationUnsupported), strings.HasPrefix(err.Error(), "invalid contract"):
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{
+			"error":   "Paper trade was not placed",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":        true,
+		"message":        "Paper trade placed",
+		"paper_trade_id": trade.ID,
+		"buy_price":      trade.Stake,
+		"payout":         trade.Payout,
+		"mode":           "paper",
+	})
+}
+
+// GetPaperAccount returns the user's paper balance and recent ledger entries
+func GetPaperAccount(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	account, err := paperEngine.Account(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to load paper account",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var ledger []models.PaperLedgerEntry
+	database.DB.Where("account_id = ?", account.ID).
+		Order("id DESC").Limit(50).Find(&ledger)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"account": account,
+		"ledger":  ledger,
+	})
+}
+
+// ResetPaperAccount restores the paper balance to its starting amount
+func ResetPaperAccount(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	account, err := paperEngine.Reset(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to reset paper account",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Paper balance reset",
+		"account": account,
+	})
+}
+
+// GetPaperTrades lists the user's paper trades, newest first
+func GetPaperTrades(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	query := database.DB.Where("user_id = ?", userID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var trades []models.PaperTrade
+	if err := query.Order("id DESC").Limit(200).Find(&trades).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch paper trades",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"trades":  trades,
+	})
+}
+
+// SetTradingMode saves whether the user's trades go live or to paper
+func SetTradingMode(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req struct {
+		Mode string `json:"mode" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	mode := strings.ToLower(strings.TrimSpace(req.Mode))
+	if mode != "live" && mode != "paper" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "mode must be 'live' or 'paper'",
+		})
+		return
+	}
+
+	if err := database.DB.Model(&models.User{}).Where("id = ?", userID).
+		Update("trading_mode", mode).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update trading mode",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":      true,
+		"trading_mode": mode,
+	})
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	services "github.com/keyadaniel56/algocdk/service"
+)
+
+// RequestRefundHandler godoc
+// @Summary Request a refund
+// @Description Asks for a refund of one of the user's settled payments, made within the last 14 days. A superadmin approves or rejects it.
+// @Tags payment
+// @Accept json
+// @Produce json
+// @Param request body object true "{\"reference\": \"TX_...\", \"reason\": \"bot does not work\", \"amount\": 500}, amount defaults to everything left"
+// @Security ApiKeyAuth
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Router /api/payment/refunds [post]
+func RequestRefundHandler(c *gin.Context) {
+	var req struct {
+		Reference string  `json:"reference" binding:"required"`
+		Reason    string  `json:"reason" binding:"required"`
+		Amount    float64 `json:"amount"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	refund, err := services.RequestRefund(c.GetUint("user_id"), req.Reference, req.Amount, req.Reason)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not request refund", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "refund": refund})
+}
+
+// GetMyRefundsHandler godoc
+// @Summary List my refunds
+// @Description Lists the user's refunds and refund requests
+// @Tags payment
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /api/payment/refunds [get]
+func GetMyRefundsHandler(c *gin.Context) {
+	var refunds []models.Refund
+	if err := database.DB.Where("user_id = ?", c.GetUint("user_id")).Order("created_at DESC").Find(&refunds).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch refunds"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "refunds": refunds})
+}
+
+// GetRefundsHandler godoc
+// @Summary List refunds
+// @Description Lists refunds and refund requests, optionally by status
+// @Tags superadmin
+// @Produce json
+// @Param status query string false "requested, pending, processed, failed or rejected"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /api/superadmin/refunds [get]
+func GetRefundsHandler(c *gin.Context) {
+	query := database.DB.Order("created_at ASC")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var refunds []models.Refund
+	if err := query.Limit(200).Find(&refunds).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch refunds"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "refunds": refunds})
+}
+
+// RejectRefundHandler godoc
+// @Summary Reject a refund request
+// @Description Turns down a refund a user asked for
+// @Tags superadmin
+// @Accept json
+// @Produce json
+// @Param id path int true "Refund ID"
+// @Param request body object false "{\"note\": \"outside our refund policy\"}"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/superadmin/refunds/{id}/reject [post]
+func RejectRefundHandler(c *gin.Context) {
+	refundID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid refund id"})
+		return
+	}
+	var req struct {
+		Note string `json:"note"`
+	}
+	c.ShouldBindJSON(&req)
+
+	refund, err := services.RejectRefund(uint(refundID), c.GetUint("user_id"), req.Note)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrRefundNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, services.ErrRefundReviewed):
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "refund": refund})
+}
+
+// GetDisputesHandler godoc
+// @Summary List chargebacks
+// @Description Lists payment disputes, open ones first
+// @Tags superadmin
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /api/superadmin/disputes [get]
+func GetDisputesHandler(c *gin.Context) {
+	var disputes []models.Dispute
+	if err := database.DB.Order("resolved_at IS NOT NULL, created_at DESC").Limit(200).Find(&disputes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch disputes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "disputes": disputes})
+}
+
+// GetTransactionHistoryHandler godoc
+// @Summary Get a transaction's history
+// @Description Returns a transaction with everything that happened to it: its settlement, refunds, disputes and their ledger entries
+// @Tags superadmin
+// @Produce json
+// @Param reference path string true "Transaction reference"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Router /api/superadmin/transactions/{reference}/history [get]
+func GetTransactionHistoryHandler(c *gin.Context) {
+	var transaction models.Transaction
+	if err := database.DB.Where("reference = ?", c.Param("reference")).First(&transaction).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "transaction not found"})
+		return
+	}
+
+	var events []models.TransactionEvent
+	var refunds []models.Refund
+	var disputes []models.Dispute
+	var entries []models.LedgerEntry
+	database.DB.Where("transaction_id = ?", transaction.ID).Order("created_at ASC, id ASC").Find(&events)
+	database.DB.Where("transaction_id = ?", transaction.ID).Order("created_at ASC").Find(&refunds)
+	database.DB.Where("transaction_id = ?", transaction.ID).Order("created_at ASC").Find(&disputes)
+	database.DB.Where("transaction_id = ?", transaction.ID).Order("created_at ASC, id ASC").Find(&entries)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":        true,
+		"transaction":    transaction,
+		"events":         events,
+		"refunds":        refunds,
+		"disputes":       disputes,
+		"ledger_entries": entries,
+	})
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	services "github.com/keyadaniel56/algocdk/service"
+)
+
+type rentalPlanRequest struct {
+	Name         string  `json:"name"`
+	Interval     string  `json:"interval" binding:"required"`
+	DurationDays int     `json:"duration_days"`
+	Price        float64 `json:"price" binding:"required"`
+}
+
+// ListBotPlansHandler godoc
+// @Summary List a bot's rental plans
+// @Description Lists every rental plan of the admin's bot, including retired ones
+// @Tags admin
+// @Produce json
+// @Param id path int true "Bot ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/admin/bots/{id}/plans [get]
+func ListBotPlansHandler(c *gin.Context) {
+	bot, ok := ownedBot(c)
+	if !ok {
+		return
+	}
+
+	var plans []models.RentalPlan
+	if err := database.DB.Where("bot_id = ?", bot.ID).Order("price ASC").Find(&plans).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch plans"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "plans": plans})
+}
+
+// CreateBotPlanHandler godoc
+// @Summary Add a rental plan
+// @Description Adds a rental plan to the admin's bot. Interval is daily, weekly, monthly, lifetime or custom; custom plans need duration_days. Once a bot has plans they replace its rent_price.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "Bot ID"
+// @Param request body object true "{\"name\": \"Weekly\", \"interval\": \"weekly\", \"price\": 300}"
+// @Security ApiKeyAuth
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /api/admin/bots/{id}/plans [post]
+func CreateBotPlanHandler(c *gin.Context) {
+	bot, ok := ownedBot(c)
+	if !ok {
+		return
+	}
+
+	var req rentalPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	plan := models.RentalPlan{
+		BotID:        bot.ID,
+		Name:         req.Name,
+		Interval:     req.Interval,
+		DurationDays: req.DurationDays,
+		Price:        req.Price,
+		Active:       true,
+	}
+	if err := services.NormalizeRentalPlan(&plan); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid plan", "details": err.Error()})
+		return
+	}
+	if err := database.DB.Create(&plan).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save plan"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "plan": plan})
+}
+
+// UpdateBotPlanHandler godoc
+// @Summary Update a rental plan
+// @Description Changes a rental plan. Current renters keep what they paid for; the new terms apply from their next payment.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "Bot ID"
+// @Param plan_id path int true "Plan ID"
+// @Param request body object true "{\"name\": \"Weekly\", \"interval\": \"weekly\", \"price\": 350}"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/admin/bots/{id}/plans/{plan_id} [put]
+func UpdateBotPlanHandler(c *gin.Context) {
+	plan, ok := ownedPlan(c)
+	if !ok {
+		return
+	}
+
+	var req rentalPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	plan.Name = req.Name
+	plan.Interval = req.Interval
+	plan.DurationDays = req.DurationDays
+	plan.Price = req.Price
+	if err := services.NormalizeRentalPlan(plan); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid plan", "details": err.Error()})
+		return
+	}
+	if err := database.DB.Save(plan).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save plan"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "plan": plan})
+}
+
+// RetireBotPlanHandler godoc
+// @Summary Retire a rental plan
+// @Description Stops offering a rental plan. Current renters keep their access until it expires; subscriptions to the plan are cancelled before their next renewal.
+// @Tags admin
+// @Produce json
+// @Param id path int true "Bot ID"
+// @Param plan_id path int true "Plan ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Router /api/admin/bots/{id}/plans/{plan_id} [delete]
+func RetireBotPlanHandler(c *gin.Context) {
+	plan, ok := ownedPlan(c)
+	if !ok {
+		return
+	}
+
+	if err := database.DB.Model(plan).Update("active", false).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retire plan"})
+		return
+	}
+	plan.Active = false
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "plan": plan})
+}
+
+// GetRentalQuoteHandler godoc
+// @Summary Price a rental
+// @Description Quotes renting, renewing or switching to a plan of the bot, crediting the unused part of a current rental on another plan
+// @Tags user
+// @Produce json
+// @Param id path int true "Bot ID"
+// @Param plan_id query int false "Plan ID, optional when the bot has a single plan"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/user/bots/{id}/rental-quote [get]
+func GetRentalQuoteHandler(c *gin.Context) {
+	var bot models.Bot
+	if err := database.DB.First(&bot, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "bot not found"})
+		return
+	}
+	planID, _ := strconv.ParseUint(c.Query("plan_id"), 10, 64)
+
+	quote, err := services.QuoteRental(database.DB, c.GetUint("user_id"), bot, uint(planID))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not price this rental", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "quote": quote})
+}
+
+// SwitchRentalPlanHandler godoc
+// @Summary Switch rental plan without paying
+// @Description Moves the user's active rental to another plan when the unused credit covers it, extending access proportionally. Plan changes that cost money go through /api/payment/initialize with payment_type "rent" and plan_id.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path int true "Bot ID"
+// @Param request body object true "{\"plan_id\": 2}"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 402 {object} map[string]string
+// @Router /api/user/bots/{id}/plan [post]
+func SwitchRentalPlanHandler(c *gin.Context) {
+	var bot models.Bot
+	if err := database.DB.First(&bot, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "bot not found"})
+		return
+	}
+
+	var req struct {
+		PlanID uint `json:"plan_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	userBot, err := services.SwitchRentalPlan(c.GetUint("user_id"), bot, req.PlanID)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrPaymentRequired) {
+			status = http.StatusPaymentRequired
+		}
+		c.JSON(status, gin.H{"error": "Could not switch plan", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "rental": userBot})
+}
+
+// ownedPlan loads the :plan_id plan of the caller's :id bot, writing the
+// error response if either is not found or not theirs
+func ownedPlan(c *gin.Context) (*models.RentalPlan, bool) {
+	bot, ok := ownedBot(c)
+	if !ok {
+		return nil, false
+	}
+	var plan models.RentalPlan
+	if err := database.DB.Where("id = ? AND bot_id = ?", c.Param("plan_id"), bot.ID).First(&plan).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "plan not found"})
+		return nil, false
+	}
+	return &plan, true
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	services "github.com/keyadaniel56/algocdk/service"
+	"gorm.io/gorm"
+)
+
+// RiskLimitsRequest sets the limits of a risk profile. Zero means no limit.
+type RiskLimitsRequest struct {
+	MaxStake             float64 `json:"max_stake"`
+	DailyLossLimit       float64 `json:"daily_loss_limit"`
+	MaxOpenContracts     int     `json:"max_open_contracts"`
+	MaxConsecutiveLosses int     `json:"max_consecutive_losses"`
+	LossCooldownMinutes  int     `json:"loss_cooldown_minutes"`
+}
+
+func (r RiskLimitsRequest) validate() error {
+	if r.MaxStake < 0 || r.DailyLossLimit < 0 || r.MaxOpenContracts < 0 ||
+		r.MaxConsecutiveLosses < 0 || r.LossCooldownMinutes < 0 {
+		return errors.New("limits must not be negative")
+	}
+	if (r.MaxConsecutiveLosses > 0) != (r.LossCooldownMinutes > 0) {
+		return errors.New("max_consecutive_losses and loss_cooldown_minutes must be set together")
+	}
+	return nil
+}
+
+func (r RiskLimitsRequest) updates() map[string]interface{} {
+	return map[string]interface{}{
+		"max_stake":              r.MaxStake,
+		"daily_loss_limit":       r.DailyLossLimit,
+		"max_open_contracts":     r.MaxOpenContracts,
+		"max_consecutive_losses": r.MaxConsecutiveLosses,
+		"loss_cooldown_minutes":  r.LossCooldownMinutes,
+	}
+}
+
+// GetRiskSettingsHandler godoc
+// @Summary Get risk settings
+// @Description Returns the user's account-wide risk profile, including the kill switch, and their per-bot profiles
+// @Tags user
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 500 {object} map[string]string
+// @Router /api/user/risk [get]
+func GetRiskSettingsHandler(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	profile, err := services.UserRiskProfile(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load risk profile"})
+		return
+	}
+
+	var botProfiles []models.RiskProfile
+	database.DB.Where("user_id = ? AND bot_id IS NOT NULL", userID).Find(&botProfiles)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":      true,
+		"profile":      profile,
+		"bot_profiles": botProfiles,
+	})
+}
+
+// UpdateRiskProfileHandler godoc
+// @Summary Update account risk limits
+// @Description Sets the limits applied to every manual and automated order of the user
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param limits body RiskLimitsRequest true "Risk limits"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Router /api/user/risk [put]
+func UpdateRiskProfileHandler(c *gin.Context) {
+	var req RiskLimitsRequest
+	if !bindRiskLimits(c, &req) {
+		return
+	}
+
+	profile, err := services.UserRiskProfile(c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load risk profile"})
+		return
+	}
+	if err := database.DB.Model(profile).Updates(req.updates()).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update risk profile"})
+		return
+	}
+	database.DB.First(profile, profile.ID)
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "profile": profile})
+}
+
+// UpdateBotRiskProfileHandler godoc
+// @Summary Update a bot's risk limits
+// @Description Sets extra limits applied to the user's trades with one bot
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param bot_id path int true "Bot ID"
+// @Param limits body RiskLimitsRequest true "Risk limits"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/user/risk/bots/{bot_id} [put]
+func UpdateBotRiskProfileHandler(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	botID, err := strconv.ParseUint(c.Param("bot_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid bot id"})
+		return
+	}
+	var bot models.Bot
+	if err := database.DB.First(&bot, botID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "bot not found"})
+		return
+	}
+
+	var req RiskLimitsRequest
+	if !bindRiskLimits(c, &req) {
+		return
+	}
+
+	var profile models.RiskProfile
+	err = database.DB.Where("user_id = ? AND bot_id = ?", userID, bot.ID).First(&profile).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		profile = models.RiskProfile{UserID: userID, BotID: &bot.ID}
+		err = database.DB.Create(&profile).Error
+	}
+	if err == nil {
+		err = database.DB.Model(&profile).Updates(req.updates()).Error
+	}
+	if err == nil {
+		err = database.DB.First(&profile, profile.ID).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update risk profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "profile": profile})
+}
+
+// DeleteBotRiskProfileHandler godoc
+// @Summary Remove a bot's risk limits
+// @Description Removes the bot-specific limits; the account-wide limits still apply
+// @Tags user
+// @Produce json
+// @Param bot_id path int true "Bot ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /api/user/risk/bots/{bot_id} [delete]
+func DeleteBotRiskProfileHandler(c *gin.Context) {
+	if err := database.DB.Where("user_id = ? AND bot_id = ?", c.GetUint("user_id"), c.Param("bot_id")).
+		Delete(&models.RiskProfile{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete risk profile"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Bot risk limits removed"})
+}
+
+// KillSwitchHandler godoc
+// @Summary Engage or release the kill switch
+// @Description Engaging the kill switch pauses every running bot of the user and blocks all automated orders until it is released. Paused bots are not resumed automatically.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param request body object true "{\"engage\": true}"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Router /api/user/kill-switch [post]
+func KillSwitchHandler(c *gin.Context) {
+	var req struct {
+		Engage *bool `json:"engage" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	profile, paused, err := botRunner.KillSwitch(c.GetUint("user_id"), *req.Engage)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update kill switch", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":           true,
+		"automation_halted": profile.AutomationHalted,
+		"runs_paused":       paused,
+	})
+}
+
+// GetBlockedOrdersHandler godoc
+// @Summary List blocked orders
+// @Description Returns the audit log of the user's orders refused by risk limits, newest first
+// @Tags user
+// @Produce json
+// @Param limit query int false "Number of records (default 100)"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /api/user/risk/blocked [get]
+func GetBlockedOrdersHandler(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	var blocked []models.BlockedOrder
+	if err := database.DB.Where("user_id = ?", c.GetUint("user_id")).
+		Order("id DESC").Limit(limit).Find(&blocked).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch blocked orders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "blocked_orders": blocked})
+}
+
+func bindRiskLimits(c *gin.Context, req *RiskLimitsRequest) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return false
+	}
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid risk limits", "details": err.Error()})
+		return false
+	}
+	return true
+}
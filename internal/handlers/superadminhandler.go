@@ -813,7 +813,7 @@ func GetBotsHandler(ctx *gin.Context) {
 
 // ScanAllBotsHandler godoc
 // @Summary Scan all bots
-// @Description Scans all bot files for invalid App IDs
+// @Description Scans all bot files for App IDs other than the configured Deriv apps
 // @Tags superadmin
 // @Produce json
 // @Security ApiKeyAuth
@@ -823,6 +823,7 @@ func GetBotsHandler(ctx *gin.Context) {
 func ScanAllBotsHandler(c *gin.Context) {
 	rootDir := "./uploads"
 	var invalidBots []map[string]interface{}
+	deriv := derivService.Config()
 
 	// Regex to match app_id or appId assignments
 	re := regexp.MustCompile(`(?i)(app[_]?id)\s*[:=]\s*['"]?(\d+)['"]?`)
@@ -842,7 +843,7 @@ func ScanAllBotsHandler(c *gin.Context) {
 
 			matches := re.FindAllStringSubmatch(string(bytes), -1)
 			for _, m := range matches {
-				if len(m) > 2 && m[2] != "1089" {
+				if len(m) > 2 && !deriv.AppIDAllowed(m[2]) {
 					// Try to find bot record
 					var bot models.Bot
 					err := database.DB.Where("html_file = ?", path).First(&bot).Error
@@ -12,6 +12,7 @@ import (
 	"github.com/keyadaniel56/algocdk/internal/database"
 	"github.com/keyadaniel56/algocdk/internal/models"
 	"github.com/keyadaniel56/algocdk/internal/utils"
+	services "github.com/keyadaniel56/algocdk/service"
 	"gorm.io/gorm"
 )
 
@@ -664,16 +665,24 @@ func GetBotDetails(ctx *gin.Context) {
 		return
 	}
 
+	issued, _ := services.LicensesIssued(database.DB, bot)
+	plans, _ := services.RentalPlans(bot)
+
 	ctx.JSON(http.StatusOK, gin.H{
 		"message": "Bot details retrieved",
 		"data": map[string]interface{}{
-			"id":           bot.ID,
-			"admin_id":     admin.ID,
-			"price":        bot.Price,
-			"rent_price":   bot.RentPrice,
-			"payment_type": bot.SubscriptionType,
-			"name":         bot.Name,
-			"description":  bot.Description,
+			"id":              bot.ID,
+			"admin_id":        admin.ID,
+			"price":           bot.Price,
+			"rent_price":      bot.RentPrice,
+			"payment_type":    bot.SubscriptionType,
+			"name":            bot.Name,
+			"description":     bot.Description,
+			"max_licenses":    bot.MaxLicenses,
+			"licenses_issued": issued,
+			"exclusive_sale":  bot.ExclusiveSale,
+			"resale_allowed":  bot.ResaleAllowed,
+			"rental_plans":    plans,
 		},
 	})
 }
@@ -718,14 +727,17 @@ func GetUserBotsHandler(ctx *gin.Context) {
 		database.DB.Model(&models.Trade{}).Where("user_id = ? AND bot_id = ?", userID, bot.ID).Select("COALESCE(SUM(profit_loss), 0)").Scan(&botProfit)
 
 		bots = append(bots, gin.H{
-			"id":            bot.ID,
-			"name":          bot.Name,
-			"status":        status,
-			"profit":        botProfit,
-			"price":         bot.Price,
-			"access_type":   userBot.AccessType,
-			"purchase_date": userBot.PurchaseDate,
-			"expiry_date":   userBot.ExpiryDate,
+			"id":             bot.ID,
+			"name":           bot.Name,
+			"status":         status,
+			"profit":         botProfit,
+			"price":          bot.Price,
+			"access_type":    userBot.AccessType,
+			"user_bot_id":    userBot.ID,
+			"resale_allowed": userBot.ResaleAllowed,
+			"purchase_date":  userBot.PurchaseDate,
+			"expiry_date":    userBot.ExpiryDate,
+			"rental_plan_id": userBot.RentalPlanID,
 		})
 	}
 
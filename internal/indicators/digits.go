@@ -0,0 +1,66 @@
+package indicators
+
+import "math"
+
+// DigitStats summarises the last digits of a run of ticks, as used for
+// Deriv's digit contracts on synthetic indices. Percentages are 0 to 100.
+type DigitStats struct {
+	Ticks     int         `json:"ticks"`
+	Counts    [10]int     `json:"counts"`
+	Percent   [10]float64 `json:"percent"`
+	Even      float64     `json:"even"`
+	Odd       float64     `json:"odd"`
+	LastDigit int         `json:"last_digit"`
+	// Streak is how many ticks in a row, up to the latest, ended on an even
+	// digit (positive) or an odd one (negative).
+	Streak int `json:"streak"`
+}
+
+// LastDigit returns the last quoted digit of a price at the given pip size
+func LastDigit(quote float64, pipSize int) int {
+	scaled := int64(math.Round(quote * math.Pow10(pipSize)))
+	if scaled < 0 {
+		scaled = -scaled
+	}
+	return int(scaled % 10)
+}
+
+// Digits computes digit statistics over quotes quoted with pipSize decimals
+func Digits(quotes []float64, pipSize int) DigitStats {
+	stats := DigitStats{Ticks: len(quotes)}
+	if len(quotes) == 0 {
+		return stats
+	}
+
+	even := 0
+	for _, q := range quotes {
+		digit := LastDigit(q, pipSize)
+		stats.Counts[digit]++
+		if digit%2 == 0 {
+			even++
+		}
+	}
+	for d, n := range stats.Counts {
+		stats.Percent[d] = round2(float64(n) / float64(len(quotes)) * 100)
+	}
+	stats.Even = round2(float64(even) / float64(len(quotes)) * 100)
+	stats.Odd = round2(100 - stats.Even)
+
+	stats.LastDigit = LastDigit(quotes[len(quotes)-1], pipSize)
+	lastEven := stats.LastDigit%2 == 0
+	for i := len(quotes) - 1; i >= 0; i-- {
+		if (LastDigit(quotes[i], pipSize)%2 == 0) != lastEven {
+			break
+		}
+		if lastEven {
+			stats.Streak++
+		} else {
+			stats.Streak--
+		}
+	}
+	return stats
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
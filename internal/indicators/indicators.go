@@ -0,0 +1,351 @@
+// Package indicators computes technical indicators over candle series. It is
+// shared by the market API, strategy evaluation and backtests so they all
+// agree on the numbers.
+//
+// Series are aligned with their input: value i is the indicator at bar i,
+// and bars before the indicator has enough data hold NaN.
+package indicators
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/keyadaniel56/algocdk/internal/models"
+)
+
+// Compute evaluates spec over candles and returns every line it produces,
+// keyed by output name (see models.IndicatorOutputs).
+func Compute(spec models.IndicatorSpec, candles []models.Candle) (map[string][]float64, error) {
+	if err := spec.Normalize(); err != nil {
+		return nil, err
+	}
+	closes := Closes(candles)
+
+	switch spec.Name {
+	case "sma":
+		return map[string][]float64{"value": SMA(closes, spec.Period)}, nil
+	case "ema":
+		return map[string][]float64{"value": EMA(closes, spec.Period)}, nil
+	case "rsi":
+		return map[string][]float64{"value": RSI(closes, spec.Period)}, nil
+	case "atr":
+		return map[string][]float64{"value": ATR(candles, spec.Period)}, nil
+	case "macd":
+		macd, signal, histogram := MACD(closes, spec.Fast, spec.Slow, spec.Signal)
+		return map[string][]float64{"macd": macd, "signal": signal, "histogram": histogram}, nil
+	case "bollinger":
+		upper, middle, lower := Bollinger(closes, spec.Period, spec.StdDev)
+		return map[string][]float64{"upper": upper, "middle": middle, "lower": lower}, nil
+	case "stochastic":
+		k, d := Stochastic(candles, spec.Period, spec.Signal)
+		return map[string][]float64{"k": k, "d": d}, nil
+	}
+	return nil, nil
+}
+
+// Closes returns the closing prices of candles
+func Closes(candles []models.Candle) []float64 {
+	closes := make([]float64, len(candles))
+	for i, c := range candles {
+		closes[i] = c.Close
+	}
+	return closes
+}
+
+// SMA is the simple moving average of values over period bars
+func SMA(values []float64, period int) []float64 {
+	out := nanSeries(len(values))
+	if period < 1 {
+		return out
+	}
+	sum := 0.0
+	for i, v := range values {
+		sum += v
+		if i >= period {
+			sum -= values[i-period]
+		}
+		if i >= period-1 {
+			out[i] = sum / float64(period)
+		}
+	}
+	return out
+}
+
+// EMA is the exponential moving average of values over period bars, seeded
+// with the simple average of the first period values. Leading NaNs in
+// values are skipped, so EMA can be applied to another indicator.
+func EMA(values []float64, period int) []float64 {
+	out := nanSeries(len(values))
+	if period < 1 {
+		return out
+	}
+	start := 0
+	for start < len(values) && math.IsNaN(values[start]) {
+		start++
+	}
+	if len(values)-start < period {
+		return out
+	}
+
+	k := 2 / float64(period+1)
+	sum := 0.0
+	for i := start; i < start+period; i++ {
+		sum += values[i]
+	}
+	prev := sum / float64(period)
+	out[start+period-1] = prev
+	for i := start + period; i < len(values); i++ {
+		prev = values[i]*k + prev*(1-k)
+		out[i] = prev
+	}
+	return out
+}
+
+// RSI is Wilder's relative strength index over period bars, from 0 to 100
+func RSI(values []float64, period int) []float64 {
+	out := nanSeries(len(values))
+	if period < 1 || len(values) <= period {
+		return out
+	}
+
+	var gain, loss float64
+	for i := 1; i <= period; i++ {
+		change := values[i] - values[i-1]
+		if change > 0 {
+			gain += change
+		} else {
+			loss -= change
+		}
+	}
+	gain /= float64(period)
+	loss /= float64(period)
+	out[period] = rsiValue(gain, loss)
+
+	for i := period + 1; i < len(values); i++ {
+		change := values[i] - values[i-1]
+		up, down := 0.0, 0.0
+		if change > 0 {
+			up = change
+		} else {
+			down = -change
+		}
+		gain = (gain*float64(period-1) + up) / float64(period)
+		loss = (loss*float64(period-1) + down) / float64(period)
+		out[i] = rsiValue(gain, loss)
+	}
+	return out
+}
+
+func rsiValue(gain, loss float64) float64 {
+	if loss == 0 {
+		if gain == 0 {
+			return 50
+		}
+		return 100
+	}
+	return 100 - 100/(1+gain/loss)
+}
+
+// MACD returns the MACD line (fast EMA minus slow EMA), its signal line and
+// the histogram between them.
+func MACD(values []float64, fast, slow, signal int) (macd, signalLine, histogram []float64) {
+	fastEMA := EMA(values, fast)
+	slowEMA := EMA(values, slow)
+
+	macd = nanSeries(len(values))
+	for i := range values {
+		macd[i] = fastEMA[i] - slowEMA[i]
+	}
+	signalLine = EMA(macd, signal)
+
+	histogram = nanSeries(len(values))
+	for i := range values {
+		histogram[i] = macd[i] - signalLine[i]
+	}
+	return macd, signalLine, histogram
+}
+
+// Bollinger returns bands stdDev standard deviations above and below the
+// period simple moving average.
+func Bollinger(values []float64, period int, stdDev float64) (upper, middle, lower []float64) {
+	middle = SMA(values, period)
+	upper = nanSeries(len(values))
+	lower = nanSeries(len(values))
+	if period < 1 {
+		return upper, middle, lower
+	}
+
+	for i := period - 1; i < len(values); i++ {
+		variance := 0.0
+		for _, v := range values[i-period+1 : i+1] {
+			variance += (v - middle[i]) * (v - middle[i])
+		}
+		width := stdDev * math.Sqrt(variance/float64(period))
+		upper[i] = middle[i] + width
+		lower[i] = middle[i] - width
+	}
+	return upper, middle, lower
+}
+
+// ATR is Wilder's average true range over period bars
+func ATR(candles []models.Candle, period int) []float64 {
+	out := nanSeries(len(candles))
+	if period < 1 || len(candles) < period {
+		return out
+	}
+
+	trueRange := func(i int) float64 {
+		c := candles[i]
+		tr := c.High - c.Low
+		if i > 0 {
+			prev := candles[i-1].Close
+			tr = math.Max(tr, math.Max(math.Abs(c.High-prev), math.Abs(c.Low-prev)))
+		}
+		return tr
+	}
+
+	sum := 0.0
+	for i := 0; i < period; i++ {
+		sum += trueRange(i)
+	}
+	prev := sum / float64(period)
+	out[period-1] = prev
+	for i := period; i < len(candles); i++ {
+		prev = (prev*float64(period-1) + trueRange(i)) / float64(period)
+		out[i] = prev
+	}
+	return out
+}
+
+// Stochastic returns the %K line (where the close sits in the period's
+// high-low range, 0 to 100) and %D, its signal-bar simple average.
+func Stochastic(candles []models.Candle, period, signal int) (k, d []float64) {
+	k = nanSeries(len(candles))
+	if period < 1 {
+		return k, nanSeries(len(candles))
+	}
+
+	for i := period - 1; i < len(candles); i++ {
+		high, low := candles[i].High, candles[i].Low
+		for _, c := range candles[i-period+1 : i] {
+			high = math.Max(high, c.High)
+			low = math.Min(low, c.Low)
+		}
+		if high == low {
+			k[i] = 50
+		} else {
+			k[i] = (candles[i].Close - low) / (high - low) * 100
+		}
+	}
+
+	d = nanSeries(len(candles))
+	if signal < 1 || len(candles) < period-1+signal {
+		return k, d
+	}
+	sum := 0.0
+	for i := period - 1; i < len(candles); i++ {
+		sum += k[i]
+		if i >= period-1+signal {
+			sum -= k[i-signal]
+		}
+		if i >= period-2+signal {
+			d[i] = sum / float64(signal)
+		}
+	}
+	return k, d
+}
+
+func nanSeries(n int) []float64 {
+	out := make([]float64, n)
+	for i := range out {
+		out[i] = math.NaN()
+	}
+	return out
+}
+
+// Point is an indicator value at a candle's start time
+type Point struct {
+	Time  int64   `json:"time"`
+	Value float64 `json:"value"`
+}
+
+// Points pairs series with the candle times, skipping the warm-up values
+// and anything before index from.
+func Points(candles []models.Candle, series []float64, from int) []Point {
+	points := make([]Point, 0, len(series))
+	for i := from; i < len(series) && i < len(candles); i++ {
+		if i < 0 || math.IsNaN(series[i]) {
+			continue
+		}
+		points = append(points, Point{Time: candles[i].Epoch, Value: series[i]})
+	}
+	return points
+}
+
+// ParseSpec reads the short form used in query strings: the indicator name
+// followed by its parameters, separated by colons, in the order period
+// (fast, slow and signal for macd), then std_dev for bollinger or signal for
+// stochastic. For example "rsi:14", "macd:12:26:9", "bollinger:20:2".
+func ParseSpec(s string) (models.IndicatorSpec, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	spec := models.IndicatorSpec{Name: parts[0]}
+
+	params := make([]float64, 0, len(parts)-1)
+	for _, p := range parts[1:] {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return spec, fmt.Errorf("invalid parameter %q for %s", p, parts[0])
+		}
+		params = append(params, v)
+	}
+	param := func(i int) float64 {
+		if i < len(params) {
+			return params[i]
+		}
+		return 0
+	}
+
+	switch strings.ToLower(spec.Name) {
+	case "macd":
+		spec.Fast, spec.Slow, spec.Signal = int(param(0)), int(param(1)), int(param(2))
+	case "bollinger":
+		spec.Period, spec.StdDev = int(param(0)), param(1)
+	case "stochastic":
+		spec.Period, spec.Signal = int(param(0)), int(param(1))
+	default:
+		spec.Period = int(param(0))
+	}
+	if err := spec.Normalize(); err != nil {
+		return spec, err
+	}
+	return spec, nil
+}
+
+// ParseSpecs parses a comma separated list of specs, e.g. "rsi:14,sma:50"
+func ParseSpecs(list string) ([]models.IndicatorSpec, error) {
+	var specs []models.IndicatorSpec
+	for _, s := range strings.Split(list, ",") {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		spec, err := ParseSpec(s)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// MaxLookback is the largest Lookback of specs
+func MaxLookback(specs []models.IndicatorSpec) int {
+	n := 0
+	for _, spec := range specs {
+		if l := spec.Lookback(); l > n {
+			n = l
+		}
+	}
+	return n
+}
@@ -0,0 +1,85 @@
+package indicators
+
+import (
+	"math"
+
+	"github.com/keyadaniel56/algocdk/internal/models"
+)
+
+// Stream keeps a rolling window of candles for one symbol and recomputes
+// indicator values as ticks arrive. The last candle is the one still
+// forming, so values move with every tick. Stream is not safe for
+// concurrent use.
+type Stream struct {
+	Granularity int
+	Specs       []models.IndicatorSpec
+
+	candles []models.Candle
+	size    int
+}
+
+// NewStream creates a stream over candles of granularity seconds, seeded
+// with history. Specs must already be normalized.
+func NewStream(granularity int, specs []models.IndicatorSpec, history []models.Candle) *Stream {
+	s := &Stream{Granularity: granularity, Specs: specs, size: MaxLookback(specs) + 1}
+	s.candles = append(s.candles, history...)
+	s.trim()
+	return s
+}
+
+// Update folds a tick into the current candle, opening a new one when the
+// tick starts a new period, and returns the latest value of every spec by
+// key and output. Outputs without enough history are left out.
+func (s *Stream) Update(epoch int64, quote float64) map[string]map[string]float64 {
+	bucket := epoch
+	if s.Granularity > 0 {
+		bucket = epoch / int64(s.Granularity) * int64(s.Granularity)
+	}
+
+	n := len(s.candles)
+	switch {
+	case n > 0 && s.candles[n-1].Epoch == bucket:
+		c := &s.candles[n-1]
+		c.High = math.Max(c.High, quote)
+		c.Low = math.Min(c.Low, quote)
+		c.Close = quote
+	case n == 0 || bucket > s.candles[n-1].Epoch:
+		s.candles = append(s.candles, models.Candle{
+			Granularity: s.Granularity,
+			Epoch:       bucket,
+			Open:        quote,
+			High:        quote,
+			Low:         quote,
+			Close:       quote,
+		})
+		s.trim()
+	}
+
+	return s.Latest()
+}
+
+// Latest returns the values at the most recent candle
+func (s *Stream) Latest() map[string]map[string]float64 {
+	values := make(map[string]map[string]float64, len(s.Specs))
+	for _, spec := range s.Specs {
+		lines, err := Compute(spec, s.candles)
+		if err != nil {
+			continue
+		}
+		latest := map[string]float64{}
+		for output, series := range lines {
+			if len(series) == 0 || math.IsNaN(series[len(series)-1]) {
+				continue
+			}
+			latest[output] = series[len(series)-1]
+		}
+		values[spec.Key()] = latest
+	}
+	return values
+}
+
+func (s *Stream) trim() {
+	if extra := len(s.candles) - s.size; extra > 0 {
+		s.candles = append(s.candles[:0], s.candles[extra:]...)
+	}
+}
@@ -15,6 +15,7 @@ type Admin struct {
 	AccountNumber          string     `json:"account_number"`
 	AccountName            string     `json:"account_name"`
 	PaystackSubaccountCode string     `json:"paystack_subaccount_code"`
+	PaystackRecipientCode  string     `json:"paystack_recipient_code"` // transfer recipient for withdrawals
 	KYCStatus              string     `gorm:"default:unverified" json:"kyc_status"`
 	VerifiedAt             *time.Time `json:"verified_at"`
 
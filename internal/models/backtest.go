@@ -0,0 +1,50 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// BacktestReport is the result of running a bot's strategy definition over
+// stored market data
+type BacktestReport struct {
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	BotID       uint   `json:"bot_id" gorm:"index"`
+	RequestedBy uint   `json:"requested_by"`
+	Status      string `json:"status"` // "running", "completed" or "failed"
+	Error       string `json:"error,omitempty"`
+
+	Symbol         string  `json:"symbol"`
+	Timeframe      string  `json:"timeframe"`
+	StartEpoch     int64   `json:"start_epoch"`
+	EndEpoch       int64   `json:"end_epoch"`
+	TicksUsed      int     `json:"ticks_used"`
+	InitialBalance float64 `json:"initial_balance"`
+	FinalBalance   float64 `json:"final_balance"`
+
+	Trades            int     `json:"trades"`
+	Wins              int     `json:"wins"`
+	Losses            int     `json:"losses"`
+	WinRate           float64 `json:"win_rate"` // percent
+	NetProfit         float64 `json:"net_profit"`
+	TotalStaked       float64 `json:"total_staked"`
+	ProfitFactor      float64 `json:"profit_factor"`
+	MaxDrawdown       float64 `json:"max_drawdown"`
+	MaxDrawdownPct    float64 `json:"max_drawdown_pct"`
+	LongestWinStreak  int     `json:"longest_win_streak"`
+	LongestLossStreak int     `json:"longest_loss_streak"`
+
+	// Strategy is the definition that was run; EquityCurve holds
+	// [{"epoch":..., "balance":...}] points after each settled contract.
+	Strategy    json.RawMessage `json:"strategy,omitempty" gorm:"type:text"`
+	EquityCurve json.RawMessage `json:"equity_curve,omitempty" gorm:"type:text"`
+
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// EquityPoint is one point of a backtest P&L curve
+type EquityPoint struct {
+	Epoch   int64   `json:"epoch"`
+	Balance float64 `json:"balance"`
+}
@@ -49,4 +49,19 @@ type Bot struct {
 	Description string `json:"description"`
 	Category    string `json:"category"`
 	Version     string `json:"version"`
+
+	// StrategyDefinition is the JSON StrategyDefinition used for backtests
+	StrategyDefinition string `json:"strategy_definition,omitempty" gorm:"type:text"`
+	LatestBacktestID   *uint  `json:"latest_backtest_id,omitempty"`
+
+	// CopyTrading makes renting the bot also subscribe the renter to the
+	// owner's live trades
+	CopyTrading bool `json:"copy_trading"`
+
+	// Purchases sell licenses and the owner keeps the bot. MaxLicenses caps
+	// them (0 is unlimited), ExclusiveSale instead hands the bot itself to
+	// the one buyer, and ResaleAllowed lets licensees resell their license.
+	MaxLicenses   int  `json:"max_licenses"`
+	ExclusiveSale bool `json:"exclusive_sale"`
+	ResaleAllowed bool `json:"resale_allowed"`
 }
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// BotRun is a bot executed on the server for one of its users. The bot's
+// strategy definition is evaluated against live ticks and contracts are
+// bought on the user's Deriv account (or paper balance) until the run is
+// stopped or the user's access to the bot ends.
+type BotRun struct {
+	ID        uint   `json:"id" gorm:"primaryKey"`
+	UserID    uint   `json:"user_id" gorm:"index"`
+	BotID     uint   `json:"bot_id" gorm:"index"`
+	UserBotID uint   `json:"user_bot_id"`
+	Mode      string `json:"mode"`   // "live" or "paper"
+	Status    string `json:"status"` // "running", "paused", "stopped", "expired" or "failed"
+
+	StopReason string `json:"stop_reason,omitempty"`
+
+	Trades    int     `json:"trades"`
+	Wins      int     `json:"wins"`
+	Losses    int     `json:"losses"`
+	NetProfit float64 `json:"net_profit"`
+
+	// Sizing state, so martingale sequences continue after a restart
+	LastStake float64 `json:"last_stake"`
+	LastWon   bool    `json:"last_won"`
+
+	// OpenTradeID is the Trade (live) or PaperTrade (paper) the run is
+	// waiting on; no new contract is bought while it is open.
+	OpenTradeID *uint `json:"open_trade_id,omitempty"`
+
+	StartedAt time.Time  `json:"started_at"`
+	StoppedAt *time.Time `json:"stopped_at,omitempty"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// BotRunLog is an entry in a bot run's activity log
+type BotRunLog struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	RunID     uint      `json:"run_id" gorm:"index"`
+	Level     string    `json:"level"` // "info", "trade" or "error"
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// Candle is a cached OHLC bar. Epoch is the start of the bar and
+// Granularity its length in seconds.
+type Candle struct {
+	ID          uint      `json:"-" gorm:"primaryKey"`
+	Symbol      string    `json:"-" gorm:"uniqueIndex:idx_candle_key;size:32"`
+	Granularity int       `json:"-" gorm:"uniqueIndex:idx_candle_key"`
+	Epoch       int64     `json:"time" gorm:"uniqueIndex:idx_candle_key"`
+	Open        float64   `json:"open"`
+	High        float64   `json:"high"`
+	Low         float64   `json:"low"`
+	Close       float64   `json:"close"`
+	CreatedAt   time.Time `json:"-"`
+}
+
+// TickRecord is a stored market tick, used to build candles locally
+type TickRecord struct {
+	ID     uint    `json:"-" gorm:"primaryKey"`
+	Symbol string  `json:"symbol" gorm:"uniqueIndex:idx_tick_key;size:32"`
+	Epoch  int64   `json:"epoch" gorm:"uniqueIndex:idx_tick_key"`
+	Quote  float64 `json:"quote"`
+	Bid    float64 `json:"bid,omitempty"`
+	Ask    float64 `json:"ask,omitempty"`
+}
+
+// CandleCoverage records a closed range [StartEpoch, EndEpoch] for which every
+// candle of Granularity (or every tick, when Granularity is 0) of Symbol is
+// stored locally, so the range can be served without asking Deriv.
+type CandleCoverage struct {
+	ID          uint   `gorm:"primaryKey"`
+	Symbol      string `gorm:"index:idx_coverage_key;size:32"`
+	Granularity int    `gorm:"index:idx_coverage_key"`
+	StartEpoch  int64
+	EndEpoch    int64
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// CommissionRule sets the platform's share of bot purchases and rentals.
+// Rules are scoped globally, to admins by sales volume (a tier), to one
+// admin or to one bot, and can be time-boxed as promotions.
+type CommissionRule struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	Name           string     `json:"name"`
+	Scope          string     `json:"scope" gorm:"index"`         // "global", "tier", "admin" or "bot"
+	PaymentType    string     `json:"payment_type"`               // "purchase", "rent", "resale", or "" for purchases and rentals
+	AdminID        *uint      `json:"admin_id,omitempty"`         // for scope "admin"
+	BotID          *uint      `json:"bot_id,omitempty"`           // for scope "bot"
+	MinSalesVolume float64    `json:"min_sales_volume,omitempty"` // for scope "tier": the admin's sales over the last 30 days
+	Rate           float64    `json:"rate"`                       // platform share, 0.25 for 25%
+	StartsAt       *time.Time `json:"starts_at,omitempty"`        // a promotion starts...
+	EndsAt         *time.Time `json:"ends_at,omitempty"`          // ...and ends
+	Active         bool       `json:"active"`
+	CreatedBy      uint       `json:"created_by"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
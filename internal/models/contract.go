@@ -0,0 +1,313 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DerivContractRequest describes a Deriv contract to price or buy. It covers
+// rise/fall, higher/lower, touch, range, digit, multiplier and accumulator
+// contracts; Validate checks the combination before anything is sent to Deriv.
+type DerivContractRequest struct {
+	Symbol       string  `json:"symbol"`
+	ContractType string  `json:"trade_type"` // e.g. "CALL", "DIGITOVER", "MULTUP", "ACCU"
+	Amount       float64 `json:"amount"`
+	Basis        string  `json:"basis,omitempty"`         // "stake" (default) or "payout"
+	Currency     string  `json:"currency,omitempty"`      // defaults to the account currency
+	Duration     int     `json:"duration,omitempty"`      // not used by multipliers and accumulators
+	DurationUnit string  `json:"duration_unit,omitempty"` // "t", "s", "m", "h" or "d"; defaults to ticks
+
+	// Barrier and Barrier2 are absolute prices ("1234.5") or offsets from
+	// the entry spot ("+0.25", "-0.3")
+	Barrier  string `json:"barrier,omitempty"`
+	Barrier2 string `json:"barrier2,omitempty"`
+
+	// Prediction is the last-digit prediction for digit contracts
+	Prediction *int `json:"prediction,omitempty"`
+
+	Multiplier float64 `json:"multiplier,omitempty"`
+	StopLoss   float64 `json:"stop_loss,omitempty"`
+	TakeProfit float64 `json:"take_profit,omitempty"`
+
+	// GrowthRate is the accumulator growth rate, 0.01 to 0.05
+	GrowthRate float64 `json:"growth_rate,omitempty"`
+
+	BotID uint `json:"bot_id,omitempty"`
+}
+
+// DerivTradeRequest is the body of the trade endpoint: either a full
+// contract to buy at market, or the ID of a proposal previously quoted by
+// the proposal endpoint together with the highest price the user accepts.
+// Mode overrides the user's trading mode for this request.
+type DerivTradeRequest struct {
+	DerivContractRequest
+	ProposalID string  `json:"proposal_id,omitempty"`
+	MaxPrice   float64 `json:"max_price,omitempty"`
+	Mode       string  `json:"mode,omitempty"` // "live" or "paper"
+}
+
+// DerivProposal is a price quote for a contract that can be bought by ID
+type DerivProposal struct {
+	ProposalID string               `json:"proposal_id"`
+	AskPrice   float64              `json:"ask_price"`
+	Payout     float64              `json:"payout"`
+	Spot       float64              `json:"spot"`
+	SpotTime   int64                `json:"spot_time"`
+	DateStart  int64                `json:"date_start"`
+	Longcode   string               `json:"longcode"`
+	Currency   string               `json:"currency"`
+	Contract   DerivContractRequest `json:"contract"`
+}
+
+type contractKind int
+
+const (
+	kindOptions contractKind = iota
+	kindDigits
+	kindMultiplier
+	kindAccumulator
+)
+
+type contractSpec struct {
+	kind      contractKind
+	barriers  int  // barriers required
+	optional  bool // a single barrier may be given but is not required
+	needDigit bool
+	minDigit  int
+	maxDigit  int
+	ticksOnly bool
+	minTicks  int
+	maxTicks  int
+}
+
+var contractSpecs = map[string]contractSpec{
+	// Rise/Fall, or Higher/Lower when a barrier is given
+	"CALL":  {kind: kindOptions, optional: true},
+	"PUT":   {kind: kindOptions, optional: true},
+	"CALLE": {kind: kindOptions},
+	"PUTE":  {kind: kindOptions},
+
+	// Touch/No Touch
+	"ONETOUCH": {kind: kindOptions, barriers: 1},
+	"NOTOUCH":  {kind: kindOptions, barriers: 1},
+
+	// Ends Between/Outside, Stays Between/Goes Outside
+	"EXPIRYRANGE": {kind: kindOptions, barriers: 2},
+	"EXPIRYMISS":  {kind: kindOptions, barriers: 2},
+	"RANGE":       {kind: kindOptions, barriers: 2},
+	"UPORDOWN":    {kind: kindOptions, barriers: 2},
+
+	// Asians
+	"ASIANU": {kind: kindOptions, ticksOnly: true, minTicks: 5, maxTicks: 10},
+	"ASIAND": {kind: kindOptions, ticksOnly: true, minTicks: 5, maxTicks: 10},
+
+	// Digits
+	"DIGITMATCH": {kind: kindDigits, needDigit: true, minDigit: 0, maxDigit: 9, ticksOnly: true, minTicks: 1, maxTicks: 10},
+	"DIGITDIFF":  {kind: kindDigits, needDigit: true, minDigit: 0, maxDigit: 9, ticksOnly: true, minTicks: 1, maxTicks: 10},
+	"DIGITOVER":  {kind: kindDigits, needDigit: true, minDigit: 0, maxDigit: 8, ticksOnly: true, minTicks: 1, maxTicks: 10},
+	"DIGITUNDER": {kind: kindDigits, needDigit: true, minDigit: 1, maxDigit: 9, ticksOnly: true, minTicks: 1, maxTicks: 10},
+	"DIGITEVEN":  {kind: kindDigits, ticksOnly: true, minTicks: 1, maxTicks: 10},
+	"DIGITODD":   {kind: kindDigits, ticksOnly: true, minTicks: 1, maxTicks: 10},
+
+	// Multipliers and accumulators
+	"MULTUP":   {kind: kindMultiplier},
+	"MULTDOWN": {kind: kindMultiplier},
+	"ACCU":     {kind: kindAccumulator},
+}
+
+var validDurationUnits = map[string]bool{"t": true, "s": true, "m": true, "h": true, "d": true}
+
+var validGrowthRates = map[float64]bool{0.01: true, 0.02: true, 0.03: true, 0.04: true, 0.05: true}
+
+// Normalize fills in defaults and canonical casing. It is called by Validate.
+func (r *DerivContractRequest) Normalize() {
+	r.Symbol = strings.TrimSpace(r.Symbol)
+	r.ContractType = strings.ToUpper(strings.TrimSpace(r.ContractType))
+	r.Basis = strings.ToLower(strings.TrimSpace(r.Basis))
+	r.Currency = strings.ToUpper(strings.TrimSpace(r.Currency))
+	r.DurationUnit = strings.ToLower(strings.TrimSpace(r.DurationUnit))
+	r.Barrier = strings.TrimSpace(r.Barrier)
+	r.Barrier2 = strings.TrimSpace(r.Barrier2)
+
+	if r.Basis == "" {
+		r.Basis = "stake"
+	}
+	if r.DurationUnit == "" {
+		r.DurationUnit = "t"
+	}
+}
+
+// Validate normalizes the request and checks that its parameters make sense
+// for the chosen contract type.
+func (r *DerivContractRequest) Validate() error {
+	r.Normalize()
+
+	spec, ok := contractSpecs[r.ContractType]
+	if !ok {
+		return fmt.Errorf("unsupported trade_type %q", r.ContractType)
+	}
+	if r.Symbol == "" {
+		return errors.New("symbol is required")
+	}
+	if r.Amount <= 0 {
+		return errors.New("amount must be greater than zero")
+	}
+	if r.Basis != "stake" && r.Basis != "payout" {
+		return errors.New("basis must be 'stake' or 'payout'")
+	}
+	if r.Currency != "" && len(r.Currency) != 3 && len(r.Currency) != 4 {
+		return fmt.Errorf("invalid currency %q", r.Currency)
+	}
+
+	switch spec.kind {
+	case kindMultiplier:
+		if r.Basis != "stake" {
+			return errors.New("multiplier contracts only support basis 'stake'")
+		}
+		if r.Multiplier <= 0 {
+			return errors.New("multiplier is required for multiplier contracts")
+		}
+		if r.StopLoss < 0 || r.TakeProfit < 0 {
+			return errors.New("stop_loss and take_profit must not be negative")
+		}
+		if r.Duration != 0 || r.Barrier != "" || r.Prediction != nil || r.GrowthRate != 0 {
+			return errors.New("multiplier contracts do not take duration, barrier, prediction or growth_rate")
+		}
+		return nil
+
+	case kindAccumulator:
+		if r.Basis != "stake" {
+			return errors.New("accumulator contracts only support basis 'stake'")
+		}
+		if !validGrowthRates[r.GrowthRate] {
+			return errors.New("growth_rate must be one of 0.01, 0.02, 0.03, 0.04 or 0.05")
+		}
+		if r.TakeProfit < 0 {
+			return errors.New("take_profit must not be negative")
+		}
+		if r.StopLoss != 0 {
+			return errors.New("accumulator contracts do not support stop_loss")
+		}
+		if r.Duration != 0 || r.Barrier != "" || r.Prediction != nil || r.Multiplier != 0 {
+			return errors.New("accumulator contracts do not take duration, barrier, prediction or multiplier")
+		}
+		return nil
+	}
+
+	if r.Multiplier != 0 || r.GrowthRate != 0 || r.StopLoss != 0 || r.TakeProfit != 0 {
+		return fmt.Errorf("%s does not take multiplier, growth_rate, stop_loss or take_profit", r.ContractType)
+	}
+	if r.Duration <= 0 {
+		return errors.New("duration must be greater than zero")
+	}
+	if !validDurationUnits[r.DurationUnit] {
+		return errors.New("duration_unit must be one of t, s, m, h, d")
+	}
+	if spec.ticksOnly {
+		if r.DurationUnit != "t" {
+			return fmt.Errorf("%s contracts must use tick durations", r.ContractType)
+		}
+		if r.Duration < spec.minTicks || r.Duration > spec.maxTicks {
+			return fmt.Errorf("%s duration must be between %d and %d ticks", r.ContractType, spec.minTicks, spec.maxTicks)
+		}
+	}
+
+	if spec.needDigit {
+		if r.Prediction == nil {
+			return fmt.Errorf("prediction is required for %s", r.ContractType)
+		}
+		if *r.Prediction < spec.minDigit || *r.Prediction > spec.maxDigit {
+			return fmt.Errorf("prediction for %s must be between %d and %d", r.ContractType, spec.minDigit, spec.maxDigit)
+		}
+	} else if r.Prediction != nil {
+		return fmt.Errorf("%s does not take a prediction", r.ContractType)
+	}
+
+	switch {
+	case spec.barriers == 2:
+		if r.Barrier == "" || r.Barrier2 == "" {
+			return fmt.Errorf("%s requires barrier and barrier2", r.ContractType)
+		}
+	case spec.barriers == 1:
+		if r.Barrier == "" || r.Barrier2 != "" {
+			return fmt.Errorf("%s requires exactly one barrier", r.ContractType)
+		}
+	case spec.optional:
+		if r.Barrier2 != "" {
+			return fmt.Errorf("%s takes at most one barrier", r.ContractType)
+		}
+	default:
+		if r.Barrier != "" || r.Barrier2 != "" {
+			return fmt.Errorf("%s does not take barriers", r.ContractType)
+		}
+	}
+
+	return nil
+}
+
+// HasFixedExpiry reports whether the contract settles at a fixed expiry
+// (options and digits) rather than running until it is closed
+// (multipliers and accumulators).
+func (r *DerivContractRequest) HasFixedExpiry() bool {
+	spec, ok := contractSpecs[strings.ToUpper(r.ContractType)]
+	return ok && (spec.kind == kindOptions || spec.kind == kindDigits)
+}
+
+// Parameters builds the Deriv "parameters"/"proposal" object for the
+// request. currency is used when the request does not name one.
+func (r *DerivContractRequest) Parameters(currency string) map[string]interface{} {
+	if r.Currency != "" {
+		currency = r.Currency
+	}
+
+	params := map[string]interface{}{
+		"contract_type": r.ContractType,
+		"symbol":        r.Symbol,
+		"amount":        r.Amount,
+		"basis":         r.Basis,
+		"currency":      currency,
+	}
+
+	switch contractSpecs[r.ContractType].kind {
+	case kindMultiplier:
+		params["multiplier"] = r.Multiplier
+		if limits := r.limitOrder(); limits != nil {
+			params["limit_order"] = limits
+		}
+		return params
+	case kindAccumulator:
+		params["growth_rate"] = r.GrowthRate
+		if limits := r.limitOrder(); limits != nil {
+			params["limit_order"] = limits
+		}
+		return params
+	}
+
+	params["duration"] = r.Duration
+	params["duration_unit"] = r.DurationUnit
+	if r.Prediction != nil {
+		params["barrier"] = fmt.Sprintf("%d", *r.Prediction)
+	}
+	if r.Barrier != "" {
+		params["barrier"] = r.Barrier
+	}
+	if r.Barrier2 != "" {
+		params["barrier2"] = r.Barrier2
+	}
+	return params
+}
+
+func (r *DerivContractRequest) limitOrder() map[string]interface{} {
+	limits := map[string]interface{}{}
+	if r.StopLoss > 0 {
+		limits["stop_loss"] = r.StopLoss
+	}
+	if r.TakeProfit > 0 {
+		limits["take_profit"] = r.TakeProfit
+	}
+	if len(limits) == 0 {
+		return nil
+	}
+	return limits
+}
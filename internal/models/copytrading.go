@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// CopySubscription is a follower mirroring a leader's live Deriv trades.
+// Access is paid for by renting one of the leader's copy-trading bots (BotID);
+// the subscription lapses with that rental.
+type CopySubscription struct {
+	ID         uint `json:"id" gorm:"primaryKey"`
+	FollowerID uint `json:"follower_id" gorm:"uniqueIndex:idx_copy_subscription"`
+	LeaderID   uint `json:"leader_id" gorm:"uniqueIndex:idx_copy_subscription;index"`
+	BotID      uint `json:"bot_id"`
+
+	// StakeMode is "multiplier" (StakeValue times the leader's stake) or
+	// "fixed" (StakeValue per trade)
+	StakeMode  string  `json:"stake_mode"`
+	StakeValue float64 `json:"stake_value"`
+	MaxStake   float64 `json:"max_stake"` // per-trade cap for this follower, 0 means none
+
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CopyTrade links a follower's copy of a trade to the leader's source trade
+type CopyTrade struct {
+	ID              uint    `json:"id" gorm:"primaryKey"`
+	SubscriptionID  uint    `json:"subscription_id" gorm:"index"`
+	LeaderID        uint    `json:"leader_id"`
+	FollowerID      uint    `json:"follower_id" gorm:"index"`
+	SourceTradeID   uint    `json:"source_trade_id" gorm:"index"`
+	FollowerTradeID *uint   `json:"follower_trade_id,omitempty"`
+	Stake           float64 `json:"stake"`
+	Status          string  `json:"status"` // "placed", "blocked", "failed" or "skipped"
+	Error           string  `json:"error,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// ExchangeRate converts the base currency prices are set in into another
+// currency users can pay in
+type ExchangeRate struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Currency  string    `json:"currency" gorm:"uniqueIndex"` // ISO 4217 code, e.g. "NGN"
+	Rate      float64   `json:"rate"`                        // units of Currency per unit of the base currency
+	UpdatedBy uint      `json:"updated_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BotPrice is a bot's fixed price in one currency, charged instead of
+// converting its base price
+type BotPrice struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	BotID        uint      `json:"bot_id" gorm:"uniqueIndex:idx_bot_price"`
+	PaymentType  string    `json:"payment_type" gorm:"uniqueIndex:idx_bot_price"`   // "purchase" or "rent"
+	RentalPlanID uint      `json:"rental_plan_id" gorm:"uniqueIndex:idx_bot_price"` // the plan a rent price is for, 0 for the default plan
+	Currency     string    `json:"currency" gorm:"uniqueIndex:idx_bot_price"`
+	Amount       float64   `json:"amount"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
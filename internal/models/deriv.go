@@ -4,23 +4,79 @@ import "time"
 
 // DerivTradeResult represents the result of a trade placement
 type DerivTradeResult struct {
-	ContractID string  `json:"contract_id"`
-	Payout     float64 `json:"payout"`
-	Status     string  `json:"status"`
+	ContractID    string    `json:"contract_id"`
+	TransactionID string    `json:"transaction_id"`
+	BuyPrice      float64   `json:"buy_price"`
+	Payout        float64   `json:"payout"`
+	BalanceAfter  float64   `json:"balance_after"`
+	Longcode      string    `json:"longcode"`
+	PurchaseTime  time.Time `json:"purchase_time"`
+	Status        string    `json:"status"`
+}
+
+// DerivOpenContract is the proposal_open_contract payload describing the
+// current state of a bought contract
+type DerivOpenContract struct {
+	ContractID   int64   `json:"contract_id"`
+	ContractType string  `json:"contract_type"`
+	Underlying   string  `json:"underlying"`
+	Currency     string  `json:"currency"`
+	BuyPrice     float64 `json:"buy_price"`
+	Payout       float64 `json:"payout"`
+	BidPrice     float64 `json:"bid_price"`
+	Profit       float64 `json:"profit"`
+	SellPrice    float64 `json:"sell_price"`
+	SellTime     int64   `json:"sell_time"`
+	DateStart    int64   `json:"date_start"`
+	DateExpiry   int64   `json:"date_expiry"`
+	EntrySpot    float64 `json:"entry_spot"`
+	ExitTickTime int64   `json:"exit_tick_time"`
+	Status       string  `json:"status"` // "open", "won", "lost", "sold"
+	IsSold       int     `json:"is_sold"`
+	IsExpired    int     `json:"is_expired"`
+}
+
+// IsSettled reports whether the contract has reached a final outcome
+func (c DerivOpenContract) IsSettled() bool {
+	return c.IsSold == 1 || c.Status == "won" || c.Status == "lost" || c.Status == "sold"
+}
+
+// Outcome maps the contract's final state onto a Trade status
+func (c DerivOpenContract) Outcome() string {
+	switch c.Status {
+	case "won", "lost":
+		return c.Status
+	}
+	if c.Profit > 0 {
+		return "won"
+	}
+	return "lost"
 }
 
 // DerivCredentials stores Deriv API token with account type
 type DerivCredentials struct {
 	ID          uint      `json:"id" gorm:"primaryKey"`
 	UserID      uint      `json:"user_id" gorm:"not null;index"`
-	APIToken    string    `json:"api_token" gorm:"type:text;not null"`
+	APIToken    string    `json:"-" gorm:"type:text;not null"`           // sealed, see secrets.Seal
+	KeyID       string    `json:"key_id,omitempty" gorm:"size:32;index"` // "" while stored in plaintext
+	TokenHint   string    `json:"token_hint" gorm:"size:100"`            // masked token for display
 	LoginID     string    `json:"loginid" gorm:"size:50"`
 	AccountType string    `json:"account_type" gorm:"size:10;default:'demo'"`
+	Currency    string    `json:"currency" gorm:"size:10"`
 	IsActive    bool      `json:"is_active" gorm:"default:true;index"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
+// DerivOAuthState ties a Deriv OAuth redirect back to the user who started it
+type DerivOAuthState struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	State     string    `json:"-" gorm:"size:64;uniqueIndex"`
+	UserID    uint      `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 // DerivUserInfo contains user account information
 type DerivUserInfo struct {
 	LoginID        string  `json:"loginid"`
@@ -99,17 +155,56 @@ type DerivWSResponse struct {
 		Accounts []DerivAccount `json:"account_list"`
 	} `json:"account_list"`
 	Buy struct {
-		ContractID string  `json:"contract_id"`
-		Payout     float64 `json:"payout"`
-		Status     string  `json:"status"`
+		BalanceAfter  float64 `json:"balance_after"`
+		BuyPrice      float64 `json:"buy_price"`
+		ContractID    int64   `json:"contract_id"`
+		Longcode      string  `json:"longcode"`
+		Payout        float64 `json:"payout"`
+		PurchaseTime  int64   `json:"purchase_time"`
+		ShortCode     string  `json:"shortcode"`
+		TransactionID int64   `json:"transaction_id"`
 	} `json:"buy"`
-	Error struct {
+	Proposal struct {
+		ID        string  `json:"id"`
+		AskPrice  float64 `json:"ask_price"`
+		Payout    float64 `json:"payout"`
+		Spot      float64 `json:"spot"`
+		SpotTime  int64   `json:"spot_time"`
+		DateStart int64   `json:"date_start"`
+		Longcode  string  `json:"longcode"`
+	} `json:"proposal"`
+	ProposalOpenContract DerivOpenContract `json:"proposal_open_contract"`
+	History              struct {
+		Prices []float64 `json:"prices"`
+		Times  []int64   `json:"times"`
+	} `json:"history"`
+	PipSize float64 `json:"pip_size"`
+	Tick    struct {
+		Ask     float64 `json:"ask"`
+		Bid     float64 `json:"bid"`
+		Epoch   int64   `json:"epoch"`
+		ID      string  `json:"id"`
+		PipSize float64 `json:"pip_size"`
+		Quote   float64 `json:"quote"`
+		Symbol  string  `json:"symbol"`
+	} `json:"tick"`
+	Candles []DerivCandle `json:"candles"`
+	Error   struct {
 		Code    string `json:"code"`
 		Message string `json:"message"`
 	} `json:"error"`
 	MsgType string `json:"msg_type"`
 }
 
+// DerivCandle is one OHLC bar as returned by ticks_history with style candles
+type DerivCandle struct {
+	Epoch int64   `json:"epoch"`
+	Open  float64 `json:"open"`
+	High  float64 `json:"high"`
+	Low   float64 `json:"low"`
+	Close float64 `json:"close"`
+}
+
 func (DerivCredentials) TableName() string {
 	return "deriv_credentials"
 }
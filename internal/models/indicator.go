@@ -0,0 +1,120 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// IndicatorSpec selects a technical indicator and its parameters. Unset
+// parameters take the usual defaults, e.g. RSI(14) or MACD(12, 26, 9).
+type IndicatorSpec struct {
+	Name   string  `json:"name"` // sma, ema, rsi, macd, bollinger, atr or stochastic
+	Period int     `json:"period,omitempty"`
+	Fast   int     `json:"fast,omitempty"`    // macd
+	Slow   int     `json:"slow,omitempty"`    // macd
+	Signal int     `json:"signal,omitempty"`  // macd signal line, stochastic %D
+	StdDev float64 `json:"std_dev,omitempty"` // bollinger band width
+
+	// Output picks the line of multi-line indicators: macd, signal or
+	// histogram for MACD, upper, middle or lower for Bollinger bands and k or
+	// d for the stochastic. Empty means the first one.
+	Output string `json:"output,omitempty"`
+}
+
+// IndicatorOutputs lists the lines each indicator produces, main line first
+var IndicatorOutputs = map[string][]string{
+	"sma":        {"value"},
+	"ema":        {"value"},
+	"rsi":        {"value"},
+	"atr":        {"value"},
+	"macd":       {"macd", "signal", "histogram"},
+	"bollinger":  {"middle", "upper", "lower"},
+	"stochastic": {"k", "d"},
+}
+
+// Normalize fills in default parameters and checks the spec
+func (s *IndicatorSpec) Normalize() error {
+	s.Name = strings.ToLower(strings.TrimSpace(s.Name))
+	s.Output = strings.ToLower(strings.TrimSpace(s.Output))
+
+	outputs, ok := IndicatorOutputs[s.Name]
+	if !ok {
+		return fmt.Errorf("unsupported indicator %q", s.Name)
+	}
+	if s.Output == "" {
+		s.Output = outputs[0]
+	}
+	valid := false
+	for _, o := range outputs {
+		valid = valid || o == s.Output
+	}
+	if !valid {
+		return fmt.Errorf("%s has no output %q", s.Name, s.Output)
+	}
+
+	switch s.Name {
+	case "sma", "ema", "bollinger":
+		setDefault(&s.Period, 20)
+	case "rsi", "atr":
+		setDefault(&s.Period, 14)
+	case "stochastic":
+		setDefault(&s.Period, 14)
+		setDefault(&s.Signal, 3)
+	case "macd":
+		setDefault(&s.Fast, 12)
+		setDefault(&s.Slow, 26)
+		setDefault(&s.Signal, 9)
+		if s.Fast >= s.Slow {
+			return fmt.Errorf("macd fast period must be shorter than the slow one")
+		}
+	}
+	if s.Name == "bollinger" && s.StdDev == 0 {
+		s.StdDev = 2
+	}
+
+	if s.Period < 0 || s.Fast < 0 || s.Slow < 0 || s.Signal < 0 || s.StdDev < 0 {
+		return fmt.Errorf("%s parameters must not be negative", s.Name)
+	}
+	if s.Period > 1000 || s.Slow > 1000 || s.Signal > 1000 {
+		return fmt.Errorf("%s periods must be at most 1000", s.Name)
+	}
+	return nil
+}
+
+// Key identifies the spec in API responses, e.g. "rsi(14)" or "macd(12,26,9)"
+func (s IndicatorSpec) Key() string {
+	var params []string
+	switch s.Name {
+	case "macd":
+		params = []string{strconv.Itoa(s.Fast), strconv.Itoa(s.Slow), strconv.Itoa(s.Signal)}
+	case "bollinger":
+		params = []string{strconv.Itoa(s.Period), strconv.FormatFloat(s.StdDev, 'f', -1, 64)}
+	case "stochastic":
+		params = []string{strconv.Itoa(s.Period), strconv.Itoa(s.Signal)}
+	default:
+		params = []string{strconv.Itoa(s.Period)}
+	}
+	return s.Name + "(" + strings.Join(params, ",") + ")"
+}
+
+// Lookback is roughly how many bars the indicator needs before its values
+// settle. Exponential averages depend on all history, so a few periods
+// are asked for.
+func (s IndicatorSpec) Lookback() int {
+	switch s.Name {
+	case "sma", "bollinger":
+		return s.Period
+	case "stochastic":
+		return s.Period + s.Signal
+	case "macd":
+		return 3*s.Slow + s.Signal
+	}
+	return 3 * s.Period
+}
+
+func setDefault(v *int, def int) {
+	if *v == 0 {
+		*v = def
+	}
+}
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// LedgerEntry is one leg of a double-entry journal. The legs sharing a
+// JournalID debit and credit the same total.
+type LedgerEntry struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	JournalID     string    `json:"journal_id" gorm:"uniqueIndex:idx_ledger_journal_account"`
+	Account       string    `json:"account" gorm:"uniqueIndex:idx_ledger_journal_account;index"` // "processor", "revenue", "payouts", "refunds", "admin:<id>" or "user:<id>"
+	AdminID       *uint     `json:"admin_id,omitempty" gorm:"index"`
+	EntryType     string    `json:"entry_type"` // "sale", "rental", "resale", "membership", "unfulfilled", "refund", "split_payout", "withdrawal", "withdrawal_paid" or "withdrawal_release"
+	Debit         float64   `json:"debit"`
+	Credit        float64   `json:"credit"`
+	TransactionID *uint     `json:"transaction_id,omitempty" gorm:"index"`
+	WithdrawalID  *uint     `json:"withdrawal_id,omitempty" gorm:"index"`
+	Description   string    `json:"description"`
+	CreatedAt     time.Time `json:"created_at" gorm:"index"`
+}
+
+// Withdrawal is an admin's request to be paid their ledger balance, or a
+// user's to be paid what their license resales earned. A superadmin approves
+// it into a payout or rejects it.
+type Withdrawal struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	AdminID        uint       `json:"admin_id" gorm:"index"`          // 0 for a user's withdrawal
+	UserID         uint       `json:"user_id,omitempty" gorm:"index"` // set instead for a resale seller's withdrawal
+	Amount         float64    `json:"amount"`
+	Status         string     `json:"status" gorm:"index"` // "pending", "processing", "paid", "rejected", "failed" or "reversed"
+	ReviewedBy     *uint      `json:"reviewed_by,omitempty"`
+	ReviewNote     string     `json:"review_note,omitempty"`
+	ReviewedAt     *time.Time `json:"reviewed_at,omitempty"`
+	PayoutChannel  string     `json:"payout_channel" gorm:"default:Paystack"` // "Paystack" to a bank account or "M-Pesa" to a phone
+	RecipientCode  string     `json:"recipient_code,omitempty"`
+	Reference      string     `json:"reference,omitempty" gorm:"index"`
+	TransferCode   string     `json:"transfer_code,omitempty"`
+	TransferStatus string     `json:"transfer_status,omitempty"` // as last reported by the payout channel
+	FailureReason  string     `json:"failure_reason,omitempty"`
+	PaidAt         *time.Time `json:"paid_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
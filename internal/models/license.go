@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// LicenseListing offers a purchased license (a UserBot) for resale
+type LicenseListing struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	UserBotID     uint      `json:"user_bot_id" gorm:"index"`
+	BotID         uint      `json:"bot_id" gorm:"index"`
+	SellerID      uint      `json:"seller_id" gorm:"index"`
+	Price         float64   `json:"price"`
+	Status        string    `json:"status" gorm:"index"` // "listed", "sold" or "cancelled"
+	BuyerID       *uint     `json:"buyer_id,omitempty"`
+	TransactionID *uint     `json:"transaction_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
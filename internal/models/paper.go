@@ -0,0 +1,73 @@
+package models
+
+import "time"
+
+// PaperAccount holds a user's virtual balance for paper trading
+type PaperAccount struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	UserID          uint      `json:"user_id" gorm:"uniqueIndex"`
+	Balance         float64   `json:"balance"`
+	StartingBalance float64   `json:"starting_balance"`
+	Currency        string    `json:"currency" gorm:"size:4;default:'USD'"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// PaperLedgerEntry records every movement of a paper account balance
+type PaperLedgerEntry struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	AccountID    uint      `json:"account_id" gorm:"index"`
+	PaperTradeID *uint     `json:"paper_trade_id,omitempty"`
+	EntryType    string    `json:"entry_type"` // "deposit", "stake", "payout", "reset"
+	Amount       float64   `json:"amount"`     // signed: debits are negative
+	BalanceAfter float64   `json:"balance_after"`
+	Description  string    `json:"description"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// PaperTrade is a simulated contract. It is kept in its own table so paper
+// results never mix with real Deriv trades.
+type PaperTrade struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	UserID       uint       `json:"user_id" gorm:"index"`
+	BotID        uint       `json:"bot_id"`
+	Symbol       string     `json:"symbol"`
+	TradeType    string     `json:"trade_type"`
+	Basis        string     `json:"basis"`
+	Currency     string     `json:"currency"`
+	Duration     int        `json:"duration"`
+	DurationUnit string     `json:"duration_unit"`
+	Barrier      string     `json:"barrier,omitempty"`
+	Barrier2     string     `json:"barrier2,omitempty"`
+	Prediction   *int       `json:"prediction,omitempty"`
+	Stake        float64    `json:"stake"`
+	Payout       float64    `json:"payout"`
+	EntrySpot    float64    `json:"entry_spot"`
+	ExitSpot     float64    `json:"exit_spot"`
+	ProfitLoss   float64    `json:"profit_loss"`
+	Status       string     `json:"status"` // "open", "won", "lost"
+	OpenTime     time.Time  `json:"open_time"`
+	CloseTime    *time.Time `json:"close_time,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// Contract rebuilds the contract request the paper trade was opened with
+func (t PaperTrade) Contract() DerivContractRequest {
+	amount := t.Stake
+	if t.Basis == "payout" {
+		amount = t.Payout
+	}
+	return DerivContractRequest{
+		Symbol:       t.Symbol,
+		ContractType: t.TradeType,
+		Amount:       amount,
+		Basis:        t.Basis,
+		Currency:     t.Currency,
+		Duration:     t.Duration,
+		DurationUnit: t.DurationUnit,
+		Barrier:      t.Barrier,
+		Barrier2:     t.Barrier2,
+		Prediction:   t.Prediction,
+		BotID:        t.BotID,
+	}
+}
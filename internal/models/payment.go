@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// PaymentSettlement records the one time a payment reference was applied.
+// Reference is the idempotency key: a second settlement of the same
+// reference finds this row and changes nothing.
+type PaymentSettlement struct {
+	ID            uint    `json:"id" gorm:"primaryKey"`
+	Reference     string  `json:"reference" gorm:"uniqueIndex"`
+	TransactionID uint    `json:"transaction_id" gorm:"index"`
+	Source        string  `json:"source"` // "verify", "callback", "webhook", "redirect" or "reconcile"
+	AmountPaid    float64 `json:"amount_paid"`
+	AmountDue     float64 `json:"amount_due"`
+	Status        string  `json:"status"` // "success", "underpaid", "sold_out" or "unavailable"
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookEvent is a payment provider webhook as received. EventKey, a hash
+// of the signed payload, rejects replays of an event already handled.
+type WebhookEvent struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	Provider    string     `json:"provider"`
+	EventKey    string     `json:"event_key" gorm:"uniqueIndex"`
+	Event       string     `json:"event"`
+	Reference   string     `json:"reference" gorm:"index"`
+	Payload     string     `json:"payload" gorm:"type:text"`
+	Status      string     `json:"status"` // "received", "processed", "ignored" or "failed"
+	Error       string     `json:"error,omitempty"`
+	Attempts    int        `json:"attempts"`
+	ProcessedAt *time.Time `json:"processed_at,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
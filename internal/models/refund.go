@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// Refund returns part or all of a settled payment to the payer, through
+// the payment provider
+type Refund struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	TransactionID uint       `json:"transaction_id" gorm:"index"`
+	Reference     string     `json:"reference" gorm:"index"` // of the refunded transaction
+	UserID        uint       `json:"user_id" gorm:"index"`
+	Amount        float64    `json:"amount"`
+	Reason        string     `json:"reason"`
+	Source        string     `json:"source"`              // "user", "superadmin", "provider", "chargeback" or "unfulfilled"
+	Status        string     `json:"status" gorm:"index"` // "requested", "pending", "processed", "failed" or "rejected"
+	ReviewedBy    *uint      `json:"reviewed_by,omitempty"`
+	ReviewNote    string     `json:"review_note,omitempty"`
+	ProviderID    string     `json:"provider_id,omitempty"`
+	FailureReason string     `json:"failure_reason,omitempty"`
+	ProcessedAt   *time.Time `json:"processed_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// Dispute is a chargeback the payer opened with their bank
+type Dispute struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	TransactionID uint       `json:"transaction_id" gorm:"index"`
+	Reference     string     `json:"reference" gorm:"index"`
+	ProviderID    string     `json:"provider_id" gorm:"uniqueIndex"`
+	Amount        float64    `json:"amount"`
+	Status        string     `json:"status"`               // as reported by the provider, e.g. "awaiting-merchant-feedback" or "resolved"
+	Resolution    string     `json:"resolution,omitempty"` // "merchant-accepted" (payer refunded) or "declined" (we keep the payment)
+	ResolvedAt    *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// TransactionEvent is one step in the history of a transaction: its
+// settlement, refunds and disputes
+type TransactionEvent struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	TransactionID uint      `json:"transaction_id" gorm:"index"`
+	Event         string    `json:"event"` // e.g. "settled", "refund_requested", "refund_processed", "dispute_opened"
+	Amount        float64   `json:"amount,omitempty"`
+	Actor         string    `json:"actor"` // who caused it, e.g. "user:5", "superadmin:1" or "paystack"
+	Detail        string    `json:"detail,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
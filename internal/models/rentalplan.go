@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// RentalPlan is one way to rent a bot: a price for a period of access
+type RentalPlan struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	BotID        uint      `json:"bot_id" gorm:"index"`
+	Name         string    `json:"name"`
+	Interval     string    `json:"interval"`      // "daily", "weekly", "monthly", "lifetime" or "custom"
+	DurationDays int       `json:"duration_days"` // 0 for lifetime
+	Price        float64   `json:"price"`
+	Active       bool      `json:"active"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Duration is how long one payment of the plan grants access; 0 never expires
+func (p RentalPlan) Duration() time.Duration {
+	return time.Duration(p.DurationDays) * 24 * time.Hour
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// RiskProfile holds a user's trading limits. The profile with no BotID
+// applies to everything the user trades; a profile with a BotID adds limits
+// for that bot's trades only. Zero means no limit.
+type RiskProfile struct {
+	ID     uint  `json:"id" gorm:"primaryKey"`
+	UserID uint  `json:"user_id" gorm:"uniqueIndex:idx_risk_profile"`
+	BotID  *uint `json:"bot_id,omitempty" gorm:"uniqueIndex:idx_risk_profile"`
+
+	MaxStake         float64 `json:"max_stake"`
+	DailyLossLimit   float64 `json:"daily_loss_limit"` // realised loss since 00:00 UTC
+	MaxOpenContracts int     `json:"max_open_contracts"`
+
+	// After MaxConsecutiveLosses losses in a row no new contract is bought
+	// for LossCooldownMinutes
+	MaxConsecutiveLosses int `json:"max_consecutive_losses"`
+	LossCooldownMinutes  int `json:"loss_cooldown_minutes"`
+
+	// AutomationHalted is the kill switch; it is only used on the user-wide
+	// profile and blocks every bot and copy order until it is released
+	AutomationHalted bool       `json:"automation_halted"`
+	HaltedAt         *time.Time `json:"halted_at,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BlockedOrder is the audit record of an order refused by a risk limit
+type BlockedOrder struct {
+	ID           uint    `json:"id" gorm:"primaryKey"`
+	UserID       uint    `json:"user_id" gorm:"index"`
+	BotID        uint    `json:"bot_id,omitempty"`
+	RunID        *uint   `json:"run_id,omitempty"`
+	Source       string  `json:"source"` // "manual", "bot" or "copy"
+	Mode         string  `json:"mode"`   // "live" or "paper"
+	Symbol       string  `json:"symbol"`
+	ContractType string  `json:"trade_type"`
+	Stake        float64 `json:"stake"`
+	Rule         string  `json:"rule"` // e.g. "max_stake", "daily_loss_limit", "kill_switch"
+	Reason       string  `json:"reason"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -7,7 +7,9 @@ type SalesHistory struct {
 	BotID          uint      `json:"bot_id"`
 	SellerID       uint      `json:"seller_id"`
 	BuyerID        uint      `json:"buyer_id"`
-	Amount         float64   `json:"amount"`
+	Amount         float64   `json:"amount"` // in the base currency
+	Currency       string    `json:"currency"`
+	ChargedAmount  float64   `json:"charged_amount"` // what the buyer paid, in Currency
 	TransactionRef string    `json:"transaction_ref"`
 	SoldAt         time.Time `json:"sold_at"`
 }
@@ -0,0 +1,163 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// StrategyDefinition is a declarative trading strategy: when every entry
+// condition holds at the close of a bar, the contract is bought with a stake
+// chosen by the sizing rule. It is stored as JSON on the bot.
+type StrategyDefinition struct {
+	Symbol    string `json:"symbol"`
+	Timeframe string `json:"timeframe"` // bar size conditions are evaluated on: "tick" or a chart timeframe such as "1m"
+
+	Entry []StrategyCondition `json:"entry"`
+
+	// Contract is the contract bought on entry. Its amount is ignored; the
+	// stake comes from Stake.
+	Contract DerivContractRequest `json:"contract"`
+	Stake    StakeSizing          `json:"stake"`
+
+	// PayoutRatio is the profit per unit of stake on a winning contract used
+	// when simulating. Zero means the default for the contract type.
+	PayoutRatio float64 `json:"payout_ratio,omitempty"`
+
+	// CooldownBars is the number of bars to wait after a contract settles
+	// before entering again.
+	CooldownBars int `json:"cooldown_bars,omitempty"`
+}
+
+// StrategyCondition compares two operands, e.g. close > 1234.5 or the last
+// digit crossing above 5.
+type StrategyCondition struct {
+	Left  StrategyOperand `json:"left"`
+	Op    string          `json:"op"` // ">", ">=", "<", "<=", "==", "!=", "crosses_above", "crosses_below"
+	Right StrategyOperand `json:"right"`
+}
+
+// StrategyOperand is a value taken from the bar series. Offset looks that
+// many bars back from the current one.
+type StrategyOperand struct {
+	Kind      string         `json:"kind"`                // "value", "price", "change", "last_digit", "streak" or "indicator"
+	Field     string         `json:"field,omitempty"`     // open, high, low or close for "price" (default close)
+	Value     float64        `json:"value,omitempty"`     // for "value"
+	Indicator *IndicatorSpec `json:"indicator,omitempty"` // for "indicator"
+	Offset    int            `json:"offset,omitempty"`
+}
+
+// StakeSizing decides the stake of each contract
+type StakeSizing struct {
+	Mode       string  `json:"mode"`                 // "fixed", "percent" or "martingale"
+	Amount     float64 `json:"amount,omitempty"`     // fixed stake, or the base stake for martingale
+	Percent    float64 `json:"percent,omitempty"`    // percentage of the balance for "percent"
+	Multiplier float64 `json:"multiplier,omitempty"` // stake multiplier after a loss for "martingale"
+	MaxStake   float64 `json:"max_stake,omitempty"`  // optional cap
+}
+
+var strategyOps = map[string]bool{
+	">": true, ">=": true, "<": true, "<=": true, "==": true, "!=": true,
+	"crosses_above": true, "crosses_below": true,
+}
+
+var operandKinds = map[string]bool{
+	"value": true, "price": true, "change": true, "last_digit": true, "streak": true, "indicator": true,
+}
+
+var priceFields = map[string]bool{"": true, "open": true, "high": true, "low": true, "close": true}
+
+// Validate normalizes the definition and checks that it can be run
+func (d *StrategyDefinition) Validate() error {
+	d.Symbol = strings.TrimSpace(d.Symbol)
+	d.Timeframe = strings.ToLower(strings.TrimSpace(d.Timeframe))
+	if d.Timeframe == "" {
+		d.Timeframe = "tick"
+	}
+	if d.Symbol == "" {
+		return errors.New("symbol is required")
+	}
+	if len(d.Entry) == 0 {
+		return errors.New("at least one entry condition is required")
+	}
+
+	for i := range d.Entry {
+		cond := &d.Entry[i]
+		cond.Op = strings.ToLower(strings.TrimSpace(cond.Op))
+		if !strategyOps[cond.Op] {
+			return fmt.Errorf("entry %d: unsupported op %q", i+1, cond.Op)
+		}
+		for _, operand := range []*StrategyOperand{&cond.Left, &cond.Right} {
+			if err := operand.validate(); err != nil {
+				return fmt.Errorf("entry %d: %v", i+1, err)
+			}
+		}
+	}
+
+	// The stake is decided at entry; validate the contract with a placeholder
+	d.Contract.Symbol = d.Symbol
+	d.Contract.Amount = 1
+	if err := d.Contract.Validate(); err != nil {
+		return fmt.Errorf("contract: %v", err)
+	}
+	if !d.Contract.HasFixedExpiry() {
+		return errors.New("contract: only contracts with a fixed expiry can be used in strategies")
+	}
+	if d.Contract.Basis != "stake" {
+		return errors.New("contract: basis must be stake, the stake comes from the sizing rule")
+	}
+
+	d.Stake.Mode = strings.ToLower(strings.TrimSpace(d.Stake.Mode))
+	switch d.Stake.Mode {
+	case "", "fixed":
+		d.Stake.Mode = "fixed"
+		if d.Stake.Amount <= 0 {
+			return errors.New("stake: amount must be greater than zero")
+		}
+	case "percent":
+		if d.Stake.Percent <= 0 || d.Stake.Percent > 100 {
+			return errors.New("stake: percent must be between 0 and 100")
+		}
+	case "martingale":
+		if d.Stake.Amount <= 0 {
+			return errors.New("stake: amount must be greater than zero")
+		}
+		if d.Stake.Multiplier < 1 {
+			return errors.New("stake: multiplier must be at least 1")
+		}
+	default:
+		return fmt.Errorf("stake: unsupported mode %q", d.Stake.Mode)
+	}
+	if d.Stake.MaxStake < 0 {
+		return errors.New("stake: max_stake must not be negative")
+	}
+
+	if d.PayoutRatio < 0 {
+		return errors.New("payout_ratio must not be negative")
+	}
+	if d.CooldownBars < 0 {
+		return errors.New("cooldown_bars must not be negative")
+	}
+	return nil
+}
+
+func (o *StrategyOperand) validate() error {
+	o.Kind = strings.ToLower(strings.TrimSpace(o.Kind))
+	o.Field = strings.ToLower(strings.TrimSpace(o.Field))
+	if !operandKinds[o.Kind] {
+		return fmt.Errorf("unsupported operand kind %q", o.Kind)
+	}
+	if o.Kind == "price" && !priceFields[o.Field] {
+		return fmt.Errorf("unsupported price field %q", o.Field)
+	}
+	if o.Offset < 0 {
+		return errors.New("operand offset must not be negative")
+	}
+	if o.Kind == "indicator" {
+		if o.Indicator == nil {
+			return errors.New("indicator operand needs an indicator")
+		}
+		return o.Indicator.Normalize()
+	}
+	return nil
+}
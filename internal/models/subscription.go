@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// BillingPlan is a Paystack plan created for something billed on a
+// schedule: a bot's rental plan or a membership tier
+type BillingPlan struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	Kind         string    `json:"kind" gorm:"index"` // "rental" or "membership"
+	BotID        uint      `json:"bot_id,omitempty" gorm:"index"`
+	RentalPlanID *uint     `json:"rental_plan_id,omitempty" gorm:"index"`
+	Tier         string    `json:"tier,omitempty"`
+	Interval     string    `json:"interval"` // Paystack interval, e.g. "monthly"
+	PeriodDays   int       `json:"period_days"`
+	Amount       float64   `json:"amount"`
+	PlanCode     string    `json:"plan_code" gorm:"uniqueIndex"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Subscription is a user's recurring Paystack payment for a bot rental or
+// a membership tier
+type Subscription struct {
+	ID                uint       `json:"id" gorm:"primaryKey"`
+	UserID            uint       `json:"user_id" gorm:"index"`
+	Kind              string     `json:"kind"` // "rental" or "membership"
+	Name              string     `json:"name"`
+	BotID             uint       `json:"bot_id,omitempty"`
+	RentalPlanID      *uint      `json:"rental_plan_id,omitempty"`
+	Tier              string     `json:"tier,omitempty"`
+	BillingPlanID     uint       `json:"billing_plan_id"`
+	PlanCode          string     `json:"plan_code" gorm:"index"`
+	PeriodDays        int        `json:"period_days"`
+	Amount            float64    `json:"amount"`
+	Reference         string     `json:"reference"` // of the first charge
+	SubscriptionCode  string     `json:"subscription_code" gorm:"index"`
+	EmailToken        string     `json:"-"`
+	AuthorizationCode string     `json:"-"`
+	CustomerCode      string     `json:"-"`
+	Status            string     `json:"status" gorm:"index"` // "pending", "active", "past_due", "non_renewing" or "cancelled"
+	NextPaymentDate   *time.Time `json:"next_payment_date,omitempty"`
+	FailedAttempts    int        `json:"failed_attempts"`
+	LastFailureAt     *time.Time `json:"last_failure_at,omitempty"`
+	CancelledAt       *time.Time `json:"cancelled_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
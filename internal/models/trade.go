@@ -7,10 +7,13 @@ type Trade struct {
 	UserID       uint       `json:"user_id"`
 	BotID        uint       `json:"bot_id"`
 	DerivTradeID string     `json:"deriv_trade_id"` // Deriv's trade ID
+	CredentialID uint       `json:"credential_id"`  // DerivCredentials the trade was placed with
 	Symbol       string     `json:"symbol"`
 	TradeType    string     `json:"trade_type"` // "CALL", "PUT"
 	Stake        float64    `json:"stake"`
+	BuyPrice     float64    `json:"buy_price"`
 	Payout       float64    `json:"payout"`
+	SellPrice    float64    `json:"sell_price"`
 	ProfitLoss   float64    `json:"profit_loss"` // Actual P&L
 	Status       string     `json:"status"`      // "open", "won", "lost"
 	OpenTime     time.Time  `json:"open_time"`
@@ -3,18 +3,31 @@ package models
 import "time"
 
 type Transaction struct {
-	ID             uint      `gorm:"primaryKey" json:"id"`
-	UserID         uint      `json:"user_id"`
-	AdminID        uint      `json:"admin_id"`
-	BotID          uint      `json:"bot_id"`
-	Amount         float64   `json:"amount"`
-	CompanyShare   float64   `json:"company_share"`
-	AdminShare     float64   `json:"admin_share"`
-	Reference      string    `json:"reference"`
-	Status         string    `json:"status"`          // "pending", "success", "failed"
-	PaymentChannel string    `json:"payment_channel"` // e.g. "Paystack"
-	PaymentType    string    `json:"payment_type"`    // "purchase" or "rent"
-	Description    string    `json:"description"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	ID                uint      `gorm:"primaryKey" json:"id"`
+	UserID            uint      `json:"user_id"`
+	AdminID           uint      `json:"admin_id"`
+	BotID             uint      `json:"bot_id"`
+	Amount            float64   `json:"amount"`                  // in the base currency, like the shares
+	Currency          string    `json:"currency"`                // what the payer was charged in
+	ChargedAmount     float64   `json:"charged_amount"`          // in Currency
+	ExchangeRate      float64   `json:"exchange_rate,omitempty"` // ChargedAmount per unit of Amount
+	CompanyShare      float64   `json:"company_share"`
+	AdminShare        float64   `json:"admin_share"`                  // owed to the admin, or to the seller of a resale
+	CommissionRate    float64   `json:"commission_rate"`              // the platform's share of Amount when it was charged
+	CommissionRuleID  *uint     `json:"commission_rule_id,omitempty"` // the CommissionRule that set it, nil for the built-in default
+	Reference         string    `json:"reference"`
+	Status            string    `json:"status"` // "pending", "success", "unfulfilled" (paid but nothing left to grant), "failed", "expired", "refunded" or "charged_back"
+	RefundedAmount    float64   `json:"refunded_amount"`
+	PaymentChannel    string    `json:"payment_channel"`                           // "Paystack", "M-Pesa" or "Stripe"
+	ProviderReference string    `json:"provider_reference,omitempty" gorm:"index"` // the provider's ID of the charge, when it is not Reference
+	ProviderChargeID  string    `json:"provider_charge_id,omitempty"`              // the provider's ID of the completed payment, which refunds name
+	PaymentType       string    `json:"payment_type"`                              // "purchase", "rent", "resale" or "membership"
+	ListingID         *uint     `json:"listing_id,omitempty"`                      // the LicenseListing a resale buys
+	SellerID          *uint     `json:"seller_id,omitempty" gorm:"index"`          // the user a resale pays
+	RentalPlanID      *uint     `json:"rental_plan_id,omitempty"`                  // the RentalPlan a rent pays for
+	SubscriptionID    *uint     `json:"subscription_id,omitempty"`                 // set for recurring charges
+	Subaccount        string    `json:"subaccount,omitempty"`                      // Paystack subaccount the admin share was split to
+	Description       string    `json:"description"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
 }
@@ -13,6 +13,7 @@ type User struct {
 	Password             string              `json:"-"`
 	Role                 string              `json:"role" gorm:"default:user"`
 	Country              string              `json:"country"`
+	PreferredCurrency    string              `json:"preferred_currency"` // overrides the currency of Country at checkout
 	Membership           string              `json:"member_ship_type" gorm:"default:freemium"`
 	EmailVerified        bool                `gorm:"default:false"`
 	VerificationToken    string              `json:"-"`
@@ -26,4 +27,11 @@ type User struct {
 	TotalTrades          uint                `json:"total_trades"`
 	SubscriptionExpiry   time.Time           `json:"subscription_expiry"`
 	UpgradeRequestStatus string              `json:"upgrade_request_status" gorm:"type:varchar(20);default:null"`
+	TradingMode          string              `json:"trading_mode" gorm:"type:varchar(10);default:live"` // "live" or "paper"
+	// Where the proceeds of license resales are paid out to
+	BankCode              string `json:"bank_code,omitempty"`
+	AccountNumber         string `json:"account_number,omitempty"`
+	AccountName           string `json:"account_name,omitempty"`
+	PhoneNumber           string `json:"phone_number,omitempty"` // for M-Pesa payouts
+	PaystackRecipientCode string `json:"-"`
 }
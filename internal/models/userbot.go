@@ -7,14 +7,15 @@ type UserBot struct {
 	UserID        uint       `json:"user_id"`
 	BotID         uint       `json:"bot_id"`
 	Bot           Bot        `json:"bot" gorm:"foreignKey:BotID"`
-	AccessType    string     `json:"access_type"` // "purchase" or "rent" (replaces Type)
+	AccessType    string     `json:"access_type"` // "purchase" (a license) or "rent" (replaces Type)
 	IsActive      bool       `json:"is_active"`   // replaces Active
 	TransactionID *uint      `json:"transaction_id,omitempty"`
 	Price         float64    `json:"price,omitempty"`
-	ExpiryDate    *time.Time `json:"expiry_date,omitempty"` // for rentals
+	ExpiryDate    *time.Time `json:"expiry_date,omitempty"`    // for rentals
+	RentalPlanID  *uint      `json:"rental_plan_id,omitempty"` // nil for the bot's default plan
 	PurchaseDate  time.Time  `json:"purchase_date"`
 	CreatedAt     time.Time  `json:"created_at"`
 	UpdatedAt     time.Time  `json:"updated_at"`
 	Type          string     `json:"type"`
-	ResaleAllowed bool
+	ResaleAllowed bool       `json:"resale_allowed"` // copied from the bot when the license is granted
 }
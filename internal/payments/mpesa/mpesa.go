@@ -0,0 +1,515 @@
+package mpesa
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/keyadaniel56/algocdk/internal/models"
+	"github.com/keyadaniel56/algocdk/internal/payments"
+	services "github.com/keyadaniel56/algocdk/service"
+)
+
+// Provider charges M-Pesa wallets with Daraja STK push, refunds with
+// transaction reversals and pays admins out to their phone with B2C,
+// whose status it can query. It
+// needs MPESA_CONSUMER_KEY, MPESA_CONSUMER_SECRET, MPESA_SHORTCODE,
+// MPESA_PASSKEY, MPESA_CALLBACK_URL (this server's
+// /api/payment/webhook/mpesa) and MPESA_CALLBACK_TOKEN, plus
+// MPESA_INITIATOR_NAME and MPESA_SECURITY_CREDENTIAL for refunds and
+// payouts.
+type Provider struct{}
+
+// defaultBaseURL is Daraja's production API. MPESA_BASE_URL overrides
+// it, e.g. with https://sandbox.safaricom.co.ke or a local stub.
+const defaultBaseURL = "https://api.safaricom.co.ke"
+
+// pendingCode is the error code Daraja answers a query about an STK push
+// the payer has not answered yet with
+const pendingCode = "500.001.1001"
+
+var eat = time.FixedZone("EAT", 3*60*60)
+
+func apiURL(path string) string {
+	base := os.Getenv("MPESA_BASE_URL")
+	if base == "" {
+		base = defaultBaseURL
+	}
+	return strings.TrimRight(base, "/") + path
+}
+
+// cachedToken caches the OAuth token Daraja calls need
+var cachedToken struct {
+	sync.Mutex
+	url     string
+	value   string
+	expires time.Time
+}
+
+func accessToken() (string, error) {
+	cachedToken.Lock()
+	defer cachedToken.Unlock()
+	tokenURL := apiURL("/oauth/v1/generate?grant_type=client_credentials")
+	if cachedToken.url == tokenURL && time.Now().Before(cachedToken.expires) {
+		return cachedToken.value, nil
+	}
+
+	req, _ := http.NewRequest("GET", tokenURL, nil)
+	req.SetBasicAuth(os.Getenv("MPESA_CONSUMER_KEY"), os.Getenv("MPESA_CONSUMER_SECRET"))
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("M-Pesa API error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", &payments.APIError{Provider: payments.ChannelMPesa, StatusCode: resp.StatusCode, Message: "authentication failed: " + string(respBody)}
+	}
+	var token struct {
+		AccessToken string      `json:"access_token"`
+		ExpiresIn   payments.ID `json:"expires_in"`
+	}
+	if err := json.Unmarshal(respBody, &token); err != nil {
+		return "", fmt.Errorf("failed to parse M-Pesa response: %v", err)
+	}
+	seconds, err := strconv.Atoi(string(token.ExpiresIn))
+	if err != nil || seconds <= 60 {
+		seconds = 3599
+	}
+	cachedToken.url = tokenURL
+	cachedToken.value = token.AccessToken
+	cachedToken.expires = time.Now().Add(time.Duration(seconds-60) * time.Second)
+	return token.AccessToken, nil
+}
+
+// call posts payload to Daraja and decodes the response into out.
+// Daraja reports failures with an HTTP error status.
+func call(path string, payload, out interface{}) error {
+	token, err := accessToken()
+	if err != nil {
+		return err
+	}
+	raw, _ := json.Marshal(payload)
+	req, _ := http.NewRequest("POST", apiURL(path), bytes.NewReader(raw))
+	req.Header.Add("Authorization", "Bearer "+token)
+	req.Header.Add("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("M-Pesa API error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		var failure struct {
+			ErrorCode    string `json:"errorCode"`
+			ErrorMessage string `json:"errorMessage"`
+		}
+		json.Unmarshal(respBody, &failure)
+		if failure.ErrorMessage == "" {
+			failure.ErrorMessage = string(respBody)
+		}
+		return &payments.APIError{Provider: payments.ChannelMPesa, StatusCode: resp.StatusCode, Code: failure.ErrorCode, Message: failure.ErrorMessage}
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to parse M-Pesa response: %v", err)
+	}
+	return nil
+}
+
+// password is the password of an STK push or query made at timestamp
+func password(timestamp string) string {
+	return base64.StdEncoding.EncodeToString([]byte(os.Getenv("MPESA_SHORTCODE") + os.Getenv("MPESA_PASSKEY") + timestamp))
+}
+
+// callbackURL is where Daraja reports results of kind "charge",
+// "refund", "payout" or "payout_status"
+func callbackURL(kind string) string {
+	callback, err := url.Parse(os.Getenv("MPESA_CALLBACK_URL"))
+	if err != nil {
+		return ""
+	}
+	query := callback.Query()
+	query.Set("kind", kind)
+	query.Set("token", os.Getenv("MPESA_CALLBACK_TOKEN"))
+	callback.RawQuery = query.Encode()
+	return callback.String()
+}
+
+// normalizeMSISDN turns a Kenyan phone number such as 0712345678 or
+// +254712345678 into the 254712345678 Daraja wants, "" if it is not one
+func normalizeMSISDN(phone string) string {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+	switch {
+	case len(digits) == 12 && strings.HasPrefix(digits, "254"):
+	case len(digits) == 10 && strings.HasPrefix(digits, "0"):
+		digits = "254" + digits[1:]
+	case len(digits) == 9 && (digits[0] == '7' || digits[0] == '1'):
+		digits = "254" + digits
+	default:
+		return ""
+	}
+	if digits[3] != '7' && digits[3] != '1' {
+		return ""
+	}
+	return digits
+}
+
+// wholeShillings is amount as the whole number of shillings M-Pesa moves
+func wholeShillings(amount float64) (int, error) {
+	if amount < 1 || amount != math.Trunc(amount) {
+		return 0, fmt.Errorf("%w: M-Pesa only moves whole shillings, got %.2f", payments.ErrUnsupportedCharge, amount)
+	}
+	return int(amount), nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+func (Provider) Name() string { return payments.ChannelMPesa }
+
+// Initialize sends an STK push asking the payer to approve the charge on
+// their phone
+func (Provider) Initialize(charge payments.Charge) (*payments.Checkout, error) {
+	if services.NormalizeCurrency(charge.Currency) != "KES" {
+		return nil, fmt.Errorf("%w: M-Pesa only takes KES", payments.ErrUnsupportedCharge)
+	}
+	phone := normalizeMSISDN(charge.Phone)
+	if phone == "" {
+		return nil, fmt.Errorf("%w: a Kenyan phone number is needed for M-Pesa", payments.ErrUnsupportedCharge)
+	}
+	amount, err := wholeShillings(charge.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp := time.Now().In(eat).Format("20060102150405")
+	var pushed struct {
+		MerchantRequestID string `json:"MerchantRequestID"`
+		CheckoutRequestID string `json:"CheckoutRequestID"`
+		ResponseCode      string `json:"ResponseCode"`
+		ResponseDesc      string `json:"ResponseDescription"`
+		CustomerMessage   string `json:"CustomerMessage"`
+	}
+	if err := call("/mpesa/stkpush/v1/processrequest", map[string]interface{}{
+		"BusinessShortCode": os.Getenv("MPESA_SHORTCODE"),
+		"Password":          password(timestamp),
+		"Timestamp":         timestamp,
+		"TransactionType":   "CustomerPayBillOnline",
+		"Amount":            amount,
+		"PartyA":            phone,
+		"PartyB":            os.Getenv("MPESA_SHORTCODE"),
+		"PhoneNumber":       phone,
+		"CallBackURL":       callbackURL("charge"),
+		"AccountReference":  "Algocdk",
+		"TransactionDesc":   truncate(charge.Description, 13),
+	}, &pushed); err != nil {
+		return nil, err
+	}
+	if pushed.ResponseCode != "0" {
+		return nil, &payments.APIError{Provider: payments.ChannelMPesa, Code: pushed.ResponseCode, Message: pushed.ResponseDesc}
+	}
+
+	return &payments.Checkout{
+		ProviderReference: pushed.CheckoutRequestID,
+		Data: map[string]interface{}{
+			"reference":           charge.Reference,
+			"checkout_request_id": pushed.CheckoutRequestID,
+			"customer_message":    pushed.CustomerMessage,
+		},
+	}, nil
+}
+
+// Verify queries the STK push. The payer cannot change the amount of a
+// push, so a completed one collected what was asked.
+func (Provider) Verify(transaction models.Transaction) (*payments.Verification, error) {
+	if transaction.ProviderReference == "" {
+		return &payments.Verification{Found: false, Message: "no STK push for this transaction"}, nil
+	}
+
+	timestamp := time.Now().In(eat).Format("20060102150405")
+	var query struct {
+		ResponseCode string      `json:"ResponseCode"`
+		ResultCode   payments.ID `json:"ResultCode"`
+		ResultDesc   string      `json:"ResultDesc"`
+	}
+	err := call("/mpesa/stkpushquery/v1/query", map[string]interface{}{
+		"BusinessShortCode": os.Getenv("MPESA_SHORTCODE"),
+		"Password":          password(timestamp),
+		"Timestamp":         timestamp,
+		"CheckoutRequestID": transaction.ProviderReference,
+	}, &query)
+	var apiErr *payments.APIError
+	if errors.As(err, &apiErr) && apiErr.Code == pendingCode {
+		return &payments.Verification{Found: true, Status: "pending", Message: apiErr.Message}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	verification := &payments.Verification{Found: true, Currency: "KES", Message: query.ResultDesc, Data: query}
+	switch query.ResultCode {
+	case "0":
+		verification.Status = "success"
+		verification.Amount = transaction.ChargedAmount
+	case "1032", "1037":
+		// Cancelled by the payer, or their phone never answered
+		verification.Status = "abandoned"
+	case "4999":
+		verification.Status = "pending"
+	default:
+		verification.Status = "failed"
+	}
+	return verification, nil
+}
+
+// ParseWebhook reads an STK push, reversal, B2C or B2C status result. Daraja does not
+// sign callbacks, so they carry the MPESA_CALLBACK_TOKEN they were sent
+// with.
+func (Provider) ParseWebhook(r *http.Request, body []byte) (*payments.Notification, error) {
+	token := os.Getenv("MPESA_CALLBACK_TOKEN")
+	if token == "" || !hmac.Equal([]byte(r.URL.Query().Get("token")), []byte(token)) {
+		return nil, payments.ErrInvalidSignature
+	}
+
+	switch kind := r.URL.Query().Get("kind"); kind {
+	case "charge":
+		var callback struct {
+			Body struct {
+				StkCallback struct {
+					CheckoutRequestID string      `json:"CheckoutRequestID"`
+					ResultCode        payments.ID `json:"ResultCode"`
+					CallbackMetadata  struct {
+						Item []struct {
+							Name  string          `json:"Name"`
+							Value json.RawMessage `json:"Value"`
+						} `json:"Item"`
+					} `json:"CallbackMetadata"`
+				} `json:"stkCallback"`
+			} `json:"Body"`
+		}
+		if err := json.Unmarshal(body, &callback); err != nil {
+			return nil, err
+		}
+		stk := callback.Body.StkCallback
+		if stk.CheckoutRequestID == "" {
+			return nil, errors.New("missing CheckoutRequestID")
+		}
+		notification := &payments.Notification{Event: "charge.failed", ProviderReference: stk.CheckoutRequestID, Payload: body}
+		if stk.ResultCode == "0" {
+			notification.Event = "charge.success"
+		}
+		for _, item := range stk.CallbackMetadata.Item {
+			switch item.Name {
+			case "Amount":
+				json.Unmarshal(item.Value, &notification.Amount)
+			case "MpesaReceiptNumber":
+				json.Unmarshal(item.Value, &notification.ChargeID)
+			}
+		}
+		return notification, nil
+
+	case "refund", "payout":
+		var callback struct {
+			Result struct {
+				ResultCode     payments.ID `json:"ResultCode"`
+				ConversationID string      `json:"ConversationID"`
+			} `json:"Result"`
+		}
+		if err := json.Unmarshal(body, &callback); err != nil {
+			return nil, err
+		}
+		if callback.Result.ConversationID == "" {
+			return nil, errors.New("missing ConversationID")
+		}
+		failed, succeeded := "refund.failed", "refund.processed"
+		if kind == "payout" {
+			failed, succeeded = "transfer.failed", "transfer.success"
+		}
+		notification := &payments.Notification{Event: failed, ProviderID: callback.Result.ConversationID, Payload: body}
+		if callback.Result.ResultCode == "0" {
+			notification.Event = succeeded
+		}
+		return notification, nil
+	case "payout_status":
+		var callback struct {
+			Result struct {
+				ResultCode       payments.ID `json:"ResultCode"`
+				ResultParameters struct {
+					ResultParameter []struct {
+						Key   string      `json:"Key"`
+						Value payments.ID `json:"Value"`
+					} `json:"ResultParameter"`
+				} `json:"ResultParameters"`
+				ReferenceData struct {
+					ReferenceItem struct {
+						Key   string `json:"Key"`
+						Value string `json:"Value"`
+					} `json:"ReferenceItem"`
+				} `json:"ReferenceData"`
+			} `json:"Result"`
+		}
+		if err := json.Unmarshal(body, &callback); err != nil {
+			return nil, err
+		}
+		// VerifyPayout sends the withdrawal's reference as the occasion
+		reference := callback.Result.ReferenceData.ReferenceItem.Value
+		if reference == "" {
+			return nil, errors.New("missing Occasion")
+		}
+		var status payments.ID
+		for _, parameter := range callback.Result.ResultParameters.ResultParameter {
+			if parameter.Key == "TransactionStatus" {
+				status = parameter.Value
+			}
+		}
+		// A query that failed says nothing about the payout
+		notification := &payments.Notification{Event: "transfer.unknown", Reference: reference, Payload: body}
+		if callback.Result.ResultCode == "0" {
+			switch status {
+			case "Completed":
+				notification.Event = "transfer.success"
+			case "Reversed":
+				notification.Event = "transfer.reversed"
+			case "Failed", "Cancelled", "Expired", "Declined":
+				notification.Event = "transfer.failed"
+			}
+		}
+		return notification, nil
+
+	default:
+		return nil, fmt.Errorf("unknown M-Pesa callback kind %q", kind)
+	}
+}
+
+// Refund reverses the payment the M-Pesa receipt of transaction names
+func (Provider) Refund(transaction models.Transaction, amount float64, note string) (*payments.ProviderResult, error) {
+	if transaction.ProviderChargeID == "" {
+		return nil, fmt.Errorf("%w: no M-Pesa receipt for this payment", payments.ErrUnsupportedCharge)
+	}
+	whole, err := wholeShillings(amount)
+	if err != nil {
+		return nil, err
+	}
+	if note == "" {
+		note = "Refund"
+	}
+
+	var reversal struct {
+		ConversationID string `json:"ConversationID"`
+		ResponseCode   string `json:"ResponseCode"`
+		ResponseDesc   string `json:"ResponseDescription"`
+	}
+	if err := call("/mpesa/reversal/v1/request", map[string]interface{}{
+		"Initiator":              os.Getenv("MPESA_INITIATOR_NAME"),
+		"SecurityCredential":     os.Getenv("MPESA_SECURITY_CREDENTIAL"),
+		"CommandID":              "TransactionReversal",
+		"TransactionID":          transaction.ProviderChargeID,
+		"Amount":                 whole,
+		"ReceiverParty":          os.Getenv("MPESA_SHORTCODE"),
+		"RecieverIdentifierType": "11",
+		"ResultURL":              callbackURL("refund"),
+		"QueueTimeOutURL":        callbackURL("refund"),
+		"Remarks":                truncate(note, 100),
+		"Occasion":               transaction.Reference,
+	}, &reversal); err != nil {
+		return nil, err
+	}
+	if reversal.ResponseCode != "0" {
+		return nil, &payments.APIError{Provider: payments.ChannelMPesa, Code: reversal.ResponseCode, Message: reversal.ResponseDesc}
+	}
+	return &payments.ProviderResult{ID: reversal.ConversationID, Status: "pending"}, nil
+}
+
+// Payout sends a B2C payment to the payee's phone
+func (Provider) Payout(withdrawal *models.Withdrawal, payee *payments.Payee) (*payments.ProviderResult, error) {
+	if services.BaseCurrency() != "KES" {
+		return nil, fmt.Errorf("%w: M-Pesa only pays out KES", payments.ErrPayoutUnsupported)
+	}
+	phone := normalizeMSISDN(payee.Phone)
+	if phone == "" {
+		return nil, services.ErrNoPhoneNumber
+	}
+	if withdrawal.Amount != math.Trunc(withdrawal.Amount) {
+		return nil, fmt.Errorf("%w: M-Pesa only pays whole shillings, got %.2f", payments.ErrPayoutUnsupported, withdrawal.Amount)
+	}
+	withdrawal.RecipientCode = phone
+
+	var payment struct {
+		ConversationID string `json:"ConversationID"`
+		ResponseCode   string `json:"ResponseCode"`
+		ResponseDesc   string `json:"ResponseDescription"`
+	}
+	if err := call("/mpesa/b2c/v1/paymentrequest", map[string]interface{}{
+		"OriginatorConversationID": withdrawal.Reference,
+		"InitiatorName":            os.Getenv("MPESA_INITIATOR_NAME"),
+		"SecurityCredential":       os.Getenv("MPESA_SECURITY_CREDENTIAL"),
+		"CommandID":                "BusinessPayment",
+		"Amount":                   int(withdrawal.Amount),
+		"PartyA":                   os.Getenv("MPESA_SHORTCODE"),
+		"PartyB":                   phone,
+		"Remarks":                  fmt.Sprintf("Algocdk payout %d", withdrawal.ID),
+		"QueueTimeOutURL":          callbackURL("payout"),
+		"ResultURL":                callbackURL("payout"),
+		"Occasion":                 withdrawal.Reference,
+	}, &payment); err != nil {
+		return nil, err
+	}
+	if payment.ResponseCode != "0" {
+		return nil, &payments.APIError{Provider: payments.ChannelMPesa, Code: payment.ResponseCode, Message: payment.ResponseDesc}
+	}
+	return &payments.ProviderResult{ID: payment.ConversationID, Status: "pending"}, nil
+}
+
+// VerifyPayout asks Daraja for the status of the B2C payment of
+// withdrawal. Daraja answers at the payout_status callback, so the payout
+// stays pending here.
+func (Provider) VerifyPayout(withdrawal models.Withdrawal) (*payments.ProviderResult, error) {
+	var query struct {
+		ResponseCode string `json:"ResponseCode"`
+		ResponseDesc string `json:"ResponseDescription"`
+	}
+	if err := call("/mpesa/transactionstatus/v1/query", map[string]interface{}{
+		"Initiator":              os.Getenv("MPESA_INITIATOR_NAME"),
+		"SecurityCredential":     os.Getenv("MPESA_SECURITY_CREDENTIAL"),
+		"CommandID":              "TransactionStatusQuery",
+		"OriginalConversationID": withdrawal.Reference,
+		"PartyA":                 os.Getenv("MPESA_SHORTCODE"),
+		"IdentifierType":         "4",
+		"ResultURL":              callbackURL("payout_status"),
+		"QueueTimeOutURL":        callbackURL("payout_status"),
+		"Remarks":                fmt.Sprintf("Algocdk payout %d", withdrawal.ID),
+		"Occasion":               withdrawal.Reference,
+	}, &query); err != nil {
+		return nil, err
+	}
+	if query.ResponseCode != "0" {
+		return nil, &payments.APIError{Provider: payments.ChannelMPesa, Code: query.ResponseCode, Message: query.ResponseDesc}
+	}
+	return &payments.ProviderResult{ID: withdrawal.TransferCode, Status: "pending"}, nil
+}
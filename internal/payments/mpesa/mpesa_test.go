@@ -0,0 +1,408 @@
+package mpesa
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/keyadaniel56/algocdk/internal/models"
+	"github.com/keyadaniel56/algocdk/internal/payments"
+	services "github.com/keyadaniel56/algocdk/service"
+)
+
+const callbackToken = "callback-token"
+
+// fakeDaraja stands in for the Daraja API. It hands out an OAuth token,
+// answers the paths it was told to and remembers what was posted to them.
+type fakeDaraja struct {
+	t       *testing.T
+	mu      sync.Mutex
+	replies map[string]func(w http.ResponseWriter)
+	posted  map[string]map[string]interface{}
+}
+
+// newFakeDaraja starts a fake Daraja and points the package at it
+func newFakeDaraja(t *testing.T) *fakeDaraja {
+	f := &fakeDaraja{t: t, replies: map[string]func(http.ResponseWriter){}, posted: map[string]map[string]interface{}{}}
+	server := httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(server.Close)
+	t.Setenv("MPESA_BASE_URL", server.URL)
+	t.Setenv("MPESA_CONSUMER_KEY", "key")
+	t.Setenv("MPESA_CONSUMER_SECRET", "secret")
+	t.Setenv("MPESA_SHORTCODE", "174379")
+	t.Setenv("MPESA_PASSKEY", "passkey")
+	t.Setenv("MPESA_CALLBACK_URL", "https://algocdk.test/api/payment/webhook/mpesa")
+	t.Setenv("MPESA_CALLBACK_TOKEN", callbackToken)
+	t.Setenv("MPESA_INITIATOR_NAME", "initiator")
+	t.Setenv("MPESA_SECURITY_CREDENTIAL", "credential")
+	return f
+}
+
+func (f *fakeDaraja) serve(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/oauth/v1/generate" {
+		if key, secret, _ := r.BasicAuth(); key != "key" || secret != "secret" {
+			http.Error(w, "bad credentials", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "token", "expires_in": "3599"})
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer token" {
+		f.t.Errorf("%s sent without the access token", r.URL.Path)
+	}
+	var payload map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&payload)
+
+	f.mu.Lock()
+	f.posted[r.URL.Path] = payload
+	reply := f.replies[r.URL.Path]
+	f.mu.Unlock()
+	if reply == nil {
+		f.t.Errorf("unexpected Daraja request %s", r.URL.Path)
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	reply(w)
+}
+
+// reply answers path with status and body
+func (f *fakeDaraja) reply(path string, status int, body interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.replies[path] = func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+// request is the last payload posted to path, nil if there was none
+func (f *fakeDaraja) request(path string) map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.posted[path]
+}
+
+// callback is a Daraja callback of kind carrying token
+func callback(kind, token string, body interface{}) (*http.Request, []byte) {
+	raw, _ := json.Marshal(body)
+	query := url.Values{"kind": {kind}}
+	if token != "" {
+		query.Set("token", token)
+	}
+	return httptest.NewRequest("POST", "/api/payment/webhook/mpesa?"+query.Encode(), strings.NewReader(string(raw))), raw
+}
+
+// callbackKind is the kind in the callback URL Daraja was given
+func callbackKind(t *testing.T, payload map[string]interface{}, field string) string {
+	t.Helper()
+	target, err := url.Parse(payload[field].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.Query().Get("token") != callbackToken {
+		t.Errorf("%s %s does not carry the callback token", field, target)
+	}
+	return target.Query().Get("kind")
+}
+
+func TestInitializeSendsSTKPush(t *testing.T) {
+	daraja := newFakeDaraja(t)
+	daraja.reply("/mpesa/stkpush/v1/processrequest", http.StatusOK, map[string]string{
+		"MerchantRequestID": "MR_1", "CheckoutRequestID": "ws_CO_1", "ResponseCode": "0", "CustomerMessage": "Check your phone",
+	})
+
+	checkout, err := Provider{}.Initialize(payments.Charge{Reference: "TX_1", Phone: "0712 345 678", Amount: 100, Currency: "kes", Description: "Trend bot purchase"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkout.ProviderReference != "ws_CO_1" || checkout.Data["reference"] != "TX_1" {
+		t.Errorf("checkout = %+v", checkout)
+	}
+	pushed := daraja.request("/mpesa/stkpush/v1/processrequest")
+	if pushed["PhoneNumber"] != "254712345678" || pushed["PartyA"] != "254712345678" || pushed["Amount"] != 100.0 {
+		t.Errorf("STK push %v", pushed)
+	}
+	if pushed["TransactionDesc"] != "Trend bot pur" {
+		t.Errorf("description sent as %q, want it cut to 13 characters", pushed["TransactionDesc"])
+	}
+	if kind := callbackKind(t, pushed, "CallBackURL"); kind != "charge" {
+		t.Errorf("STK push reports to kind %q", kind)
+	}
+
+	daraja.reply("/mpesa/stkpush/v1/processrequest", http.StatusOK, map[string]string{"ResponseCode": "1", "ResponseDescription": "Rejected"})
+	var apiErr *payments.APIError
+	if _, err := (Provider{}).Initialize(payments.Charge{Reference: "TX_2", Phone: "0712345678", Amount: 100, Currency: "KES"}); !errors.As(err, &apiErr) || apiErr.Code != "1" {
+		t.Errorf("rejected push: %v", err)
+	}
+
+	for name, charge := range map[string]payments.Charge{
+		"dollars":        {Reference: "TX_3", Phone: "0712345678", Amount: 100, Currency: "USD"},
+		"foreign phone":  {Reference: "TX_4", Phone: "+441234567890", Amount: 100, Currency: "KES"},
+		"no phone":       {Reference: "TX_5", Amount: 100, Currency: "KES"},
+		"cents":          {Reference: "TX_6", Phone: "0712345678", Amount: 99.5, Currency: "KES"},
+		"nothing to pay": {Reference: "TX_7", Phone: "0712345678", Amount: 0, Currency: "KES"},
+	} {
+		if _, err := (Provider{}).Initialize(charge); !errors.Is(err, payments.ErrUnsupportedCharge) {
+			t.Errorf("%s: %v, want ErrUnsupportedCharge", name, err)
+		}
+	}
+}
+
+func TestVerifyMapsSTKQueryResults(t *testing.T) {
+	daraja := newFakeDaraja(t)
+	transaction := models.Transaction{Reference: "TX_1", ProviderReference: "ws_CO_1", ChargedAmount: 100}
+
+	for code, want := range map[string]string{"0": "success", "1032": "abandoned", "1037": "abandoned", "4999": "pending", "1": "failed"} {
+		daraja.reply("/mpesa/stkpushquery/v1/query", http.StatusOK, map[string]string{"ResponseCode": "0", "ResultCode": code, "ResultDesc": "result " + code})
+		verification, err := Provider{}.Verify(transaction)
+		if err != nil {
+			t.Fatalf("result %s: %v", code, err)
+		}
+		if !verification.Found || verification.Status != want {
+			t.Errorf("result %s verified as %+v, want %s", code, verification, want)
+		}
+		if want == "success" && (verification.Amount != 100 || verification.Currency != "KES") {
+			t.Errorf("completed push collected %.2f %s, want 100 KES", verification.Amount, verification.Currency)
+		}
+	}
+	if query := daraja.request("/mpesa/stkpushquery/v1/query"); query["CheckoutRequestID"] != "ws_CO_1" {
+		t.Errorf("query %v does not name the push", query)
+	}
+
+	// Daraja answers a push still on the payer's phone with an error
+	daraja.reply("/mpesa/stkpushquery/v1/query", http.StatusInternalServerError, map[string]string{
+		"errorCode": pendingCode, "errorMessage": "The transaction is being processed",
+	})
+	verification, err := Provider{}.Verify(transaction)
+	if err != nil || verification.Status != "pending" {
+		t.Errorf("unanswered push verified as %+v, %v", verification, err)
+	}
+
+	daraja.reply("/mpesa/stkpushquery/v1/query", http.StatusInternalServerError, map[string]string{"errorCode": "500.003.1001", "errorMessage": "Internal Server Error"})
+	if _, err := (Provider{}).Verify(transaction); err == nil {
+		t.Error("Daraja error verified without an error")
+	}
+
+	verification, err = Provider{}.Verify(models.Transaction{Reference: "TX_2"})
+	if err != nil || verification.Found {
+		t.Errorf("transaction without a push verified as %+v, %v", verification, err)
+	}
+}
+
+func TestParseWebhookChecksCallbackToken(t *testing.T) {
+	t.Setenv("MPESA_CALLBACK_TOKEN", callbackToken)
+	stk := map[string]interface{}{"Body": map[string]interface{}{"stkCallback": map[string]interface{}{
+		"CheckoutRequestID": "ws_CO_1",
+		"ResultCode":        0,
+		"CallbackMetadata": map[string]interface{}{"Item": []map[string]interface{}{
+			{"Name": "Amount", "Value": 100},
+			{"Name": "MpesaReceiptNumber", "Value": "RCP123"},
+		}},
+	}}}
+
+	for name, token := range map[string]string{"missing": "", "wrong": "guess"} {
+		r, body := callback("charge", token, stk)
+		if _, err := (Provider{}).ParseWebhook(r, body); !errors.Is(err, payments.ErrInvalidSignature) {
+			t.Errorf("%s token: %v, want ErrInvalidSignature", name, err)
+		}
+	}
+
+	// Without a configured token nothing is accepted
+	t.Setenv("MPESA_CALLBACK_TOKEN", "")
+	r, body := callback("charge", "", stk)
+	if _, err := (Provider{}).ParseWebhook(r, body); !errors.Is(err, payments.ErrInvalidSignature) {
+		t.Errorf("callback with no token configured: %v", err)
+	}
+	t.Setenv("MPESA_CALLBACK_TOKEN", callbackToken)
+
+	r, body = callback("charge", callbackToken, stk)
+	notification, err := Provider{}.ParseWebhook(r, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notification.Event != "charge.success" || notification.ProviderReference != "ws_CO_1" ||
+		notification.Amount != 100 || notification.ChargeID != "RCP123" {
+		t.Errorf("STK callback read as %+v", notification)
+	}
+
+	r, body = callback("charge", callbackToken, map[string]interface{}{"Body": map[string]interface{}{"stkCallback": map[string]interface{}{
+		"CheckoutRequestID": "ws_CO_2", "ResultCode": 1032,
+	}}})
+	if notification, err := (Provider{}).ParseWebhook(r, body); err != nil || notification.Event != "charge.failed" {
+		t.Errorf("cancelled STK push read as %+v, %v", notification, err)
+	}
+
+	result := func(code int) map[string]interface{} {
+		return map[string]interface{}{"Result": map[string]interface{}{"ResultCode": code, "ConversationID": "AG_1"}}
+	}
+	for _, c := range []struct {
+		kind  string
+		code  int
+		event string
+	}{
+		{"refund", 0, "refund.processed"},
+		{"refund", 1, "refund.failed"},
+		{"payout", 0, "transfer.success"},
+		{"payout", 2001, "transfer.failed"},
+	} {
+		r, body := callback(c.kind, callbackToken, result(c.code))
+		notification, err := Provider{}.ParseWebhook(r, body)
+		if err != nil {
+			t.Fatalf("%s result %d: %v", c.kind, c.code, err)
+		}
+		if notification.Event != c.event || notification.ProviderID != "AG_1" {
+			t.Errorf("%s result %d read as %+v, want %s", c.kind, c.code, notification, c.event)
+		}
+	}
+
+	r, body = callback("payout", callbackToken, map[string]interface{}{"Result": map[string]interface{}{"ResultCode": 0}})
+	if _, err := (Provider{}).ParseWebhook(r, body); err == nil {
+		t.Error("result without a ConversationID parsed")
+	}
+	r, body = callback("balance", callbackToken, result(0))
+	if _, err := (Provider{}).ParseWebhook(r, body); err == nil {
+		t.Error("unknown callback kind parsed")
+	}
+}
+
+func TestParseWebhookReadsPayoutStatus(t *testing.T) {
+	t.Setenv("MPESA_CALLBACK_TOKEN", callbackToken)
+	status := func(code int, transactionStatus string) map[string]interface{} {
+		return map[string]interface{}{"Result": map[string]interface{}{
+			"ResultCode": code,
+			"ResultParameters": map[string]interface{}{"ResultParameter": []map[string]interface{}{
+				{"Key": "ReceiptNo", "Value": "RCP123"},
+				{"Key": "TransactionStatus", "Value": transactionStatus},
+			}},
+			"ReferenceData": map[string]interface{}{"ReferenceItem": map[string]string{"Key": "Occasion", "Value": "WD_1"}},
+		}}
+	}
+	for _, c := range []struct {
+		code   int
+		status string
+		event  string
+	}{
+		{0, "Completed", "transfer.success"},
+		{0, "Reversed", "transfer.reversed"},
+		{0, "Declined", "transfer.failed"},
+		{0, "Expired", "transfer.failed"},
+		{0, "Pending", "transfer.unknown"},
+		{2001, "Completed", "transfer.unknown"},
+	} {
+		r, body := callback("payout_status", callbackToken, status(c.code, c.status))
+		notification, err := Provider{}.ParseWebhook(r, body)
+		if err != nil {
+			t.Fatalf("%s: %v", c.status, err)
+		}
+		if notification.Event != c.event || notification.Reference != "WD_1" {
+			t.Errorf("status %s (result %d) read as %+v, want %s", c.status, c.code, notification, c.event)
+		}
+	}
+
+	r, body := callback("payout_status", callbackToken, map[string]interface{}{"Result": map[string]interface{}{"ResultCode": 0}})
+	if _, err := (Provider{}).ParseWebhook(r, body); err == nil {
+		t.Error("status without an occasion parsed")
+	}
+}
+
+func TestRefundReversesReceipt(t *testing.T) {
+	daraja := newFakeDaraja(t)
+	daraja.reply("/mpesa/reversal/v1/request", http.StatusOK, map[string]string{"ConversationID": "AG_refund", "ResponseCode": "0"})
+
+	transaction := models.Transaction{Reference: "TX_1", ProviderChargeID: "RCP123", Currency: "KES"}
+	result, err := Provider{}.Refund(transaction, 60, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ID != "AG_refund" || result.Status != "pending" {
+		t.Errorf("refund = %+v, want pending AG_refund", result)
+	}
+	reversal := daraja.request("/mpesa/reversal/v1/request")
+	if reversal["TransactionID"] != "RCP123" || reversal["Amount"] != 60.0 || reversal["Occasion"] != "TX_1" || reversal["Remarks"] != "Refund" {
+		t.Errorf("reversal %v", reversal)
+	}
+	if kind := callbackKind(t, reversal, "ResultURL"); kind != "refund" {
+		t.Errorf("reversal reports to kind %q", kind)
+	}
+
+	daraja.reply("/mpesa/reversal/v1/request", http.StatusOK, map[string]string{"ResponseCode": "1", "ResponseDescription": "Rejected"})
+	var apiErr *payments.APIError
+	if _, err := (Provider{}).Refund(transaction, 60, "duplicate"); !errors.As(err, &apiErr) {
+		t.Errorf("rejected reversal: %v", err)
+	}
+
+	// A reversal moves whole shillings, so a part of one is not rounded away
+	if _, err := (Provider{}).Refund(transaction, 100.40, ""); !errors.Is(err, payments.ErrUnsupportedCharge) {
+		t.Errorf("refund of 100.40: %v, want ErrUnsupportedCharge", err)
+	}
+	if reversal := daraja.request("/mpesa/reversal/v1/request"); reversal["Amount"] != 60.0 {
+		t.Errorf("refund of 100.40 sent a reversal of %v", reversal["Amount"])
+	}
+
+	if _, err := (Provider{}).Refund(models.Transaction{Reference: "TX_2"}, 60, ""); !errors.Is(err, payments.ErrUnsupportedCharge) {
+		t.Errorf("refund without a receipt: %v", err)
+	}
+}
+
+func TestPayoutSendsB2C(t *testing.T) {
+	daraja := newFakeDaraja(t)
+	t.Setenv("BASE_CURRENCY", "KES")
+	daraja.reply("/mpesa/b2c/v1/paymentrequest", http.StatusOK, map[string]string{"ConversationID": "AG_payout", "ResponseCode": "0"})
+
+	withdrawal := &models.Withdrawal{Reference: "WD_1", Amount: 70}
+	result, err := Provider{}.Payout(withdrawal, &payments.Payee{Phone: "+254 712 345 678"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ID != "AG_payout" || result.Status != "pending" {
+		t.Errorf("payout = %+v, want pending AG_payout", result)
+	}
+	if withdrawal.RecipientCode != "254712345678" {
+		t.Errorf("withdrawal paid to %q", withdrawal.RecipientCode)
+	}
+	payment := daraja.request("/mpesa/b2c/v1/paymentrequest")
+	if payment["PartyB"] != "254712345678" || payment["Amount"] != 70.0 ||
+		payment["OriginatorConversationID"] != "WD_1" || payment["Occasion"] != "WD_1" {
+		t.Errorf("B2C payment %v", payment)
+	}
+	if kind := callbackKind(t, payment, "ResultURL"); kind != "payout" {
+		t.Errorf("B2C payment reports to kind %q", kind)
+	}
+
+	if _, err := (Provider{}).Payout(&models.Withdrawal{Reference: "WD_2", Amount: 70}, &payments.Payee{}); !errors.Is(err, services.ErrNoPhoneNumber) {
+		t.Errorf("payout without a phone: %v", err)
+	}
+	if _, err := (Provider{}).Payout(&models.Withdrawal{Reference: "WD_3", Amount: 70.5}, &payments.Payee{Phone: "0712345678"}); !errors.Is(err, payments.ErrPayoutUnsupported) {
+		t.Errorf("payout of cents: %v", err)
+	}
+	t.Setenv("BASE_CURRENCY", "USD")
+	if _, err := (Provider{}).Payout(&models.Withdrawal{Reference: "WD_4", Amount: 70}, &payments.Payee{Phone: "0712345678"}); !errors.Is(err, payments.ErrPayoutUnsupported) {
+		t.Errorf("payout of dollars: %v", err)
+	}
+}
+
+func TestVerifyPayoutQueriesStatus(t *testing.T) {
+	daraja := newFakeDaraja(t)
+	daraja.reply("/mpesa/transactionstatus/v1/query", http.StatusOK, map[string]string{"ConversationID": "AG_query", "ResponseCode": "0"})
+
+	result, err := Provider{}.VerifyPayout(models.Withdrawal{Reference: "WD_1", TransferCode: "AG_payout"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != "pending" || result.ID != "AG_payout" {
+		t.Errorf("status query = %+v, want the payout still pending", result)
+	}
+	query := daraja.request("/mpesa/transactionstatus/v1/query")
+	if query["OriginalConversationID"] != "WD_1" || query["Occasion"] != "WD_1" {
+		t.Errorf("status query %v does not name the withdrawal", query)
+	}
+	if kind := callbackKind(t, query, "ResultURL"); kind != "payout_status" {
+		t.Errorf("status query reports to kind %q", kind)
+	}
+}
@@ -0,0 +1,156 @@
+// Package payments holds what the payment providers share: the interface
+// charges, refunds and payouts go through and the types they exchange. The
+// adapters live in their own packages.
+package payments
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/keyadaniel56/algocdk/internal/models"
+)
+
+// Payment channels, as stored in Transaction.PaymentChannel and
+// Withdrawal.PayoutChannel
+const (
+	ChannelPaystack = "Paystack"
+	ChannelMPesa    = "M-Pesa"
+	ChannelStripe   = "Stripe"
+)
+
+var (
+	ErrUnknownProvider   = errors.New("unknown payment provider")
+	ErrPayoutUnsupported = errors.New("this payment provider cannot pay out")
+	ErrUnsupportedCharge = errors.New("this payment provider cannot take the charge")
+	ErrInvalidSignature  = errors.New("invalid webhook signature")
+	ErrPayoutNotFound    = errors.New("the payment provider has no record of this payout")
+)
+
+// PaymentProvider is a payment service charges, refunds and payouts go
+// through. Amounts are in major units of the currency they are charged in.
+type PaymentProvider interface {
+	// Name is the payment channel transactions of the provider record
+	Name() string
+	// Initialize starts charge and tells the payer how to complete it
+	Initialize(charge Charge) (*Checkout, error)
+	// Verify asks the provider how the charge of transaction went. An error
+	// means the provider could not be asked.
+	Verify(transaction models.Transaction) (*Verification, error)
+	// ParseWebhook authenticates a webhook request and reduces it to what
+	// happened
+	ParseWebhook(r *http.Request, body []byte) (*Notification, error)
+	// Refund returns amount of transaction's charge to the payer
+	Refund(transaction models.Transaction, amount float64, note string) (*ProviderResult, error)
+	// Payout sends a processing withdrawal to payee
+	Payout(withdrawal *models.Withdrawal, payee *Payee) (*ProviderResult, error)
+}
+
+// PayoutVerifier is a provider that can be asked how a payout went, for
+// when its webhook was missed
+type PayoutVerifier interface {
+	// VerifyPayout asks how the payout of a processing withdrawal went.
+	// ErrPayoutNotFound means it never reached the provider; a provider
+	// that answers through its webhook returns "pending".
+	VerifyPayout(withdrawal models.Withdrawal) (*ProviderResult, error)
+}
+
+// Charge is a payment to start
+type Charge struct {
+	Reference   string
+	Email       string
+	Phone       string // the payer's mobile money number
+	Amount      float64
+	Currency    string
+	Description string
+	Subaccount  string  // Paystack subaccount the admin share is split to
+	PlatformFee float64 // the platform's part of Amount when it is split
+}
+
+// Checkout is a started charge
+type Checkout struct {
+	ProviderReference string                 // the provider's ID for the charge, when it is not our reference
+	AuthorizationURL  string                 // where to send the payer, if anywhere
+	Data              map[string]interface{} // passed on to the frontend
+}
+
+// Verification is the state of a charge as the provider reports it
+type Verification struct {
+	Found      bool        // false when the provider does not know the charge
+	Status     string      // "success", "pending", "failed", "reversed" or "abandoned"
+	Amount     float64     // what was collected, in Currency
+	Currency   string      // empty when the provider does not say
+	ChargeID   string      // the provider's ID of the completed payment, which refunds name
+	Subaccount string      // the Paystack subaccount the charge was split to
+	Message    string      // the provider's explanation of a failure
+	Data       interface{} // the provider's response, passed on to the frontend
+}
+
+// Notification is a webhook reduced to what happened. Event is one of
+// "charge.success", "charge.failed", "charge.expired", "refund.processed",
+// "refund.failed", "transfer.success", "transfer.failed" or
+// "transfer.reversed", or the provider's own name for anything else.
+type Notification struct {
+	Event             string
+	Reference         string // our reference of the charge, or of the withdrawal a transfer pays
+	ProviderReference string // the provider's ID of the charge
+	ProviderID        string // the refund or transfer an event is about
+	ChargeID          string // the provider's ID of the payment
+	Amount            float64
+	Payload           []byte
+}
+
+// Payee is who a withdrawal is paid out to: an admin, or a user who resold
+// a license
+type Payee struct {
+	BankCode      string
+	AccountNumber string
+	AccountName   string
+	Phone         string // for mobile money
+	RecipientCode string // the Paystack transfer recipient of the bank account, once created
+}
+
+// ProviderResult is the provider's answer to a refund or payout: its ID and
+// "success", "pending" or "failed"
+type ProviderResult struct {
+	ID     string
+	Status string
+}
+
+// APIError is a request a payment provider answered and turned down, as
+// opposed to one whose outcome is unknown
+type APIError struct {
+	Provider   string
+	StatusCode int
+	Code       string // the provider's error code, if it gives one
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	provider := e.Provider
+	if provider == "" {
+		provider = "payment provider"
+	}
+	return fmt.Sprintf("%s error: %s", provider, e.Message)
+}
+
+// MinorUnits is amount in hundredths of the currency, the kobo or cents
+// most providers take amounts in, rounded rather than truncated so that
+// e.g. 19.99 is not sent as 1998
+func MinorUnits(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// ID is an ID a provider sends as a number or a string
+type ID string
+
+func (id *ID) UnmarshalJSON(raw []byte) error {
+	if string(raw) == "null" {
+		*id = ""
+		return nil
+	}
+	*id = ID(strings.Trim(string(raw), `"`))
+	return nil
+}
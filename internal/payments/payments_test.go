@@ -0,0 +1,35 @@
+package payments
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMinorUnitsRounds(t *testing.T) {
+	cases := map[float64]int64{
+		0:       0,
+		19.99:   1999,
+		0.29:    29,
+		4999.95: 499995,
+		1234.56: 123456,
+	}
+	for amount, want := range cases {
+		if got := MinorUnits(amount); got != want {
+			t.Errorf("MinorUnits(%v) = %d, want %d", amount, got, want)
+		}
+	}
+}
+
+func TestIDAcceptsNumbersAndStrings(t *testing.T) {
+	var got struct {
+		A ID `json:"a"`
+		B ID `json:"b"`
+		C ID `json:"c"`
+	}
+	if err := json.Unmarshal([]byte(`{"a": 1234, "b": "rf_5", "c": null}`), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.A != "1234" || got.B != "rf_5" || got.C != "" {
+		t.Errorf("got %+v", got)
+	}
+}
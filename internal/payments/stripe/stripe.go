@@ -0,0 +1,354 @@
+package stripe
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/keyadaniel56/algocdk/internal/models"
+	"github.com/keyadaniel56/algocdk/internal/payments"
+	services "github.com/keyadaniel56/algocdk/service"
+)
+
+// Provider charges cards through Stripe Checkout. The platform
+// collects the whole charge and owes admins their share in the ledger. It
+// needs STRIPE_SECRET_KEY and STRIPE_WEBHOOK_SECRET, and returns payers to
+// STRIPE_SUCCESS_URL or PAYSTACK_CALLBACK_URL.
+type Provider struct{}
+
+// defaultBaseURL is Stripe's API. STRIPE_BASE_URL overrides it, e.g.
+// with a local stub.
+const defaultBaseURL = "https://api.stripe.com"
+
+// signatureTolerance is how old a signed webhook may be
+const signatureTolerance = 5 * time.Minute
+
+// zeroDecimal are the currencies Stripe takes in major units
+var zeroDecimal = map[string]bool{
+	"BIF": true, "CLP": true, "DJF": true, "GNF": true, "JPY": true, "KMF": true, "KRW": true, "MGA": true,
+	"PYG": true, "RWF": true, "UGX": true, "VND": true, "VUV": true, "XAF": true, "XOF": true, "XPF": true,
+}
+
+func apiURL(path string) string {
+	base := os.Getenv("STRIPE_BASE_URL")
+	if base == "" {
+		base = defaultBaseURL
+	}
+	return strings.TrimRight(base, "/") + path
+}
+
+// minorUnits converts amount into the smallest unit of currency
+func minorUnits(amount float64, currency string) int64 {
+	if zeroDecimal[services.NormalizeCurrency(currency)] {
+		return int64(math.Round(amount))
+	}
+	return payments.MinorUnits(amount)
+}
+
+func majorUnits(minor int64, currency string) float64 {
+	if zeroDecimal[services.NormalizeCurrency(currency)] {
+		return float64(minor)
+	}
+	return float64(minor) / 100
+}
+
+// call sends form to the Stripe API and decodes the response into
+// out. Stripe turned the request down on a 4xx; a 5xx leaves the outcome
+// unknown.
+func call(method, path string, form url.Values, out interface{}) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, _ := http.NewRequest(method, apiURL(path), body)
+	req.Header.Add("Authorization", "Bearer "+os.Getenv("STRIPE_SECRET_KEY"))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Stripe API error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("Stripe returned %d: %s", resp.StatusCode, string(respBody))
+	}
+	if resp.StatusCode >= 300 {
+		var failure struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.Unmarshal(respBody, &failure)
+		return &payments.APIError{Provider: payments.ChannelStripe, StatusCode: resp.StatusCode, Code: failure.Error.Code, Message: failure.Error.Message}
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to parse Stripe response: %v", err)
+	}
+	return nil
+}
+
+// returnURL is where Checkout sends the payer back to, with the
+// reference HandleCallbackRedirect verifies
+func returnURL(env, reference string) (string, error) {
+	base := os.Getenv(env)
+	if base == "" {
+		base = os.Getenv("STRIPE_SUCCESS_URL")
+	}
+	if base == "" {
+		base = os.Getenv("PAYSTACK_CALLBACK_URL")
+	}
+	target, err := url.Parse(base)
+	if err != nil || base == "" {
+		return "", errors.New("STRIPE_SUCCESS_URL is not set")
+	}
+	query := target.Query()
+	query.Set("reference", reference)
+	target.RawQuery = query.Encode()
+	return target.String(), nil
+}
+
+// checkoutSession is the part of a Checkout Session we use
+type checkoutSession struct {
+	ID                string `json:"id"`
+	URL               string `json:"url"`
+	ClientReferenceID string `json:"client_reference_id"`
+	Status            string `json:"status"`         // "open", "complete" or "expired"
+	PaymentStatus     string `json:"payment_status"` // "paid", "unpaid" or "no_payment_required"
+	AmountTotal       int64  `json:"amount_total"`
+	Currency          string `json:"currency"`
+	PaymentIntent     string `json:"payment_intent"`
+}
+
+func (Provider) Name() string { return payments.ChannelStripe }
+
+// Initialize creates a Checkout Session for the charge
+func (Provider) Initialize(charge payments.Charge) (*payments.Checkout, error) {
+	successURL, err := returnURL("STRIPE_SUCCESS_URL", charge.Reference)
+	if err != nil {
+		return nil, err
+	}
+	cancelURL, err := returnURL("STRIPE_CANCEL_URL", charge.Reference)
+	if err != nil {
+		return nil, err
+	}
+	name := charge.Description
+	if name == "" {
+		name = "Algocdk"
+	}
+
+	form := url.Values{}
+	form.Set("mode", "payment")
+	form.Set("client_reference_id", charge.Reference)
+	form.Set("metadata[reference]", charge.Reference)
+	form.Set("payment_intent_data[metadata][reference]", charge.Reference)
+	form.Set("customer_email", charge.Email)
+	form.Set("line_items[0][quantity]", "1")
+	form.Set("line_items[0][price_data][currency]", strings.ToLower(charge.Currency))
+	form.Set("line_items[0][price_data][unit_amount]", strconv.FormatInt(minorUnits(charge.Amount, charge.Currency), 10))
+	form.Set("line_items[0][price_data][product_data][name]", name)
+	form.Set("success_url", successURL)
+	form.Set("cancel_url", cancelURL)
+
+	var session checkoutSession
+	if err := call("POST", "/v1/checkout/sessions", form, &session); err != nil {
+		return nil, err
+	}
+	return &payments.Checkout{
+		ProviderReference: session.ID,
+		AuthorizationURL:  session.URL,
+		Data: map[string]interface{}{
+			"reference":         charge.Reference,
+			"session_id":        session.ID,
+			"authorization_url": session.URL,
+		},
+	}, nil
+}
+
+func (Provider) Verify(transaction models.Transaction) (*payments.Verification, error) {
+	if transaction.ProviderReference == "" {
+		return &payments.Verification{Found: false, Message: "no Checkout Session for this transaction"}, nil
+	}
+
+	var session checkoutSession
+	err := call("GET", "/v1/checkout/sessions/"+url.PathEscape(transaction.ProviderReference), nil, &session)
+	var apiErr *payments.APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return &payments.Verification{Found: false, Message: apiErr.Message}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	verification := &payments.Verification{
+		Found:    true,
+		Status:   "pending",
+		Amount:   majorUnits(session.AmountTotal, session.Currency),
+		Currency: strings.ToUpper(session.Currency),
+		ChargeID: session.PaymentIntent,
+		Data:     session,
+	}
+	switch {
+	case session.PaymentStatus == "paid":
+		verification.Status = "success"
+	case session.Status == "expired":
+		verification.Status = "abandoned"
+	}
+	return verification, nil
+}
+
+// ParseWebhook checks the Stripe-Signature header, an HMAC-SHA256 of the
+// timestamp and body with STRIPE_WEBHOOK_SECRET
+func (Provider) ParseWebhook(r *http.Request, body []byte) (*payments.Notification, error) {
+	if !validSignature(r.Header.Get("Stripe-Signature"), body, os.Getenv("STRIPE_WEBHOOK_SECRET"), time.Now()) {
+		return nil, payments.ErrInvalidSignature
+	}
+
+	var event struct {
+		Type string `json:"type"`
+		Data struct {
+			Object json.RawMessage `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, err
+	}
+	notification := &payments.Notification{Event: event.Type, Payload: body}
+
+	switch {
+	case strings.HasPrefix(event.Type, "checkout.session."):
+		var session checkoutSession
+		if err := json.Unmarshal(event.Data.Object, &session); err != nil {
+			return nil, err
+		}
+		notification.Reference = session.ClientReferenceID
+		notification.ProviderReference = session.ID
+		notification.ChargeID = session.PaymentIntent
+		notification.Amount = majorUnits(session.AmountTotal, session.Currency)
+		switch event.Type {
+		case "checkout.session.completed":
+			// Delayed payment methods complete unpaid and report later
+			if session.PaymentStatus == "paid" {
+				notification.Event = "charge.success"
+			}
+		case "checkout.session.async_payment_succeeded":
+			notification.Event = "charge.success"
+		case "checkout.session.async_payment_failed":
+			notification.Event = "charge.failed"
+		case "checkout.session.expired":
+			notification.Event = "charge.expired"
+		}
+	case strings.HasPrefix(event.Type, "refund."):
+		var refund struct {
+			ID            string `json:"id"`
+			Status        string `json:"status"`
+			Amount        int64  `json:"amount"`
+			Currency      string `json:"currency"`
+			PaymentIntent string `json:"payment_intent"`
+			Metadata      struct {
+				Reference string `json:"reference"`
+			} `json:"metadata"`
+		}
+		if err := json.Unmarshal(event.Data.Object, &refund); err != nil {
+			return nil, err
+		}
+		notification.ProviderID = refund.ID
+		notification.Reference = refund.Metadata.Reference
+		notification.ChargeID = refund.PaymentIntent
+		notification.Amount = majorUnits(refund.Amount, refund.Currency)
+		switch refund.Status {
+		case "succeeded":
+			notification.Event = "refund.processed"
+		case "failed", "canceled":
+			notification.Event = "refund.failed"
+		}
+	}
+	return notification, nil
+}
+
+// validSignature checks a Stripe-Signature header of the form
+// t=<unix time>,v1=<hex hmac>[,v1=...] against body
+func validSignature(header string, body []byte, secret string, now time.Time) bool {
+	if secret == "" {
+		return false
+	}
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := now.Sub(time.Unix(signedAt, 0)); age > signatureTolerance || age < -signatureTolerance {
+		return false
+	}
+
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(timestamp + "."))
+	h.Write(body)
+	expected := hex.EncodeToString(h.Sum(nil))
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Refund refunds part or all of the charge's PaymentIntent
+func (Provider) Refund(transaction models.Transaction, amount float64, note string) (*payments.ProviderResult, error) {
+	if transaction.ProviderChargeID == "" {
+		return nil, fmt.Errorf("%w: no Stripe payment for this transaction", payments.ErrUnsupportedCharge)
+	}
+
+	form := url.Values{}
+	form.Set("payment_intent", transaction.ProviderChargeID)
+	form.Set("amount", strconv.FormatInt(minorUnits(amount, services.TransactionCurrency(transaction)), 10))
+	form.Set("metadata[reference]", transaction.Reference)
+	if note != "" {
+		form.Set("metadata[note]", note)
+	}
+	var refund struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	if err := call("POST", "/v1/refunds", form, &refund); err != nil {
+		return nil, err
+	}
+
+	status := "pending"
+	switch refund.Status {
+	case "succeeded":
+		status = "success"
+	case "failed", "canceled":
+		status = "failed"
+	}
+	return &payments.ProviderResult{ID: refund.ID, Status: status}, nil
+}
+
+// Payout is not offered: payees are not Stripe connected accounts
+func (Provider) Payout(withdrawal *models.Withdrawal, payee *payments.Payee) (*payments.ProviderResult, error) {
+	return nil, payments.ErrPayoutUnsupported
+}
@@ -0,0 +1,322 @@
+package stripe
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/keyadaniel56/algocdk/internal/models"
+	"github.com/keyadaniel56/algocdk/internal/payments"
+)
+
+const webhookSecret = "whsec_test"
+
+// fakeStripe stands in for the Stripe API. It answers "METHOD /path"
+// routes it was told to and remembers the form posted to each.
+type fakeStripe struct {
+	t       *testing.T
+	mu      sync.Mutex
+	replies map[string]func(w http.ResponseWriter)
+	posted  map[string]url.Values
+}
+
+// newFakeStripe starts a fake Stripe and points the package at it
+func newFakeStripe(t *testing.T) *fakeStripe {
+	f := &fakeStripe{t: t, replies: map[string]func(http.ResponseWriter){}, posted: map[string]url.Values{}}
+	server := httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(server.Close)
+	t.Setenv("STRIPE_BASE_URL", server.URL)
+	t.Setenv("STRIPE_SECRET_KEY", "sk_test_stripe")
+	t.Setenv("STRIPE_SUCCESS_URL", "https://algocdk.test/payment/callback")
+	t.Setenv("STRIPE_CANCEL_URL", "")
+	return f
+}
+
+func (f *fakeStripe) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer sk_test_stripe" {
+		f.t.Errorf("%s %s sent without the secret key", r.Method, r.URL.Path)
+	}
+	route := r.Method + " " + r.URL.Path
+	r.ParseForm()
+
+	f.mu.Lock()
+	f.posted[route] = r.PostForm
+	reply := f.replies[route]
+	f.mu.Unlock()
+	if reply == nil {
+		f.t.Errorf("unexpected Stripe request %s", route)
+		http.Error(w, `{"error":{"code":"resource_missing"}}`, http.StatusNotFound)
+		return
+	}
+	reply(w)
+}
+
+// reply answers route with status and body
+func (f *fakeStripe) reply(route string, status int, body interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.replies[route] = func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+// form is the last form posted to route
+func (f *fakeStripe) form(route string) url.Values {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.posted[route]
+}
+
+// sign is the Stripe-Signature header of body sent at signedAt
+func sign(body []byte, secret string, signedAt time.Time) string {
+	timestamp := fmt.Sprint(signedAt.Unix())
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(timestamp + "."))
+	h.Write(body)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(h.Sum(nil))
+}
+
+// event is a webhook of type about object, signed now
+func event(t *testing.T, eventType string, object interface{}) (*http.Request, []byte) {
+	t.Helper()
+	body, err := json.Marshal(map[string]interface{}{"type": eventType, "data": map[string]interface{}{"object": object}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("POST", "/api/payment/webhook/stripe", strings.NewReader(string(body)))
+	r.Header.Set("Stripe-Signature", sign(body, webhookSecret, time.Now()))
+	return r, body
+}
+
+func TestInitializeCreatesCheckoutSession(t *testing.T) {
+	stripe := newFakeStripe(t)
+	stripe.reply("POST /v1/checkout/sessions", http.StatusOK, map[string]string{"id": "cs_1", "url": "https://checkout.stripe.test/cs_1"})
+
+	checkout, err := Provider{}.Initialize(payments.Charge{Reference: "TX_1", Email: "buyer@example.com", Amount: 12.34, Currency: "USD", Description: "Trend"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkout.ProviderReference != "cs_1" || checkout.AuthorizationURL != "https://checkout.stripe.test/cs_1" {
+		t.Errorf("checkout = %+v", checkout)
+	}
+	form := stripe.form("POST /v1/checkout/sessions")
+	for field, want := range map[string]string{
+		"client_reference_id":                           "TX_1",
+		"metadata[reference]":                           "TX_1",
+		"payment_intent_data[metadata][reference]":      "TX_1",
+		"line_items[0][price_data][currency]":           "usd",
+		"line_items[0][price_data][unit_amount]":        "1234",
+		"line_items[0][price_data][product_data][name]": "Trend",
+		"success_url":                                   "https://algocdk.test/payment/callback?reference=TX_1",
+		"cancel_url":                                    "https://algocdk.test/payment/callback?reference=TX_1",
+	} {
+		if got := form.Get(field); got != want {
+			t.Errorf("%s = %q, want %q", field, got, want)
+		}
+	}
+
+	// Zero-decimal currencies are sent in major units
+	if _, err := (Provider{}).Initialize(payments.Charge{Reference: "TX_2", Amount: 1500, Currency: "UGX"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := stripe.form("POST /v1/checkout/sessions").Get("line_items[0][price_data][unit_amount]"); got != "1500" {
+		t.Errorf("UGX 1500 sent as %s", got)
+	}
+
+	stripe.reply("POST /v1/checkout/sessions", http.StatusBadRequest, map[string]interface{}{
+		"error": map[string]string{"code": "amount_too_small", "message": "Amount must be at least 50 cents"},
+	})
+	var apiErr *payments.APIError
+	if _, err := (Provider{}).Initialize(payments.Charge{Reference: "TX_3", Amount: 0.1, Currency: "USD"}); !errors.As(err, &apiErr) || apiErr.Code != "amount_too_small" {
+		t.Errorf("declined session: %v", err)
+	}
+}
+
+func TestVerifyReadsCheckoutSession(t *testing.T) {
+	stripe := newFakeStripe(t)
+	transaction := models.Transaction{Reference: "TX_1", ProviderReference: "cs_1"}
+
+	for _, c := range []struct {
+		status, paymentStatus, want string
+	}{
+		{"complete", "paid", "success"},
+		{"open", "unpaid", "pending"},
+		{"complete", "unpaid", "pending"},
+		{"expired", "unpaid", "abandoned"},
+	} {
+		stripe.reply("GET /v1/checkout/sessions/cs_1", http.StatusOK, map[string]interface{}{
+			"id": "cs_1", "client_reference_id": "TX_1", "status": c.status, "payment_status": c.paymentStatus,
+			"amount_total": 1234, "currency": "usd", "payment_intent": "pi_1",
+		})
+		verification, err := Provider{}.Verify(transaction)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !verification.Found || verification.Status != c.want {
+			t.Errorf("%s/%s session verified as %s, want %s", c.status, c.paymentStatus, verification.Status, c.want)
+		}
+		if verification.Amount != 12.34 || verification.Currency != "USD" || verification.ChargeID != "pi_1" {
+			t.Errorf("session verified as %+v", verification)
+		}
+	}
+
+	stripe.reply("GET /v1/checkout/sessions/cs_1", http.StatusNotFound, map[string]interface{}{
+		"error": map[string]string{"code": "resource_missing", "message": "No such checkout.session"},
+	})
+	verification, err := Provider{}.Verify(transaction)
+	if err != nil || verification.Found {
+		t.Errorf("unknown session verified as %+v, %v", verification, err)
+	}
+
+	stripe.reply("GET /v1/checkout/sessions/cs_1", http.StatusBadGateway, nil)
+	if _, err := (Provider{}).Verify(transaction); err == nil {
+		t.Error("Stripe outage verified without an error")
+	}
+
+	verification, err = Provider{}.Verify(models.Transaction{Reference: "TX_2"})
+	if err != nil || verification.Found {
+		t.Errorf("transaction without a session verified as %+v, %v", verification, err)
+	}
+}
+
+func TestValidSignatureTolerance(t *testing.T) {
+	body := []byte(`{"type":"checkout.session.completed"}`)
+	now := time.Now()
+
+	for name, c := range map[string]struct {
+		header string
+		secret string
+		want   bool
+	}{
+		"fresh":              {sign(body, webhookSecret, now), webhookSecret, true},
+		"within tolerance":   {sign(body, webhookSecret, now.Add(-signatureTolerance+time.Second)), webhookSecret, true},
+		"stale":              {sign(body, webhookSecret, now.Add(-signatureTolerance-time.Second)), webhookSecret, false},
+		"from the future":    {sign(body, webhookSecret, now.Add(signatureTolerance+time.Second)), webhookSecret, false},
+		"other secret":       {sign(body, "whsec_other", now), webhookSecret, false},
+		"no secret":          {sign(body, "", now), "", false},
+		"no timestamp":       {"v1=" + strings.TrimPrefix(sign(body, webhookSecret, now), "t="), webhookSecret, false},
+		"empty":              {"", webhookSecret, false},
+		"one of two secrets": {sign(body, "whsec_old", now) + ",v1=" + strings.SplitN(sign(body, webhookSecret, now), "v1=", 2)[1], webhookSecret, true},
+	} {
+		if got := validSignature(c.header, body, c.secret, now); got != c.want {
+			t.Errorf("%s: valid = %v, want %v", name, got, c.want)
+		}
+	}
+
+	tampered := []byte(`{"type":"checkout.session.completed","livemode":true}`)
+	if validSignature(sign(body, webhookSecret, now), tampered, webhookSecret, now) {
+		t.Error("signature accepted for a tampered body")
+	}
+}
+
+func TestParseWebhook(t *testing.T) {
+	t.Setenv("STRIPE_WEBHOOK_SECRET", webhookSecret)
+	session := func(paymentStatus string) map[string]interface{} {
+		return map[string]interface{}{
+			"id": "cs_1", "client_reference_id": "TX_1", "payment_status": paymentStatus,
+			"amount_total": 1234, "currency": "usd", "payment_intent": "pi_1",
+		}
+	}
+
+	for _, c := range []struct {
+		eventType, paymentStatus, want string
+	}{
+		{"checkout.session.completed", "paid", "charge.success"},
+		{"checkout.session.completed", "unpaid", "checkout.session.completed"},
+		{"checkout.session.async_payment_succeeded", "paid", "charge.success"},
+		{"checkout.session.async_payment_failed", "unpaid", "charge.failed"},
+		{"checkout.session.expired", "unpaid", "charge.expired"},
+	} {
+		r, body := event(t, c.eventType, session(c.paymentStatus))
+		notification, err := Provider{}.ParseWebhook(r, body)
+		if err != nil {
+			t.Fatalf("%s: %v", c.eventType, err)
+		}
+		if notification.Event != c.want {
+			t.Errorf("%s (%s) read as %s, want %s", c.eventType, c.paymentStatus, notification.Event, c.want)
+		}
+		if notification.Reference != "TX_1" || notification.ProviderReference != "cs_1" ||
+			notification.ChargeID != "pi_1" || notification.Amount != 12.34 {
+			t.Errorf("%s read as %+v", c.eventType, notification)
+		}
+	}
+
+	for status, want := range map[string]string{"succeeded": "refund.processed", "failed": "refund.failed", "canceled": "refund.failed", "pending": "refund.updated"} {
+		r, body := event(t, "refund.updated", map[string]interface{}{
+			"id": "re_1", "status": status, "amount": 500, "currency": "usd", "payment_intent": "pi_1",
+			"metadata": map[string]string{"reference": "TX_1"},
+		})
+		notification, err := Provider{}.ParseWebhook(r, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if notification.Event != want || notification.ProviderID != "re_1" || notification.Reference != "TX_1" ||
+			notification.ChargeID != "pi_1" || notification.Amount != 5 {
+			t.Errorf("%s refund read as %+v, want %s", status, notification, want)
+		}
+	}
+
+	// A replay signed outside the tolerance is turned away
+	r, body := event(t, "checkout.session.completed", session("paid"))
+	r.Header.Set("Stripe-Signature", sign(body, webhookSecret, time.Now().Add(-time.Hour)))
+	if _, err := (Provider{}).ParseWebhook(r, body); !errors.Is(err, payments.ErrInvalidSignature) {
+		t.Errorf("stale webhook: %v, want ErrInvalidSignature", err)
+	}
+	r, body = event(t, "checkout.session.completed", session("paid"))
+	r.Header.Del("Stripe-Signature")
+	if _, err := (Provider{}).ParseWebhook(r, body); !errors.Is(err, payments.ErrInvalidSignature) {
+		t.Errorf("unsigned webhook: %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestRefundRefundsPaymentIntent(t *testing.T) {
+	stripe := newFakeStripe(t)
+	transaction := models.Transaction{Reference: "TX_1", ProviderChargeID: "pi_1", Currency: "USD"}
+
+	for status, want := range map[string]string{"succeeded": "success", "pending": "pending", "failed": "failed", "canceled": "failed"} {
+		stripe.reply("POST /v1/refunds", http.StatusOK, map[string]string{"id": "re_1", "status": status})
+		result, err := Provider{}.Refund(transaction, 5.5, "duplicate purchase")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.ID != "re_1" || result.Status != want {
+			t.Errorf("%s refund = %+v, want %s", status, result, want)
+		}
+	}
+	form := stripe.form("POST /v1/refunds")
+	if form.Get("payment_intent") != "pi_1" || form.Get("amount") != "550" ||
+		form.Get("metadata[reference]") != "TX_1" || form.Get("metadata[note]") != "duplicate purchase" {
+		t.Errorf("refund form %v", form)
+	}
+
+	stripe.reply("POST /v1/refunds", http.StatusBadRequest, map[string]interface{}{
+		"error": map[string]string{"code": "charge_already_refunded", "message": "Charge has already been refunded"},
+	})
+	var apiErr *payments.APIError
+	if _, err := (Provider{}).Refund(transaction, 5.5, ""); !errors.As(err, &apiErr) || apiErr.Code != "charge_already_refunded" {
+		t.Errorf("declined refund: %v", err)
+	}
+
+	if _, err := (Provider{}).Refund(models.Transaction{Reference: "TX_2"}, 5.5, ""); !errors.Is(err, payments.ErrUnsupportedCharge) {
+		t.Errorf("refund without a payment: %v", err)
+	}
+}
+
+func TestPayoutIsUnsupported(t *testing.T) {
+	newFakeStripe(t)
+	if _, err := (Provider{}).Payout(&models.Withdrawal{Reference: "WD_1", Amount: 70}, &payments.Payee{}); !errors.Is(err, payments.ErrPayoutUnsupported) {
+		t.Errorf("payout: %v, want ErrPayoutUnsupported", err)
+	}
+}
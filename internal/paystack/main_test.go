@@ -0,0 +1,226 @@
+package paystack
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const testSecretKey = "sk_test_secret"
+
+// fakePaystack stands in for the Paystack API. Routes are "METHOD /path"
+// prefixes; a request no route matches fails the test.
+type fakePaystack struct {
+	t      *testing.T
+	mu     sync.Mutex
+	routes map[string]http.HandlerFunc
+	calls  map[string]int
+}
+
+// newFakePaystack starts a fake Paystack and points the package at it
+func newFakePaystack(t *testing.T) *fakePaystack {
+	f := &fakePaystack{t: t, routes: map[string]http.HandlerFunc{}, calls: map[string]int{}}
+	server := httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(server.Close)
+	t.Setenv("PAYSTACK_BASE_URL", server.URL)
+	t.Setenv("PAYSTACK_SECRET_KEY", testSecretKey)
+	return f
+}
+
+func (f *fakePaystack) serve(w http.ResponseWriter, r *http.Request) {
+	request := r.Method + " " + r.URL.Path
+	f.mu.Lock()
+	var match string
+	for route := range f.routes {
+		if strings.HasPrefix(request, route) && len(route) > len(match) {
+			match = route
+		}
+	}
+	handler := f.routes[match]
+	if match != "" {
+		f.calls[match]++
+	}
+	f.mu.Unlock()
+
+	if handler == nil {
+		f.t.Errorf("unexpected Paystack request %s", request)
+		http.Error(w, `{"status":false,"message":"not found"}`, http.StatusNotFound)
+		return
+	}
+	handler(w, r)
+}
+
+// reply answers route with status and data wrapped the way Paystack wraps
+// it
+func (f *fakePaystack) reply(route string, status int, data interface{}) {
+	f.handle(route, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  status < 300,
+			"message": http.StatusText(status),
+			"data":    data,
+		})
+	})
+}
+
+func (f *fakePaystack) handle(route string, handler http.HandlerFunc) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.routes[route] = handler
+}
+
+// count is how many requests route answered
+func (f *fakePaystack) count(route string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[route]
+}
+
+// verified is the data of a verification of a successful charge of amount
+func verified(reference string, amount float64) map[string]interface{} {
+	return map[string]interface{}{
+		"reference": reference,
+		"status":    "success",
+		"amount":    int(amount * 100),
+		"currency":  "KES",
+	}
+}
+
+// setupDB gives the test an empty in-memory database
+func setupDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: is a database of its own
+	sqlDB.SetMaxOpenConns(1)
+	if err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = previous
+		sqlDB.Close()
+	})
+	t.Setenv("BASE_CURRENCY", "KES")
+}
+
+// testShop is an admin selling a bot and a user buying it
+type testShop struct {
+	admin models.Admin
+	buyer models.User
+	bot   models.Bot
+}
+
+func seedShop(t *testing.T) testShop {
+	t.Helper()
+	owner := models.User{Name: "Owner", Email: "owner@example.com", Role: "Admin"}
+	buyer := models.User{Name: "Buyer", Email: "buyer@example.com", Role: "user"}
+	for _, user := range []*models.User{&owner, &buyer} {
+		if err := database.DB.Create(user).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	admin := models.Admin{PersonID: owner.ID}
+	if err := database.DB.Create(&admin).Error; err != nil {
+		t.Fatal(err)
+	}
+	bot := models.Bot{Name: "Trend", Price: 100, RentPrice: 20, OwnerID: owner.ID}
+	if err := database.DB.Create(&bot).Error; err != nil {
+		t.Fatal(err)
+	}
+	return testShop{admin: admin, buyer: buyer, bot: bot}
+}
+
+// pendingPurchase is a checkout of the shop's bot waiting to be paid
+func pendingPurchase(t *testing.T, shop testShop, reference string) models.Transaction {
+	t.Helper()
+	transaction := models.Transaction{
+		UserID:         shop.buyer.ID,
+		AdminID:        shop.admin.ID,
+		BotID:          shop.bot.ID,
+		Amount:         shop.bot.Price,
+		Currency:       "KES",
+		ChargedAmount:  shop.bot.Price,
+		ExchangeRate:   1,
+		CompanyShare:   30,
+		AdminShare:     70,
+		CommissionRate: 0.3,
+		Reference:      reference,
+		Status:         "pending",
+		PaymentChannel: "Paystack",
+		PaymentType:    "purchase",
+	}
+	if err := database.DB.Create(&transaction).Error; err != nil {
+		t.Fatal(err)
+	}
+	return transaction
+}
+
+// testRouter serves handler at method path as the user userID
+func testRouter(userID uint, method, path string, handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Handle(method, path, func(c *gin.Context) {
+		c.Set("user_id", userID)
+		handler(c)
+	})
+	return router
+}
+
+// send makes a request to router and returns the response
+func send(router http.Handler, method, target string, body []byte, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// signedWebhook is a Paystack webhook of event about data, with the
+// signature Paystack would send
+func signedWebhook(t *testing.T, event string, data interface{}) ([]byte, http.Header) {
+	t.Helper()
+	body, err := json.Marshal(map[string]interface{}{"event": event, "data": data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := hmac.New(sha512.New, []byte(testSecretKey))
+	h.Write(body)
+	return body, http.Header{"X-Paystack-Signature": {hex.EncodeToString(h.Sum(nil))}}
+}
+
+// balance is the ledger balance of account
+func balance(t *testing.T, account string) float64 {
+	t.Helper()
+	var sum float64
+	if err := database.DB.Model(&models.LedgerEntry{}).Where("account = ?", account).
+		Select("COALESCE(SUM(credit - debit), 0)").Scan(&sum).Error; err != nil {
+		t.Fatal(err)
+	}
+	return sum
+}
@@ -0,0 +1,248 @@
+package paystack
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	"github.com/keyadaniel56/algocdk/internal/payments"
+	services "github.com/keyadaniel56/algocdk/service"
+)
+
+// ErrTransferNotFound is returned for transfer events of no withdrawal
+var ErrTransferNotFound = errors.New("no withdrawal for this transfer")
+
+// recipientType is the Paystack transfer recipient type of admin bank
+// accounts, "kepss" for Kenyan banks unless PAYSTACK_RECIPIENT_TYPE says
+// otherwise (e.g. "mobile_money")
+func recipientType() string {
+	if t := os.Getenv("PAYSTACK_RECIPIENT_TYPE"); t != "" {
+		return t
+	}
+	return "kepss"
+}
+
+// ensureRecipient returns the payee's Paystack transfer recipient, creating
+// it from their bank details the first time
+func ensureRecipient(payee *payments.Payee) (string, error) {
+	if payee.RecipientCode != "" {
+		return payee.RecipientCode, nil
+	}
+	if payee.BankCode == "" || payee.AccountNumber == "" || payee.AccountName == "" {
+		return "", services.ErrNoBankDetails
+	}
+
+	var recipient struct {
+		RecipientCode string `json:"recipient_code"`
+	}
+	if err := paystackCall("POST", "/transferrecipient", map[string]interface{}{
+		"type":           recipientType(),
+		"name":           payee.AccountName,
+		"account_number": payee.AccountNumber,
+		"bank_code":      payee.BankCode,
+		"currency":       services.BaseCurrency(),
+	}, &recipient); err != nil {
+		return "", err
+	}
+	payee.RecipientCode = recipient.RecipientCode
+	return payee.RecipientCode, nil
+}
+
+// withdrawalPayee returns who withdrawal pays: the admin, or the user who
+// resold a license
+func withdrawalPayee(withdrawal *models.Withdrawal) (payments.Payee, error) {
+	if withdrawal.UserID != 0 {
+		var user models.User
+		if err := database.DB.First(&user, withdrawal.UserID).Error; err != nil {
+			return payments.Payee{}, fmt.Errorf("user %d not found", withdrawal.UserID)
+		}
+		return payments.Payee{
+			BankCode:      user.BankCode,
+			AccountNumber: user.AccountNumber,
+			AccountName:   user.AccountName,
+			Phone:         user.PhoneNumber,
+			RecipientCode: user.PaystackRecipientCode,
+		}, nil
+	}
+
+	var admin models.Admin
+	if err := database.DB.First(&admin, withdrawal.AdminID).Error; err != nil {
+		return payments.Payee{}, fmt.Errorf("admin %d not found", withdrawal.AdminID)
+	}
+	payee := payments.Payee{
+		BankCode:      admin.BankCode,
+		AccountNumber: admin.AccountNumber,
+		AccountName:   admin.AccountName,
+		RecipientCode: admin.PaystackRecipientCode,
+	}
+	if admin.PhoneNumber != 0 {
+		payee.Phone = strconv.FormatInt(admin.PhoneNumber, 10)
+	}
+	return payee, nil
+}
+
+// saveRecipient keeps a Paystack transfer recipient created for the payee
+// of withdrawal, so later payouts reuse it
+func saveRecipient(withdrawal *models.Withdrawal, code string) {
+	var err error
+	if withdrawal.UserID != 0 {
+		err = database.DB.Model(&models.User{}).Where("id = ?", withdrawal.UserID).Update("paystack_recipient_code", code).Error
+	} else {
+		err = database.DB.Model(&models.Admin{}).Where("id = ?", withdrawal.AdminID).Update("paystack_recipient_code", code).Error
+	}
+	if err != nil {
+		log.Printf("Failed to save transfer recipient %s of withdrawal %d: %v", code, withdrawal.ID, err)
+		return
+	}
+	log.Printf("Transfer recipient %s created for withdrawal %d", code, withdrawal.ID)
+}
+
+// ApproveWithdrawal godoc
+// @Summary Approve a withdrawal
+// @Description Approves a pending withdrawal of an admin or resale seller and pays it out through its payout channel: a Paystack transfer to their bank account or an M-Pesa B2C payment to their phone. The withdrawal is paid once the provider confirms the payout.
+// @Tags superadmin
+// @Produce json
+// @Param id path int true "Withdrawal ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Success 202 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 502 {object} map[string]string
+// @Router /api/superadmin/withdrawals/{id}/approve [post]
+func ApproveWithdrawal(ctx *gin.Context) {
+	withdrawalID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid withdrawal id"})
+		return
+	}
+
+	withdrawal, err := services.ClaimWithdrawal(uint(withdrawalID), ctx.GetUint("user_id"))
+	if errors.Is(err, services.ErrWithdrawalNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrWithdrawalReviewed) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error(), "status": withdrawal.Status})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve withdrawal", "details": err.Error()})
+		return
+	}
+
+	if err := startTransfer(withdrawal); err != nil {
+		log.Printf("Failed to pay out withdrawal %d: %v", withdrawal.ID, err)
+		// A payout the provider may have accepted is left for reconciliation
+		if withdrawal.Reference != "" && !rejected(err) {
+			ctx.JSON(http.StatusAccepted, gin.H{"success": true, "withdrawal": withdrawal, "warning": "Transfer outcome unknown, it will be reconciled"})
+			return
+		}
+		if failErr := services.CompleteWithdrawal(withdrawal.ID, false, err.Error()); failErr != nil {
+			log.Printf("Failed to release withdrawal %d: %v", withdrawal.ID, failErr)
+		}
+		ctx.JSON(http.StatusBadGateway, gin.H{"error": "Failed to start transfer", "details": err.Error()})
+		return
+	}
+
+	database.DB.First(withdrawal, withdrawal.ID)
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "withdrawal": withdrawal})
+}
+
+// startTransfer pays a processing withdrawal out through its payout channel
+func startTransfer(withdrawal *models.Withdrawal) error {
+	payee, err := withdrawalPayee(withdrawal)
+	if err != nil {
+		return err
+	}
+	provider, err := ProviderFor(withdrawal.PayoutChannel)
+	if err != nil {
+		return err
+	}
+
+	withdrawal.Reference = fmt.Sprintf("WDR_%d_%d", withdrawal.ID, time.Now().Unix())
+	if err := database.DB.Model(withdrawal).Update("reference", withdrawal.Reference).Error; err != nil {
+		withdrawal.Reference = ""
+		return err
+	}
+
+	known := payee.RecipientCode
+	result, err := provider.Payout(withdrawal, &payee)
+	if payee.RecipientCode != known {
+		saveRecipient(withdrawal, payee.RecipientCode)
+	}
+	if err != nil {
+		return err
+	}
+
+	withdrawal.TransferCode = result.ID
+	withdrawal.TransferStatus = result.Status
+	if err := database.DB.Model(withdrawal).Updates(map[string]interface{}{
+		"recipient_code":  withdrawal.RecipientCode,
+		"transfer_code":   withdrawal.TransferCode,
+		"transfer_status": withdrawal.TransferStatus,
+	}).Error; err != nil {
+		return err
+	}
+	log.Printf("%s payout %s for withdrawal %d is %s", provider.Name(), withdrawal.TransferCode, withdrawal.ID, result.Status)
+
+	switch result.Status {
+	case "success":
+		return services.CompleteWithdrawal(withdrawal.ID, true, "")
+	case "failed":
+		return services.CompleteWithdrawal(withdrawal.ID, false, provider.Name()+" payout failed")
+	}
+	return nil
+}
+
+// ReconcileTransfers asks the payout channel of every withdrawal still
+// being paid out after staleAfter how its transfer went, in case a webhook
+// was missed. M-Pesa answers through its callback.
+func ReconcileTransfers(staleAfter time.Duration) {
+	channels := configuredChannels()
+	if os.Getenv("PAYSTACK_SECRET_KEY") != "" {
+		channels = append(channels, "")
+	}
+	var processing []models.Withdrawal
+	if err := database.DB.
+		Where("status = ? AND reference <> ? AND updated_at < ?", "processing", "", time.Now().Add(-staleAfter)).
+		Where("payout_channel IN ?", channels).
+		Find(&processing).Error; err != nil {
+		log.Printf("[Reconcile] failed to look up transfers: %v", err)
+		return
+	}
+	for _, withdrawal := range processing {
+		provider, err := ProviderFor(withdrawal.PayoutChannel)
+		if err != nil {
+			log.Printf("[Reconcile] cannot verify transfer %s: %v", withdrawal.Reference, err)
+			continue
+		}
+		verifier, ok := provider.(payments.PayoutVerifier)
+		if !ok {
+			continue
+		}
+		result, err := verifier.VerifyPayout(withdrawal)
+		if errors.Is(err, payments.ErrPayoutNotFound) {
+			// The transfer never reached the provider
+			services.CompleteWithdrawal(withdrawal.ID, false, "transfer not found")
+			continue
+		}
+		if err != nil {
+			log.Printf("[Reconcile] could not verify transfer %s: %v", withdrawal.Reference, err)
+			continue
+		}
+		switch result.Status {
+		case "success":
+			services.CompleteWithdrawal(withdrawal.ID, true, "")
+		case "failed":
+			services.CompleteWithdrawal(withdrawal.ID, false, "transfer failed")
+		}
+	}
+}
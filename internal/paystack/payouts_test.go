@@ -0,0 +1,143 @@
+package paystack
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	services "github.com/keyadaniel56/algocdk/service"
+)
+
+// earnedWithdrawal settles a purchase so the shop's admin is owed 70 and
+// claims a withdrawal of all of it through channel
+func earnedWithdrawal(t *testing.T, shop testShop, channel string) *models.Withdrawal {
+	t.Helper()
+	transaction := pendingPurchase(t, shop, "TX_earned")
+	if _, _, err := Settle(transaction.Reference, transaction.Amount, "test"); err != nil {
+		t.Fatal(err)
+	}
+	var admin models.Admin
+	database.DB.First(&admin, shop.admin.ID)
+	withdrawal, err := services.RequestWithdrawal(admin, 70, channel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claimed, err := services.ClaimWithdrawal(withdrawal.ID, 99)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return claimed
+}
+
+func TestReversedTransferReturnsPaidWithdrawal(t *testing.T) {
+	setupDB(t)
+	paystack := newFakePaystack(t)
+	paystack.reply("POST /transferrecipient", http.StatusOK, map[string]string{"recipient_code": "RCP_admin"})
+	paystack.reply("POST /transfer", http.StatusOK, map[string]string{"transfer_code": "TRF_1", "status": "success"})
+	shop := seedShop(t)
+	database.DB.Model(&shop.admin).Updates(map[string]interface{}{"bank_code": "01", "account_number": "0123456789", "account_name": "Owner"})
+
+	withdrawal := earnedWithdrawal(t, shop, "paystack")
+	if err := startTransfer(withdrawal); err != nil {
+		t.Fatal(err)
+	}
+	account := services.AdminAccount(shop.admin.ID)
+	if got := balance(t, account); got != 0 {
+		t.Fatalf("admin is owed %.2f after being paid", got)
+	}
+
+	router := testRouter(0, "POST", "/webhook", PaystackCallback)
+	body, header := signedWebhook(t, "transfer.reversed", map[string]string{"reference": withdrawal.Reference, "transfer_code": "TRF_1"})
+	if w := send(router, "POST", "/webhook", body, header); w.Code != http.StatusOK {
+		t.Fatalf("webhook: %d %s", w.Code, w.Body)
+	}
+
+	database.DB.First(withdrawal, withdrawal.ID)
+	if withdrawal.Status != "reversed" {
+		t.Errorf("withdrawal is %s, want reversed", withdrawal.Status)
+	}
+	if got := balance(t, account); got != 70 {
+		t.Errorf("admin is owed %.2f after the reversal, want 70", got)
+	}
+	// The processor holds the whole 100 collected again
+	if got := balance(t, services.AccountProcessor); got != -100 {
+		t.Errorf("processor balance is %.2f, want -100", got)
+	}
+	var release int64
+	database.DB.Model(&models.LedgerEntry{}).Where("journal_id = ? AND entry_type = ?",
+		fmt.Sprintf("withdrawal:%d:reversed", withdrawal.ID), "withdrawal_release").Count(&release)
+	if release != 2 {
+		t.Errorf("reversal booked %d withdrawal_release entries, want 2", release)
+	}
+}
+
+func TestReconcileTransfersQueriesMPesa(t *testing.T) {
+	setupDB(t)
+	var queried map[string]interface{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/v1/generate", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "token", "expires_in": "3599"})
+	})
+	mux.HandleFunc("/mpesa/b2c/v1/paymentrequest", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"ConversationID": "AG_1", "ResponseCode": "0"})
+	})
+	mux.HandleFunc("/mpesa/transactionstatus/v1/query", func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&queried)
+		json.NewEncoder(w).Encode(map[string]string{"ConversationID": "AG_2", "ResponseCode": "0"})
+	})
+	daraja := httptest.NewServer(mux)
+	defer daraja.Close()
+	t.Setenv("MPESA_BASE_URL", daraja.URL)
+	t.Setenv("MPESA_CONSUMER_KEY", "key")
+	t.Setenv("MPESA_CALLBACK_URL", "https://algocdk.test/api/payment/webhook/mpesa")
+	t.Setenv("MPESA_CALLBACK_TOKEN", "callback-token")
+	shop := seedShop(t)
+	database.DB.Model(&shop.admin).Update("phone_number", 254712345678)
+
+	withdrawal := earnedWithdrawal(t, shop, "mpesa")
+	if err := startTransfer(withdrawal); err != nil {
+		t.Fatal(err)
+	}
+	database.DB.Model(withdrawal).UpdateColumn("updated_at", time.Now().Add(-time.Hour))
+
+	ReconcileTransfers(10 * time.Minute)
+	if queried["OriginalConversationID"] != withdrawal.Reference || queried["Occasion"] != withdrawal.Reference {
+		t.Fatalf("status query %v does not name %s", queried, withdrawal.Reference)
+	}
+
+	router := testRouter(0, "POST", "/webhook/:provider", ProviderWebhook)
+	result := func(status string) []byte {
+		body, _ := json.Marshal(map[string]interface{}{"Result": map[string]interface{}{
+			"ResultCode": 0,
+			"ResultParameters": map[string]interface{}{"ResultParameter": []map[string]interface{}{
+				{"Key": "TransactionStatus", "Value": status},
+			}},
+			"ReferenceData": map[string]interface{}{"ReferenceItem": map[string]string{"Key": "Occasion", "Value": withdrawal.Reference}},
+		}})
+		return body
+	}
+	target := "/webhook/mpesa?kind=payout_status&token=callback-token"
+	if w := send(router, "POST", target, result("Completed"), nil); w.Code != http.StatusOK {
+		t.Fatalf("status callback: %d %s", w.Code, w.Body)
+	}
+	database.DB.First(withdrawal, withdrawal.ID)
+	if withdrawal.Status != "paid" {
+		t.Fatalf("withdrawal is %s after the status query, want paid", withdrawal.Status)
+	}
+
+	if w := send(router, "POST", target, result("Reversed"), nil); w.Code != http.StatusOK {
+		t.Fatalf("reversal callback: %d %s", w.Code, w.Body)
+	}
+	database.DB.First(withdrawal, withdrawal.ID)
+	if withdrawal.Status != "reversed" {
+		t.Errorf("withdrawal is %s, want reversed", withdrawal.Status)
+	}
+	if got := balance(t, services.AdminAccount(shop.admin.ID)); got != 70 {
+		t.Errorf("admin is owed %.2f after the reversal, want 70", got)
+	}
+}
@@ -1,22 +1,27 @@
 package paystack
 
 import (
-	"bytes"
-	"crypto/hmac"
-	"crypto/sha512"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/keyadaniel56/algocdk/internal/database"
 	"github.com/keyadaniel56/algocdk/internal/models"
+	"github.com/keyadaniel56/algocdk/internal/payments"
+	services "github.com/keyadaniel56/algocdk/service"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // PaystackSubaccount represents the subaccount object in Paystack response
@@ -41,6 +46,7 @@ type PaystackVerifyResponse struct {
 		Status     string             `json:"status"`
 		Amount     int                `json:"amount"`
 		Reference  string             `json:"reference"`
+		Currency   string             `json:"currency"`
 		Subaccount PaystackSubaccount `json:"subaccount"`
 		Fees       int                `json:"fees"`
 		Customer   struct {
@@ -49,61 +55,91 @@ type PaystackVerifyResponse struct {
 	} `json:"data"`
 }
 
-// CreatePaystackSubaccount creates a subaccount for an admin
-func CreatePaystackSubaccount(admin *models.Admin) error {
-	log.Printf("Creating Paystack subaccount for admin ID %d", admin.ID)
-	payload := map[string]interface{}{
-		"business_name":     admin.AccountName,
-		"settlement_bank":   admin.BankCode,
-		"account_number":    admin.AccountNumber,
-		"percentage_charge": 10,
+// defaultBaseURL is Paystack's API. PAYSTACK_BASE_URL overrides it, for
+// example to point at a local fake server.
+const defaultBaseURL = "https://api.paystack.co"
+
+func apiURL(path string) string {
+	base := os.Getenv("PAYSTACK_BASE_URL")
+	if base == "" {
+		base = defaultBaseURL
 	}
+	return strings.TrimRight(base, "/") + path
+}
 
-	body, _ := json.Marshal(payload)
-	log.Printf("Subaccount payload: %s", string(body))
-	req, _ := http.NewRequest("POST", "https://api.paystack.co/subaccount", bytes.NewReader(body))
+// AmountPaid is the verified amount in major currency units
+func (r *PaystackVerifyResponse) AmountPaid() float64 {
+	return float64(r.Data.Amount) / 100.0
+}
+
+// verifyTransaction asks Paystack for the state of reference. An error means
+// Paystack could not be asked; a reference it does not know comes back with
+// Status false.
+func verifyTransaction(reference string) (*PaystackVerifyResponse, error) {
+	req, _ := http.NewRequest("GET", apiURL("/transaction/verify/"+url.PathEscape(reference)), nil)
 	req.Header.Add("Authorization", "Bearer "+os.Getenv("PAYSTACK_SECRET_KEY"))
-	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("Accept", "application/json")
 	req.Header.Add("Cache-Control", "no-cache")
 
-	client := &http.Client{}
+	client := &http.Client{Timeout: 30 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Printf("Paystack subaccount creation failed: %v", err)
-		return fmt.Errorf("Paystack API error: %v", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	respBody, _ := io.ReadAll(resp.Body)
-	log.Printf("Subaccount response: %s", string(respBody))
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return fmt.Errorf("Paystack error: %s", string(respBody))
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden || resp.StatusCode >= 500 {
+		return nil, fmt.Errorf("Paystack returned %d: %s", resp.StatusCode, string(respBody))
 	}
 
-	var result map[string]interface{}
+	var result PaystackVerifyResponse
 	if err := json.Unmarshal(respBody, &result); err != nil {
-		log.Printf("Failed to parse subaccount response: %v", err)
-		return fmt.Errorf("failed to parse Paystack response: %v", err)
+		return nil, fmt.Errorf("failed to parse Paystack response: %v", err)
 	}
+	return &result, nil
+}
 
-	if data, ok := result["data"].(map[string]interface{}); ok {
-		admin.PaystackSubaccountCode = data["subaccount_code"].(string)
-		if err := database.DB.Save(admin).Error; err != nil {
-			log.Printf("Failed to save admin subaccount: %v", err)
-			return fmt.Errorf("failed to save admin subaccount: %v", err)
-		}
-		log.Printf("Subaccount created: %s", admin.PaystackSubaccountCode)
-		return nil
+// CreatePaystackSubaccount creates a subaccount for an admin
+func CreatePaystackSubaccount(admin *models.Admin) error {
+	log.Printf("Creating Paystack subaccount for admin ID %d", admin.ID)
+	// Each charge sets its own split; the subaccount's percentage is only the
+	// fallback Paystack uses for charges that do not, so it is the admin's
+	// current purchase commission
+	commission, err := services.CommissionFor(database.DB, "purchase", admin.ID, 0, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to look up commission: %v", err)
+	}
+	payload := map[string]interface{}{
+		"business_name":     admin.AccountName,
+		"settlement_bank":   admin.BankCode,
+		"account_number":    admin.AccountNumber,
+		"percentage_charge": commission.Rate * 100,
 	}
 
-	log.Printf("No subaccount_code in response")
-	return fmt.Errorf("failed to parse Paystack response: no data field")
+	var subaccount struct {
+		SubaccountCode string `json:"subaccount_code"`
+	}
+	if err := paystackCall("POST", "/subaccount", payload, &subaccount); err != nil {
+		log.Printf("Paystack subaccount creation failed for admin %d: %v", admin.ID, err)
+		return err
+	}
+	if subaccount.SubaccountCode == "" {
+		return fmt.Errorf("failed to parse Paystack response: no subaccount_code")
+	}
+
+	admin.PaystackSubaccountCode = subaccount.SubaccountCode
+	if err := database.DB.Save(admin).Error; err != nil {
+		log.Printf("Failed to save admin subaccount: %v", err)
+		return fmt.Errorf("failed to save admin subaccount: %v", err)
+	}
+	log.Printf("Subaccount created: %s", admin.PaystackSubaccountCode)
+	return nil
 }
 
 // InitializePayment godoc
 // @Summary Initialize payment
-// @Description Initializes a payment transaction for purchasing or renting a bot
+// @Description Initializes a payment transaction for purchasing or renting a bot through a payment provider: paystack (the default), mpesa (an STK push to phone, in KES) or stripe (Checkout)
 // @Tags payment
 // @Accept json
 // @Produce json
@@ -113,6 +149,7 @@ func CreatePaystackSubaccount(admin *models.Admin) error {
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
 // @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /api/payment/initialize [post]
 func InitializePayment(ctx *gin.Context) {
@@ -120,6 +157,11 @@ func InitializePayment(ctx *gin.Context) {
 		Amount      float64 `json:"amount"`
 		BotID       uint    `json:"bot_id"`
 		PaymentType string  `json:"payment_type"`
+		ListingID   uint    `json:"listing_id"` // the license to buy when payment_type is "resale"
+		PlanID      uint    `json:"plan_id"`    // the rental plan when payment_type is "rent"
+		Currency    string  `json:"currency"`   // defaults to the user's preferred or local currency
+		Provider    string  `json:"provider"`   // "paystack" (the default), "mpesa" or "stripe"
+		Phone       string  `json:"phone"`      // the number to charge through mpesa
 		Description string  `json:"description"`
 	}
 
@@ -128,9 +170,33 @@ func InitializePayment(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
 		return
 	}
+	provider, err := ProviderFor(input.Provider)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if provider.Name() == payments.ChannelMPesa && input.Currency == "" {
+		input.Currency = "KES"
+	}
 
 	userID := ctx.GetUint("user_id")
-	log.Printf("Initializing payment for user_id: %d, bot_id: %d, payment_type: %s", userID, input.BotID, input.PaymentType)
+	var listing *models.LicenseListing
+	if input.PaymentType == "resale" {
+		if listing, err = services.OpenResaleListing(input.ListingID); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, services.ErrListingReserved) {
+				status = http.StatusConflict
+			}
+			ctx.JSON(status, gin.H{"message": err.Error()})
+			return
+		}
+		if listing.SellerID == userID {
+			ctx.JSON(http.StatusBadRequest, gin.H{"message": "You cannot buy your own license"})
+			return
+		}
+		input.BotID = listing.BotID
+	}
+	log.Printf("Initializing %s payment for user_id: %d, bot_id: %d, payment_type: %s", provider.Name(), userID, input.BotID, input.PaymentType)
 
 	var user models.User
 	if err := database.DB.First(&user, userID).Error; err != nil {
@@ -166,105 +232,133 @@ func InitializePayment(ctx *gin.Context) {
 	}
 
 	var subaccountCode string
-	var companyPercent float64
-	if admin.PaystackSubaccountCode == "" && (admin.BankCode == "" || admin.AccountNumber == "" || admin.AccountName == "") {
-		log.Printf("No subaccount or bank details for admin ID %d, company takes 100%%", admin.ID)
-		companyPercent = 1.0
-	} else {
-		if admin.PaystackSubaccountCode == "" {
-			log.Printf("Creating subaccount for admin ID %d", admin.ID)
-			if err := CreatePaystackSubaccount(&admin); err != nil {
-				log.Printf("Failed to create Paystack subaccount: %v", err)
-				ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to create Paystack subaccount", "error": err.Error()})
-				return
+	var commission services.Commission
+	switch input.PaymentType {
+	case "purchase", "rent", "resale":
+		if commission, err = services.CommissionFor(database.DB, input.PaymentType, admin.ID, bot.ID, time.Now()); err != nil {
+			log.Printf("Failed to look up commission: %v", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to look up commission"})
+			return
+		}
+	default:
+		log.Printf("Invalid payment type: %s", input.PaymentType)
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": "Invalid payment type"})
+		return
+	}
+	// Only Paystack splits a charge; other providers' charges are collected
+	// by the platform and the admin's share is owed in the ledger
+	if input.PaymentType != "resale" && provider.Name() == payments.ChannelPaystack {
+		if admin.PaystackSubaccountCode == "" && (admin.BankCode == "" || admin.AccountNumber == "" || admin.AccountName == "") {
+			// Without a subaccount the platform collects everything and the
+			// admin's share is owed to them in the ledger
+			log.Printf("No subaccount or bank details for admin ID %d, admin share goes to the ledger", admin.ID)
+		} else {
+			if admin.PaystackSubaccountCode == "" {
+				log.Printf("Creating subaccount for admin ID %d", admin.ID)
+				if err := CreatePaystackSubaccount(&admin); err != nil {
+					log.Printf("Failed to create Paystack subaccount: %v", err)
+					ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to create Paystack subaccount", "error": err.Error()})
+					return
+				}
 			}
+			subaccountCode = admin.PaystackSubaccountCode
 		}
-		subaccountCode = admin.PaystackSubaccountCode
-		switch input.PaymentType {
-		case "purchase":
-			companyPercent = 0.30
-		case "rent":
-			companyPercent = 0.20
-		default:
-			log.Printf("Invalid payment type: %s", input.PaymentType)
-			ctx.JSON(http.StatusBadRequest, gin.H{"message": "Invalid payment type"})
+	}
+
+	if input.PaymentType == "purchase" || input.PaymentType == "resale" {
+		if bot.OwnerID == userID {
+			ctx.JSON(http.StatusBadRequest, gin.H{"message": "You own this bot"})
+			return
+		}
+		var licensed int64
+		database.DB.Model(&models.UserBot{}).
+			Where("user_id = ? AND bot_id = ? AND access_type = ?", userID, input.BotID, "purchase").
+			Count(&licensed)
+		if licensed > 0 {
+			log.Printf("Bot %d already licensed by user %d", input.BotID, userID)
+			ctx.JSON(http.StatusBadRequest, gin.H{"message": "You already purchased this bot"})
 			return
 		}
 	}
-
 	if input.PaymentType == "purchase" {
-		var existing models.Transaction
-		if err := database.DB.
-			Where("user_id = ? AND bot_id = ? AND payment_type = ? AND status = ?", userID, input.BotID, "purchase", "success").
-			First(&existing).Error; err == nil {
-			log.Printf("Bot already purchased: %s", existing.Reference)
-			ctx.JSON(http.StatusBadRequest, gin.H{"message": "You already purchased this bot"})
+		if err := services.CheckLicenseAvailable(bot); err != nil {
+			log.Printf("No license available for bot %d: %v", bot.ID, err)
+			ctx.JSON(http.StatusConflict, gin.H{"message": err.Error()})
 			return
 		}
 	}
 
+	currency, err := services.PaymentCurrency(database.DB, user, input.Currency)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error(), "currency": input.Currency})
+		return
+	}
+
+	var rentalPlanID *uint
 	var expectedPrice float64
+	// The price list entry, if any, the charge is priced from
+	var listBotID, listPlanID uint
+	var listBase float64
 	if input.PaymentType == "purchase" {
 		expectedPrice = bot.Price
+		listBotID, listBase = bot.ID, bot.Price
 	} else if input.PaymentType == "rent" {
-		expectedPrice = bot.RentPrice
+		quote, err := services.QuoteRental(database.DB, userID, bot, input.PlanID)
+		if err != nil {
+			log.Printf("Cannot rent bot %d: %v", bot.ID, err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		if quote.Due <= 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"message": "Your current rental covers this plan, switch to it without paying", "quote": quote})
+			return
+		}
+		expectedPrice = quote.Due
+		if quote.Plan.ID != 0 {
+			rentalPlanID = &quote.Plan.ID
+		}
+		listBotID, listPlanID, listBase = bot.ID, quote.Plan.ID, quote.Plan.Price
+	} else if input.PaymentType == "resale" {
+		expectedPrice = listing.Price
 	} else {
 		log.Printf("Invalid payment type: %s", input.PaymentType)
 		ctx.JSON(http.StatusBadRequest, gin.H{"message": "Invalid payment type"})
 		return
 	}
-	if input.Amount < expectedPrice {
-		log.Printf("Invalid amount: %f, expected >= %f", input.Amount, expectedPrice)
-		ctx.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("Amount must be at least KES %.2f", expectedPrice)})
-		return
-	}
-
-	companyShare := input.Amount * companyPercent
-	adminShare := input.Amount - companyShare
-	reference := fmt.Sprintf("ALG_%d_%d", userID, time.Now().Unix())
-
-	payload := map[string]interface{}{
-		"email":        user.Email,
-		"amount":       int(input.Amount * 100),
-		"reference":    reference,
-		"callback_url": os.Getenv("PAYSTACK_CALLBACK_URL"),
-		"currency":     "KES",
-	}
-	if subaccountCode != "" {
-		payload["subaccount"] = subaccountCode
-		payload["bearer"] = "subaccount"
-		payload["transaction_charge"] = int(companyShare * 100)
-	}
-
-	body, _ := json.Marshal(payload)
-	log.Printf("Paystack payload: %s", string(body))
-	req, _ := http.NewRequest("POST", "https://api.paystack.co/transaction/initialize", bytes.NewReader(body))
-	req.Header.Add("Authorization", "Bearer "+os.Getenv("PAYSTACK_SECRET_KEY"))
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-	req.Header.Add("Cache-Control", "no-cache")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	price, err := services.QuotePrice(database.DB, currency, expectedPrice, listBotID, input.PaymentType, listPlanID, listBase)
 	if err != nil {
-		log.Printf("Paystack request error: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Paystack request failed", "error": err.Error()})
+		log.Printf("Cannot price bot %d in %s: %v", bot.ID, currency, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error(), "currency": currency})
 		return
 	}
-	defer resp.Body.Close()
-
-	respBody, _ := io.ReadAll(resp.Body)
-	log.Printf("Paystack raw response: %s", string(respBody))
-	var result map[string]interface{}
-	if err := json.Unmarshal(respBody, &result); err != nil {
-		log.Printf("Failed to parse Paystack response: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to parse Paystack response"})
+	if input.Amount < price.Amount {
+		log.Printf("Invalid amount: %f, expected >= %f %s", input.Amount, price.Amount, currency)
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("Amount must be at least %s %.2f", currency, price.Amount), "price": price})
 		return
 	}
 
-	if result["status"] != true {
-		log.Printf("Paystack initialization failed: %v", result["message"])
-		ctx.JSON(http.StatusBadRequest, gin.H{"message": "Failed to initialize payment", "error": result["message"]})
+	// Shares and the ledger are in the base currency
+	baseAmount := price.ToBase(input.Amount)
+	companyShare, adminShare := commission.Split(baseAmount)
+	reference := fmt.Sprintf("ALG_%d_%d", userID, time.Now().Unix())
+
+	checkout, err := provider.Initialize(payments.Charge{
+		Reference:   reference,
+		Email:       user.Email,
+		Phone:       input.Phone,
+		Amount:      input.Amount,
+		Currency:    currency,
+		Description: input.Description,
+		Subaccount:  subaccountCode,
+		PlatformFee: companyShare * price.Rate,
+	})
+	if err != nil {
+		log.Printf("%s initialization failed: %v", provider.Name(), err)
+		if rejected(err) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"message": "Failed to initialize payment", "error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": provider.Name() + " request failed", "error": err.Error()})
 		return
 	}
 
@@ -272,16 +366,31 @@ func InitializePayment(ctx *gin.Context) {
 		UserID:         userID,
 		AdminID:        admin.ID,
 		BotID:          input.BotID,
-		Amount:         input.Amount,
+		Amount:         baseAmount,
+		Currency:       currency,
+		ChargedAmount:  input.Amount,
+		ExchangeRate:   price.Rate,
 		CompanyShare:   companyShare,
 		AdminShare:     adminShare,
+		CommissionRate: commission.Rate,
 		Status:         "pending",
 		Reference:      reference,
-		PaymentChannel: "Paystack",
+		PaymentChannel: provider.Name(),
 		PaymentType:    input.PaymentType,
 		Description:    input.Description,
 		CreatedAt:      time.Now(),
 	}
+	if listing != nil {
+		// The platform collects a resale and owes the seller, not the
+		// bot's admin, what is left after its commission
+		transaction.ListingID = &listing.ID
+		transaction.SellerID = &listing.SellerID
+		transaction.AdminID = 0
+	}
+	transaction.RentalPlanID = rentalPlanID
+	transaction.CommissionRuleID = commission.RuleID()
+	transaction.Subaccount = subaccountCode
+	transaction.ProviderReference = checkout.ProviderReference
 
 	if err := database.DB.Create(&transaction).Error; err != nil {
 		log.Printf("Failed to save transaction: %v", err)
@@ -289,11 +398,11 @@ func InitializePayment(ctx *gin.Context) {
 		return
 	}
 
-	data := result["data"].(map[string]interface{})
-	log.Printf("Paystack response data: %v", data)
 	ctx.JSON(http.StatusOK, gin.H{
-		"message": "Payment initialized",
-		"data":    data,
+		"message":  "Payment initialized",
+		"provider": provider.Name(),
+		"data":     checkout.Data,
+		"price":    price,
 	})
 }
 
@@ -317,176 +426,25 @@ func VerifyPayment(ctx *gin.Context) {
 	}
 	log.Printf("Verifying payment for reference: %s", reference)
 
-	req, _ := http.NewRequest("GET", fmt.Sprintf("https://api.paystack.co/transaction/verify/%s", reference), nil)
-	req.Header.Add("Authorization", "Bearer "+os.Getenv("PAYSTACK_SECRET_KEY"))
-	req.Header.Add("Accept", "application/json")
-	req.Header.Add("Cache-Control", "no-cache")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("Paystack verify request failed: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to verify payment", "error": err.Error()})
+	verification, ok := verifySuccess(ctx, reference)
+	if !ok {
 		return
 	}
-	defer resp.Body.Close()
-
-	respBody, _ := io.ReadAll(resp.Body)
-	log.Printf("Paystack verify response: %s", string(respBody))
-	var result PaystackVerifyResponse
-	if err := json.Unmarshal(respBody, &result); err != nil {
-		log.Printf("Failed to parse Paystack verify response: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to parse Paystack response", "error": err.Error()})
-		return
-	}
-
-	if !result.Status || result.Data.Status != "success" {
-		log.Printf("Payment verification failed: status=%v, message=%s, transaction_status=%s", result.Status, result.Message, result.Data.Status)
-		ctx.JSON(http.StatusBadRequest, gin.H{
-			"message": "Payment verification failed",
-			"error":   result.Message,
-			"status":  result.Data.Status,
-		})
-		return
-	}
-
-	tx := database.DB.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			log.Printf("Panic in VerifyPayment: %v", r)
-			tx.Rollback()
-			ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal server error"})
-		}
-	}()
-
-	var transaction models.Transaction
-	if err := tx.Where("reference = ?", reference).First(&transaction).Error; err != nil {
-		log.Printf("Transaction not found: %s", reference)
-		tx.Rollback()
-		ctx.JSON(http.StatusNotFound, gin.H{"message": "Transaction not found"})
-		return
-	}
-
-	var bot models.Bot
-	if err := tx.First(&bot, transaction.BotID).Error; err != nil {
-		log.Printf("Bot not found: %d", transaction.BotID)
-		tx.Rollback()
-		ctx.JSON(http.StatusNotFound, gin.H{"message": "Bot not found"})
-		return
-	}
-	amountPaid := float64(result.Data.Amount) / 100.0
-	expectedPrice := bot.Price
-	if transaction.PaymentType == "rent" {
-		expectedPrice = bot.RentPrice
-	}
-	if amountPaid < expectedPrice {
-		log.Printf("Payment amount too low: paid=%.2f, expected=%.2f", amountPaid, expectedPrice)
-		tx.Rollback()
-		ctx.JSON(http.StatusForbidden, gin.H{
-			"message": fmt.Sprintf("Payment amount (KES %.2f) is less than expected (KES %.2f)", amountPaid, expectedPrice),
-		})
-		return
-	}
-
-	transaction.Status = "success"
-	if err := tx.Save(&transaction).Error; err != nil {
-		log.Printf("Failed to update transaction: %v", err)
-		tx.Rollback()
-		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to update transaction"})
-		return
-	}
-
-	if transaction.PaymentType == "purchase" {
-		originalOwnerID := bot.OwnerID
-		bot.OwnerID = transaction.UserID
-		if err := tx.Save(&bot).Error; err != nil {
-			log.Printf("Failed to update bot ownership: %v", err)
-			tx.Rollback()
-			ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to update bot ownership"})
-			return
-		}
-
-		sale := models.Sale{
-			BotID:     transaction.BotID,
-			SellerID:  originalOwnerID,
-			BuyerID:   transaction.UserID,
-			Amount:    transaction.Amount,
-			SaleType:  "purchase",
-			SaleDate:  time.Now(),
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		}
-		if err := tx.Create(&sale).Error; err != nil {
-			log.Printf("Failed to record sale: %v", err)
-			tx.Rollback()
-			ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to record sale"})
-			return
-		}
-
-		if err := tx.Where("user_id = ? AND bot_id = ?", originalOwnerID, bot.ID).Delete(&models.UserBot{}).Error; err != nil {
-			log.Printf("Failed to remove old owner access: %v", err)
-			tx.Rollback()
-			ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to remove old owner access"})
-			return
-		}
-
-		var existing models.UserBot
-		if err := tx.Where("user_id = ? AND bot_id = ?", transaction.UserID, transaction.BotID).First(&existing).Error; err == gorm.ErrRecordNotFound {
-			userBot := models.UserBot{
-				UserID:       transaction.UserID,
-				BotID:        transaction.BotID,
-				AccessType:   "purchase",
-				IsActive:     true,
-				PurchaseDate: time.Now(),
-				CreatedAt:    time.Now(),
-				UpdatedAt:    time.Now(),
-			}
-			if err := tx.Create(&userBot).Error; err != nil {
-				log.Printf("Failed to create user_bot entry: %v", err)
-				tx.Rollback()
-				ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to create user_bot entry"})
-				return
-			}
-		}
-	} else if transaction.PaymentType == "rent" {
-		var existing models.UserBot
-		if err := tx.Where("user_id = ? AND bot_id = ?", transaction.UserID, transaction.BotID).First(&existing).Error; err == gorm.ErrRecordNotFound {
-			expiry := time.Now().Add(30 * 24 * time.Hour)
-			userBot := models.UserBot{
-				UserID:       transaction.UserID,
-				BotID:        transaction.BotID,
-				AccessType:   "rent",
-				IsActive:     true,
-				PurchaseDate: time.Now(),
-				ExpiryDate:   &expiry,
-				CreatedAt:    time.Now(),
-				UpdatedAt:    time.Now(),
-			}
-			if err := tx.Create(&userBot).Error; err != nil {
-				log.Printf("Failed to create user_bot entry for rent: %v", err)
-				tx.Rollback()
-				ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to create user_bot entry"})
-				return
-			}
-		}
-	}
-
-	if err := tx.Commit().Error; err != nil {
-		log.Printf("Failed to commit transaction: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to commit transaction"})
+	if _, _, err := settleVerified(reference, verification, "verify"); err != nil {
+		respondSettleError(ctx, reference, err)
 		return
 	}
 
 	log.Printf("Payment verified successfully for reference: %s", reference)
 	ctx.JSON(http.StatusOK, gin.H{
 		"message": "Payment verified and bot access updated",
-		"data":    result.Data,
+		"data":    verification.Data,
 	})
 }
 
 // FrontendCallback godoc
 // @Summary Frontend payment callback
-// @Description Handles callback from Paystack frontend integration
+// @Description Handles the callback of the frontend once a payment completes. Payments the backend did not initialize can only be Paystack's.
 // @Tags payment
 // @Accept json
 // @Produce json
@@ -517,253 +475,97 @@ func FrontendCallback(ctx *gin.Context) {
 		return
 	}
 
-	req, _ := http.NewRequest("GET", fmt.Sprintf("https://api.paystack.co/transaction/verify/%s", input.Reference), nil)
-	req.Header.Add("Authorization", "Bearer "+os.Getenv("PAYSTACK_SECRET_KEY"))
-	req.Header.Add("Accept", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("Paystack verify request failed: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to verify payment", "error": err.Error()})
-		return
-	}
-	defer resp.Body.Close()
-
-	respBody, _ := io.ReadAll(resp.Body)
-	log.Printf("Paystack verify response: %s", string(respBody))
-	var result PaystackVerifyResponse
-	if err := json.Unmarshal(respBody, &result); err != nil {
-		log.Printf("Failed to parse Paystack verify response: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to parse Paystack response", "error": err.Error()})
-		return
-	}
-
-	if !result.Status || result.Data.Status != "success" {
-		log.Printf("Payment verification failed: status=%v, message=%s, transaction_status=%s", result.Status, result.Message, result.Data.Status)
-		ctx.JSON(http.StatusBadRequest, gin.H{
-			"message": "Payment verification failed",
-			"error":   result.Message,
-			"status":  result.Data.Status,
-		})
+	verification, ok := verifySuccess(ctx, input.Reference)
+	if !ok {
 		return
 	}
 
-	tx := database.DB.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			log.Printf("Panic in FrontendCallback: %v", r)
-			tx.Rollback()
-			ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal server error"})
-		}
-	}()
-
+	// Payments started outside InitializePayment have no transaction yet
 	var transaction models.Transaction
-	if err := tx.Where("reference = ?", input.Reference).First(&transaction).Error; err != nil {
+	if err := database.DB.Where("reference = ?", input.Reference).First(&transaction).Error; err != nil {
 		if err != gorm.ErrRecordNotFound {
 			log.Printf("Error finding transaction: %v", err)
-			tx.Rollback()
 			ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Error finding transaction"})
 			return
 		}
 
-		userID := ctx.GetUint("user_id")
 		var bot models.Bot
-		if err := tx.First(&bot, input.BotID).Error; err != nil {
+		if err := database.DB.First(&bot, input.BotID).Error; err != nil {
 			log.Printf("Bot not found: %d", input.BotID)
-			tx.Rollback()
 			ctx.JSON(http.StatusNotFound, gin.H{"message": "Bot not found"})
 			return
 		}
 
 		var admin models.Admin
-		if err := tx.Where("person_id = ?", bot.OwnerID).First(&admin).Error; err != nil {
+		if err := database.DB.Where("person_id = ?", bot.OwnerID).First(&admin).Error; err != nil {
 			log.Printf("Admin not found: %v", err)
-			tx.Rollback()
 			ctx.JSON(http.StatusNotFound, gin.H{"message": "Admin not found"})
 			return
 		}
 
-		expectedPrice := bot.Price
-		if input.PaymentType == "rent" {
-			expectedPrice = bot.RentPrice
-		}
-		if input.AmountPaid < expectedPrice {
-			log.Printf("Invalid amount: paid=%.2f, expected=%.2f", input.AmountPaid, expectedPrice)
-			tx.Rollback()
-			ctx.JSON(http.StatusBadRequest, gin.H{
-				"message": fmt.Sprintf("Amount must be at least KES %.2f", expectedPrice),
-			})
+		commission, err := services.CommissionFor(database.DB, input.PaymentType, admin.ID, bot.ID, time.Now())
+		if err != nil {
+			log.Printf("Failed to look up commission: %v", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to look up commission"})
 			return
 		}
 
-		var companyPercent float64
-		if admin.PaystackSubaccountCode == "" && (admin.BankCode == "" || admin.AccountNumber == "" || admin.AccountName == "") {
-			companyPercent = 1.0
-		} else {
-			if admin.PaystackSubaccountCode == "" {
-				log.Printf("Creating subaccount for admin ID %d", admin.ID)
-				if err := CreatePaystackSubaccount(&admin); err != nil {
-					log.Printf("Failed to create Paystack subaccount: %v", err)
-					tx.Rollback()
-					ctx.JSON(http.StatusInternalServerError, gin.H{
-						"message": "Failed to create Paystack subaccount",
-						"error":   err.Error(),
-					})
-					return
-				}
-			}
-			companyPercent = 0.30
-			if input.PaymentType == "rent" {
-				companyPercent = 0.20
-			}
+		currency := services.NormalizeCurrency(verification.Currency)
+		if currency == "" {
+			currency = services.BaseCurrency()
+		}
+		rate, err := services.ExchangeRateFor(database.DB, currency)
+		if err != nil {
+			log.Printf("Cannot convert %s payment %s: %v", currency, input.Reference, err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error(), "currency": currency})
+			return
 		}
 
+		amountPaid := verification.Amount
+		baseAmount := math.Round(amountPaid/rate*100) / 100
+		companyShare, adminShare := commission.Split(baseAmount)
 		transaction = models.Transaction{
-			UserID:         userID,
-			AdminID:        admin.ID,
-			BotID:          input.BotID,
-			Amount:         input.AmountPaid,
-			CompanyShare:   input.AmountPaid * companyPercent,
-			AdminShare:     input.AmountPaid * (1 - companyPercent),
-			Status:         "pending",
-			Reference:      input.Reference,
-			PaymentChannel: "Paystack",
-			PaymentType:    input.PaymentType,
-			Description:    fmt.Sprintf("Payment for bot %d (%s)", input.BotID, input.PaymentType),
-			CreatedAt:      time.Now(),
-		}
-		if err := tx.Create(&transaction).Error; err != nil {
+			UserID:           ctx.GetUint("user_id"),
+			AdminID:          admin.ID,
+			BotID:            input.BotID,
+			Amount:           baseAmount,
+			Currency:         currency,
+			ChargedAmount:    amountPaid,
+			ExchangeRate:     rate,
+			CompanyShare:     companyShare,
+			AdminShare:       adminShare,
+			CommissionRate:   commission.Rate,
+			CommissionRuleID: commission.RuleID(),
+			Status:           "pending",
+			Reference:        input.Reference,
+			PaymentChannel:   payments.ChannelPaystack,
+			PaymentType:      input.PaymentType,
+			Subaccount:       verification.Subaccount,
+			Description:      fmt.Sprintf("Payment for bot %d (%s)", input.BotID, input.PaymentType),
+			CreatedAt:        time.Now(),
+		}
+		if err := database.DB.Create(&transaction).Error; err != nil {
 			log.Printf("Failed to create transaction: %v", err)
-			tx.Rollback()
 			ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to save transaction"})
 			return
 		}
 	}
 
-	if transaction.Status == "pending" {
-		transaction.Status = "success"
-		transaction.Amount = input.AmountPaid
-		if err := tx.Save(&transaction).Error; err != nil {
-			log.Printf("Failed to update transaction: %v", err)
-			tx.Rollback()
-			ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to update transaction"})
-			return
-		}
-
-		var bot models.Bot
-		if err := tx.First(&bot, transaction.BotID).Error; err != nil {
-			log.Printf("Bot not found: %d", transaction.BotID)
-			tx.Rollback()
-			ctx.JSON(http.StatusNotFound, gin.H{"message": "Bot not found"})
-			return
-		}
-		amountPaid := float64(result.Data.Amount) / 100.0
-		expectedPrice := bot.Price
-		if transaction.PaymentType == "rent" {
-			expectedPrice = bot.RentPrice
-		}
-		if amountPaid < expectedPrice {
-			log.Printf("Payment amount too low: paid=%.2f, expected=%.2f", amountPaid, expectedPrice)
-			tx.Rollback()
-			ctx.JSON(http.StatusForbidden, gin.H{
-				"message": fmt.Sprintf("Payment amount (KES %.2f) is less than expected (KES %.2f)", amountPaid, expectedPrice),
-			})
-			return
-		}
-
-		if transaction.PaymentType == "purchase" {
-			originalOwnerID := bot.OwnerID
-			bot.OwnerID = transaction.UserID
-			if err := tx.Save(&bot).Error; err != nil {
-				log.Printf("Failed to update bot ownership: %v", err)
-				tx.Rollback()
-				ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to update bot ownership"})
-				return
-			}
-
-			sale := models.Sale{
-				BotID:     transaction.BotID,
-				SellerID:  originalOwnerID,
-				BuyerID:   transaction.UserID,
-				Amount:    transaction.Amount,
-				SaleType:  "purchase",
-				SaleDate:  time.Now(),
-				CreatedAt: time.Now(),
-				UpdatedAt: time.Now(),
-			}
-			if err := tx.Create(&sale).Error; err != nil {
-				log.Printf("Failed to record sale: %v", err)
-				tx.Rollback()
-				ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to record sale"})
-				return
-			}
-
-			if err := tx.Where("user_id = ? AND bot_id = ?", originalOwnerID, bot.ID).Delete(&models.UserBot{}).Error; err != nil {
-				log.Printf("Failed to remove old owner access: %v", err)
-				tx.Rollback()
-				ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to remove old owner access"})
-				return
-			}
-
-			var existing models.UserBot
-			if err := tx.Where("user_id = ? AND bot_id = ?", transaction.UserID, transaction.BotID).First(&existing).Error; err == gorm.ErrRecordNotFound {
-				userBot := models.UserBot{
-					UserID:       transaction.UserID,
-					BotID:        transaction.BotID,
-					AccessType:   "purchase",
-					IsActive:     true,
-					PurchaseDate: time.Now(),
-					CreatedAt:    time.Now(),
-					UpdatedAt:    time.Now(),
-				}
-				if err := tx.Create(&userBot).Error; err != nil {
-					log.Printf("Failed to create user_bot entry: %v", err)
-					tx.Rollback()
-					ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to create user_bot entry"})
-					return
-				}
-			}
-		} else if transaction.PaymentType == "rent" {
-			var existing models.UserBot
-			if err := tx.Where("user_id = ? AND bot_id = ?", transaction.UserID, transaction.BotID).First(&existing).Error; err == gorm.ErrRecordNotFound {
-				expiry := time.Now().Add(30 * 24 * time.Hour)
-				userBot := models.UserBot{
-					UserID:       transaction.UserID,
-					BotID:        transaction.BotID,
-					AccessType:   "rent",
-					IsActive:     true,
-					PurchaseDate: time.Now(),
-					ExpiryDate:   &expiry,
-					CreatedAt:    time.Now(),
-					UpdatedAt:    time.Now(),
-				}
-				if err := tx.Create(&userBot).Error; err != nil {
-					log.Printf("Failed to create user_bot entry for rent: %v", err)
-					tx.Rollback()
-					ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to create user_bot entry"})
-					return
-				}
-			}
-		}
-	}
-
-	if err := tx.Commit().Error; err != nil {
-		log.Printf("Failed to commit transaction: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to commit transaction"})
+	if _, _, err := settleVerified(input.Reference, verification, "callback"); err != nil {
+		respondSettleError(ctx, input.Reference, err)
 		return
 	}
 
 	log.Printf("Payment processed successfully for reference: %s", input.Reference)
 	ctx.JSON(http.StatusOK, gin.H{
 		"message": "Payment verified and bot access updated",
-		"data":    result.Data,
+		"data":    verification.Data,
 	})
 }
 
 // PaystackCallback godoc
 // @Summary Paystack webhook callback
-// @Description Handles webhook notifications from Paystack
+// @Description Handles webhook notifications from Paystack: charges, the subscription.create, subscription.not_renew, subscription.disable and invoice.payment_failed events of subscriptions, the transfer events of admin payouts, refund.processed and refund.failed, and the charge.dispute.create, charge.dispute.remind and charge.dispute.resolve events of chargebacks
 // @Tags payment
 // @Accept json
 // @Produce json
@@ -773,215 +575,103 @@ func FrontendCallback(ctx *gin.Context) {
 // @Failure 500 {object} map[string]string
 // @Router /api/payment/webhook [post]
 func PaystackCallback(ctx *gin.Context) {
-	signature := ctx.GetHeader("X-Paystack-Signature")
-	body, err := io.ReadAll(ctx.Request.Body)
-	if err != nil {
-		log.Printf("Invalid webhook request: %v", err)
-		ctx.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request"})
-		return
-	}
-	ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
-
-	h := hmac.New(sha512.New, []byte(os.Getenv("PAYSTACK_SECRET_KEY")))
-	h.Write(body)
-	expectedSignature := hex.EncodeToString(h.Sum(nil))
-	if signature != expectedSignature {
-		log.Printf("Invalid Paystack webhook signature: expected %s, got %s", expectedSignature, signature)
-		ctx.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid signature"})
-		return
-	}
+	handleWebhook(ctx, paystackProvider{})
+}
 
-	var event struct {
-		Event string                 `json:"event"`
-		Data  map[string]interface{} `json:"data"`
-	}
-	if err := json.Unmarshal(body, &event); err != nil {
-		log.Printf("Invalid webhook payload: %v", err)
-		ctx.JSON(http.StatusBadRequest, gin.H{"message": "Invalid JSON"})
-		return
-	}
-	log.Printf("Webhook received: event=%s, data=%v", event.Event, event.Data)
+// recordWebhookEvent logs a webhook before it is handled. replay is true
+// when the same payload was already received and is processed, ignored or
+// still being handled; an event that failed is handed out again for retry.
+func recordWebhookEvent(provider string, payload []byte, event, reference string) (record *models.WebhookEvent, replay bool, err error) {
+	sum := sha256.Sum256(payload)
+	record = &models.WebhookEvent{
+		Provider:  provider,
+		EventKey:  hex.EncodeToString(sum[:]),
+		Event:     event,
+		Reference: reference,
+		Payload:   string(payload),
+		Status:    "received",
+		Attempts:  1,
+	}
+	result := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return record, false, nil
+	}
+
+	if err := database.DB.Where("event_key = ?", record.EventKey).First(record).Error; err != nil {
+		return nil, false, err
+	}
+	if record.Status != "failed" {
+		return record, true, nil
+	}
+	retry := database.DB.Model(&models.WebhookEvent{}).
+		Where("id = ? AND status = ?", record.ID, "failed").
+		Updates(map[string]interface{}{"status": "received", "attempts": gorm.Expr("attempts + 1")})
+	if retry.Error != nil {
+		return nil, false, retry.Error
+	}
+	return record, retry.RowsAffected == 0, nil
+}
 
-	if event.Event != "charge.success" {
-		log.Printf("Ignoring non-success event: %s", event.Event)
-		ctx.JSON(http.StatusOK, gin.H{"message": "Event ignored"})
-		return
+func finishWebhookEvent(record *models.WebhookEvent, status string, cause error) {
+	now := time.Now()
+	updates := map[string]interface{}{"status": status, "error": "", "processed_at": &now}
+	if cause != nil {
+		updates["error"] = cause.Error()
 	}
-
-	reference, ok := event.Data["reference"].(string)
-	if !ok || reference == "" {
-		log.Printf("Missing or invalid reference in webhook")
-		ctx.JSON(http.StatusBadRequest, gin.H{"message": "Invalid reference"})
-		return
+	if err := database.DB.Model(record).Updates(updates).Error; err != nil {
+		log.Printf("Failed to update webhook event %d: %v", record.ID, err)
 	}
+}
 
-	tx := database.DB.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			log.Printf("Panic in PaystackCallback: %v", r)
-			tx.Rollback()
-			ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal server error"})
-		}
-	}()
-
-	var transaction models.Transaction
-	if err := tx.Where("reference = ?", reference).First(&transaction).Error; err != nil {
-		log.Printf("Transaction not found: %s", reference)
-		tx.Rollback()
-		ctx.JSON(http.StatusNotFound, gin.H{"message": "Transaction not found"})
-		return
-	}
-
-	req, _ := http.NewRequest("GET", fmt.Sprintf("https://api.paystack.co/transaction/verify/%s", reference), nil)
-	req.Header.Add("Authorization", "Bearer "+os.Getenv("PAYSTACK_SECRET_KEY"))
-	req.Header.Add("Accept", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// verifySuccess verifies reference with the provider that charged it and
+// writes the error response unless the charge succeeded
+func verifySuccess(ctx *gin.Context, reference string) (*payments.Verification, bool) {
+	transaction, provider, err := transactionProvider(reference)
 	if err != nil {
-		log.Printf("Paystack verify request failed: %v", err)
-		tx.Rollback()
+		log.Printf("Cannot verify %s: %v", reference, err)
 		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to verify payment", "error": err.Error()})
-		return
+		return nil, false
 	}
-	defer resp.Body.Close()
-
-	respBody, _ := io.ReadAll(resp.Body)
-	log.Printf("Paystack verify response: %s", string(respBody))
-	var result PaystackVerifyResponse
-	if err := json.Unmarshal(respBody, &result); err != nil {
-		log.Printf("Failed to parse Paystack verify response: %v", err)
-		tx.Rollback()
-		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to parse Paystack response", "error": err.Error()})
-		return
+	verification, err := provider.Verify(transaction)
+	if err != nil {
+		log.Printf("%s verify request failed: %v", provider.Name(), err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to verify payment", "error": err.Error()})
+		return nil, false
 	}
-
-	if !result.Status || result.Data.Status != "success" {
-		log.Printf("Payment verification failed: status=%v, message=%s, transaction_status=%s", result.Status, result.Message, result.Data.Status)
-		tx.Rollback()
+	if !verification.Found || verification.Status != "success" {
+		log.Printf("Payment verification failed: found=%v, message=%s, transaction_status=%s", verification.Found, verification.Message, verification.Status)
 		ctx.JSON(http.StatusBadRequest, gin.H{
 			"message": "Payment verification failed",
-			"error":   result.Message,
-			"status":  result.Data.Status,
+			"error":   verification.Message,
+			"status":  verification.Status,
 		})
-		return
-	}
-
-	transaction.Status = "success"
-	if err := tx.Save(&transaction).Error; err != nil {
-		log.Printf("Failed to update transaction: %v", err)
-		tx.Rollback()
-		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to update transaction"})
-		return
+		return verification, false
 	}
+	return verification, true
+}
 
-	var bot models.Bot
-	if err := tx.First(&bot, transaction.BotID).Error; err != nil {
-		log.Printf("Bot not found: %d", transaction.BotID)
-		tx.Rollback()
+func respondSettleError(ctx *gin.Context, reference string, err error) {
+	var underpaid *UnderpaymentError
+	switch {
+	case errors.Is(err, ErrTransactionNotFound):
+		log.Printf("Transaction not found: %s", reference)
+		ctx.JSON(http.StatusNotFound, gin.H{"message": "Transaction not found"})
+	case errors.Is(err, ErrBotNotFound):
+		log.Printf("Bot not found for transaction: %s", reference)
 		ctx.JSON(http.StatusNotFound, gin.H{"message": "Bot not found"})
-		return
+	case errors.As(err, &underpaid):
+		log.Printf("Payment amount too low: paid=%.2f, expected=%.2f", underpaid.Paid, underpaid.Expected)
+		ctx.JSON(http.StatusForbidden, gin.H{"message": underpaid.Error()})
+	case errors.Is(err, services.ErrSoldOut), errors.Is(err, services.ErrListingUnavailable), errors.Is(err, services.ErrRentalUnavailable):
+		log.Printf("Payment %s cannot be fulfilled: %v", reference, err)
+		ctx.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+	default:
+		log.Printf("Failed to settle payment %s: %v", reference, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to settle payment", "error": err.Error()})
 	}
-	amountPaid := float64(result.Data.Amount) / 100.0
-	expectedPrice := bot.Price
-	if transaction.PaymentType == "rent" {
-		expectedPrice = bot.RentPrice
-	}
-	if amountPaid < expectedPrice {
-		log.Printf("Payment amount too low: paid=%.2f, expected=%.2f", amountPaid, expectedPrice)
-		tx.Rollback()
-		ctx.JSON(http.StatusForbidden, gin.H{
-			"message": fmt.Sprintf("Payment amount (KES %.2f) is less than expected (KES %.2f)", amountPaid, expectedPrice),
-		})
-		return
-	}
-
-	if transaction.PaymentType == "purchase" {
-		originalOwnerID := bot.OwnerID
-		bot.OwnerID = transaction.UserID
-		if err := tx.Save(&bot).Error; err != nil {
-			log.Printf("Failed to update bot ownership: %v", err)
-			tx.Rollback()
-			ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to update bot ownership"})
-			return
-		}
-
-		sale := models.Sale{
-			BotID:     transaction.BotID,
-			SellerID:  originalOwnerID,
-			BuyerID:   transaction.UserID,
-			Amount:    transaction.Amount,
-			SaleType:  "purchase",
-			SaleDate:  time.Now(),
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		}
-		if err := tx.Create(&sale).Error; err != nil {
-			log.Printf("Failed to record sale: %v", err)
-			tx.Rollback()
-			ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to record sale"})
-			return
-		}
-
-		if err := tx.Where("user_id = ? AND bot_id = ?", originalOwnerID, bot.ID).Delete(&models.UserBot{}).Error; err != nil {
-			log.Printf("Failed to remove old owner access: %v", err)
-			tx.Rollback()
-			ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to remove old owner access"})
-			return
-		}
-
-		var existing models.UserBot
-		if err := tx.Where("user_id = ? AND bot_id = ?", transaction.UserID, transaction.BotID).First(&existing).Error; err == gorm.ErrRecordNotFound {
-			userBot := models.UserBot{
-				UserID:       transaction.UserID,
-				BotID:        transaction.BotID,
-				AccessType:   "purchase",
-				IsActive:     true,
-				PurchaseDate: time.Now(),
-				CreatedAt:    time.Now(),
-				UpdatedAt:    time.Now(),
-			}
-			if err := tx.Create(&userBot).Error; err != nil {
-				log.Printf("Failed to create user_bot entry: %v", err)
-				tx.Rollback()
-				ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to create user_bot entry"})
-				return
-			}
-		}
-	} else if transaction.PaymentType == "rent" {
-		var existing models.UserBot
-		if err := tx.Where("user_id = ? AND bot_id = ?", transaction.UserID, transaction.BotID).First(&existing).Error; err == gorm.ErrRecordNotFound {
-			expiry := time.Now().Add(30 * 24 * time.Hour)
-			userBot := models.UserBot{
-				UserID:       transaction.UserID,
-				BotID:        transaction.BotID,
-				AccessType:   "rent",
-				IsActive:     true,
-				PurchaseDate: time.Now(),
-				ExpiryDate:   &expiry,
-				CreatedAt:    time.Now(),
-				UpdatedAt:    time.Now(),
-			}
-			if err := tx.Create(&userBot).Error; err != nil {
-				log.Printf("Failed to create user_bot entry for rent: %v", err)
-				tx.Rollback()
-				ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to create user_bot entry"})
-				return
-			}
-		}
-	}
-
-	if err := tx.Commit().Error; err != nil {
-		log.Printf("Failed to commit transaction: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to commit transaction"})
-		return
-	}
-
-	log.Printf("Webhook processed successfully for reference: %s", reference)
-	ctx.JSON(http.StatusOK, gin.H{
-		"message": "Webhook processed successfully",
-		"data":    result.Data,
-	})
 }
 
 // UpdateTransaction godoc
@@ -1047,8 +737,8 @@ func UpdateTransaction(ctx *gin.Context) {
 }
 
 // HandleCallbackRedirect godoc
-// @Summary Handle Paystack callback redirect
-// @Description Handles the redirect callback from Paystack
+// @Summary Handle payment callback redirect
+// @Description Handles the redirect back from Paystack or Stripe Checkout
 // @Tags payment
 // @Produce json
 // @Param reference query string true "Transaction reference"
@@ -1068,177 +758,15 @@ func HandleCallbackRedirect(ctx *gin.Context) {
 	}
 	log.Printf("Handling callback redirect for reference: %s", reference)
 
-	// Verify the payment
-	req, _ := http.NewRequest("GET", fmt.Sprintf("https://api.paystack.co/transaction/verify/%s", reference), nil)
-	req.Header.Add("Authorization", "Bearer "+os.Getenv("PAYSTACK_SECRET_KEY"))
-	req.Header.Add("Accept", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("Paystack verify request failed: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to verify payment", "error": err.Error()})
-		return
-	}
-	defer resp.Body.Close()
-
-	respBody, _ := io.ReadAll(resp.Body)
-	log.Printf("Paystack verify response: %s", string(respBody))
-	var result PaystackVerifyResponse
-	if err := json.Unmarshal(respBody, &result); err != nil {
-		log.Printf("Failed to parse Paystack verify response: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to parse Paystack response", "error": err.Error()})
-		return
-	}
-
-	if !result.Status || result.Data.Status != "success" {
-		log.Printf("Payment verification failed: status=%v, message=%s, transaction_status=%s", result.Status, result.Message, result.Data.Status)
-		// Update transaction to failed if abandoned
-		if result.Data.Status == "abandoned" {
-			var transaction models.Transaction
-			if err := database.DB.Where("reference = ?", reference).First(&transaction).Error; err == nil {
-				transaction.Status = "failed"
-				transaction.UpdatedAt = time.Now()
-				if err := database.DB.Save(&transaction).Error; err != nil {
-					log.Printf("Failed to update transaction to failed: %v", err)
-				} else {
-					log.Printf("Transaction updated to failed for reference: %s", reference)
-				}
-			}
+	verification, ok := verifySuccess(ctx, reference)
+	if !ok {
+		if verification != nil && verification.Status == "abandoned" {
+			markTransaction(reference, "failed")
 		}
-		ctx.JSON(http.StatusBadRequest, gin.H{
-			"message": "Payment verification failed",
-			"error":   result.Message,
-			"status":  result.Data.Status,
-		})
-		return
-	}
-
-	tx := database.DB.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			log.Printf("Panic in HandleCallbackRedirect: %v", r)
-			tx.Rollback()
-			ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Internal server error"})
-		}
-	}()
-
-	var transaction models.Transaction
-	if err := tx.Where("reference = ?", reference).First(&transaction).Error; err != nil {
-		log.Printf("Transaction not found: %s", reference)
-		tx.Rollback()
-		ctx.JSON(http.StatusNotFound, gin.H{"message": "Transaction not found"})
-		return
-	}
-
-	var bot models.Bot
-	if err := tx.First(&bot, transaction.BotID).Error; err != nil {
-		log.Printf("Bot not found: %d", transaction.BotID)
-		tx.Rollback()
-		ctx.JSON(http.StatusNotFound, gin.H{"message": "Bot not found"})
-		return
-	}
-
-	amountPaid := float64(result.Data.Amount) / 100.0
-	expectedPrice := bot.Price
-	if transaction.PaymentType == "rent" {
-		expectedPrice = bot.RentPrice
-	}
-	if amountPaid < expectedPrice {
-		log.Printf("Payment amount too low: paid=%.2f, expected=%.2f", amountPaid, expectedPrice)
-		tx.Rollback()
-		ctx.JSON(http.StatusForbidden, gin.H{
-			"message": fmt.Sprintf("Payment amount (KES %.2f) is less than expected (KES %.2f)", amountPaid, expectedPrice),
-		})
-		return
-	}
-
-	transaction.Status = "success"
-	if err := tx.Save(&transaction).Error; err != nil {
-		log.Printf("Failed to update transaction: %v", err)
-		tx.Rollback()
-		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to update transaction"})
 		return
 	}
-
-	if transaction.PaymentType == "purchase" {
-		originalOwnerID := bot.OwnerID
-		bot.OwnerID = transaction.UserID
-		if err := tx.Save(&bot).Error; err != nil {
-			log.Printf("Failed to update bot ownership: %v", err)
-			tx.Rollback()
-			ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to update bot ownership"})
-			return
-		}
-
-		sale := models.Sale{
-			BotID:     transaction.BotID,
-			SellerID:  originalOwnerID,
-			BuyerID:   transaction.UserID,
-			Amount:    transaction.Amount,
-			SaleType:  "purchase",
-			SaleDate:  time.Now(),
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		}
-		if err := tx.Create(&sale).Error; err != nil {
-			log.Printf("Failed to record sale: %v", err)
-			tx.Rollback()
-			ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to record sale"})
-			return
-		}
-
-		if err := tx.Where("user_id = ? AND bot_id = ?", originalOwnerID, bot.ID).Delete(&models.UserBot{}).Error; err != nil {
-			log.Printf("Failed to remove old owner access: %v", err)
-			tx.Rollback()
-			ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to remove old owner access"})
-			return
-		}
-
-		var existing models.UserBot
-		if err := tx.Where("user_id = ? AND bot_id = ?", transaction.UserID, transaction.BotID).First(&existing).Error; err == gorm.ErrRecordNotFound {
-			userBot := models.UserBot{
-				UserID:       transaction.UserID,
-				BotID:        transaction.BotID,
-				AccessType:   "purchase",
-				IsActive:     true,
-				PurchaseDate: time.Now(),
-				CreatedAt:    time.Now(),
-				UpdatedAt:    time.Now(),
-			}
-			if err := tx.Create(&userBot).Error; err != nil {
-				log.Printf("Failed to create user_bot entry: %v", err)
-				tx.Rollback()
-				ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to create user_bot entry"})
-				return
-			}
-		}
-	} else if transaction.PaymentType == "rent" {
-		var existing models.UserBot
-		if err := tx.Where("user_id = ? AND bot_id = ?", transaction.UserID, transaction.BotID).First(&existing).Error; err == gorm.ErrRecordNotFound {
-			expiry := time.Now().Add(30 * 24 * time.Hour)
-			userBot := models.UserBot{
-				UserID:       transaction.UserID,
-				BotID:        transaction.BotID,
-				AccessType:   "rent",
-				IsActive:     true,
-				PurchaseDate: time.Now(),
-				ExpiryDate:   &expiry,
-				CreatedAt:    time.Now(),
-				UpdatedAt:    time.Now(),
-			}
-			if err := tx.Create(&userBot).Error; err != nil {
-				log.Printf("Failed to create user_bot entry for rent: %v", err)
-				tx.Rollback()
-				ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to create user_bot entry"})
-				return
-			}
-		}
-	}
-
-	if err := tx.Commit().Error; err != nil {
-		log.Printf("Failed to commit transaction: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to commit transaction"})
+	if _, _, err := settleVerified(reference, verification, "redirect"); err != nil {
+		respondSettleError(ctx, reference, err)
 		return
 	}
 
@@ -0,0 +1,241 @@
+package paystack
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	services "github.com/keyadaniel56/algocdk/service"
+)
+
+// settledOnce fails the test unless reference was settled and booked
+// exactly once
+func settledOnce(t *testing.T, shop testShop, reference string) {
+	t.Helper()
+	var transaction models.Transaction
+	database.DB.Where("reference = ?", reference).First(&transaction)
+	if transaction.Status != "success" {
+		t.Errorf("%s is %s, want success", reference, transaction.Status)
+	}
+	counts := map[string]*int64{"settlements": new(int64), "licenses": new(int64), "sales": new(int64), "settled events": new(int64)}
+	database.DB.Model(&models.PaymentSettlement{}).Where("reference = ?", reference).Count(counts["settlements"])
+	database.DB.Model(&models.UserBot{}).Where("user_id = ? AND bot_id = ?", shop.buyer.ID, shop.bot.ID).Count(counts["licenses"])
+	database.DB.Model(&models.Sale{}).Where("buyer_id = ?", shop.buyer.ID).Count(counts["sales"])
+	database.DB.Model(&models.TransactionEvent{}).Where("transaction_id = ? AND event = ?", transaction.ID, "settled").Count(counts["settled events"])
+	for what, count := range counts {
+		if *count != 1 {
+			t.Errorf("%d %s for %s, want 1", *count, what, reference)
+		}
+	}
+	if got := balance(t, services.AdminAccount(shop.admin.ID)); got != 70 {
+		t.Errorf("admin is owed %.2f, want 70", got)
+	}
+	if got := balance(t, services.AccountRevenue); got != 30 {
+		t.Errorf("revenue is %.2f, want 30", got)
+	}
+}
+
+func TestSettlesOnceAcrossVerifyCallbackAndWebhook(t *testing.T) {
+	setupDB(t)
+	paystack := newFakePaystack(t)
+	shop := seedShop(t)
+	transaction := pendingPurchase(t, shop, "TX_once")
+	paystack.reply("GET /transaction/verify/TX_once", http.StatusOK, verified("TX_once", 100))
+
+	verify := testRouter(shop.buyer.ID, "GET", "/verify", VerifyPayment)
+	callback := testRouter(shop.buyer.ID, "POST", "/callback", FrontendCallback)
+	webhook := testRouter(0, "POST", "/webhook", PaystackCallback)
+	callbackBody, _ := json.Marshal(map[string]interface{}{
+		"reference": transaction.Reference, "bot_id": shop.bot.ID, "amount_paid": 100, "payment_type": "purchase",
+	})
+
+	// The payer's browser and Paystack race each other, more than once
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			if w := send(verify, "GET", "/verify?reference=TX_once", nil, nil); w.Code != http.StatusOK {
+				t.Errorf("verify: %d %s", w.Code, w.Body)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if w := send(callback, "POST", "/callback", callbackBody, nil); w.Code != http.StatusOK {
+				t.Errorf("callback: %d %s", w.Code, w.Body)
+			}
+		}()
+		go func(attempt int) {
+			defer wg.Done()
+			// Paystack retries with the same body; each delivery here differs
+			body, header := signedWebhook(t, "charge.success", map[string]interface{}{
+				"id": attempt, "reference": transaction.Reference, "status": "success", "amount": 10000, "currency": "KES",
+			})
+			if w := send(webhook, "POST", "/webhook", body, header); w.Code != http.StatusOK {
+				t.Errorf("webhook: %d %s", w.Code, w.Body)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	settledOnce(t, shop, transaction.Reference)
+}
+
+func TestWebhookReplayIsIgnoredAndFailureRetried(t *testing.T) {
+	setupDB(t)
+	paystack := newFakePaystack(t)
+	shop := seedShop(t)
+	webhook := testRouter(0, "POST", "/webhook", PaystackCallback)
+
+	// Paystack is down when the first delivery is verified
+	transaction := pendingPurchase(t, shop, "TX_retry")
+	paystack.reply("GET /transaction/verify/TX_retry", http.StatusBadGateway, nil)
+	body, header := signedWebhook(t, "charge.success", map[string]interface{}{
+		"reference": transaction.Reference, "status": "success", "amount": 10000, "currency": "KES",
+	})
+	if w := send(webhook, "POST", "/webhook", body, header); w.Code != http.StatusInternalServerError {
+		t.Fatalf("delivery while Paystack is down: %d %s, want 500 so Paystack retries", w.Code, w.Body)
+	}
+	var event models.WebhookEvent
+	database.DB.Where("reference = ?", transaction.Reference).First(&event)
+	if event.Status != "failed" || event.Error == "" {
+		t.Fatalf("failed delivery recorded as %s (%q)", event.Status, event.Error)
+	}
+
+	paystack.reply("GET /transaction/verify/TX_retry", http.StatusOK, verified("TX_retry", 100))
+	if w := send(webhook, "POST", "/webhook", body, header); w.Code != http.StatusOK {
+		t.Fatalf("retried delivery: %d %s", w.Code, w.Body)
+	}
+	database.DB.First(&event, event.ID)
+	if event.Status != "processed" || event.Attempts != 2 {
+		t.Errorf("retried delivery recorded as %s after %d attempts, want processed after 2", event.Status, event.Attempts)
+	}
+	settledOnce(t, shop, transaction.Reference)
+
+	// A delivery that was handled is not handled again
+	verifies := paystack.count("GET /transaction/verify/TX_retry")
+	w := send(webhook, "POST", "/webhook", body, header)
+	if w.Code != http.StatusOK {
+		t.Fatalf("replayed delivery: %d %s", w.Code, w.Body)
+	}
+	var reply struct {
+		Message string `json:"message"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &reply)
+	if reply.Message != "Event already processed" {
+		t.Errorf("replayed delivery answered %q", reply.Message)
+	}
+	if got := paystack.count("GET /transaction/verify/TX_retry"); got != verifies {
+		t.Errorf("replayed delivery verified the charge again")
+	}
+	database.DB.First(&event, event.ID)
+	if event.Attempts != 2 {
+		t.Errorf("replay counted as attempt %d", event.Attempts)
+	}
+	var events int64
+	database.DB.Model(&models.WebhookEvent{}).Count(&events)
+	if events != 1 {
+		t.Errorf("%d webhook events recorded for one delivery", events)
+	}
+
+	// A forged delivery is turned away before it is recorded
+	header.Set("X-Paystack-Signature", "forged")
+	if w := send(webhook, "POST", "/webhook", body, header); w.Code != http.StatusUnauthorized {
+		t.Errorf("forged delivery: %d", w.Code)
+	}
+}
+
+func TestReconcilePendingSettlesFailsAndExpires(t *testing.T) {
+	setupDB(t)
+	paystack := newFakePaystack(t)
+	shop := seedShop(t)
+
+	stale := time.Now().Add(-20 * time.Minute)
+	ancient := time.Now().Add(-3 * time.Hour)
+	references := map[string]time.Time{
+		"TX_paid":      stale,
+		"TX_declined":  stale,
+		"TX_abandoned": ancient,
+		"TX_waiting":   stale,
+		"TX_fresh":     time.Now(),
+	}
+	for reference, created := range references {
+		transaction := pendingPurchase(t, shop, reference)
+		database.DB.Model(&transaction).UpdateColumn("created_at", created)
+	}
+	paystack.reply("GET /transaction/verify/TX_paid", http.StatusOK, verified("TX_paid", 100))
+	paystack.reply("GET /transaction/verify/TX_declined", http.StatusOK, map[string]interface{}{"reference": "TX_declined", "status": "failed"})
+	paystack.reply("GET /transaction/verify/TX_abandoned", http.StatusOK, map[string]interface{}{"reference": "TX_abandoned", "status": "abandoned"})
+	paystack.reply("GET /transaction/verify/TX_waiting", http.StatusOK, map[string]interface{}{"reference": "TX_waiting", "status": "ongoing"})
+
+	report, err := ReconcilePending(10*time.Minute, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (ReconcileReport{Checked: 4, Settled: 1, Failed: 1, Expired: 1}); report != want {
+		t.Errorf("report = %+v, want %+v", report, want)
+	}
+
+	want := map[string]string{
+		"TX_paid":      "success",
+		"TX_declined":  "failed",
+		"TX_abandoned": "expired",
+		"TX_waiting":   "pending",
+		"TX_fresh":     "pending",
+	}
+	for reference, status := range want {
+		var transaction models.Transaction
+		database.DB.Where("reference = ?", reference).First(&transaction)
+		if transaction.Status != status {
+			t.Errorf("%s is %s, want %s", reference, transaction.Status, status)
+		}
+	}
+	if paystack.count("GET /transaction/verify/TX_fresh") != 0 {
+		t.Error("a checkout still in progress was verified")
+	}
+	settledOnce(t, shop, "TX_paid")
+
+	// A second pass finds nothing left to settle
+	report, err = ReconcilePending(10*time.Minute, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Settled != 0 || report.Failed != 0 || report.Expired != 0 {
+		t.Errorf("second pass = %+v", report)
+	}
+	settledOnce(t, shop, "TX_paid")
+}
+
+func TestCreatePaystackSubaccount(t *testing.T) {
+	setupDB(t)
+	paystack := newFakePaystack(t)
+	shop := seedShop(t)
+	admin := shop.admin
+	admin.BankCode, admin.AccountNumber, admin.AccountName = "01", "0123456789", "Owner"
+
+	var sent map[string]interface{}
+	paystack.handle("POST /subaccount", func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&sent)
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": true, "data": map[string]string{"subaccount_code": "ACCT_1"}})
+	})
+	if err := CreatePaystackSubaccount(&admin); err != nil {
+		t.Fatal(err)
+	}
+	if sent["account_number"] != "0123456789" || sent["settlement_bank"] != "01" {
+		t.Errorf("subaccount request %v", sent)
+	}
+	var saved models.Admin
+	database.DB.First(&saved, admin.ID)
+	if saved.PaystackSubaccountCode != "ACCT_1" {
+		t.Errorf("saved subaccount %q, want ACCT_1", saved.PaystackSubaccountCode)
+	}
+
+	paystack.reply("POST /subaccount", http.StatusBadRequest, nil)
+	if err := CreatePaystackSubaccount(&admin); err == nil {
+		t.Error("declined subaccount created without an error")
+	}
+}
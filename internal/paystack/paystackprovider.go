@@ -0,0 +1,178 @@
+package paystack
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/keyadaniel56/algocdk/internal/models"
+	"github.com/keyadaniel56/algocdk/internal/payments"
+	services "github.com/keyadaniel56/algocdk/service"
+)
+
+// paystackProvider charges cards and bank accounts through Paystack
+// checkout, splitting the admin's share to their subaccount
+type paystackProvider struct{}
+
+func (paystackProvider) Name() string { return payments.ChannelPaystack }
+
+func (paystackProvider) Initialize(charge payments.Charge) (*payments.Checkout, error) {
+	payload := map[string]interface{}{
+		"email":        charge.Email,
+		"amount":       payments.MinorUnits(charge.Amount),
+		"reference":    charge.Reference,
+		"callback_url": os.Getenv("PAYSTACK_CALLBACK_URL"),
+		"currency":     charge.Currency,
+	}
+	if charge.Subaccount != "" {
+		payload["subaccount"] = charge.Subaccount
+		payload["bearer"] = "subaccount"
+		payload["transaction_charge"] = payments.MinorUnits(charge.PlatformFee)
+	}
+
+	var data map[string]interface{}
+	if err := paystackCall("POST", "/transaction/initialize", payload, &data); err != nil {
+		return nil, err
+	}
+	authorizationURL, _ := data["authorization_url"].(string)
+	return &payments.Checkout{AuthorizationURL: authorizationURL, Data: data}, nil
+}
+
+func (paystackProvider) Verify(transaction models.Transaction) (*payments.Verification, error) {
+	result, err := verifyTransaction(transaction.Reference)
+	if err != nil {
+		return nil, err
+	}
+	return &payments.Verification{
+		Found:      result.Status,
+		Status:     result.Data.Status,
+		Amount:     result.AmountPaid(),
+		Currency:   result.Data.Currency,
+		Subaccount: result.Data.Subaccount.SubaccountCode,
+		Message:    result.Message,
+		Data:       result.Data,
+	}, nil
+}
+
+// ParseWebhook checks the HMAC-SHA512 of the body Paystack signs with the
+// secret key
+func (paystackProvider) ParseWebhook(r *http.Request, body []byte) (*payments.Notification, error) {
+	h := hmac.New(sha512.New, []byte(os.Getenv("PAYSTACK_SECRET_KEY")))
+	h.Write(body)
+	if !hmac.Equal([]byte(r.Header.Get("X-Paystack-Signature")), []byte(hex.EncodeToString(h.Sum(nil)))) {
+		return nil, payments.ErrInvalidSignature
+	}
+
+	var event struct {
+		Event string    `json:"event"`
+		Data  eventData `json:"data"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, err
+	}
+	notification := &payments.Notification{
+		Event:      event.Event,
+		Reference:  event.Data.Reference,
+		ProviderID: string(event.Data.ID),
+		Amount:     float64(event.Data.Amount) / 100,
+		Payload:    body,
+	}
+	switch {
+	case strings.HasPrefix(event.Event, "refund."), strings.HasPrefix(event.Event, "charge.dispute."):
+		notification.Reference = event.Data.transactionReference()
+	case strings.HasPrefix(event.Event, "transfer."):
+		// The reference of a transfer is the withdrawal's
+		notification.ProviderID = event.Data.TransferCode
+	}
+	return notification, nil
+}
+
+// Refund refunds by the charge's reference, in the currency it was charged
+// in
+func (paystackProvider) Refund(transaction models.Transaction, amount float64, note string) (*payments.ProviderResult, error) {
+	var created struct {
+		ID     payments.ID `json:"id"`
+		Status string      `json:"status"`
+	}
+	if err := paystackCall("POST", "/refund", map[string]interface{}{
+		"transaction":   transaction.Reference,
+		"amount":        payments.MinorUnits(amount),
+		"merchant_note": note,
+	}, &created); err != nil {
+		return nil, err
+	}
+
+	status := "pending"
+	switch created.Status {
+	case "processed":
+		status = "success"
+	case "failed":
+		status = "failed"
+	}
+	return &payments.ProviderResult{ID: string(created.ID), Status: status}, nil
+}
+
+// Payout transfers from the Paystack balance to the payee's bank account
+func (paystackProvider) Payout(withdrawal *models.Withdrawal, payee *payments.Payee) (*payments.ProviderResult, error) {
+	recipient, err := ensureRecipient(payee)
+	if err != nil {
+		return nil, err
+	}
+	withdrawal.RecipientCode = recipient
+
+	var transfer struct {
+		TransferCode string `json:"transfer_code"`
+		Status       string `json:"status"`
+	}
+	if err := paystackCall("POST", "/transfer", map[string]interface{}{
+		"source":    "balance",
+		"amount":    payments.MinorUnits(withdrawal.Amount),
+		"recipient": recipient,
+		"reference": withdrawal.Reference,
+		"reason":    fmt.Sprintf("Algocdk payout %d", withdrawal.ID),
+		"currency":  services.BaseCurrency(),
+	}, &transfer); err != nil {
+		return nil, err
+	}
+
+	status := "pending"
+	switch transfer.Status {
+	case "success":
+		status = "success"
+	case "failed", "reversed":
+		status = "failed"
+	}
+	return &payments.ProviderResult{ID: transfer.TransferCode, Status: status}, nil
+}
+
+// VerifyPayout looks the transfer of withdrawal up by its reference
+func (paystackProvider) VerifyPayout(withdrawal models.Withdrawal) (*payments.ProviderResult, error) {
+	var transfer struct {
+		TransferCode string `json:"transfer_code"`
+		Status       string `json:"status"`
+	}
+	err := paystackCall("GET", "/transfer/verify/"+url.PathEscape(withdrawal.Reference), nil, &transfer)
+	var rejected *payments.APIError
+	if errors.As(err, &rejected) && rejected.StatusCode == http.StatusNotFound {
+		return nil, payments.ErrPayoutNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	status := "pending"
+	switch transfer.Status {
+	case "success":
+		status = "success"
+	case "failed", "reversed":
+		status = "failed"
+	}
+	return &payments.ProviderResult{ID: transfer.TransferCode, Status: status}, nil
+}
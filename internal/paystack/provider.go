@@ -0,0 +1,292 @@
+package paystack
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	"github.com/keyadaniel56/algocdk/internal/payments"
+	"github.com/keyadaniel56/algocdk/internal/payments/mpesa"
+	"github.com/keyadaniel56/algocdk/internal/payments/stripe"
+	services "github.com/keyadaniel56/algocdk/service"
+)
+
+// ProviderFor returns the provider of a payment channel, e.g. "Paystack" or
+// "mpesa". Transactions from before there was a choice are Paystack's.
+func ProviderFor(channel string) (payments.PaymentProvider, error) {
+	switch strings.NewReplacer("-", "", "_", "", " ", "").Replace(strings.ToLower(channel)) {
+	case "", "paystack":
+		return paystackProvider{}, nil
+	case "mpesa":
+		return mpesa.Provider{}, nil
+	case "stripe":
+		return stripe.Provider{}, nil
+	}
+	return nil, fmt.Errorf("%w: %q", payments.ErrUnknownProvider, channel)
+}
+
+// transactionProvider returns the transaction with reference and the
+// provider that charged it. A reference we have no transaction for can only
+// have come from Paystack's checkout.
+func transactionProvider(reference string) (models.Transaction, payments.PaymentProvider, error) {
+	var transaction models.Transaction
+	found := database.DB.Where("reference = ?", reference).Limit(1).Find(&transaction)
+	if found.Error != nil {
+		return transaction, nil, found.Error
+	}
+	if found.RowsAffected == 0 {
+		return models.Transaction{Reference: reference, PaymentChannel: payments.ChannelPaystack}, paystackProvider{}, nil
+	}
+	provider, err := ProviderFor(transaction.PaymentChannel)
+	return transaction, provider, err
+}
+
+// rejected reports whether err is a provider turning a request down, as
+// opposed to one whose outcome is unknown
+func rejected(err error) bool {
+	var apiErr *payments.APIError
+	return errors.As(err, &apiErr) || errors.Is(err, services.ErrNoBankDetails) ||
+		errors.Is(err, services.ErrNoPhoneNumber) || errors.Is(err, payments.ErrPayoutUnsupported) ||
+		errors.Is(err, payments.ErrUnsupportedCharge)
+}
+
+// settleVerified settles a charge the provider confirmed, keeping the
+// provider's ID of the payment for refunds
+func settleVerified(reference string, verification *payments.Verification, source string) (models.Transaction, bool, error) {
+	if verification.ChargeID != "" {
+		database.DB.Model(&models.Transaction{}).
+			Where("reference = ? AND provider_charge_id = ?", reference, "").
+			Update("provider_charge_id", verification.ChargeID)
+	}
+	return Settle(reference, verification.Amount, source)
+}
+
+// ProviderWebhook godoc
+// @Summary Payment provider webhook
+// @Description Handles webhook notifications from a payment provider: paystack (as /api/payment/webhook), mpesa (STK push results, reversals, B2C payouts and their status queries) or stripe (Checkout sessions and refunds). Charges are verified with the provider before they are settled.
+// @Tags payment
+// @Accept json
+// @Produce json
+// @Param provider path string true "paystack, mpesa or stripe"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/payment/webhook/{provider} [post]
+func ProviderWebhook(ctx *gin.Context) {
+	provider, err := ProviderFor(ctx.Param("provider"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	handleWebhook(ctx, provider)
+}
+
+// handleWebhook authenticates a provider's webhook, logs it so a replay is
+// ignored, and applies it
+func handleWebhook(ctx *gin.Context, provider payments.PaymentProvider) {
+	body, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		log.Printf("Invalid %s webhook request: %v", provider.Name(), err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request"})
+		return
+	}
+	notification, err := provider.ParseWebhook(ctx.Request, body)
+	if errors.Is(err, payments.ErrInvalidSignature) {
+		log.Printf("Invalid %s webhook signature", provider.Name())
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid signature"})
+		return
+	}
+	if err != nil {
+		log.Printf("Invalid %s webhook payload: %v", provider.Name(), err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": "Invalid payload"})
+		return
+	}
+	log.Printf("%s webhook received: event=%s, reference=%s", provider.Name(), notification.Event, notification.Reference)
+
+	record, replay, err := recordWebhookEvent(strings.ToLower(provider.Name()), body, notification.Event, notification.Reference)
+	if err != nil {
+		log.Printf("Failed to record webhook event: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to record event"})
+		return
+	}
+	if replay {
+		log.Printf("Ignoring replayed webhook event %d (%s)", record.ID, record.Status)
+		ctx.JSON(http.StatusOK, gin.H{"message": "Event already processed"})
+		return
+	}
+
+	status, err := handleNotification(provider, notification)
+	finishWebhookEvent(record, status, err)
+	switch status {
+	case "failed":
+		log.Printf("Failed to handle %s %s: %v", provider.Name(), notification.Event, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to handle event", "error": err.Error()})
+	case "ignored":
+		ctx.JSON(http.StatusOK, gin.H{"message": "Event ignored"})
+	default:
+		ctx.JSON(http.StatusOK, gin.H{"message": "Webhook processed successfully"})
+	}
+}
+
+// handleNotification applies a webhook and returns the status to record it
+// with. Paystack's subscription and dispute events are its own; everything
+// else is handled alike for every provider.
+func handleNotification(provider payments.PaymentProvider, n *payments.Notification) (string, error) {
+	var data eventData
+	if provider.Name() == payments.ChannelPaystack {
+		var err error
+		if data, err = parseEventData(n.Payload); err != nil {
+			return "failed", err
+		}
+		switch n.Event {
+		case "subscription.create", "subscription.not_renew", "subscription.disable", "invoice.payment_failed":
+			return outcome(handleSubscriptionEvent(n.Event, data))
+		case "charge.dispute.create", "charge.dispute.remind", "charge.dispute.resolve":
+			return outcome(handleDisputeEvent(n.Event, data))
+		case "charge.success":
+			// Subscription renewals arrive under references Paystack made up
+			if err := recordRenewal(data); err != nil {
+				return "failed", err
+			}
+		}
+	}
+
+	switch n.Event {
+	case "charge.success", "charge.failed", "charge.expired":
+		var transaction models.Transaction
+		query := database.DB.Where("payment_channel IN ?", channelNames(provider))
+		if n.Reference != "" {
+			query = query.Where("reference = ?", n.Reference)
+		} else {
+			query = query.Where("provider_reference = ? AND provider_reference <> ?", n.ProviderReference, "")
+		}
+		if err := query.First(&transaction).Error; err != nil {
+			return "failed", ErrTransactionNotFound
+		}
+		if n.Event != "charge.success" {
+			markTransaction(transaction.Reference, strings.TrimPrefix(n.Event, "charge."))
+			return "processed", nil
+		}
+
+		// Webhooks are only a hint; the provider's own answer is settled
+		verification, err := provider.Verify(transaction)
+		if err != nil {
+			return "failed", err
+		}
+		if !verification.Found || verification.Status != "success" {
+			return "failed", fmt.Errorf("verification failed: %s", verification.Status)
+		}
+		if verification.ChargeID == "" {
+			verification.ChargeID = n.ChargeID
+		}
+		settled, _, err := settleVerified(transaction.Reference, verification, "webhook")
+		if err != nil {
+			if IsFinal(err) {
+				// Settled for good, just without access
+				stopSubscription(settled, err)
+				return "processed", err
+			}
+			return "failed", err
+		}
+		noteSubscriptionCharge(settled, data)
+		return "processed", nil
+
+	case "refund.processed", "refund.failed":
+		return outcome(applyRefund(provider, n))
+
+	case "transfer.success", "transfer.failed", "transfer.reversed":
+		var withdrawal models.Withdrawal
+		found := database.DB.Where("payout_channel IN ?", channelNames(provider)).
+			Where("(transfer_code = ? AND transfer_code <> ?) OR (reference = ? AND reference <> ?)", n.ProviderID, "", n.Reference, "").
+			Limit(1).Find(&withdrawal)
+		if found.Error != nil {
+			return "failed", found.Error
+		}
+		if found.RowsAffected == 0 {
+			return "failed", ErrTransferNotFound
+		}
+		database.DB.Model(&withdrawal).Update("transfer_status", strings.TrimPrefix(n.Event, "transfer."))
+		if n.Event == "transfer.reversed" && withdrawal.Status == "paid" {
+			return outcome(services.ReverseWithdrawal(withdrawal.ID, n.Event))
+		}
+		return outcome(services.CompleteWithdrawal(withdrawal.ID, n.Event == "transfer.success", n.Event))
+	}
+	log.Printf("Ignoring unhandled %s event: %s", provider.Name(), n.Event)
+	return "ignored", nil
+}
+
+// applyRefund applies the outcome of a refund: to the refund the provider
+// ID names, else to the oldest pending refund of the charge whose
+// submission timed out before it got one. A refund made on the provider's
+// dashboard is opened here.
+func applyRefund(provider payments.PaymentProvider, n *payments.Notification) error {
+	actor := strings.ToLower(provider.Name())
+	var refund models.Refund
+	found := database.DB.Where("provider_id = ? AND provider_id <> ?", n.ProviderID, "").Limit(1).Find(&refund)
+	if found.Error != nil {
+		return found.Error
+	}
+
+	if found.RowsAffected == 0 {
+		var transaction models.Transaction
+		query := database.DB.Where("payment_channel IN ?", channelNames(provider))
+		if n.Reference != "" {
+			query = query.Where("reference = ?", n.Reference)
+		} else {
+			query = query.Where("provider_charge_id = ? AND provider_charge_id <> ?", n.ChargeID, "")
+		}
+		if err := query.First(&transaction).Error; err != nil {
+			return services.ErrRefundNotFound
+		}
+		found = database.DB.Where("transaction_id = ? AND status = ? AND provider_id = ?", transaction.ID, "pending", "").
+			Order("id ASC").Limit(1).Find(&refund)
+		if found.Error != nil {
+			return found.Error
+		}
+		if found.RowsAffected == 0 {
+			if n.Event != "refund.processed" {
+				return nil
+			}
+			created, err := services.OpenRefund(transaction, services.ToBase(transaction, n.Amount),
+				"refunded on "+provider.Name(), "provider", "pending", actor)
+			if err != nil {
+				return err
+			}
+			refund = *created
+		}
+		if n.ProviderID != "" {
+			database.DB.Model(&refund).Update("provider_id", n.ProviderID)
+		}
+	}
+
+	if n.Event == "refund.processed" {
+		return services.CompleteRefund(refund.ID, actor)
+	}
+	return services.FailRefund(refund.ID, n.Event)
+}
+
+// channelNames are the payment channels a provider's transactions and
+// withdrawals may be stored with
+func channelNames(provider payments.PaymentProvider) []string {
+	if provider.Name() == payments.ChannelPaystack {
+		return []string{payments.ChannelPaystack, ""}
+	}
+	return []string{provider.Name()}
+}
+
+// outcome is the status to record a webhook with once handling it ended in
+// err
+func outcome(err error) (string, error) {
+	if err != nil {
+		return "failed", err
+	}
+	return "processed", nil
+}
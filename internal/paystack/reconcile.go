@@ -0,0 +1,132 @@
+package paystack
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	"github.com/keyadaniel56/algocdk/internal/payments"
+)
+
+// ReconcileReport counts what one reconciliation pass did
+type ReconcileReport struct {
+	Checked int `json:"checked"`
+	Settled int `json:"settled"`
+	Failed  int `json:"failed"`
+	Expired int `json:"expired"`
+}
+
+// ReconcilePending asks the provider of every transaction of a configured
+// channel still pending after staleAfter how its charge went. Successful
+// charges are settled, failed or reversed ones marked failed, and anything
+// still unpaid after expireAfter is expired. Transactions the provider
+// cannot be asked about are left for the next pass.
+func ReconcilePending(staleAfter, expireAfter time.Duration) (ReconcileReport, error) {
+	var report ReconcileReport
+	var pending []models.Transaction
+	if err := database.DB.
+		Where("status = ? AND payment_channel IN ? AND created_at < ?", "pending", configuredChannels(), time.Now().Add(-staleAfter)).
+		Find(&pending).Error; err != nil {
+		return report, err
+	}
+
+	for _, transaction := range pending {
+		report.Checked++
+		provider, err := ProviderFor(transaction.PaymentChannel)
+		if err != nil {
+			log.Printf("[Reconcile] cannot verify %s: %v", transaction.Reference, err)
+			continue
+		}
+		verification, err := provider.Verify(transaction)
+		if err != nil {
+			log.Printf("[Reconcile] could not verify %s: %v", transaction.Reference, err)
+			continue
+		}
+
+		switch {
+		case verification.Found && verification.Status == "success":
+			_, _, err := settleVerified(transaction.Reference, verification, "reconcile")
+			switch {
+			case IsFinal(err):
+				report.Failed++
+			case err != nil:
+				log.Printf("[Reconcile] failed to settle %s: %v", transaction.Reference, err)
+			default:
+				report.Settled++
+			}
+		case verification.Found && (verification.Status == "failed" || verification.Status == "reversed"):
+			if markTransaction(transaction.Reference, "failed") {
+				report.Failed++
+			}
+		case time.Since(transaction.CreatedAt) > expireAfter:
+			if markTransaction(transaction.Reference, "expired") {
+				report.Expired++
+			}
+		}
+	}
+	return report, nil
+}
+
+// configuredChannels are the payment channels whose provider has
+// credentials set
+func configuredChannels() []string {
+	var channels []string
+	if os.Getenv("PAYSTACK_SECRET_KEY") != "" {
+		channels = append(channels, payments.ChannelPaystack)
+	}
+	if os.Getenv("MPESA_CONSUMER_KEY") != "" {
+		channels = append(channels, payments.ChannelMPesa)
+	}
+	if os.Getenv("STRIPE_SECRET_KEY") != "" {
+		channels = append(channels, payments.ChannelStripe)
+	}
+	return channels
+}
+
+// StartReconciler runs ReconcilePending and ReconcileTransfers every
+// interval in the background, and with Paystack configured also
+// ReconcileRefunds and cancels subscriptions to retired plans
+func StartReconciler(interval, staleAfter, expireAfter time.Duration) {
+	if len(configuredChannels()) == 0 {
+		log.Println("[Reconcile] no payment provider configured, payment reconciliation disabled")
+		return
+	}
+	paystack := os.Getenv("PAYSTACK_SECRET_KEY") != ""
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			report, err := ReconcilePending(staleAfter, expireAfter)
+			if err != nil {
+				log.Printf("[Reconcile] pass failed: %v", err)
+			} else if report.Checked > 0 {
+				log.Printf("[Reconcile] checked %d pending payments: %d settled, %d failed, %d expired",
+					report.Checked, report.Settled, report.Failed, report.Expired)
+			}
+			ReconcileTransfers(staleAfter)
+			if paystack {
+				ReconcileRefunds(staleAfter)
+				CancelRetiredSubscriptions()
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// markTransaction moves a still pending transaction to status
+func markTransaction(reference, status string) bool {
+	result := database.DB.Model(&models.Transaction{}).
+		Where("reference = ? AND status = ?", reference, "pending").
+		Updates(map[string]interface{}{"status": status, "updated_at": time.Now()})
+	if result.Error != nil {
+		log.Printf("Failed to mark transaction %s %s: %v", reference, status, result.Error)
+		return false
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Transaction updated to %s for reference: %s", status, reference)
+	}
+	return result.RowsAffected > 0
+}
@@ -0,0 +1,206 @@
+package paystack
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	"github.com/keyadaniel56/algocdk/internal/payments"
+	services "github.com/keyadaniel56/algocdk/service"
+)
+
+// transactionReference is the charge a refund or dispute event is about
+func (d eventData) transactionReference() string {
+	if d.TransactionReference != "" {
+		return d.TransactionReference
+	}
+	var transaction struct {
+		Reference string `json:"reference"`
+	}
+	if json.Unmarshal(d.Transaction, &transaction) == nil && transaction.Reference != "" {
+		return transaction.Reference
+	}
+	return d.Reference
+}
+
+// IssueRefund godoc
+// @Summary Refund a payment
+// @Description Refunds all or part of a settled payment through the provider that charged it. The payer loses the access it bought once the provider confirms the refund: a license with a full refund, a rental or membership by the refunded part of its period.
+// @Tags superadmin
+// @Accept json
+// @Produce json
+// @Param request body object true "{\"reference\": \"TX_...\", \"amount\": 500, \"reason\": \"duplicate charge\"}, amount defaults to everything left"
+// @Security ApiKeyAuth
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 502 {object} map[string]string
+// @Router /api/superadmin/refunds [post]
+func IssueRefund(ctx *gin.Context) {
+	var req struct {
+		Reference string  `json:"reference" binding:"required"`
+		Amount    float64 `json:"amount"`
+		Reason    string  `json:"reason"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	var transaction models.Transaction
+	if err := database.DB.Where("reference = ?", req.Reference).First(&transaction).Error; err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "transaction not found"})
+		return
+	}
+	refund, err := services.OpenRefund(transaction, req.Amount, req.Reason, "superadmin", "pending",
+		fmt.Sprintf("superadmin:%d", ctx.GetUint("user_id")))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Could not refund this payment", "details": err.Error()})
+		return
+	}
+	respondRefundSubmitted(ctx, refund, http.StatusCreated)
+}
+
+// ApproveRefund godoc
+// @Summary Approve a refund request
+// @Description Approves a refund a user asked for and sends it to the provider that charged the payment
+// @Tags superadmin
+// @Produce json
+// @Param id path int true "Refund ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 502 {object} map[string]string
+// @Router /api/superadmin/refunds/{id}/approve [post]
+func ApproveRefund(ctx *gin.Context) {
+	refundID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid refund id"})
+		return
+	}
+
+	refund, err := services.ClaimRefund(uint(refundID), ctx.GetUint("user_id"))
+	if errors.Is(err, services.ErrRefundNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrRefundReviewed) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error(), "status": refund.Status})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve refund", "details": err.Error()})
+		return
+	}
+	respondRefundSubmitted(ctx, refund, http.StatusOK)
+}
+
+// respondRefundSubmitted sends a pending refund to the payment provider and
+// reports how that went
+func respondRefundSubmitted(ctx *gin.Context, refund *models.Refund, status int) {
+	if err := submitRefund(refund); err != nil {
+		log.Printf("Failed to submit refund %d: %v", refund.ID, err)
+		if !rejected(err) {
+			// The provider may have taken it, the webhook settles it either way
+			ctx.JSON(http.StatusAccepted, gin.H{"success": true, "refund": refund, "warning": "Refund outcome unknown, it will be applied once the provider confirms it"})
+			return
+		}
+		if failErr := services.FailRefund(refund.ID, err.Error()); failErr != nil {
+			log.Printf("Failed to mark refund %d failed: %v", refund.ID, failErr)
+		}
+		ctx.JSON(http.StatusBadGateway, gin.H{"error": "The payment provider refused the refund", "details": err.Error()})
+		return
+	}
+
+	database.DB.First(refund, refund.ID)
+	ctx.JSON(status, gin.H{"success": true, "refund": refund})
+}
+
+// submitRefund asks the provider that charged the payment to return a
+// pending refund to the payer
+func submitRefund(refund *models.Refund) error {
+	var transaction models.Transaction
+	if err := database.DB.First(&transaction, refund.TransactionID).Error; err != nil {
+		return ErrTransactionNotFound
+	}
+	provider, err := ProviderFor(transaction.PaymentChannel)
+	if err != nil {
+		return err
+	}
+	// Providers refund in the currency the payment was charged in
+	result, err := provider.Refund(transaction, services.ToCharged(transaction, refund.Amount), refund.Reason)
+	if err != nil {
+		return err
+	}
+
+	refund.ProviderID = result.ID
+	if err := database.DB.Model(refund).Update("provider_id", refund.ProviderID).Error; err != nil {
+		return err
+	}
+	log.Printf("%s refund %s for refund %d is %s", provider.Name(), refund.ProviderID, refund.ID, result.Status)
+	switch result.Status {
+	case "success":
+		return services.CompleteRefund(refund.ID, strings.ToLower(provider.Name()))
+	case "failed":
+		return &payments.APIError{Provider: provider.Name(), Message: "refund failed"}
+	}
+	return nil
+}
+
+// handleDisputeEvent tracks a chargeback: access is suspended while it is
+// open and taken back if the payer wins
+func handleDisputeEvent(event string, data eventData) error {
+	var transaction models.Transaction
+	if err := database.DB.Where("reference = ?", data.transactionReference()).First(&transaction).Error; err != nil {
+		return ErrTransactionNotFound
+	}
+	amount := services.ToBase(transaction, float64(data.RefundAmount)/100)
+
+	switch event {
+	case "charge.dispute.create", "charge.dispute.remind":
+		_, err := services.OpenDispute(transaction, string(data.ID), amount, data.Status)
+		return err
+	case "charge.dispute.resolve":
+		return services.ResolveDispute(transaction, string(data.ID), data.Resolution, amount)
+	}
+	return nil
+}
+
+// ReconcileRefunds asks Paystack about its refunds still pending after
+// staleAfter, in case a refund webhook was missed
+func ReconcileRefunds(staleAfter time.Duration) {
+	var pending []models.Refund
+	if err := database.DB.
+		Where("status = ? AND provider_id <> ? AND updated_at < ?", "pending", "", time.Now().Add(-staleAfter)).
+		Where("transaction_id IN (?)", database.DB.Model(&models.Transaction{}).Select("id").
+			Where("payment_channel IN ?", []string{payments.ChannelPaystack, ""})).
+		Find(&pending).Error; err != nil {
+		log.Printf("[Reconcile] failed to look up refunds: %v", err)
+		return
+	}
+	for _, refund := range pending {
+		var fetched struct {
+			Status string `json:"status"`
+		}
+		if err := paystackCall("GET", "/refund/"+url.PathEscape(refund.ProviderID), nil, &fetched); err != nil {
+			log.Printf("[Reconcile] could not fetch refund %s: %v", refund.ProviderID, err)
+			continue
+		}
+		switch fetched.Status {
+		case "processed":
+			services.CompleteRefund(refund.ID, "reconcile")
+		case "failed":
+			services.FailRefund(refund.ID, "refund failed")
+		}
+	}
+}
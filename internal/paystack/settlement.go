@@ -0,0 +1,333 @@
+package paystack
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	services "github.com/keyadaniel56/algocdk/service"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrTransactionNotFound = errors.New("transaction not found")
+	ErrBotNotFound         = errors.New("bot not found")
+)
+
+// UnderpaymentError is returned when Paystack collected less than the bot's
+// price. The reference is settled as underpaid, grants nothing and is
+// refunded.
+type UnderpaymentError struct {
+	Paid     float64
+	Expected float64
+	Currency string
+}
+
+func (e *UnderpaymentError) Error() string {
+	return fmt.Sprintf("Payment amount (%s %.2f) is less than expected (%s %.2f)", e.Currency, e.Paid, e.Currency, e.Expected)
+}
+
+// Settle applies a successful charge of amountPaid, in the currency the
+// transaction was charged in, to the transaction with reference, grants the
+// bot access it paid for and books it in the ledger. The reference is the
+// idempotency key: only the first call changes anything, later ones return
+// the same transaction with settled false. A charge that no longer buys what
+// it was for leaves the transaction unfulfilled and is refunded in full.
+func Settle(reference string, amountPaid float64, source string) (transaction models.Transaction, settled bool, err error) {
+	var settlement models.PaymentSettlement
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("reference = ?", reference).First(&transaction).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrTransactionNotFound
+			}
+			return err
+		}
+		found := tx.Where("reference = ?", reference).Limit(1).Find(&settlement)
+		if found.Error != nil || found.RowsAffected > 0 {
+			return found.Error
+		}
+
+		var bot models.Bot
+		if transaction.PaymentType != "membership" {
+			if err := tx.First(&bot, transaction.BotID).Error; err != nil {
+				return ErrBotNotFound
+			}
+		}
+
+		// Prices and dues are in the base currency
+		paid := services.ToBase(transaction, amountPaid)
+		status, due, err := settlementOutcome(tx, transaction, bot, paid)
+		if err != nil {
+			return err
+		}
+		settlement = models.PaymentSettlement{
+			Reference:     reference,
+			TransactionID: transaction.ID,
+			Source:        source,
+			AmountPaid:    paid,
+			AmountDue:     due,
+			Status:        status,
+		}
+
+		// A concurrent settlement of the same reference loses here
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&settlement)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return tx.Where("reference = ?", reference).First(&settlement).Error
+		}
+		settled = true
+
+		if settlement.Status != "success" {
+			// The provider keeps the money all the same, it is owed back
+			transaction.Status = "unfulfilled"
+			if err := tx.Model(&transaction).Update("status", transaction.Status).Error; err != nil {
+				return err
+			}
+			if err := services.PostUnfulfilled(tx, transaction, paid); err != nil {
+				return err
+			}
+			return services.RecordTransactionEvent(tx, transaction.ID, "unfulfilled", paid, source, settlement.Status)
+		}
+		transaction.Status = "success"
+		if err := tx.Model(&transaction).Update("status", transaction.Status).Error; err != nil {
+			return err
+		}
+		if err := grantAccess(tx, transaction, bot); err != nil {
+			return err
+		}
+		if err := services.PostSettlement(tx, transaction); err != nil {
+			return err
+		}
+		return services.RecordTransactionEvent(tx, transaction.ID, "settled", paid, source, "")
+	})
+	if err != nil {
+		return transaction, false, err
+	}
+
+	if settled {
+		log.Printf("[Payments] %s settled %s as %s (%s %.2f)", source, reference, settlement.Status, services.TransactionCurrency(transaction), amountPaid)
+		if settlement.Status != "success" && settlement.AmountPaid > 0 {
+			refundUnfulfilled(transaction, settlement.Status)
+		}
+	}
+	switch settlement.Status {
+	case "underpaid":
+		return transaction, settled, &UnderpaymentError{
+			Paid:     amountPaid,
+			Expected: services.ToCharged(transaction, settlement.AmountDue),
+			Currency: services.TransactionCurrency(transaction),
+		}
+	case "sold_out":
+		return transaction, settled, services.ErrSoldOut
+	case "unavailable":
+		if transaction.PaymentType == "rent" {
+			return transaction, settled, services.ErrRentalUnavailable
+		}
+		return transaction, settled, services.ErrListingUnavailable
+	}
+	return transaction, settled, nil
+}
+
+// refundUnfulfilled returns everything an unfulfilled transaction collected
+// to the payer. A refund the provider turns down is left failed for a
+// superadmin to look at; one whose outcome is unknown stays pending until
+// the provider's webhook settles it.
+func refundUnfulfilled(transaction models.Transaction, outcome string) {
+	refund, err := services.OpenRefund(transaction, 0, "payment could not be fulfilled: "+outcome, "unfulfilled", "pending", "system")
+	if err != nil {
+		log.Printf("[Payments] failed to open a refund of unfulfilled %s: %v", transaction.Reference, err)
+		return
+	}
+	if err := submitRefund(refund); err != nil {
+		log.Printf("[Payments] failed to submit refund %d of unfulfilled %s: %v", refund.ID, transaction.Reference, err)
+		if rejected(err) {
+			services.FailRefund(refund.ID, err.Error())
+		}
+	}
+}
+
+// IsFinal reports whether err from Settle is a settled outcome that grants
+// nothing and is refunded, as opposed to a failure worth retrying
+func IsFinal(err error) bool {
+	var underpaid *UnderpaymentError
+	return errors.As(err, &underpaid) || errors.Is(err, services.ErrSoldOut) ||
+		errors.Is(err, services.ErrListingUnavailable) || errors.Is(err, services.ErrRentalUnavailable)
+}
+
+// settlementOutcome decides whether amountPaid still buys what transaction
+// was for: "success", or "underpaid", "sold_out" (no seat left) or
+// "unavailable" (the resale listing is gone, or the rental no longer
+// applies). It also returns the price due.
+func settlementOutcome(tx *gorm.DB, transaction models.Transaction, bot models.Bot, amountPaid float64) (string, float64, error) {
+	due := bot.Price
+	switch transaction.PaymentType {
+	case "rent":
+		quote, err := services.QuoteRental(tx, transaction.UserID, bot, rentalPlanID(transaction))
+		if err != nil {
+			return "unavailable", 0, nil
+		}
+		due = quote.Due
+		// A switch quoted at checkout costs a little more by now, as the
+		// credit for the current plan shrinks; the checkout price stands.
+		// Subscriptions renew at the price they were started at.
+		if (transaction.RentalPlanID != nil || transaction.SubscriptionID != nil) && transaction.Amount < due {
+			due = transaction.Amount
+		}
+	case "resale":
+		var listing models.LicenseListing
+		if transaction.ListingID == nil || tx.First(&listing, *transaction.ListingID).Error != nil {
+			return "unavailable", 0, nil
+		}
+		due = listing.Price
+		if listing.Status != "listed" {
+			return "unavailable", due, nil
+		}
+	case "membership":
+		due = transaction.Amount
+	case "purchase":
+		if !bot.ExclusiveSale && bot.MaxLicenses > 0 {
+			issued, err := services.LicensesIssued(tx, bot)
+			if err != nil {
+				return "", due, err
+			}
+			if issued >= int64(bot.MaxLicenses) {
+				return "sold_out", due, nil
+			}
+		}
+	}
+
+	if amountPaid < due {
+		return "underpaid", due, nil
+	}
+	return "success", due, nil
+}
+
+// grantAccess gives the buyer of a settled transaction what they paid for:
+// a purchase is a license while the owner keeps the bot, unless the bot is
+// on exclusive sale and changes hands; a rent starts, renews or switches the
+// rental plan; a resale moves the seller's license to the buyer; a
+// membership charge extends the subscriber's tier.
+func grantAccess(tx *gorm.DB, transaction models.Transaction, bot models.Bot) error {
+	switch transaction.PaymentType {
+	case "purchase":
+		saleType := "license"
+		if bot.ExclusiveSale {
+			saleType = "exclusive"
+			if err := transferBot(tx, bot, transaction.UserID); err != nil {
+				return err
+			}
+		}
+
+		if err := recordSale(tx, transaction, bot.OwnerID, saleType); err != nil {
+			return err
+		}
+
+		// A renter who buys keeps their row, upgraded to a license
+		var userBot models.UserBot
+		if err := tx.Where("user_id = ? AND bot_id = ?", transaction.UserID, transaction.BotID).
+			FirstOrInit(&userBot).Error; err != nil {
+			return err
+		}
+		transactionID := transaction.ID
+		userBot.UserID = transaction.UserID
+		userBot.BotID = transaction.BotID
+		userBot.AccessType = "purchase"
+		userBot.IsActive = true
+		userBot.TransactionID = &transactionID
+		userBot.Price = transaction.Amount
+		userBot.ExpiryDate = nil
+		userBot.PurchaseDate = time.Now()
+		userBot.ResaleAllowed = bot.ResaleAllowed && !bot.ExclusiveSale
+		if err := tx.Omit("Bot").Save(&userBot).Error; err != nil {
+			return fmt.Errorf("failed to create user_bot entry: %w", err)
+		}
+	case "rent":
+		transactionID := transaction.ID
+		if _, err := services.ApplyRental(tx, transaction.UserID, bot, rentalPlanID(transaction), &transactionID); err != nil {
+			return fmt.Errorf("failed to apply rental: %w", err)
+		}
+	case "membership":
+		var sub models.Subscription
+		if transaction.SubscriptionID == nil || tx.First(&sub, *transaction.SubscriptionID).Error != nil {
+			return ErrSubscriptionNotFound
+		}
+		if _, err := services.ExtendMembership(tx, transaction.UserID, sub.Tier, sub.PeriodDays); err != nil {
+			return fmt.Errorf("failed to extend membership: %w", err)
+		}
+	case "resale":
+		listing, err := services.TransferLicense(tx, transaction)
+		if err != nil {
+			return err
+		}
+		if err := recordSale(tx, transaction, listing.SellerID, "resale"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordSale books the sale a settled transaction made, with what the buyer
+// paid in their currency
+func recordSale(tx *gorm.DB, transaction models.Transaction, sellerID uint, saleType string) error {
+	currency := services.TransactionCurrency(transaction)
+	charged := services.ToCharged(transaction, transaction.Amount)
+	sale := models.Sale{
+		BotID:         transaction.BotID,
+		SellerID:      sellerID,
+		BuyerID:       transaction.UserID,
+		Amount:        transaction.Amount,
+		Currency:      currency,
+		ChargedAmount: charged,
+		SaleType:      saleType,
+		SaleDate:      time.Now(),
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+	if err := tx.Create(&sale).Error; err != nil {
+		return fmt.Errorf("failed to record sale: %w", err)
+	}
+	return tx.Create(&models.SalesHistory{
+		BotID:          transaction.BotID,
+		SellerID:       sellerID,
+		BuyerID:        transaction.UserID,
+		Amount:         transaction.Amount,
+		Currency:       currency,
+		ChargedAmount:  charged,
+		TransactionRef: transaction.Reference,
+		SoldAt:         sale.SaleDate,
+	}).Error
+}
+
+// transferBot hands an exclusively sold bot to its buyer. The sale is a one
+// off: the new owner has to opt in again to sell it exclusively, and copy
+// trading of the old owner's trades ends.
+func transferBot(tx *gorm.DB, bot models.Bot, buyerID uint) error {
+	if err := tx.Model(&models.Bot{}).Where("id = ?", bot.ID).Updates(map[string]interface{}{
+		"owner_id":       buyerID,
+		"exclusive_sale": false,
+		"copy_trading":   false,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to update bot ownership: %w", err)
+	}
+	if err := tx.Where("user_id = ? AND bot_id = ?", bot.OwnerID, bot.ID).Delete(&models.UserBot{}).Error; err != nil {
+		return fmt.Errorf("failed to remove old owner access: %w", err)
+	}
+	if err := tx.Model(&models.CopySubscription{}).Where("bot_id = ?", bot.ID).Update("active", false).Error; err != nil {
+		return err
+	}
+	log.Printf("[Payments] bot %d sold exclusively by user %d to user %d", bot.ID, bot.OwnerID, buyerID)
+	return nil
+}
+
+func rentalPlanID(transaction models.Transaction) uint {
+	if transaction.RentalPlanID == nil {
+		return 0
+	}
+	return *transaction.RentalPlanID
+}
@@ -0,0 +1,198 @@
+package paystack
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	services "github.com/keyadaniel56/algocdk/service"
+)
+
+// listLicense gives a new user a license of the shop's bot and lists it for
+// price
+func listLicense(t *testing.T, shop testShop, price float64) (models.User, *models.LicenseListing) {
+	t.Helper()
+	seller := models.User{Name: "Seller", Email: "seller@example.com", Role: "user"}
+	if err := database.DB.Create(&seller).Error; err != nil {
+		t.Fatal(err)
+	}
+	license := models.UserBot{UserID: seller.ID, BotID: shop.bot.ID, AccessType: "purchase", IsActive: true, ResaleAllowed: true}
+	if err := database.DB.Create(&license).Error; err != nil {
+		t.Fatal(err)
+	}
+	listing, err := services.ListLicenseForResale(seller.ID, license.ID, price)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return seller, listing
+}
+
+func TestResaleCreditsSellerWhoCanWithdraw(t *testing.T) {
+	setupDB(t)
+	paystack := newFakePaystack(t)
+	paystack.reply("POST /transaction/initialize", http.StatusOK, map[string]string{"authorization_url": "https://checkout.test/x"})
+	shop := seedShop(t)
+	seller, listing := listLicense(t, shop, 50)
+
+	body, _ := json.Marshal(map[string]interface{}{"payment_type": "resale", "listing_id": listing.ID, "amount": 50})
+	w := send(testRouter(shop.buyer.ID, "POST", "/initialize", InitializePayment), "POST", "/initialize", body, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("initialize: %d %s", w.Code, w.Body)
+	}
+	var transaction models.Transaction
+	database.DB.Where("listing_id = ?", listing.ID).First(&transaction)
+	if transaction.SellerID == nil || *transaction.SellerID != seller.ID || transaction.AdminID != 0 {
+		t.Fatalf("resale should pay the seller, got seller %v admin %d", transaction.SellerID, transaction.AdminID)
+	}
+	if transaction.CompanyShare != 5 || transaction.AdminShare != 45 {
+		t.Fatalf("shares = %.2f/%.2f, want 5/45", transaction.CompanyShare, transaction.AdminShare)
+	}
+
+	if _, _, err := Settle(transaction.Reference, 50, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if got := balance(t, services.UserAccount(seller.ID)); got != 45 {
+		t.Errorf("seller is owed %.2f, want 45", got)
+	}
+	if got := balance(t, services.AccountRevenue); got != 5 {
+		t.Errorf("revenue is %.2f, want 5", got)
+	}
+	if got := balance(t, services.AdminAccount(shop.admin.ID)); got != 0 {
+		t.Errorf("the bot's admin is owed %.2f of a resale", got)
+	}
+
+	if _, err := services.RequestUserWithdrawal(seller, 45, "paystack"); !errors.Is(err, services.ErrNoBankDetails) {
+		t.Fatalf("withdrawal without bank details: %v", err)
+	}
+	seller.BankCode, seller.AccountNumber, seller.AccountName = "01", "0123456789", "Seller"
+	database.DB.Save(&seller)
+	if _, err := services.RequestUserWithdrawal(seller, 46, "paystack"); !errors.Is(err, services.ErrInsufficientBalance) {
+		t.Fatalf("withdrawal above the balance: %v", err)
+	}
+	withdrawal, err := services.RequestUserWithdrawal(seller, 45, "paystack")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paystack.reply("POST /transferrecipient", http.StatusOK, map[string]string{"recipient_code": "RCP_seller"})
+	paystack.reply("POST /transfer", http.StatusOK, map[string]string{"transfer_code": "TRF_1", "status": "success"})
+	claimed, err := services.ClaimWithdrawal(withdrawal.ID, 99)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := startTransfer(claimed); err != nil {
+		t.Fatal(err)
+	}
+
+	database.DB.First(withdrawal, withdrawal.ID)
+	if withdrawal.Status != "paid" {
+		t.Errorf("withdrawal is %s, want paid", withdrawal.Status)
+	}
+	database.DB.First(&seller, seller.ID)
+	if seller.PaystackRecipientCode != "RCP_seller" {
+		t.Errorf("recipient %q was not kept for the seller", seller.PaystackRecipientCode)
+	}
+	if got := balance(t, services.UserAccount(seller.ID)); got != 0 {
+		t.Errorf("seller is still owed %.2f", got)
+	}
+}
+
+func TestResaleListingIsHeldDuringCheckout(t *testing.T) {
+	setupDB(t)
+	paystack := newFakePaystack(t)
+	paystack.reply("POST /transaction/initialize", http.StatusOK, map[string]string{"authorization_url": "https://checkout.test/x"})
+	shop := seedShop(t)
+	_, listing := listLicense(t, shop, 50)
+	other := models.User{Name: "Other", Email: "other@example.com", Role: "user"}
+	database.DB.Create(&other)
+
+	body, _ := json.Marshal(map[string]interface{}{"payment_type": "resale", "listing_id": listing.ID, "amount": 50})
+	if w := send(testRouter(shop.buyer.ID, "POST", "/initialize", InitializePayment), "POST", "/initialize", body, nil); w.Code != http.StatusOK {
+		t.Fatalf("first checkout: %d %s", w.Code, w.Body)
+	}
+	if w := send(testRouter(other.ID, "POST", "/initialize", InitializePayment), "POST", "/initialize", body, nil); w.Code != http.StatusConflict {
+		t.Fatalf("second checkout of a held listing: %d %s", w.Code, w.Body)
+	}
+
+	// The hold lapses with the checkout
+	database.DB.Model(&models.Transaction{}).Where("listing_id = ?", listing.ID).
+		Update("created_at", time.Now().Add(-services.LicenseHold-time.Minute))
+	if w := send(testRouter(other.ID, "POST", "/initialize", InitializePayment), "POST", "/initialize", body, nil); w.Code != http.StatusOK {
+		t.Fatalf("checkout after the hold lapsed: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestUnfulfillableSettlementIsRefunded(t *testing.T) {
+	setupDB(t)
+	paystack := newFakePaystack(t)
+	var refunded []int64
+	paystack.handle("POST /refund", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Amount int64 `json:"amount"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		refunded = append(refunded, req.Amount)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": true, "data": map[string]interface{}{"id": len(refunded), "status": "pending"}})
+	})
+	shop := seedShop(t)
+	_, listing := listLicense(t, shop, 50)
+
+	resale := models.Transaction{Reference: "TX_resale", UserID: shop.buyer.ID, BotID: shop.bot.ID, PaymentType: "resale",
+		ListingID: &listing.ID, Amount: 50, Status: "pending", PaymentChannel: "Paystack"}
+	underpaid := models.Transaction{Reference: "TX_under", UserID: shop.buyer.ID, BotID: shop.bot.ID, PaymentType: "purchase",
+		AdminID: shop.admin.ID, Amount: 100, Status: "pending", PaymentChannel: "Paystack"}
+	for _, transaction := range []*models.Transaction{&resale, &underpaid} {
+		if err := database.DB.Create(transaction).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The seller takes the license off sale while the buyer pays
+	database.DB.Model(listing).Update("status", "cancelled")
+
+	if _, _, err := Settle(resale.Reference, 50, "test"); !errors.Is(err, services.ErrListingUnavailable) {
+		t.Fatalf("settling a cancelled listing: %v", err)
+	}
+	var underpayment *UnderpaymentError
+	if _, _, err := Settle(underpaid.Reference, 30, "test"); !errors.As(err, &underpayment) {
+		t.Fatalf("settling an underpayment: %v", err)
+	}
+	if len(refunded) != 2 || refunded[0] != 5000 || refunded[1] != 3000 {
+		t.Fatalf("refunds sent to Paystack = %v, want [5000 3000]", refunded)
+	}
+	if got := balance(t, services.AccountRefunds); got != 80 {
+		t.Errorf("owed back %.2f, want 80", got)
+	}
+
+	var refunds []models.Refund
+	database.DB.Order("id").Find(&refunds)
+	for _, refund := range refunds {
+		if refund.Source != "unfulfilled" || refund.Status != "pending" || refund.ProviderID == "" {
+			t.Fatalf("refund %+v was not sent automatically", refund)
+		}
+		if err := services.CompleteRefund(refund.ID, "paystack"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, transaction := range []*models.Transaction{&resale, &underpaid} {
+		database.DB.First(transaction, transaction.ID)
+		if transaction.Status != "refunded" {
+			t.Errorf("%s is %s, want refunded", transaction.Reference, transaction.Status)
+		}
+	}
+	if got := balance(t, services.AccountRefunds); got != 0 {
+		t.Errorf("still owed back %.2f", got)
+	}
+	if got := balance(t, services.AccountRevenue); got != 0 {
+		t.Errorf("revenue is %.2f from payments that bought nothing", got)
+	}
+	database.DB.First(listing, listing.ID)
+	if listing.Status != "cancelled" {
+		t.Errorf("refund changed the listing to %s", listing.Status)
+	}
+}
@@ -0,0 +1,678 @@
+package paystack
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	"github.com/keyadaniel56/algocdk/internal/payments"
+	"github.com/keyadaniel56/algocdk/internal/utils"
+	services "github.com/keyadaniel56/algocdk/service"
+)
+
+// paystackIntervals maps billing periods in days to Paystack plan intervals.
+// Plans of other lengths, and lifetime plans, cannot be subscribed to.
+var paystackIntervals = map[int]string{
+	1:   "daily",
+	7:   "weekly",
+	30:  "monthly",
+	90:  "quarterly",
+	180: "biannually",
+	365: "annually",
+}
+
+const (
+	// membershipPeriodDays is the billing period of paid membership tiers
+	membershipPeriodDays = 30
+	// maxDunningAttempts failed renewals cancel a subscription
+	maxDunningAttempts = 3
+)
+
+var (
+	ErrNotRecurring         = errors.New("this plan cannot be billed as a subscription")
+	ErrAlreadySubscribed    = errors.New("you already have a subscription for this")
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+)
+
+// renewingStatuses are the states of a subscription Paystack still charges
+var renewingStatuses = []string{"active", "past_due"}
+
+// eventData is the part of Paystack's charge, subscription, invoice,
+// transfer, refund and dispute webhook events that we use
+type eventData struct {
+	ID               payments.ID     `json:"id"`
+	Reference        string          `json:"reference"`
+	Amount           int             `json:"amount"`
+	Status           string          `json:"status"`
+	TransferCode     string          `json:"transfer_code"`
+	SubscriptionCode string          `json:"subscription_code"`
+	EmailToken       string          `json:"email_token"`
+	NextPaymentDate  string          `json:"next_payment_date"`
+	Plan             json.RawMessage `json:"plan"`
+	// Refund and dispute events name the charge they are about
+	TransactionReference string          `json:"transaction_reference"`
+	Transaction          json.RawMessage `json:"transaction"`
+	RefundAmount         int             `json:"refund_amount"`
+	Resolution           string          `json:"resolution"`
+	Customer             struct {
+		Email        string `json:"email"`
+		CustomerCode string `json:"customer_code"`
+	} `json:"customer"`
+	Authorization struct {
+		AuthorizationCode string `json:"authorization_code"`
+	} `json:"authorization"`
+	Subscription struct {
+		SubscriptionCode string `json:"subscription_code"`
+		NextPaymentDate  string `json:"next_payment_date"`
+	} `json:"subscription"`
+}
+
+// planCode is the Paystack plan a charge or subscription belongs to; one-off
+// charges have none
+func (d eventData) planCode() string {
+	var plan struct {
+		PlanCode string `json:"plan_code"`
+	}
+	if json.Unmarshal(d.Plan, &plan) != nil {
+		return ""
+	}
+	return plan.PlanCode
+}
+
+func parseEventData(payload []byte) (eventData, error) {
+	var event struct {
+		Data eventData `json:"data"`
+	}
+	err := json.Unmarshal(payload, &event)
+	return event.Data, err
+}
+
+func parsePaymentDate(value string) *time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// paystackCall sends payload to the Paystack API and decodes the data of a
+// successful response into out
+func paystackCall(method, path string, payload, out interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		raw, _ := json.Marshal(payload)
+		body = bytes.NewReader(raw)
+	}
+	req, _ := http.NewRequest(method, apiURL(path), body)
+	req.Header.Add("Authorization", "Bearer "+os.Getenv("PAYSTACK_SECRET_KEY"))
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Accept", "application/json")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Paystack API error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	var result struct {
+		Status  bool            `json:"status"`
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return fmt.Errorf("failed to parse Paystack response: %v", err)
+	}
+	if !result.Status {
+		return &payments.APIError{Provider: payments.ChannelPaystack, StatusCode: resp.StatusCode, Message: result.Message}
+	}
+	if out != nil {
+		return json.Unmarshal(result.Data, out)
+	}
+	return nil
+}
+
+// ensureBillingPlan returns the Paystack plan billing amount every PeriodDays
+// for what plan describes, creating it on Paystack the first time. A price
+// change gets a new plan; existing subscribers stay on the old one.
+func ensureBillingPlan(plan models.BillingPlan, name string) (*models.BillingPlan, error) {
+	interval, ok := paystackIntervals[plan.PeriodDays]
+	if !ok {
+		return nil, ErrNotRecurring
+	}
+	plan.Interval = interval
+
+	query := database.DB.Where("kind = ? AND bot_id = ? AND tier = ? AND period_days = ? AND amount = ?",
+		plan.Kind, plan.BotID, plan.Tier, plan.PeriodDays, plan.Amount)
+	if plan.RentalPlanID != nil {
+		query = query.Where("rental_plan_id = ?", *plan.RentalPlanID)
+	} else {
+		query = query.Where("rental_plan_id IS NULL")
+	}
+	var existing models.BillingPlan
+	found := query.Limit(1).Find(&existing)
+	if found.Error != nil {
+		return nil, found.Error
+	}
+	if found.RowsAffected > 0 {
+		return &existing, nil
+	}
+
+	var created struct {
+		PlanCode string `json:"plan_code"`
+	}
+	if err := paystackCall("POST", "/plan", map[string]interface{}{
+		"name":     name,
+		"interval": interval,
+		"amount":   payments.MinorUnits(plan.Amount),
+		"currency": services.BaseCurrency(),
+	}, &created); err != nil {
+		return nil, err
+	}
+	plan.PlanCode = created.PlanCode
+	if err := database.DB.Create(&plan).Error; err != nil {
+		return nil, err
+	}
+	log.Printf("[Subscriptions] created Paystack plan %s for %s (%s %.2f %s)", plan.PlanCode, name, services.BaseCurrency(), plan.Amount, interval)
+	return &plan, nil
+}
+
+// subscriptionTransaction is the pending transaction of one charge of sub
+func subscriptionTransaction(sub models.Subscription, reference string, amount float64) (models.Transaction, error) {
+	subscriptionID := sub.ID
+	transaction := models.Transaction{
+		UserID:         sub.UserID,
+		Amount:         amount,
+		Currency:       services.BaseCurrency(),
+		ChargedAmount:  amount,
+		ExchangeRate:   1,
+		CompanyShare:   amount,
+		CommissionRate: 1,
+		Status:         "pending",
+		Reference:      reference,
+		PaymentChannel: "Paystack",
+		PaymentType:    "membership",
+		SubscriptionID: &subscriptionID,
+		Description:    "Subscription: " + sub.Name,
+		CreatedAt:      time.Now(),
+	}
+	if sub.Kind != "rental" {
+		return transaction, nil
+	}
+
+	var bot models.Bot
+	if err := database.DB.First(&bot, sub.BotID).Error; err != nil {
+		return transaction, ErrBotNotFound
+	}
+	var admin models.Admin
+	database.DB.Where("person_id = ?", bot.OwnerID).Limit(1).Find(&admin)
+	transaction.AdminID = admin.ID
+	// Paystack does not split plan charges, the platform collects and owes
+	// the owner their share
+	transaction.BotID = bot.ID
+	transaction.PaymentType = "rent"
+	transaction.RentalPlanID = sub.RentalPlanID
+	commission, err := services.CommissionFor(database.DB, "rent", admin.ID, bot.ID, time.Now())
+	if err != nil {
+		return transaction, err
+	}
+	transaction.CompanyShare, transaction.AdminShare = commission.Split(amount)
+	transaction.CommissionRate = commission.Rate
+	transaction.CommissionRuleID = commission.RuleID()
+	return transaction, nil
+}
+
+// Subscribe godoc
+// @Summary Start a subscription
+// @Description Starts a recurring Paystack subscription to a bot rental plan (kind "rental" with bot_id and plan_id) or a membership tier (kind "membership" with tier). The first payment is made at the returned authorization URL, after which Paystack renews it every period.
+// @Tags payment
+// @Accept json
+// @Produce json
+// @Param body body object true "{\"kind\": \"rental\", \"bot_id\": 1, \"plan_id\": 2}"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/payment/subscribe [post]
+func Subscribe(ctx *gin.Context) {
+	var input struct {
+		Kind   string `json:"kind" binding:"required"`
+		BotID  uint   `json:"bot_id"`
+		PlanID uint   `json:"plan_id"`
+		Tier   string `json:"tier"`
+	}
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		log.Printf("Invalid subscription input: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+		return
+	}
+
+	userID := ctx.GetUint("user_id")
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+		return
+	}
+
+	sub := models.Subscription{UserID: userID, Kind: input.Kind, Status: "pending"}
+	billing := models.BillingPlan{Kind: input.Kind}
+	switch input.Kind {
+	case "rental":
+		var bot models.Bot
+		if err := database.DB.First(&bot, input.BotID).Error; err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"message": "Bot not found"})
+			return
+		}
+		quote, err := services.QuoteRental(database.DB, userID, bot, input.PlanID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		if quote.Kind == "switch" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"message": "Your current rental is on another plan, switch to this plan before subscribing to it"})
+			return
+		}
+		if quote.Plan.ID != 0 {
+			planID := quote.Plan.ID
+			sub.RentalPlanID = &planID
+		}
+		sub.BotID = bot.ID
+		sub.Name = fmt.Sprintf("%s (%s)", bot.Name, quote.Plan.Name)
+		billing.BotID = bot.ID
+		billing.RentalPlanID = sub.RentalPlanID
+		billing.PeriodDays = quote.Plan.DurationDays
+		billing.Amount = quote.Plan.Price
+	case "membership":
+		price, err := services.MembershipPrice(input.Tier)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		sub.Tier = input.Tier
+		sub.Name = input.Tier + " membership"
+		billing.Tier = input.Tier
+		billing.PeriodDays = membershipPeriodDays
+		billing.Amount = price
+	default:
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": "Invalid subscription kind, must be 'rental' or 'membership'"})
+		return
+	}
+
+	var open int64
+	database.DB.Model(&models.Subscription{}).
+		Where("user_id = ? AND kind = ? AND bot_id = ? AND tier = ?", userID, sub.Kind, sub.BotID, sub.Tier).
+		Where("status IN ? OR (status = ? AND created_at > ?)", renewingStatuses, "pending", time.Now().Add(-services.LicenseHold)).
+		Count(&open)
+	if open > 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": ErrAlreadySubscribed.Error()})
+		return
+	}
+
+	plan, err := ensureBillingPlan(billing, sub.Name)
+	if errors.Is(err, ErrNotRecurring) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to set up Paystack plan for %s: %v", sub.Name, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to set up subscription plan", "error": err.Error()})
+		return
+	}
+	sub.BillingPlanID = plan.ID
+	sub.PlanCode = plan.PlanCode
+	sub.PeriodDays = plan.PeriodDays
+	sub.Amount = plan.Amount
+	sub.Reference = fmt.Sprintf("SUB_%d_%d", userID, time.Now().UnixNano())
+
+	var data map[string]interface{}
+	if err := paystackCall("POST", "/transaction/initialize", map[string]interface{}{
+		"email":        user.Email,
+		"amount":       payments.MinorUnits(plan.Amount),
+		"plan":         plan.PlanCode,
+		"reference":    sub.Reference,
+		"callback_url": os.Getenv("PAYSTACK_CALLBACK_URL"),
+		"currency":     services.BaseCurrency(),
+	}, &data); err != nil {
+		log.Printf("Paystack subscription initialization failed: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": "Failed to initialize subscription", "error": err.Error()})
+		return
+	}
+
+	if err := database.DB.Create(&sub).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to save subscription"})
+		return
+	}
+	transaction, err := subscriptionTransaction(sub, sub.Reference, plan.Amount)
+	if err == nil {
+		err = database.DB.Create(&transaction).Error
+	}
+	if err != nil {
+		log.Printf("Failed to save subscription transaction: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to save transaction"})
+		return
+	}
+
+	log.Printf("[Subscriptions] user %d subscribing to %s on %s", userID, sub.Name, plan.PlanCode)
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":      "Subscription initialized",
+		"data":         data,
+		"subscription": sub,
+	})
+}
+
+// ListSubscriptions godoc
+// @Summary List subscriptions
+// @Description Lists the user's recurring subscriptions
+// @Tags payment
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /api/payment/subscriptions [get]
+func ListSubscriptions(ctx *gin.Context) {
+	var subs []models.Subscription
+	if err := database.DB.Where("user_id = ?", ctx.GetUint("user_id")).Order("created_at DESC").Find(&subs).Error; err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to fetch subscriptions"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"subscriptions": subs})
+}
+
+// CancelSubscription godoc
+// @Summary Cancel a subscription
+// @Description Stops a subscription from renewing. Access already paid for lasts until the end of the period.
+// @Tags payment
+// @Produce json
+// @Param id path int true "Subscription ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 502 {object} map[string]string
+// @Router /api/payment/subscriptions/{id}/cancel [post]
+func CancelSubscription(ctx *gin.Context) {
+	var sub models.Subscription
+	if err := database.DB.Where("id = ? AND user_id = ?", ctx.Param("id"), ctx.GetUint("user_id")).First(&sub).Error; err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"message": ErrSubscriptionNotFound.Error()})
+		return
+	}
+	if sub.Status == "cancelled" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": "Subscription is already cancelled"})
+		return
+	}
+
+	if err := cancelSubscription(&sub); err != nil {
+		log.Printf("Failed to cancel subscription %d: %v", sub.ID, err)
+		ctx.JSON(http.StatusBadGateway, gin.H{"message": "Failed to cancel subscription", "error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Subscription cancelled", "subscription": sub})
+}
+
+// cancelSubscription disables sub on Paystack, if it got that far, and
+// marks it cancelled
+func cancelSubscription(sub *models.Subscription) error {
+	if sub.SubscriptionCode != "" {
+		if err := paystackCall("POST", "/subscription/disable", map[string]interface{}{
+			"code":  sub.SubscriptionCode,
+			"token": sub.EmailToken,
+		}, nil); err != nil {
+			return err
+		}
+	}
+	now := time.Now()
+	sub.Status = "cancelled"
+	sub.CancelledAt = &now
+	log.Printf("[Subscriptions] subscription %d (%s) of user %d cancelled", sub.ID, sub.Name, sub.UserID)
+	return database.DB.Model(sub).Updates(map[string]interface{}{"status": sub.Status, "cancelled_at": sub.CancelledAt}).Error
+}
+
+// recordRenewal creates the transaction of a subscription renewal charge,
+// which Paystack starts under a reference of its own
+func recordRenewal(data eventData) error {
+	planCode := data.planCode()
+	if planCode == "" || data.Reference == "" {
+		return nil
+	}
+	var known int64
+	if err := database.DB.Model(&models.Transaction{}).Where("reference = ?", data.Reference).Count(&known).Error; err != nil {
+		return err
+	}
+	if known > 0 {
+		return nil
+	}
+
+	var sub models.Subscription
+	found := database.DB.
+		Where("plan_code = ? AND status IN ?", planCode, []string{"active", "past_due", "non_renewing"}).
+		Where("user_id IN (?)", database.DB.Model(&models.User{}).Select("id").Where("email = ?", data.Customer.Email)).
+		Order("id DESC").Limit(1).Find(&sub)
+	if found.Error != nil {
+		return found.Error
+	}
+	if found.RowsAffected == 0 {
+		return ErrSubscriptionNotFound
+	}
+
+	transaction, err := subscriptionTransaction(sub, data.Reference, float64(data.Amount)/100.0)
+	if err != nil {
+		return err
+	}
+	transaction.Description = "Renewal: " + sub.Name
+	return database.DB.Create(&transaction).Error
+}
+
+// noteSubscriptionCharge records a settled charge on its subscription: a
+// payment that went through clears past failures
+func noteSubscriptionCharge(transaction models.Transaction, data eventData) {
+	if transaction.SubscriptionID == nil {
+		return
+	}
+	updates := map[string]interface{}{"status": "active", "failed_attempts": 0}
+	if data.Authorization.AuthorizationCode != "" {
+		updates["authorization_code"] = data.Authorization.AuthorizationCode
+	}
+	if data.Customer.CustomerCode != "" {
+		updates["customer_code"] = data.Customer.CustomerCode
+	}
+	if err := database.DB.Model(&models.Subscription{}).
+		Where("id = ? AND status IN ?", *transaction.SubscriptionID, []string{"pending", "active", "past_due"}).
+		Updates(updates).Error; err != nil {
+		log.Printf("Failed to update subscription %d: %v", *transaction.SubscriptionID, err)
+	}
+}
+
+// stopSubscription cancels the subscription of a charge that could not be
+// granted, so it is not charged again for nothing
+func stopSubscription(transaction models.Transaction, cause error) {
+	if transaction.SubscriptionID == nil {
+		return
+	}
+	var sub models.Subscription
+	if err := database.DB.First(&sub, *transaction.SubscriptionID).Error; err != nil || sub.Status == "cancelled" {
+		return
+	}
+	if err := cancelSubscription(&sub); err != nil {
+		log.Printf("Failed to cancel subscription %d: %v", sub.ID, err)
+		return
+	}
+	notifySubscriber(sub, func(email string) {
+		utils.SendSubscriptionEndedEmail(email, sub.Name, cause.Error())
+	})
+}
+
+// handleSubscriptionEvent applies a Paystack subscription or invoice event
+func handleSubscriptionEvent(event string, data eventData) error {
+	switch event {
+	case "subscription.create":
+		return subscriptionCreated(data)
+	case "invoice.payment_failed":
+		return renewalFailed(data)
+	case "subscription.not_renew":
+		return database.DB.Model(&models.Subscription{}).
+			Where("subscription_code = ? AND status IN ?", data.SubscriptionCode, renewingStatuses).
+			Update("status", "non_renewing").Error
+	case "subscription.disable":
+		return subscriptionDisabled(data)
+	}
+	return nil
+}
+
+// subscriptionCreated stores the codes of the subscription Paystack created
+// after a first charge on one of our plans
+func subscriptionCreated(data eventData) error {
+	var sub models.Subscription
+	found := database.DB.
+		Where("subscription_code = ? AND plan_code = ?", "", data.planCode()).
+		Where("user_id IN (?)", database.DB.Model(&models.User{}).Select("id").Where("email = ?", data.Customer.Email)).
+		Order("id DESC").Limit(1).Find(&sub)
+	if found.Error != nil {
+		return found.Error
+	}
+	if found.RowsAffected == 0 {
+		return ErrSubscriptionNotFound
+	}
+
+	sub.SubscriptionCode = data.SubscriptionCode
+	sub.EmailToken = data.EmailToken
+	sub.AuthorizationCode = data.Authorization.AuthorizationCode
+	sub.CustomerCode = data.Customer.CustomerCode
+	sub.NextPaymentDate = parsePaymentDate(data.NextPaymentDate)
+	if err := database.DB.Model(&sub).Updates(map[string]interface{}{
+		"subscription_code":  sub.SubscriptionCode,
+		"email_token":        sub.EmailToken,
+		"authorization_code": sub.AuthorizationCode,
+		"customer_code":      sub.CustomerCode,
+		"next_payment_date":  sub.NextPaymentDate,
+	}).Error; err != nil {
+		return err
+	}
+	log.Printf("[Subscriptions] subscription %d is %s on Paystack", sub.ID, sub.SubscriptionCode)
+
+	// Cancelled while the first payment was still going through
+	if sub.Status == "cancelled" {
+		return cancelSubscription(&sub)
+	}
+	return database.DB.Model(&sub).Where("status = ?", "pending").Update("status", "active").Error
+}
+
+// renewalFailed runs dunning for a failed renewal charge: the subscriber is
+// emailed a link to update their card, and after maxDunningAttempts
+// failures the subscription is cancelled. Access already paid for runs out
+// on its own.
+func renewalFailed(data eventData) error {
+	var sub models.Subscription
+	if err := database.DB.Where("subscription_code = ?", data.Subscription.SubscriptionCode).First(&sub).Error; err != nil {
+		return ErrSubscriptionNotFound
+	}
+	if sub.Status == "cancelled" {
+		return nil
+	}
+
+	now := time.Now()
+	sub.FailedAttempts++
+	sub.LastFailureAt = &now
+	sub.Status = "past_due"
+	if next := parsePaymentDate(data.Subscription.NextPaymentDate); next != nil {
+		sub.NextPaymentDate = next
+	}
+	if err := database.DB.Model(&sub).Updates(map[string]interface{}{
+		"failed_attempts":   sub.FailedAttempts,
+		"last_failure_at":   sub.LastFailureAt,
+		"status":            sub.Status,
+		"next_payment_date": sub.NextPaymentDate,
+	}).Error; err != nil {
+		return err
+	}
+	log.Printf("[Subscriptions] renewal of subscription %d failed (%d/%d)", sub.ID, sub.FailedAttempts, maxDunningAttempts)
+
+	if sub.FailedAttempts >= maxDunningAttempts {
+		if err := cancelSubscription(&sub); err != nil {
+			return err
+		}
+		notifySubscriber(sub, func(email string) {
+			utils.SendSubscriptionEndedEmail(email, sub.Name, fmt.Sprintf("the last %d renewal payments failed", sub.FailedAttempts))
+		})
+		return nil
+	}
+
+	var manage struct {
+		Link string `json:"link"`
+	}
+	if err := paystackCall("GET", "/subscription/"+url.PathEscape(sub.SubscriptionCode)+"/manage/link", nil, &manage); err != nil {
+		log.Printf("Failed to get manage link for subscription %d: %v", sub.ID, err)
+	}
+	notifySubscriber(sub, func(email string) {
+		utils.SendPaymentFailedEmail(email, sub.Name, sub.FailedAttempts, maxDunningAttempts, manage.Link)
+	})
+	return nil
+}
+
+// subscriptionDisabled records a subscription Paystack stopped, whether the
+// subscriber cancelled it with Paystack or it ran out of retries
+func subscriptionDisabled(data eventData) error {
+	var sub models.Subscription
+	if err := database.DB.Where("subscription_code = ?", data.SubscriptionCode).First(&sub).Error; err != nil {
+		return ErrSubscriptionNotFound
+	}
+	if sub.Status == "cancelled" {
+		return nil
+	}
+	now := time.Now()
+	sub.Status = "cancelled"
+	sub.CancelledAt = &now
+	if err := database.DB.Model(&sub).Updates(map[string]interface{}{"status": sub.Status, "cancelled_at": sub.CancelledAt}).Error; err != nil {
+		return err
+	}
+	log.Printf("[Subscriptions] subscription %d disabled on Paystack", sub.ID)
+	notifySubscriber(sub, func(email string) {
+		utils.SendSubscriptionEndedEmail(email, sub.Name, "it was disabled on Paystack")
+	})
+	return nil
+}
+
+// CancelRetiredSubscriptions cancels rental subscriptions whose plan was
+// retired or whose bot is gone, before they are charged for access that can
+// no longer be granted
+func CancelRetiredSubscriptions() {
+	var subs []models.Subscription
+	if err := database.DB.
+		Where("kind = ? AND status IN ?", "rental", []string{"active", "past_due", "non_renewing"}).
+		Where("rental_plan_id IN (?) OR bot_id NOT IN (?)",
+			database.DB.Model(&models.RentalPlan{}).Select("id").Where("active = ?", false),
+			database.DB.Model(&models.Bot{}).Select("id")).
+		Find(&subs).Error; err != nil {
+		log.Printf("[Subscriptions] failed to look up retired subscriptions: %v", err)
+		return
+	}
+	for i := range subs {
+		if err := cancelSubscription(&subs[i]); err != nil {
+			log.Printf("[Subscriptions] failed to cancel subscription %d: %v", subs[i].ID, err)
+			continue
+		}
+		sub := subs[i]
+		notifySubscriber(sub, func(email string) {
+			utils.SendSubscriptionEndedEmail(email, sub.Name, "the plan is no longer offered")
+		})
+	}
+}
+
+func notifySubscriber(sub models.Subscription, send func(email string)) {
+	var user models.User
+	if err := database.DB.Select("email").First(&user, sub.UserID).Error; err != nil {
+		log.Printf("No email for subscriber %d: %v", sub.UserID, err)
+		return
+	}
+	go send(user.Email)
+}
@@ -18,6 +18,8 @@ func SetUpRouter(router *gin.Engine) {
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 	api := router.Group("/api")
 	api.GET("/marketplace", handlers.MarketplaceHandler)
+	api.GET("/marketplace/bots/:id/backtest", handlers.MarketplaceBotBacktestHandler)
+	api.GET("/currencies", handlers.GetCurrenciesHandler)
 	router.GET("/api/paystack/callback", paystack.HandleCallbackRedirect)
 	router.SetTrustedProxies(nil)
 	router.GET("/bots/:id", handlers.ServeBotHandler)
@@ -37,8 +39,10 @@ func SetUpRouter(router *gin.Engine) {
 			market.GET("/data", handlers.GetMarketData)
 			market.GET("/deriv", handlers.GetDerivMarketData)
 			market.GET("/chart/:symbol", handlers.GetChartData)
+			market.GET("/indicators/:symbol", handlers.GetIndicators)
 			market.GET("/calendar", handlers.GetEconomicCalendar)
 			market.GET("/news", handlers.GetMarketNews)
+			market.GET("/export/:symbol", middleware.AuthMiddleware(), handlers.ExportMarketData)
 		}
 
 		// WebSocket endpoint
@@ -57,6 +61,45 @@ func SetUpRouter(router *gin.Engine) {
 			user.POST("/trades", handlers.RecordTradeHandler)
 			user.GET("/trades", handlers.GetUserTradesHandler)
 
+			// Server-side bot runs
+			user.POST("/bots/:id/run", handlers.StartBotRunHandler)
+			user.GET("/runs", handlers.GetBotRunsHandler)
+			user.GET("/runs/:id", handlers.GetBotRunHandler)
+			user.POST("/runs/:id/pause", handlers.PauseBotRunHandler)
+			user.POST("/runs/:id/resume", handlers.ResumeBotRunHandler)
+			user.POST("/runs/:id/stop", handlers.StopBotRunHandler)
+
+			// Risk limits and kill switch
+			user.GET("/risk", handlers.GetRiskSettingsHandler)
+			user.PUT("/risk", handlers.UpdateRiskProfileHandler)
+			user.PUT("/risk/bots/:bot_id", handlers.UpdateBotRiskProfileHandler)
+			user.DELETE("/risk/bots/:bot_id", handlers.DeleteBotRiskProfileHandler)
+			user.GET("/risk/blocked", handlers.GetBlockedOrdersHandler)
+			user.POST("/kill-switch", handlers.KillSwitchHandler)
+
+			// Copy trading
+			user.GET("/copy", handlers.GetCopySubscriptionsHandler)
+			user.GET("/copy/trades", handlers.GetCopyTradesHandler)
+			user.POST("/copy/:bot_id", handlers.FollowLeaderHandler)
+			user.DELETE("/copy/:id", handlers.UnfollowLeaderHandler)
+
+			// Rental plans
+			user.GET("/bots/:id/rental-quote", handlers.GetRentalQuoteHandler)
+			user.POST("/bots/:id/plan", handlers.SwitchRentalPlanHandler)
+
+			// Payment currency
+			user.PUT("/currency", handlers.SetPreferredCurrencyHandler)
+			user.GET("/bots/:id/prices", handlers.GetBotPricesHandler)
+
+			// License resale
+			user.GET("/resale", handlers.GetResaleListingsHandler)
+			user.POST("/resale", handlers.ListLicenseForResaleHandler)
+			user.DELETE("/resale/:id", handlers.CancelResaleListingHandler)
+			user.GET("/earnings", handlers.GetUserEarningsHandler)
+			user.PUT("/payout-details", handlers.UpdatePayoutDetailsHandler)
+			user.GET("/withdrawals", handlers.GetUserWithdrawalsHandler)
+			user.POST("/withdrawals", handlers.RequestUserWithdrawalHandler)
+
 			user.POST("/favorite/:bot_id", handlers.ToggleFavorite)
 			user.GET("/favorite", handlers.GetUserFavorites)
 
@@ -102,6 +145,22 @@ func SetUpRouter(router *gin.Engine) {
 			superadmin.GET("/sales", handlers.GetAllSales)
 			superadmin.GET("/performance", handlers.GetPlatformPerformance)
 			superadmin.GET("/transactions", handlers.GetAllTransactions)
+			superadmin.GET("/withdrawals", handlers.GetWithdrawalsHandler)
+			superadmin.POST("/withdrawals/:id/approve", paystack.ApproveWithdrawal)
+			superadmin.POST("/withdrawals/:id/reject", handlers.RejectWithdrawalHandler)
+			superadmin.GET("/transactions/:reference/history", handlers.GetTransactionHistoryHandler)
+			superadmin.GET("/refunds", handlers.GetRefundsHandler)
+			superadmin.POST("/refunds", paystack.IssueRefund)
+			superadmin.POST("/refunds/:id/approve", paystack.ApproveRefund)
+			superadmin.POST("/refunds/:id/reject", handlers.RejectRefundHandler)
+			superadmin.GET("/disputes", handlers.GetDisputesHandler)
+			superadmin.GET("/commission-rules", handlers.GetCommissionRulesHandler)
+			superadmin.GET("/commission-rules/preview", handlers.PreviewCommissionHandler)
+			superadmin.POST("/commission-rules", handlers.CreateCommissionRuleHandler)
+			superadmin.PUT("/commission-rules/:id", handlers.UpdateCommissionRuleHandler)
+			superadmin.DELETE("/commission-rules/:id", handlers.DeleteCommissionRuleHandler)
+			superadmin.PUT("/exchange-rates", handlers.SetExchangeRateHandler)
+			superadmin.DELETE("/exchange-rates/:currency", handlers.DeleteExchangeRateHandler)
 
 			// Admin Requests Management
 			superadmin.GET("/admin-requests", handlers.GetPendingAdminRequests)
@@ -123,6 +182,27 @@ func SetUpRouter(router *gin.Engine) {
 			admin.POST("/transactions", handlers.RecordTransaction)
 			admin.GET("/bots/:id/users", handlers.BotUsersHandler)
 			admin.DELETE("/bots/:bot_id/users/:user_id", handlers.RemoveUserFromBotHandler)
+			admin.PUT("/bots/:id/strategy", handlers.SetBotStrategyHandler)
+			admin.POST("/bots/:id/backtests", handlers.RunBotBacktestHandler)
+			admin.GET("/bots/:id/backtests", handlers.ListBotBacktestsHandler)
+			admin.GET("/backtests/:id", handlers.GetBacktestHandler)
+			admin.PUT("/bots/:id/copy-trading", handlers.SetBotCopyTradingHandler)
+			admin.PUT("/bots/:id/licensing", handlers.SetBotLicensingHandler)
+			admin.GET("/bots/:id/plans", handlers.ListBotPlansHandler)
+			admin.POST("/bots/:id/plans", handlers.CreateBotPlanHandler)
+			admin.PUT("/bots/:id/plans/:plan_id", handlers.UpdateBotPlanHandler)
+			admin.DELETE("/bots/:id/plans/:plan_id", handlers.RetireBotPlanHandler)
+			admin.GET("/bots/:id/prices", handlers.ListBotPricesHandler)
+			admin.PUT("/bots/:id/prices", handlers.SetBotPriceHandler)
+			admin.DELETE("/bots/:id/prices/:price_id", handlers.DeleteBotPriceHandler)
+			admin.GET("/copy/followers", handlers.GetCopyFollowersHandler)
+
+			// Earnings and payouts
+			admin.GET("/commission", handlers.GetAdminCommissionHandler)
+			admin.GET("/ledger", handlers.GetAdminLedgerHandler)
+			admin.GET("/ledger/statement", handlers.GetAdminStatementHandler)
+			admin.GET("/withdrawals", handlers.GetAdminWithdrawalsHandler)
+			admin.POST("/withdrawals", handlers.RequestWithdrawalHandler)
 			admin.POST("/reset_password/:id", handlers.ResetPasswordHandler)
 
 			// Sites Management
@@ -143,8 +223,14 @@ func SetUpRouter(router *gin.Engine) {
 				paystackGroup.GET("/verify", paystack.VerifyPayment)
 				paystackGroup.POST("/callback", paystack.FrontendCallback)
 				paystackGroup.POST("update-transaction", paystack.UpdateTransaction)
+				paystackGroup.POST("/subscribe", paystack.Subscribe)
+				paystackGroup.GET("/subscriptions", paystack.ListSubscriptions)
+				paystackGroup.POST("/subscriptions/:id/cancel", paystack.CancelSubscription)
+				paystackGroup.POST("/refunds", handlers.RequestRefundHandler)
+				paystackGroup.GET("/refunds", handlers.GetMyRefundsHandler)
 			}
 			paystackGroup.POST("/webhook", paystack.PaystackCallback)
+			paystackGroup.POST("/webhook/:provider", paystack.ProviderWebhook)
 		}
 
 		// ============================================
@@ -159,6 +245,8 @@ func SetUpRouter(router *gin.Engine) {
 			derivGroup.POST("/user/balance", handlers.GetDerivBalance)
 			derivGroup.POST("/accounts/list", handlers.GetDerivAccountList)
 			derivGroup.POST("/accounts/switch", handlers.SwitchDerivAccount)
+			derivGroup.GET("/oauth/callback", handlers.DerivOAuthCallback)
+			derivGroup.GET("/config", handlers.GetDerivConfig)
 		}
 
 		// Protected Deriv endpoints - requires authentication
@@ -170,6 +258,7 @@ func SetUpRouter(router *gin.Engine) {
 			derivProtected.POST("/validate", handlers.ValidateDerivToken)
 
 			// Token management
+			derivProtected.GET("/oauth/authorize", handlers.DerivOAuthAuthorize)
 			derivProtected.POST("/token/save", handlers.SaveDerivToken)
 			derivProtected.GET("/token", handlers.GetUserDerivToken)
 			derivProtected.DELETE("/token", handlers.DeleteDerivToken)
@@ -182,8 +271,19 @@ func SetUpRouter(router *gin.Engine) {
 			derivProtected.GET("/me/balance", handlers.GetDerivBalanceWithStoredToken)
 			derivProtected.GET("/me/accounts", handlers.GetDerivAccountListWithStoredToken)
 			derivProtected.POST("/me/switch", handlers.SwitchDerivAccountWithStoredToken)
+			derivProtected.POST("/proposal", handlers.GetDerivProposal)
 			derivProtected.POST("/trade", handlers.PlaceDerivTrade)
 		}
+
+		// Paper trading - simulated fills against a virtual balance
+		paper := api.Group("/paper")
+		paper.Use(middleware.AuthMiddleware())
+		{
+			paper.GET("/account", handlers.GetPaperAccount)
+			paper.POST("/account/reset", handlers.ResetPaperAccount)
+			paper.GET("/trades", handlers.GetPaperTrades)
+			paper.PUT("/mode", handlers.SetTradingMode)
+		}
 	}
 
 	// Frontend path
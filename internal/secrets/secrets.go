@@ -0,0 +1,198 @@
+// Package secrets seals credentials at rest with envelope encryption: every
+// value gets its own AES-256-GCM data key, which is in turn encrypted with a
+// master key from configuration. Sealed values carry the ID of the master key
+// so keys can be rotated.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// prefix marks a sealed value: enc:v1:<key id>:<wrapped data key>:<ciphertext>
+const prefix = "enc:v1:"
+
+var (
+	// ErrUnknownKey is returned when a value was sealed with a key that is not
+	// configured
+	ErrUnknownKey = errors.New("value was sealed with an unknown key")
+
+	// ErrNoKey is returned by Seal when no master key is configured
+	ErrNoKey = errors.New("no encryption key configured")
+)
+
+var (
+	mu        sync.RWMutex
+	keys      = map[string][]byte{}
+	currentID string
+)
+
+// Configure loads the master keys from spec, a comma separated list of
+// id:base64key pairs, each key 32 bytes. currentKeyID picks the key new values
+// are sealed with and defaults to the first one listed.
+func Configure(spec, currentKeyID string) error {
+	parsed := map[string][]byte{}
+	first := ""
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || id == "" || strings.Contains(id, ":") {
+			return fmt.Errorf("invalid key entry %q, expected id:base64key", entry)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return fmt.Errorf("key %q must be 32 bytes of base64", id)
+		}
+		parsed[id] = key
+		if first == "" {
+			first = id
+		}
+	}
+
+	if currentKeyID == "" {
+		currentKeyID = first
+	}
+	if currentKeyID != "" {
+		if _, ok := parsed[currentKeyID]; !ok {
+			return fmt.Errorf("current key %q is not configured", currentKeyID)
+		}
+	}
+
+	mu.Lock()
+	keys, currentID = parsed, currentKeyID
+	mu.Unlock()
+	return nil
+}
+
+// CurrentKeyID returns the ID of the key new values are sealed with, or ""
+// when encryption is not configured
+func CurrentKeyID() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return currentID
+}
+
+// IsSealed reports whether value is a sealed value rather than plaintext
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Seal encrypts plaintext with the current key and returns the sealed value
+// and the key ID
+func Seal(plaintext string) (string, string, error) {
+	mu.RLock()
+	id, kek := currentID, keys[currentID]
+	mu.RUnlock()
+	if id == "" {
+		return "", "", ErrNoKey
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", "", err
+	}
+	wrapped, err := encrypt(kek, dataKey, []byte(id))
+	if err != nil {
+		return "", "", err
+	}
+	ciphertext, err := encrypt(dataKey, []byte(plaintext), nil)
+	if err != nil {
+		return "", "", err
+	}
+
+	enc := base64.RawURLEncoding
+	return prefix + id + ":" + enc.EncodeToString(wrapped) + ":" + enc.EncodeToString(ciphertext), id, nil
+}
+
+// Open decrypts a sealed value. Plaintext values are returned unchanged so
+// callers can pass either.
+func Open(value string) (string, error) {
+	if !IsSealed(value) {
+		return value, nil
+	}
+
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 {
+		return "", errors.New("malformed sealed value")
+	}
+	id := parts[0]
+	mu.RLock()
+	kek, ok := keys[id]
+	mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownKey, id)
+	}
+
+	enc := base64.RawURLEncoding
+	wrapped, err := enc.DecodeString(parts[1])
+	if err != nil {
+		return "", errors.New("malformed sealed value")
+	}
+	ciphertext, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return "", errors.New("malformed sealed value")
+	}
+
+	dataKey, err := decrypt(kek, wrapped, []byte(id))
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := decrypt(dataKey, ciphertext, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// Mask hides all but the last four characters of a secret for display
+func Mask(secret string) string {
+	if len(secret) <= 4 {
+		return strings.Repeat("*", len(secret))
+	}
+	return strings.Repeat("*", len(secret)-4) + secret[len(secret)-4:]
+}
+
+func encrypt(key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func decrypt(key, sealed, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("malformed sealed value")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, errors.New("failed to decrypt sealed value")
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -34,6 +34,38 @@ func SendVerificationEmail(to, verificationLink string) {
 	sendEmail(mode, from, to, msg, "VERIFICATION EMAIL")
 }
 
+// SendPaymentFailedEmail tells a subscriber that a renewal charge failed and
+// how many attempts are left before the subscription is cancelled.
+func SendPaymentFailedEmail(to, item string, attempt, maxAttempts int, manageLink string) {
+	mode := os.Getenv("EMAIL_MODE")
+	from := os.Getenv("EMAIL_FROM")
+
+	update := "Please make sure your card can be charged."
+	if manageLink != "" {
+		update = fmt.Sprintf("You can update your card here:\n%s", manageLink)
+	}
+	msg := fmt.Sprintf(
+		"Subject: Payment Failed for %s\n\nWe could not renew your %s subscription (attempt %d of %d).\n\n%s\n\nIf the payment keeps failing, the subscription will be cancelled and access will end when the paid period runs out.",
+		item, item, attempt, maxAttempts, update,
+	)
+
+	sendEmail(mode, from, to, msg, "PAYMENT FAILED EMAIL")
+}
+
+// SendSubscriptionEndedEmail tells a subscriber their subscription will not
+// renew anymore.
+func SendSubscriptionEndedEmail(to, item, reason string) {
+	mode := os.Getenv("EMAIL_MODE")
+	from := os.Getenv("EMAIL_FROM")
+
+	msg := fmt.Sprintf(
+		"Subject: Subscription Cancelled: %s\n\nYour %s subscription has been cancelled: %s.\n\nYou keep access until the end of the period you paid for. You can subscribe again at any time.",
+		item, item, reason,
+	)
+
+	sendEmail(mode, from, to, msg, "SUBSCRIPTION ENDED EMAIL")
+}
+
 // sendEmail is a helper function to send emails based on the configured mode
 func sendEmail(mode, from, to, msg, emailType string) {
 
@@ -2,11 +2,16 @@ package main
 
 import (
 	"log"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/keyadaniel56/algocdk/internal/config"
 	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/handlers"
+	"github.com/keyadaniel56/algocdk/internal/paystack"
 	"github.com/keyadaniel56/algocdk/internal/routes"
+	"github.com/keyadaniel56/algocdk/internal/secrets"
+	services "github.com/keyadaniel56/algocdk/service"
 	"github.com/keyadaniel56/algocdk/tasks"
 )
 
@@ -16,9 +21,37 @@ func main() {
 	if err != nil {
 		log.Fatalf("%v", err.Error())
 	}
+	if err := secrets.Configure(cfg.TokenEncryptionKeys, cfg.TokenEncryptionKeyID); err != nil {
+		log.Fatalf("invalid TOKEN_ENCRYPTION_KEYS: %v", err)
+	}
+	if secrets.CurrentKeyID() == "" {
+		if cfg.AppEnv != "development" {
+			log.Fatalf("TOKEN_ENCRYPTION_KEYS is required when APP_ENV is %s", cfg.AppEnv)
+		}
+		log.Println("Warning: TOKEN_ENCRYPTION_KEYS not set, Deriv tokens are stored unencrypted")
+	}
+
+	handlers.ConfigureDeriv(services.DerivConfig{
+		AppID:         cfg.DerivAppID,
+		Endpoint:      cfg.DerivEndpoint,
+		Language:      cfg.DerivLanguage,
+		Brand:         cfg.DerivBrand,
+		OAuthURL:      cfg.DerivOAuthURL,
+		AllowedAppIDs: cfg.DerivAllowedAppIDs,
+	})
 
 	database.InitDB()
-	tasks.DeactivateExpiredBots()
+	tasks.Start(time.Hour)
+	paystack.StartReconciler(10*time.Minute, 15*time.Minute, 24*time.Hour)
+	handlers.ResumeContractTracking()
+	handlers.ResumePaperTrades()
+	handlers.RestoreBotRuns()
+	if cfg.MarketDataSource == "synthetic" {
+		handlers.UseMarketDataSource(services.NewSyntheticMarketSource())
+	}
+	if len(cfg.RecorderSymbols) > 0 {
+		handlers.StartMarketRecorder(cfg.RecorderSymbols, time.Duration(cfg.TickRetentionDays)*24*time.Hour)
+	}
 	r := gin.Default()
 	r.SetTrustedProxies(nil)
 
@@ -0,0 +1,297 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+)
+
+// minStake is the smallest stake Deriv accepts
+const minStake = 0.35
+
+// maxEquityPoints caps the stored P&L curve; longer curves are thinned out
+const maxEquityPoints = 1000
+
+// Backtester replays strategy definitions over historical ticks and
+// simulates the contracts they would have bought.
+type Backtester struct {
+	candles  *CandleStore
+	MaxTicks int
+}
+
+// NewBacktester creates a backtester reading market data through candles.
+func NewBacktester(candles *CandleStore) *Backtester {
+	return &Backtester{
+		candles:  candles,
+		MaxTicks: 1000000,
+	}
+}
+
+// StartBotBacktest validates the bot's strategy definition, records a
+// running report and runs the backtest in the background. The bot's latest
+// report is updated once the run completes.
+func (b *Backtester) StartBotBacktest(bot models.Bot, requestedBy uint, start, end int64, initialBalance float64) (*models.BacktestReport, error) {
+	def, err := BotStrategy(bot)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	if end <= 0 || end > now {
+		end = now
+	}
+	if start <= 0 {
+		start = end - 86400
+	}
+	if start >= end {
+		return nil, errors.New("start must be before end")
+	}
+	if initialBalance <= 0 {
+		initialBalance = 1000
+	}
+
+	strategy, _ := json.Marshal(def)
+	report := models.BacktestReport{
+		BotID:          bot.ID,
+		RequestedBy:    requestedBy,
+		Status:         "running",
+		Symbol:         def.Symbol,
+		Timeframe:      def.Timeframe,
+		StartEpoch:     start,
+		EndEpoch:       end,
+		InitialBalance: initialBalance,
+		Strategy:       strategy,
+	}
+	if err := database.DB.Create(&report).Error; err != nil {
+		return nil, err
+	}
+
+	go func() {
+		result := report
+		err := b.Run(def, &result)
+
+		completed := time.Now()
+		result.CompletedAt = &completed
+		result.Status = "completed"
+		if err != nil {
+			result.Status = "failed"
+			result.Error = err.Error()
+			log.Printf("[Backtest] report %d for bot %d failed: %v", report.ID, bot.ID, err)
+		}
+		if err := database.DB.Save(&result).Error; err != nil {
+			log.Printf("[Backtest] failed to save report %d: %v", report.ID, err)
+			return
+		}
+		if result.Status == "completed" {
+			database.DB.Model(&models.Bot{}).Where("id = ?", bot.ID).Update("latest_backtest_id", result.ID)
+		}
+	}()
+
+	return &report, nil
+}
+
+// Run simulates def over report's period and fills in its statistics. At
+// most one contract is open at a time; a new entry is only considered once
+// the previous contract has settled and the cooldown has passed.
+func (b *Backtester) Run(def models.StrategyDefinition, report *models.BacktestReport) error {
+	if err := def.Validate(); err != nil {
+		return err
+	}
+
+	granularity := 0
+	if def.Timeframe != "tick" {
+		g, err := ParseTimeframe(def.Timeframe)
+		if err != nil {
+			return err
+		}
+		granularity = g
+	}
+
+	payoutRatio := def.PayoutRatio
+	if payoutRatio == 0 {
+		ratio, err := DefaultPayoutRatio(def.Contract)
+		if err != nil {
+			return err
+		}
+		payoutRatio = ratio
+	}
+
+	// Load a little past the end so contracts opened near it can settle
+	settleWindow := int64(600)
+	if def.Contract.DurationUnit != "t" {
+		settleWindow += durationSeconds(def.Contract.Duration, def.Contract.DurationUnit)
+	}
+	ticks, pipSize, err := b.candles.Ticks(def.Symbol, report.StartEpoch, report.EndEpoch+settleWindow, b.MaxTicks)
+	if err != nil {
+		return fmt.Errorf("loading ticks: %v", err)
+	}
+	if len(ticks) == 0 {
+		return errors.New("no market data for the requested period")
+	}
+	report.TicksUsed = len(ticks)
+
+	bars, lastTick := buildBars(def.Symbol, ticks, granularity, report.EndEpoch)
+	evaluator := NewStrategyEvaluator(&def, bars, pipSize)
+
+	balance := report.InitialBalance
+	peak := balance
+	curve := []models.EquityPoint{{Epoch: report.StartEpoch, Balance: balance}}
+	var grossWin, grossLoss, lastStake float64
+	var lastWon bool
+	winStreak, lossStreak := 0, 0
+	nextBar := 0
+
+	for i := range bars {
+		if i < nextBar {
+			continue
+		}
+		// Bars are only complete once the next one has started
+		if granularity > 0 && i == len(bars)-1 {
+			break
+		}
+		if !evaluator.EntryAt(i) {
+			continue
+		}
+
+		stake := NextStake(def.Stake, balance, lastStake, lastWon)
+		if stake < minStake {
+			stake = minStake
+		}
+		if stake > balance {
+			break // out of funds
+		}
+
+		entryIdx := lastTick[i]
+		buyEpoch := ticks[entryIdx].Epoch
+		outcome, done, err := SimulateContract(def.Contract, buyEpoch, ticks[entryIdx:], pipSize)
+		if err != nil {
+			return err
+		}
+		if !done {
+			break // ran out of data before the contract settled
+		}
+
+		report.Trades++
+		report.TotalStaked += stake
+		if outcome.Won {
+			profit := roundTo(stake*payoutRatio, 2)
+			balance += profit
+			grossWin += profit
+			report.Wins++
+			winStreak++
+			lossStreak = 0
+		} else {
+			balance -= stake
+			grossLoss += stake
+			report.Losses++
+			lossStreak++
+			winStreak = 0
+		}
+		if winStreak > report.LongestWinStreak {
+			report.LongestWinStreak = winStreak
+		}
+		if lossStreak > report.LongestLossStreak {
+			report.LongestLossStreak = lossStreak
+		}
+		lastStake = stake
+		lastWon = outcome.Won
+
+		if balance > peak {
+			peak = balance
+		}
+		if drawdown := peak - balance; drawdown > report.MaxDrawdown {
+			report.MaxDrawdown = drawdown
+			report.MaxDrawdownPct = drawdown / peak * 100
+		}
+		curve = append(curve, models.EquityPoint{Epoch: outcome.ExitEpoch, Balance: roundTo(balance, 2)})
+
+		// Resume on the first bar closing after settlement, plus the cooldown
+		next := sort.Search(len(bars), func(j int) bool {
+			return ticks[lastTick[j]].Epoch >= outcome.ExitEpoch
+		})
+		nextBar = next + def.CooldownBars
+		if nextBar <= i {
+			nextBar = i + 1
+		}
+	}
+
+	report.FinalBalance = roundTo(balance, 2)
+	report.NetProfit = roundTo(balance-report.InitialBalance, 2)
+	report.TotalStaked = roundTo(report.TotalStaked, 2)
+	report.MaxDrawdown = roundTo(report.MaxDrawdown, 2)
+	report.MaxDrawdownPct = roundTo(report.MaxDrawdownPct, 2)
+	if report.Trades > 0 {
+		report.WinRate = roundTo(float64(report.Wins)/float64(report.Trades)*100, 2)
+	}
+	if grossLoss > 0 {
+		report.ProfitFactor = roundTo(grossWin/grossLoss, 2)
+	}
+
+	equity, err := json.Marshal(thinCurve(curve, maxEquityPoints))
+	if err != nil {
+		return err
+	}
+	report.EquityCurve = equity
+	return nil
+}
+
+// buildBars groups ticks up to end into bars of granularity seconds, or one
+// bar per tick when granularity is zero. lastTick[i] is the index of the
+// last tick of bar i, the moment its close is known.
+func buildBars(symbol string, ticks []Tick, granularity int, end int64) ([]models.Candle, []int) {
+	var bars []models.Candle
+	var lastTick []int
+	g := int64(granularity)
+
+	for i, t := range ticks {
+		if t.Epoch > end {
+			break
+		}
+		bucket := t.Epoch
+		if g > 0 {
+			bucket = t.Epoch / g * g
+		}
+
+		n := len(bars)
+		if g == 0 || n == 0 || bars[n-1].Epoch != bucket {
+			bars = append(bars, models.Candle{
+				Symbol:      symbol,
+				Granularity: granularity,
+				Epoch:       bucket,
+				Open:        t.Quote,
+				High:        t.Quote,
+				Low:         t.Quote,
+				Close:       t.Quote,
+			})
+			lastTick = append(lastTick, i)
+			continue
+		}
+
+		bar := &bars[n-1]
+		bar.High = math.Max(bar.High, t.Quote)
+		bar.Low = math.Min(bar.Low, t.Quote)
+		bar.Close = t.Quote
+		lastTick[n-1] = i
+	}
+	return bars, lastTick
+}
+
+// thinCurve keeps at most max points, always including the first and last
+func thinCurve(curve []models.EquityPoint, max int) []models.EquityPoint {
+	if len(curve) <= max {
+		return curve
+	}
+	thinned := make([]models.EquityPoint, 0, max)
+	step := float64(len(curve)-1) / float64(max-1)
+	for i := 0; i < max; i++ {
+		thinned = append(thinned, curve[int(math.Round(float64(i)*step))])
+	}
+	return thinned
+}
@@ -0,0 +1,650 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+)
+
+var (
+	// ErrNoBotAccess is returned when the user has not bought the bot or
+	// their rental has ended
+	ErrNoBotAccess = errors.New("no active access to this bot")
+	// ErrRunActive is returned when the bot is already running for the user
+	ErrRunActive = errors.New("bot is already running for this user")
+	// ErrRunNotFound is returned for runs that do not exist or belong to
+	// another user
+	ErrRunNotFound = errors.New("bot run not found")
+)
+
+// BotRunner executes bots' strategy definitions on the server for the users
+// who own or rent them. Each run watches live ticks for the strategy's
+// symbol and buys one contract at a time, on the user's Deriv account or
+// paper balance. Runs are stored in the database and picked up again by
+// Restore after a restart.
+type BotRunner struct {
+	deriv   *DerivService
+	hub     *TickHub
+	candles *CandleStore
+	paper   *PaperEngine
+	tracker *ContractTracker
+
+	SettleInterval time.Duration // how often open contracts are checked
+	AccessInterval time.Duration // how often the user's access to the bot is checked
+	MaxFailures    int           // consecutive failed buys before the run fails
+
+	mu      sync.Mutex
+	workers map[uint]*runWorker
+}
+
+type runWorker struct {
+	mu       sync.Mutex
+	paused   bool
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func (w *runWorker) halt() {
+	w.stopOnce.Do(func() { close(w.stop) })
+}
+
+func (w *runWorker) isPaused() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.paused
+}
+
+// NewBotRunner creates a runner that reads ticks from hub and trades
+// through deriv, or paper for paper runs. Live trades are settled by tracker.
+func NewBotRunner(deriv *DerivService, hub *TickHub, candles *CandleStore, paper *PaperEngine, tracker *ContractTracker) *BotRunner {
+	return &BotRunner{
+		deriv:          deriv,
+		hub:            hub,
+		candles:        candles,
+		paper:          paper,
+		tracker:        tracker,
+		SettleInterval: 2 * time.Second,
+		AccessInterval: time.Minute,
+		MaxFailures:    5,
+		workers:        make(map[uint]*runWorker),
+	}
+}
+
+// Start begins running botID for userID in mode ("live" or "paper").
+func (r *BotRunner) Start(userID, botID uint, mode string) (*models.BotRun, error) {
+	userBot, err := activeUserBot(userID, botID)
+	if err != nil {
+		return nil, err
+	}
+
+	var bot models.Bot
+	if err := database.DB.First(&bot, botID).Error; err != nil {
+		return nil, ErrNoBotAccess
+	}
+	def, err := BotStrategy(bot)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkKillSwitch(userID); err != nil {
+		return nil, err
+	}
+
+	if mode == "live" {
+		var credentials models.DerivCredentials
+		if err := database.DB.Where("user_id = ? AND is_active = ?", userID, true).
+			First(&credentials).Error; err != nil {
+			return nil, errors.New("no Deriv token found, save one before running a bot live")
+		}
+	}
+
+	var active int64
+	database.DB.Model(&models.BotRun{}).
+		Where("user_id = ? AND bot_id = ? AND status IN ?", userID, botID, []string{"running", "paused"}).
+		Count(&active)
+	if active > 0 {
+		return nil, ErrRunActive
+	}
+
+	run := models.BotRun{
+		UserID:    userID,
+		BotID:     botID,
+		UserBotID: userBot.ID,
+		Mode:      mode,
+		Status:    "running",
+		StartedAt: time.Now(),
+	}
+	if err := database.DB.Create(&run).Error; err != nil {
+		return nil, err
+	}
+
+	r.logf(run.ID, "info", "Started in %s mode on %s (%s bars)", mode, def.Symbol, def.Timeframe)
+	r.launch(run, def)
+	return &run, nil
+}
+
+// Pause keeps the run subscribed but stops it from buying new contracts.
+// A contract already open still settles.
+func (r *BotRunner) Pause(userID, runID uint) (*models.BotRun, error) {
+	return r.setPaused(userID, runID, true)
+}
+
+// Resume lets a paused run buy contracts again
+func (r *BotRunner) Resume(userID, runID uint) (*models.BotRun, error) {
+	return r.setPaused(userID, runID, false)
+}
+
+func (r *BotRunner) setPaused(userID, runID uint, paused bool) (*models.BotRun, error) {
+	run, err := userRun(userID, runID)
+	if err != nil {
+		return nil, err
+	}
+	from, to := "running", "paused"
+	if !paused {
+		from, to = "paused", "running"
+	}
+	if run.Status != from {
+		return nil, fmt.Errorf("run is %s", run.Status)
+	}
+	if !paused {
+		if err := checkKillSwitch(userID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := database.DB.Model(run).Updates(map[string]interface{}{
+		"status":      to,
+		"stop_reason": "",
+	}).Error; err != nil {
+		return nil, err
+	}
+	run.Status = to
+	run.StopReason = ""
+	r.mu.Lock()
+	if w, ok := r.workers[run.ID]; ok {
+		w.mu.Lock()
+		w.paused = paused
+		w.mu.Unlock()
+	}
+	r.mu.Unlock()
+
+	if paused {
+		r.logf(run.ID, "info", "Paused")
+	} else {
+		r.logf(run.ID, "info", "Resumed")
+	}
+	return run, nil
+}
+
+// pause pauses a run from its worker, e.g. when a risk limit blocks an order
+func (r *BotRunner) pause(w *runWorker, run *models.BotRun, reason string) {
+	w.mu.Lock()
+	w.paused = true
+	w.mu.Unlock()
+
+	run.Status = "paused"
+	run.StopReason = reason
+	database.DB.Model(run).Updates(map[string]interface{}{
+		"status":      "paused",
+		"stop_reason": reason,
+	})
+	r.logf(run.ID, "info", "Paused: %s", reason)
+}
+
+// KillSwitch engages or releases the user's kill switch. Engaging it pauses
+// every running bot of the user and blocks automated orders until it is
+// released; released runs stay paused until they are resumed. It returns
+// the number of runs paused.
+func (r *BotRunner) KillSwitch(userID uint, engage bool) (*models.RiskProfile, int, error) {
+	profile, err := SetAutomationHalted(userID, engage)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !engage {
+		log.Printf("[BotRunner] kill switch released for user %d", userID)
+		return profile, 0, nil
+	}
+
+	var runs []models.BotRun
+	database.DB.Where("user_id = ? AND status = ?", userID, "running").Find(&runs)
+	for i := range runs {
+		run := &runs[i]
+		r.mu.Lock()
+		w, ok := r.workers[run.ID]
+		r.mu.Unlock()
+		if !ok {
+			continue
+		}
+		r.pause(w, run, "kill switch engaged")
+	}
+	log.Printf("[BotRunner] kill switch engaged for user %d, %d runs paused", userID, len(runs))
+	return profile, len(runs), nil
+}
+
+// Stop ends the run for good
+func (r *BotRunner) Stop(userID, runID uint) (*models.BotRun, error) {
+	run, err := userRun(userID, runID)
+	if err != nil {
+		return nil, err
+	}
+	if run.Status != "running" && run.Status != "paused" {
+		return nil, fmt.Errorf("run is already %s", run.Status)
+	}
+	r.finish(run, "stopped", "stopped by user")
+	return run, nil
+}
+
+// Restore relaunches runs that were running or paused when the server last
+// stopped. Runs whose bot access has ended are marked expired instead.
+func (r *BotRunner) Restore() {
+	var runs []models.BotRun
+	if err := database.DB.Where("status IN ?", []string{"running", "paused"}).Find(&runs).Error; err != nil {
+		log.Printf("[BotRunner] failed to load runs: %v", err)
+		return
+	}
+
+	for i := range runs {
+		run := &runs[i]
+		if _, err := activeUserBot(run.UserID, run.BotID); err != nil {
+			r.finish(run, "expired", "bot access ended")
+			continue
+		}
+		var bot models.Bot
+		if err := database.DB.First(&bot, run.BotID).Error; err != nil {
+			r.finish(run, "failed", "bot no longer exists")
+			continue
+		}
+		def, err := BotStrategy(bot)
+		if err != nil {
+			r.finish(run, "failed", err.Error())
+			continue
+		}
+		r.logf(run.ID, "info", "Restored after restart")
+		r.launch(*run, def)
+	}
+	log.Printf("[BotRunner] restored %d runs", len(runs))
+}
+
+// finish records the final status of a run and stops its worker
+func (r *BotRunner) finish(run *models.BotRun, status, reason string) {
+	now := time.Now()
+	run.Status = status
+	run.StopReason = reason
+	run.StoppedAt = &now
+	if err := database.DB.Model(run).Updates(map[string]interface{}{
+		"status":      status,
+		"stop_reason": reason,
+		"stopped_at":  now,
+	}).Error; err != nil {
+		log.Printf("[BotRunner] failed to update run %d: %v", run.ID, err)
+	}
+	r.logf(run.ID, "info", "Run %s: %s", status, reason)
+
+	r.mu.Lock()
+	w, ok := r.workers[run.ID]
+	r.mu.Unlock()
+	if ok {
+		w.halt()
+	}
+}
+
+func (r *BotRunner) launch(run models.BotRun, def models.StrategyDefinition) {
+	w := &runWorker{
+		paused: run.Status == "paused",
+		stop:   make(chan struct{}),
+	}
+	r.mu.Lock()
+	r.workers[run.ID] = w
+	r.mu.Unlock()
+
+	go func() {
+		defer func() {
+			r.mu.Lock()
+			if r.workers[run.ID] == w {
+				delete(r.workers, run.ID)
+			}
+			r.mu.Unlock()
+		}()
+		r.work(w, run, def)
+	}()
+}
+
+// work is the run's main loop: it builds bars from live ticks, evaluates the
+// entry conditions at every bar close and follows the open contract.
+func (r *BotRunner) work(w *runWorker, run models.BotRun, def models.StrategyDefinition) {
+	granularity := 0
+	if def.Timeframe != "tick" {
+		granularity, _ = ParseTimeframe(def.Timeframe)
+	}
+	window := StrategyLookback(&def) + 2
+
+	var bars []models.Candle
+	if granularity > 0 {
+		history, err := r.candles.Candles(def.Symbol, granularity, 0, 0, window)
+		if err != nil {
+			r.logf(run.ID, "error", "Could not load %s history, starting without it: %v", def.Symbol, err)
+		}
+		bars = history
+	}
+
+	ticks := make(chan MarketTick, 64)
+	if err := r.hub.Subscribe(def.Symbol, ticks); err != nil {
+		r.hub.Unsubscribe(def.Symbol, ticks)
+		r.finish(&run, "failed", fmt.Sprintf("could not stream %s: %v", def.Symbol, err))
+		return
+	}
+	defer r.hub.Unsubscribe(def.Symbol, ticks)
+
+	settle := time.NewTicker(r.SettleInterval)
+	defer settle.Stop()
+	access := time.NewTicker(r.AccessInterval)
+	defer access.Stop()
+
+	pipSize := 0
+	cooldown := 0
+	failures := 0
+
+	for {
+		select {
+		case <-w.stop:
+			return
+
+		case <-access.C:
+			if _, err := activeUserBot(run.UserID, run.BotID); err != nil {
+				r.finish(&run, "expired", "bot access ended")
+				return
+			}
+
+		case <-settle.C:
+			if r.checkSettlement(&run) {
+				cooldown = def.CooldownBars
+			}
+
+		case tick := <-ticks:
+			if tick.PipSize > 0 {
+				pipSize = tick.PipSize
+			}
+
+			var closed []models.Candle
+			bars, closed = addTickToBars(bars, tick, granularity, window)
+			if closed == nil {
+				continue
+			}
+			if cooldown > 0 {
+				cooldown--
+				continue
+			}
+			if w.isPaused() || run.OpenTradeID != nil {
+				continue
+			}
+
+			evaluator := NewStrategyEvaluator(&def, closed, pipSize)
+			if !evaluator.EntryAt(len(closed) - 1) {
+				continue
+			}
+
+			if err := r.enter(&run, def); err != nil {
+				var violation *RiskViolation
+				if errors.As(err, &violation) {
+					r.pause(w, &run, violation.Reason)
+					continue
+				}
+
+				failures++
+				r.logf(run.ID, "error", "Buy failed: %v", err)
+				switch {
+				case errors.Is(err, ErrInsufficientPaperBalance):
+					r.finish(&run, "stopped", "insufficient paper balance")
+					return
+				case failures >= r.MaxFailures:
+					r.finish(&run, "failed", fmt.Sprintf("%d buys failed in a row", failures))
+					return
+				}
+				continue
+			}
+			failures = 0
+		}
+	}
+}
+
+// addTickToBars folds tick into bars and trims them to window. When the tick
+// closes a bar it returns the closed bars; for tick bars every tick closes
+// one. For timed bars the last bar is the one still forming.
+func addTickToBars(bars []models.Candle, tick MarketTick, granularity, window int) ([]models.Candle, []models.Candle) {
+	bucket := tick.Epoch
+	if granularity > 0 {
+		bucket = tick.Epoch / int64(granularity) * int64(granularity)
+	}
+
+	var closed []models.Candle
+	n := len(bars)
+	switch {
+	case granularity > 0 && n > 0 && bars[n-1].Epoch == bucket:
+		bar := &bars[n-1]
+		bar.High = math.Max(bar.High, tick.Quote)
+		bar.Low = math.Min(bar.Low, tick.Quote)
+		bar.Close = tick.Quote
+		return bars, nil
+	case n > 0 && bucket < bars[n-1].Epoch:
+		return bars, nil // out of order
+	}
+
+	bars = append(bars, models.Candle{
+		Symbol:      tick.Symbol,
+		Granularity: granularity,
+		Epoch:       bucket,
+		Open:        tick.Quote,
+		High:        tick.Quote,
+		Low:         tick.Quote,
+		Close:       tick.Quote,
+	})
+	if extra := len(bars) - window; extra > 0 {
+		bars = append(bars[:0], bars[extra:]...)
+	}
+
+	if granularity == 0 {
+		closed = bars
+	} else if len(bars) > 1 {
+		closed = bars[:len(bars)-1]
+	}
+	return bars, closed
+}
+
+// enter buys the strategy's contract with the stake chosen by its sizing rule
+func (r *BotRunner) enter(run *models.BotRun, def models.StrategyDefinition) error {
+	balance := 0.0
+	if def.Stake.Mode == "percent" {
+		b, err := r.balance(run)
+		if err != nil {
+			return err
+		}
+		balance = b
+	}
+
+	stake := NextStake(def.Stake, balance, run.LastStake, run.LastWon)
+	if stake < minStake {
+		stake = minStake
+	}
+	contract := def.Contract
+	contract.Amount = stake
+	contract.BotID = run.BotID
+
+	runID := run.ID
+	if err := CheckOrder(RiskOrder{
+		UserID:   run.UserID,
+		BotID:    run.BotID,
+		RunID:    &runID,
+		Source:   "bot",
+		Mode:     run.Mode,
+		Contract: contract,
+		Stake:    stake,
+	}); err != nil {
+		return err
+	}
+
+	var tradeID uint
+	if run.Mode == "paper" {
+		trade, err := r.paper.PlaceTrade(run.UserID, contract)
+		if err != nil {
+			return err
+		}
+		tradeID = trade.ID
+	} else {
+		var credentials models.DerivCredentials
+		if err := database.DB.Where("user_id = ? AND is_active = ?", run.UserID, true).
+			First(&credentials).Error; err != nil {
+			return errors.New("no Deriv token found")
+		}
+		result, err := r.deriv.PlaceTrade(credentials.APIToken, contract)
+		if err != nil {
+			return err
+		}
+
+		trade := models.Trade{
+			UserID:       run.UserID,
+			BotID:        run.BotID,
+			DerivTradeID: result.ContractID,
+			CredentialID: credentials.ID,
+			Symbol:       contract.Symbol,
+			TradeType:    contract.ContractType,
+			Stake:        stake,
+			BuyPrice:     result.BuyPrice,
+			Payout:       result.Payout,
+			Status:       "open",
+			OpenTime:     result.PurchaseTime,
+			CreatedAt:    time.Now(),
+		}
+		if err := database.DB.Create(&trade).Error; err != nil {
+			return fmt.Errorf("contract %s was bought but could not be recorded: %v", result.ContractID, err)
+		}
+		r.tracker.Track(trade, credentials.APIToken)
+		tradeID = trade.ID
+	}
+
+	run.OpenTradeID = &tradeID
+	run.LastStake = stake
+	database.DB.Model(run).Updates(map[string]interface{}{
+		"open_trade_id": tradeID,
+		"last_stake":    stake,
+	})
+	r.logf(run.ID, "trade", "Bought %s on %s for %.2f (trade %d)", contract.ContractType, contract.Symbol, stake, tradeID)
+	return nil
+}
+
+// balance returns the balance stakes are sized against
+func (r *BotRunner) balance(run *models.BotRun) (float64, error) {
+	if run.Mode == "paper" {
+		account, err := r.paper.Account(run.UserID)
+		if err != nil {
+			return 0, err
+		}
+		return account.Balance, nil
+	}
+
+	var credentials models.DerivCredentials
+	if err := database.DB.Where("user_id = ? AND is_active = ?", run.UserID, true).
+		First(&credentials).Error; err != nil {
+		return 0, errors.New("no Deriv token found")
+	}
+	balance, err := r.deriv.GetBalance(credentials.APIToken)
+	if err != nil {
+		return 0, err
+	}
+	return balance.Balance, nil
+}
+
+// checkSettlement updates the run's statistics once its open contract has
+// settled. It reports whether a contract settled.
+func (r *BotRunner) checkSettlement(run *models.BotRun) bool {
+	if run.OpenTradeID == nil {
+		return false
+	}
+
+	var status string
+	var profit float64
+	if run.Mode == "paper" {
+		var trade models.PaperTrade
+		if err := database.DB.First(&trade, *run.OpenTradeID).Error; err != nil {
+			return false
+		}
+		status, profit = trade.Status, trade.ProfitLoss
+	} else {
+		var trade models.Trade
+		if err := database.DB.First(&trade, *run.OpenTradeID).Error; err != nil {
+			return false
+		}
+		status, profit = trade.Status, trade.ProfitLoss
+	}
+	if status == "open" {
+		return false
+	}
+
+	won := profit > 0
+	run.Trades++
+	if won {
+		run.Wins++
+	} else {
+		run.Losses++
+	}
+	run.NetProfit = math.Round((run.NetProfit+profit)*100) / 100
+	run.LastWon = won
+	tradeID := *run.OpenTradeID
+	run.OpenTradeID = nil
+
+	database.DB.Model(run).Updates(map[string]interface{}{
+		"trades":        run.Trades,
+		"wins":          run.Wins,
+		"losses":        run.Losses,
+		"net_profit":    run.NetProfit,
+		"last_won":      won,
+		"open_trade_id": nil,
+	})
+	r.logf(run.ID, "trade", "Trade %d settled %s (P&L %.2f)", tradeID, status, profit)
+	return true
+}
+
+func (r *BotRunner) logf(runID uint, level, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	log.Printf("[BotRunner] run %d: %s", runID, message)
+	database.DB.Create(&models.BotRunLog{RunID: runID, Level: level, Message: message})
+}
+
+// activeUserBot returns the user's active access to botID, failing once a
+// rental has expired
+func activeUserBot(userID, botID uint) (*models.UserBot, error) {
+	var userBot models.UserBot
+	if err := database.DB.Where("user_id = ? AND bot_id = ? AND is_active = ?", userID, botID, true).
+		First(&userBot).Error; err != nil {
+		return nil, ErrNoBotAccess
+	}
+	if userBot.ExpiryDate != nil && userBot.ExpiryDate.Before(time.Now()) {
+		return nil, ErrNoBotAccess
+	}
+	return &userBot, nil
+}
+
+// checkKillSwitch fails while the user's automated trading is halted
+func checkKillSwitch(userID uint) error {
+	profile, err := UserRiskProfile(userID)
+	if err != nil {
+		return err
+	}
+	if profile.AutomationHalted {
+		return &RiskViolation{Rule: "kill_switch", Reason: "automated trading is halted by the kill switch"}
+	}
+	return nil
+}
+
+func userRun(userID, runID uint) (*models.BotRun, error) {
+	var run models.BotRun
+	if err := database.DB.Where("id = ? AND user_id = ?", runID, userID).First(&run).Error; err != nil {
+		return nil, ErrRunNotFound
+	}
+	return &run, nil
+}
@@ -0,0 +1,438 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Timeframes maps chart timeframes to candle lengths in seconds. Minute and
+// longer timeframes are served by Deriv; shorter ones are built from ticks.
+var Timeframes = map[string]int{
+	"5s":  5,
+	"10s": 10,
+	"15s": 15,
+	"30s": 30,
+	"1m":  60,
+	"2m":  120,
+	"3m":  180,
+	"5m":  300,
+	"10m": 600,
+	"15m": 900,
+	"30m": 1800,
+	"1h":  3600,
+	"2h":  7200,
+	"4h":  14400,
+	"8h":  28800,
+	"1d":  86400,
+}
+
+// derivGranularities are the candle lengths ticks_history accepts
+var derivGranularities = map[int]bool{
+	60: true, 120: true, 180: true, 300: true, 600: true, 900: true, 1800: true,
+	3600: true, 7200: true, 14400: true, 28800: true, 86400: true,
+}
+
+// ParseTimeframe accepts a timeframe name such as "15m" or its length in
+// seconds such as "900" and returns the length in seconds.
+func ParseTimeframe(timeframe string) (int, error) {
+	timeframe = strings.ToLower(strings.TrimSpace(timeframe))
+	if granularity, ok := Timeframes[timeframe]; ok {
+		return granularity, nil
+	}
+	if seconds, err := strconv.Atoi(timeframe); err == nil {
+		for _, granularity := range Timeframes {
+			if granularity == seconds {
+				return granularity, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unsupported timeframe %q", timeframe)
+}
+
+// CandleStore serves OHLC candles from the local database and fetches only
+// the missing ranges from Deriv. The candle that is still forming is never
+// cached.
+type CandleStore struct {
+	deriv      *DerivService
+	MaxCandles int
+}
+
+// NewCandleStore creates a candle store that fetches through deriv.
+func NewCandleStore(deriv *DerivService) *CandleStore {
+	return &CandleStore{
+		deriv:      deriv,
+		MaxCandles: 5000,
+	}
+}
+
+// Candles returns up to count candles of granularity seconds for symbol,
+// oldest first. start and end are epoch seconds; a zero end means now and a
+// zero start means count candles back from end.
+func (s *CandleStore) Candles(symbol string, granularity int, start, end int64, count int) ([]models.Candle, error) {
+	if granularity <= 0 {
+		return nil, fmt.Errorf("invalid granularity %d", granularity)
+	}
+	g := int64(granularity)
+	now := time.Now().Unix()
+	if end <= 0 || end > now {
+		end = now
+	}
+	if count <= 0 {
+		count = 100
+	}
+	if count > s.MaxCandles {
+		count = s.MaxCandles
+	}
+
+	last := end / g * g
+	first := last - int64(count-1)*g
+	if start > 0 && start/g*g > first {
+		first = start / g * g
+	}
+	if first > last {
+		return []models.Candle{}, nil
+	}
+
+	// Buckets up to lastClosed are complete and can be cached
+	lastClosed := now/g*g - g
+	if lastClosed > last {
+		lastClosed = last
+	}
+
+	var candles []models.Candle
+	var err error
+	if derivGranularities[granularity] {
+		candles, err = s.derivCandles(symbol, granularity, first, last, lastClosed)
+	} else {
+		candles, err = s.tickCandles(symbol, granularity, first, end)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(candles) > count {
+		candles = candles[len(candles)-count:]
+	}
+	return candles, nil
+}
+
+func (s *CandleStore) derivCandles(symbol string, granularity int, first, last, lastClosed int64) ([]models.Candle, error) {
+	g := int64(granularity)
+
+	if lastClosed >= first && covered(symbol, granularity, first, lastClosed) {
+		candles, err := loadCandles(symbol, granularity, first, lastClosed)
+		if err != nil {
+			return nil, err
+		}
+		if last > lastClosed {
+			// Only the forming candle is missing
+			if latest, err := s.deriv.Candles(symbol, granularity, 0, 0, 1); err == nil {
+				for _, c := range latest {
+					if c.Epoch > lastClosed {
+						candles = append(candles, toCandle(symbol, granularity, c))
+					}
+				}
+			}
+		}
+		return candles, nil
+	}
+
+	fetched, err := s.deriv.Candles(symbol, granularity, first, last+g-1, int((last-first)/g)+1)
+	if err != nil {
+		// Fall back to whatever ticks are stored locally
+		local, localErr := s.localTickCandles(symbol, granularity, first, last+g-1)
+		if localErr == nil && len(local) > 0 {
+			log.Printf("[Candles] Deriv unavailable for %s, built %d candles from stored ticks: %v", symbol, len(local), err)
+			return local, nil
+		}
+		return nil, err
+	}
+
+	candles := make([]models.Candle, 0, len(fetched))
+	closed := make([]models.Candle, 0, len(fetched))
+	for _, c := range fetched {
+		candle := toCandle(symbol, granularity, c)
+		candles = append(candles, candle)
+		if candle.Epoch <= lastClosed {
+			closed = append(closed, candle)
+		}
+	}
+
+	if lastClosed >= first {
+		if err := saveCandles(closed); err != nil {
+			log.Printf("[Candles] failed to cache candles for %s: %v", symbol, err)
+		} else {
+			addCoverage(symbol, granularity, first, lastClosed)
+		}
+	}
+	return candles, nil
+}
+
+// tickCandles builds candles shorter than a minute from ticks, fetching the
+// ticks that are not stored yet.
+func (s *CandleStore) tickCandles(symbol string, granularity int, from, to int64) ([]models.Candle, error) {
+	complete := to
+	if now := time.Now().Unix(); complete >= now {
+		complete = now - 1
+	}
+
+	if !covered(symbol, 0, from, complete) {
+		ticks, _, err := s.deriv.TickHistory(symbol, from, to, 5000)
+		if err != nil {
+			local, localErr := s.localTickCandles(symbol, granularity, from, to)
+			if localErr == nil && len(local) > 0 {
+				return local, nil
+			}
+			return nil, err
+		}
+
+		if err := SaveTicks(symbol, ticks); err != nil {
+			log.Printf("[Candles] failed to store ticks for %s: %v", symbol, err)
+		} else if len(ticks) == 5000 {
+			// Truncated: only the range actually returned is known to be complete
+			addCoverage(symbol, 0, ticks[0].Epoch, ticks[len(ticks)-1].Epoch)
+		} else {
+			addCoverage(symbol, 0, from, complete)
+		}
+	}
+
+	return s.localTickCandles(symbol, granularity, from, to)
+}
+
+// Ticks returns the ticks of symbol in [from, to], oldest first, together
+// with the symbol's pip size. Ranges not stored locally are fetched from
+// Deriv page by page; at most limit ticks are fetched per call.
+func (s *CandleStore) Ticks(symbol string, from, to int64, limit int) ([]Tick, int, error) {
+	if now := time.Now().Unix(); to >= now {
+		to = now - 1
+	}
+	pipSize := 0
+	fetched := 0
+	for fetched < limit {
+		gapFrom, gapTo, ok := firstGap(symbol, 0, from, to)
+		if !ok {
+			break
+		}
+
+		page, pip, err := s.deriv.TickHistory(symbol, gapFrom, gapTo, 5000)
+		if err != nil {
+			return nil, 0, err
+		}
+		if pip > 0 {
+			pipSize = pip
+		}
+		if err := SaveTicks(symbol, page); err != nil {
+			return nil, 0, err
+		}
+		fetched += len(page)
+
+		if len(page) < 5000 {
+			addCoverage(symbol, 0, gapFrom, gapTo)
+		} else {
+			addCoverage(symbol, 0, page[0].Epoch, page[len(page)-1].Epoch)
+		}
+	}
+
+	var records []models.TickRecord
+	if err := database.DB.Where("symbol = ? AND epoch BETWEEN ? AND ?", symbol, from, to).
+		Order("epoch").Limit(limit).Find(&records).Error; err != nil {
+		return nil, 0, err
+	}
+
+	ticks := make([]Tick, len(records))
+	for i, r := range records {
+		ticks[i] = Tick{Epoch: r.Epoch, Quote: r.Quote}
+	}
+	if pipSize == 0 {
+		pipSize = guessPipSize(ticks)
+	}
+	return ticks, pipSize, nil
+}
+
+// guessPipSize infers the quoted decimals from stored prices, which do not
+// keep the pip size Deriv reported.
+func guessPipSize(ticks []Tick) int {
+	decimals := 0
+	for i, t := range ticks {
+		if i >= 200 {
+			break
+		}
+		for d := decimals; d < 8; d++ {
+			scaled := t.Quote * math.Pow10(d)
+			if math.Abs(scaled-math.Round(scaled)) < 1e-6 {
+				break
+			}
+			decimals = d + 1
+		}
+	}
+	return decimals
+}
+
+func (s *CandleStore) localTickCandles(symbol string, granularity int, from, to int64) ([]models.Candle, error) {
+	var records []models.TickRecord
+	if err := database.DB.Where("symbol = ? AND epoch BETWEEN ? AND ?", symbol, from, to).
+		Order("epoch").Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	ticks := make([]Tick, len(records))
+	for i, r := range records {
+		ticks[i] = Tick{Epoch: r.Epoch, Quote: r.Quote}
+	}
+	return AggregateTicks(symbol, ticks, granularity), nil
+}
+
+// AggregateTicks groups ticks (sorted by epoch) into candles of granularity
+// seconds. Buckets without ticks are skipped.
+func AggregateTicks(symbol string, ticks []Tick, granularity int) []models.Candle {
+	g := int64(granularity)
+	candles := []models.Candle{}
+	for _, t := range ticks {
+		bucket := t.Epoch / g * g
+		n := len(candles)
+		if n == 0 || candles[n-1].Epoch != bucket {
+			candles = append(candles, models.Candle{
+				Symbol:      symbol,
+				Granularity: granularity,
+				Epoch:       bucket,
+				Open:        t.Quote,
+				High:        t.Quote,
+				Low:         t.Quote,
+				Close:       t.Quote,
+			})
+			continue
+		}
+		c := &candles[n-1]
+		if t.Quote > c.High {
+			c.High = t.Quote
+		}
+		if t.Quote < c.Low {
+			c.Low = t.Quote
+		}
+		c.Close = t.Quote
+	}
+	return candles
+}
+
+// SaveTicks stores ticks for symbol, ignoring ones already stored.
+func SaveTicks(symbol string, ticks []Tick) error {
+	if len(ticks) == 0 {
+		return nil
+	}
+	records := make([]models.TickRecord, len(ticks))
+	for i, t := range ticks {
+		records[i] = models.TickRecord{Symbol: symbol, Epoch: t.Epoch, Quote: t.Quote}
+	}
+	return database.DB.Clauses(clause.OnConflict{DoNothing: true}).
+		CreateInBatches(&records, 200).Error
+}
+
+func toCandle(symbol string, granularity int, c models.DerivCandle) models.Candle {
+	return models.Candle{
+		Symbol:      symbol,
+		Granularity: granularity,
+		Epoch:       c.Epoch,
+		Open:        c.Open,
+		High:        c.High,
+		Low:         c.Low,
+		Close:       c.Close,
+	}
+}
+
+func loadCandles(symbol string, granularity int, first, last int64) ([]models.Candle, error) {
+	var candles []models.Candle
+	err := database.DB.Where("symbol = ? AND granularity = ? AND epoch BETWEEN ? AND ?", symbol, granularity, first, last).
+		Order("epoch").Find(&candles).Error
+	return candles, err
+}
+
+func saveCandles(candles []models.Candle) error {
+	if len(candles) == 0 {
+		return nil
+	}
+	return database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "symbol"}, {Name: "granularity"}, {Name: "epoch"}},
+		DoUpdates: clause.AssignmentColumns([]string{"open", "high", "low", "close"}),
+	}).CreateInBatches(&candles, 100).Error
+}
+
+// covered reports whether [from, to] lies inside a single stored coverage range
+func covered(symbol string, granularity int, from, to int64) bool {
+	var n int64
+	database.DB.Model(&models.CandleCoverage{}).
+		Where("symbol = ? AND granularity = ? AND start_epoch <= ? AND end_epoch >= ?", symbol, granularity, from, to).
+		Count(&n)
+	return n > 0
+}
+
+// firstGap returns the earliest part of [from, to] not covered by a stored
+// coverage range.
+func firstGap(symbol string, granularity int, from, to int64) (int64, int64, bool) {
+	var ranges []models.CandleCoverage
+	database.DB.Where("symbol = ? AND granularity = ? AND end_epoch >= ? AND start_epoch <= ?", symbol, granularity, from, to).
+		Order("start_epoch").Find(&ranges)
+
+	cursor := from
+	for _, r := range ranges {
+		if r.StartEpoch > cursor {
+			return cursor, r.StartEpoch - 1, true
+		}
+		if r.EndEpoch >= cursor {
+			cursor = r.EndEpoch + 1
+		}
+		if cursor > to {
+			return 0, 0, false
+		}
+	}
+	if cursor > to {
+		return 0, 0, false
+	}
+	return cursor, to, true
+}
+
+// addCoverage records [from, to] as stored, merging it with any range it
+// overlaps or touches.
+func addCoverage(symbol string, granularity int, from, to int64) {
+	step := int64(granularity)
+	if step == 0 {
+		step = 1
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var overlapping []models.CandleCoverage
+		if err := tx.Where("symbol = ? AND granularity = ? AND start_epoch <= ? AND end_epoch >= ?", symbol, granularity, to+step, from-step).
+			Find(&overlapping).Error; err != nil {
+			return err
+		}
+
+		merged := models.CandleCoverage{Symbol: symbol, Granularity: granularity, StartEpoch: from, EndEpoch: to}
+		ids := make([]uint, 0, len(overlapping))
+		for _, r := range overlapping {
+			ids = append(ids, r.ID)
+			if r.StartEpoch < merged.StartEpoch {
+				merged.StartEpoch = r.StartEpoch
+			}
+			if r.EndEpoch > merged.EndEpoch {
+				merged.EndEpoch = r.EndEpoch
+			}
+		}
+		if len(ids) > 0 {
+			if err := tx.Delete(&models.CandleCoverage{}, ids).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(&merged).Error
+	})
+	if err != nil {
+		log.Printf("[Candles] failed to record coverage for %s: %v", symbol, err)
+	}
+}
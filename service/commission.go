@@ -0,0 +1,172 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/keyadaniel56/algocdk/internal/models"
+	"gorm.io/gorm"
+)
+
+// SalesVolumeWindow is the period of sales that places an admin in a
+// commission tier
+const SalesVolumeWindow = 30 * 24 * time.Hour
+
+// defaultCommission is the platform's share when no rule applies. The rest
+// of a resale goes to the user who sold the license.
+var defaultCommission = map[string]float64{"purchase": 0.30, "rent": 0.20, "resale": 0.10}
+
+// commissionScopes ranks rule scopes from least to most specific
+var commissionScopes = map[string]int{"global": 0, "tier": 1, "admin": 2, "bot": 3}
+
+var ErrNoCommission = errors.New("commission only applies to purchases, rentals and resales")
+
+// Commission is the platform's share of a payment and where it came from
+type Commission struct {
+	Rate   float64                `json:"rate"`
+	Rule   *models.CommissionRule `json:"rule,omitempty"` // nil for the built-in default
+	Volume float64                `json:"sales_volume"`   // the admin's recent sales, when a tier was considered
+}
+
+// Split divides amount into the platform's and the admin's shares
+func (c Commission) Split(amount float64) (companyShare, adminShare float64) {
+	companyShare = roundMoney(amount * c.Rate)
+	return companyShare, roundMoney(amount - companyShare)
+}
+
+// RuleID is the ID of the rule behind the rate, for the transaction record
+func (c Commission) RuleID() *uint {
+	if c.Rule == nil {
+		return nil
+	}
+	id := c.Rule.ID
+	return &id
+}
+
+// NormalizeCommissionRule validates rule and clears the fields its scope
+// does not use
+func NormalizeCommissionRule(rule *models.CommissionRule) error {
+	rule.Scope = strings.ToLower(strings.TrimSpace(rule.Scope))
+	rule.PaymentType = strings.ToLower(strings.TrimSpace(rule.PaymentType))
+	if _, ok := commissionScopes[rule.Scope]; !ok {
+		return fmt.Errorf("scope must be global, tier, admin or bot, got %q", rule.Scope)
+	}
+	if _, ok := defaultCommission[rule.PaymentType]; !ok && rule.PaymentType != "" {
+		return fmt.Errorf("payment_type must be purchase, rent, resale or empty for purchases and rentals, got %q", rule.PaymentType)
+	}
+	if rule.Rate < 0 || rule.Rate > 1 {
+		return errors.New("rate must be between 0 and 1")
+	}
+	if rule.StartsAt != nil && rule.EndsAt != nil && !rule.EndsAt.After(*rule.StartsAt) {
+		return errors.New("ends_at must be after starts_at")
+	}
+
+	switch rule.Scope {
+	case "admin":
+		if rule.AdminID == nil {
+			return errors.New("an admin rule needs admin_id")
+		}
+		rule.BotID = nil
+	case "bot":
+		if rule.BotID == nil {
+			return errors.New("a bot rule needs bot_id")
+		}
+		rule.AdminID = nil
+	default:
+		rule.AdminID, rule.BotID = nil, nil
+	}
+	if rule.Scope != "tier" {
+		rule.MinSalesVolume = 0
+	} else if rule.MinSalesVolume < 0 {
+		return errors.New("min_sales_volume cannot be negative")
+	}
+	if strings.TrimSpace(rule.Name) == "" {
+		rule.Name = rule.Scope
+	}
+	return nil
+}
+
+// AdminSalesVolume is what adminID's bots sold and rented for, less refunds,
+// in the SalesVolumeWindow before at
+func AdminSalesVolume(db *gorm.DB, adminID uint, at time.Time) (float64, error) {
+	var volume float64
+	err := db.Model(&models.Transaction{}).
+		Where("admin_id = ? AND payment_type IN ? AND status = ? AND created_at BETWEEN ? AND ?",
+			adminID, []string{"purchase", "rent"}, "success", at.Add(-SalesVolumeWindow), at).
+		Select("COALESCE(SUM(amount - refunded_amount), 0)").Scan(&volume).Error
+	return roundMoney(volume), err
+}
+
+// CommissionFor finds the platform's share of a paymentType payment for
+// botID of adminID at time at. The most specific active rule in force wins:
+// a bot override, then a rule for the admin, then the highest tier their
+// sales volume reaches, then the global default. Within a scope a
+// time-boxed promotion beats a standing rule, and a newer rule an older one.
+func CommissionFor(db *gorm.DB, paymentType string, adminID, botID uint, at time.Time) (Commission, error) {
+	rate, ok := defaultCommission[paymentType]
+	if !ok {
+		return Commission{}, ErrNoCommission
+	}
+	commission := Commission{Rate: rate}
+	// Rules for both purchases and rentals leave resales alone
+	paymentTypes := []string{paymentType, ""}
+	if paymentType == "resale" {
+		paymentTypes = paymentTypes[:1]
+	}
+
+	var rules []models.CommissionRule
+	if err := db.Where("active = ? AND payment_type IN ?", true, paymentTypes).
+		Where("(starts_at IS NULL OR starts_at <= ?) AND (ends_at IS NULL OR ends_at > ?)", at, at).
+		Where("scope IN ? OR (scope = ? AND admin_id = ?) OR (scope = ? AND bot_id = ?)",
+			[]string{"global", "tier"}, "admin", adminID, "bot", botID).
+		Find(&rules).Error; err != nil {
+		return commission, err
+	}
+
+	volumeKnown := false
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Scope == "tier" {
+			if adminID == 0 {
+				continue
+			}
+			if !volumeKnown {
+				volume, err := AdminSalesVolume(db, adminID, at)
+				if err != nil {
+					return commission, err
+				}
+				commission.Volume, volumeKnown = volume, true
+			}
+			if commission.Volume < rule.MinSalesVolume {
+				continue
+			}
+		}
+		if commission.Rule == nil || outranks(*rule, *commission.Rule) {
+			commission.Rule = rule
+		}
+	}
+	if commission.Rule != nil {
+		commission.Rate = commission.Rule.Rate
+	}
+	return commission, nil
+}
+
+// outranks reports whether rule a takes precedence over rule b
+func outranks(a, b models.CommissionRule) bool {
+	if commissionScopes[a.Scope] != commissionScopes[b.Scope] {
+		return commissionScopes[a.Scope] > commissionScopes[b.Scope]
+	}
+	if a.Scope == "tier" && a.MinSalesVolume != b.MinSalesVolume {
+		return a.MinSalesVolume > b.MinSalesVolume
+	}
+	aPromo, bPromo := a.StartsAt != nil || a.EndsAt != nil, b.StartsAt != nil || b.EndsAt != nil
+	if aPromo != bPromo {
+		return aPromo
+	}
+	if a.PaymentType != b.PaymentType {
+		return a.PaymentType != ""
+	}
+	return a.ID > b.ID
+}
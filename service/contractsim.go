@@ -0,0 +1,240 @@
+package services
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/keyadaniel56/algocdk/internal/indicators"
+	"github.com/keyadaniel56/algocdk/internal/models"
+)
+
+// Tick is a single price observation for a symbol
+type Tick struct {
+	Epoch int64   `json:"epoch"`
+	Quote float64 `json:"quote"`
+}
+
+// SimulatedOutcome is the result of replaying a contract over tick data
+type SimulatedOutcome struct {
+	EntrySpot  float64 `json:"entry_spot"`
+	EntryEpoch int64   `json:"entry_epoch"`
+	ExitSpot   float64 `json:"exit_spot"`
+	ExitEpoch  int64   `json:"exit_epoch"`
+	Won        bool    `json:"won"`
+}
+
+// ErrSimulationUnsupported is returned for contract types that cannot be
+// settled from ticks alone, such as multipliers and accumulators.
+var ErrSimulationUnsupported = errors.New("contract type cannot be simulated from tick data")
+
+// SimulateContract replays a binary contract bought at startEpoch over ticks
+// (sorted by epoch) using Deriv's settlement rules: the entry spot is the
+// first tick after purchase, tick contracts exit on the Nth tick after entry
+// and timed contracts on the last tick at or before expiry. It returns false
+// while the ticks do not yet reach a final outcome. pipSize is the number of
+// decimals quoted for the symbol, used for last-digit contracts.
+func SimulateContract(c models.DerivContractRequest, startEpoch int64, ticks []Tick, pipSize int) (*SimulatedOutcome, bool, error) {
+	c.Normalize()
+	if !c.HasFixedExpiry() {
+		return nil, false, ErrSimulationUnsupported
+	}
+
+	first := -1
+	for i, t := range ticks {
+		if t.Epoch > startEpoch {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return nil, false, nil
+	}
+	path := ticks[first:]
+	entry := path[0]
+
+	high, low, err := resolveBarriers(c, entry.Quote)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Find the exit tick, if the data already reaches it
+	exitIdx := -1
+	if c.DurationUnit == "t" {
+		if len(path) > c.Duration {
+			exitIdx = c.Duration
+		}
+	} else {
+		expiry := startEpoch + durationSeconds(c.Duration, c.DurationUnit)
+		if path[len(path)-1].Epoch >= expiry {
+			exitIdx = 0
+			for i, t := range path {
+				if t.Epoch > expiry {
+					break
+				}
+				exitIdx = i
+			}
+		}
+	}
+
+	outcome := func(idx int, won bool) (*SimulatedOutcome, bool, error) {
+		return &SimulatedOutcome{
+			EntrySpot:  entry.Quote,
+			EntryEpoch: entry.Epoch,
+			ExitSpot:   path[idx].Quote,
+			ExitEpoch:  path[idx].Epoch,
+			Won:        won,
+		}, true, nil
+	}
+
+	// Path-dependent contracts can settle before expiry
+	last := len(path) - 1
+	if exitIdx >= 0 {
+		last = exitIdx
+	}
+	switch c.ContractType {
+	case "ONETOUCH", "NOTOUCH":
+		for i := 1; i <= last; i++ {
+			if touches(path[i].Quote, entry.Quote, high) {
+				return outcome(i, c.ContractType == "ONETOUCH")
+			}
+		}
+	case "RANGE", "UPORDOWN":
+		for i := 1; i <= last; i++ {
+			if path[i].Quote >= high || path[i].Quote <= low {
+				return outcome(i, c.ContractType == "UPORDOWN")
+			}
+		}
+	}
+
+	if exitIdx < 0 {
+		return nil, false, nil
+	}
+	exit := path[exitIdx].Quote
+
+	var won bool
+	switch c.ContractType {
+	case "CALL":
+		won = exit > high
+	case "CALLE":
+		won = exit >= high
+	case "PUT":
+		won = exit < high
+	case "PUTE":
+		won = exit <= high
+	case "ONETOUCH":
+		won = false
+	case "NOTOUCH":
+		won = true
+	case "EXPIRYRANGE":
+		won = exit < high && exit > low
+	case "EXPIRYMISS":
+		won = exit >= high || exit <= low
+	case "RANGE":
+		won = true
+	case "UPORDOWN":
+		won = false
+	case "ASIANU", "ASIAND":
+		sum := 0.0
+		for i := 0; i <= exitIdx; i++ {
+			sum += path[i].Quote
+		}
+		avg := sum / float64(exitIdx+1)
+		if c.ContractType == "ASIANU" {
+			won = exit > avg
+		} else {
+			won = exit < avg
+		}
+	default:
+		digit := indicators.LastDigit(exit, pipSize)
+		prediction := 0
+		if c.Prediction != nil {
+			prediction = *c.Prediction
+		}
+		switch c.ContractType {
+		case "DIGITMATCH":
+			won = digit == prediction
+		case "DIGITDIFF":
+			won = digit != prediction
+		case "DIGITOVER":
+			won = digit > prediction
+		case "DIGITUNDER":
+			won = digit < prediction
+		case "DIGITEVEN":
+			won = digit%2 == 0
+		case "DIGITODD":
+			won = digit%2 == 1
+		default:
+			return nil, false, ErrSimulationUnsupported
+		}
+	}
+
+	return outcome(exitIdx, won)
+}
+
+// resolveBarriers turns absolute or entry-relative barriers into prices. For
+// contracts without a barrier the entry spot is used. high is always >= low.
+func resolveBarriers(c models.DerivContractRequest, entry float64) (high, low float64, err error) {
+	high = entry
+	low = entry
+	if c.Barrier != "" {
+		if high, err = resolveBarrier(c.Barrier, entry); err != nil {
+			return 0, 0, err
+		}
+		low = high
+	}
+	if c.Barrier2 != "" {
+		if low, err = resolveBarrier(c.Barrier2, entry); err != nil {
+			return 0, 0, err
+		}
+		if low > high {
+			high, low = low, high
+		}
+	}
+	return high, low, nil
+}
+
+func resolveBarrier(barrier string, entry float64) (float64, error) {
+	if strings.HasPrefix(barrier, "+") || strings.HasPrefix(barrier, "-") {
+		offset, err := strconv.ParseFloat(barrier, 64)
+		if err != nil {
+			return 0, errors.New("invalid barrier " + barrier)
+		}
+		return entry + offset, nil
+	}
+	value, err := strconv.ParseFloat(barrier, 64)
+	if err != nil {
+		return 0, errors.New("invalid barrier " + barrier)
+	}
+	return value, nil
+}
+
+// settlesEarly reports whether a contract can end before its expiry because
+// a barrier was touched or breached.
+func settlesEarly(contractType string) bool {
+	switch contractType {
+	case "ONETOUCH", "NOTOUCH", "RANGE", "UPORDOWN":
+		return true
+	}
+	return false
+}
+
+func touches(quote, entry, barrier float64) bool {
+	if barrier >= entry {
+		return quote >= barrier
+	}
+	return quote <= barrier
+}
+
+func durationSeconds(duration int, unit string) int64 {
+	d := int64(duration)
+	switch unit {
+	case "m":
+		return d * 60
+	case "h":
+		return d * 3600
+	case "d":
+		return d * 86400
+	}
+	return d
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+)
+
+// ContractTracker follows open Deriv contracts through proposal_open_contract
+// subscriptions and settles the matching models.Trade rows once Deriv
+// reports a final outcome.
+type ContractTracker struct {
+	deriv         *DerivService
+	RetryInterval time.Duration
+
+	mu     sync.Mutex
+	active map[uint]bool
+}
+
+// NewContractTracker creates a tracker that subscribes through deriv's pool.
+func NewContractTracker(deriv *DerivService) *ContractTracker {
+	return &ContractTracker{
+		deriv:         deriv,
+		RetryInterval: 5 * time.Second,
+		active:        make(map[uint]bool),
+	}
+}
+
+// Resume starts tracking every open trade that was placed with a stored
+// credential, e.g. after a restart.
+func (t *ContractTracker) Resume() {
+	var trades []models.Trade
+	if err := database.DB.Where("status = ? AND credential_id <> 0", "open").Find(&trades).Error; err != nil {
+		log.Printf("[Tracker] failed to load open trades: %v", err)
+		return
+	}
+
+	for _, trade := range trades {
+		var credentials models.DerivCredentials
+		if err := database.DB.First(&credentials, trade.CredentialID).Error; err != nil {
+			log.Printf("[Tracker] no credentials for trade %d: %v", trade.ID, err)
+			continue
+		}
+		t.Track(trade, credentials.APIToken)
+	}
+	log.Printf("[Tracker] resumed tracking of %d open trades", len(trades))
+}
+
+// Track follows trade's contract in the background until it settles.
+// Calling it again for a trade already being tracked is a no-op.
+func (t *ContractTracker) Track(trade models.Trade, apiToken string) {
+	contractID, err := strconv.ParseInt(trade.DerivTradeID, 10, 64)
+	if err != nil {
+		log.Printf("[Tracker] trade %d has no Deriv contract id (%q), not tracking", trade.ID, trade.DerivTradeID)
+		return
+	}
+
+	t.mu.Lock()
+	if t.active[trade.ID] {
+		t.mu.Unlock()
+		return
+	}
+	t.active[trade.ID] = true
+	t.mu.Unlock()
+
+	go func() {
+		defer func() {
+			t.mu.Lock()
+			delete(t.active, trade.ID)
+			t.mu.Unlock()
+		}()
+		t.follow(trade.ID, contractID, apiToken)
+	}()
+}
+
+func (t *ContractTracker) follow(tradeID uint, contractID int64, apiToken string) {
+	req := map[string]interface{}{
+		"proposal_open_contract": 1,
+		"contract_id":            contractID,
+	}
+
+	for {
+		sub, err := t.deriv.pool.Subscribe(apiToken, req)
+		if err != nil {
+			var apiErr *DerivAPIError
+			if errors.As(err, &apiErr) {
+				log.Printf("[Tracker] Deriv rejected tracking of contract %d: %v", contractID, err)
+				return
+			}
+			log.Printf("[Tracker] subscribe for contract %d failed, retrying: %v", contractID, err)
+			time.Sleep(t.RetryInterval)
+			continue
+		}
+
+		if t.handle(tradeID, sub.Initial) {
+			sub.Close()
+			return
+		}
+		for raw := range sub.C {
+			if t.handle(tradeID, raw) {
+				sub.Close()
+				return
+			}
+		}
+
+		// The stream ended without a final state; the session was lost for good.
+		time.Sleep(t.RetryInterval)
+	}
+}
+
+// handle settles the trade if raw carries a final contract state.
+func (t *ContractTracker) handle(tradeID uint, raw []byte) bool {
+	var response models.DerivWSResponse
+	if err := json.Unmarshal(raw, &response); err != nil {
+		return false
+	}
+	contract := response.ProposalOpenContract
+	if !contract.IsSettled() {
+		return false
+	}
+
+	if err := SettleTrade(tradeID, contract); err != nil {
+		log.Printf("[Tracker] failed to settle trade %d: %v", tradeID, err)
+		return false
+	}
+	return true
+}
+
+// SettleTrade records the final outcome of a contract on its Trade row.
+// Rows that are no longer open are left untouched.
+func SettleTrade(tradeID uint, contract models.DerivOpenContract) error {
+	closeTime := time.Now()
+	if contract.SellTime > 0 {
+		closeTime = time.Unix(contract.SellTime, 0)
+	}
+
+	updates := map[string]interface{}{
+		"status":      contract.Outcome(),
+		"profit_loss": contract.Profit,
+		"sell_price":  contract.SellPrice,
+		"close_time":  closeTime,
+	}
+	if contract.Payout > 0 {
+		updates["payout"] = contract.Payout
+	}
+
+	result := database.DB.Model(&models.Trade{}).
+		Where("id = ? AND status = ?", tradeID, "open").
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("[Tracker] trade %d settled as %s (P&L %.2f)", tradeID, contract.Outcome(), contract.Profit)
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+)
+
+// ErrNoCopyTrading is returned for a bot that does not offer copy trading
+var ErrNoCopyTrading = errors.New("bot does not offer copy trading")
+
+// CopyTrader replicates a leader's live trades to the accounts of their
+// followers
+type CopyTrader struct {
+	deriv   *DerivService
+	tracker *ContractTracker
+
+	// MaxConcurrent bounds how many follower trades are placed at once
+	MaxConcurrent int
+}
+
+// NewCopyTrader creates a copy trader that buys through deriv and settles
+// follower trades with tracker
+func NewCopyTrader(deriv *DerivService, tracker *ContractTracker) *CopyTrader {
+	return &CopyTrader{deriv: deriv, tracker: tracker, MaxConcurrent: 8}
+}
+
+// Follow subscribes followerID to the owner of a copy-trading bot, or updates
+// the stake settings of an existing subscription. The follower must hold an
+// active rental of the bot.
+func Follow(followerID, botID uint, stakeMode string, stakeValue, maxStake float64) (*models.CopySubscription, error) {
+	switch stakeMode {
+	case "multiplier", "fixed":
+	default:
+		return nil, fmt.Errorf("stake_mode must be 'multiplier' or 'fixed', got %q", stakeMode)
+	}
+	if stakeValue <= 0 {
+		return nil, errors.New("stake_value must be positive")
+	}
+	if stakeMode == "fixed" && stakeValue < minStake {
+		return nil, fmt.Errorf("fixed stake must be at least %.2f", minStake)
+	}
+	if maxStake < 0 {
+		return nil, errors.New("max_stake cannot be negative")
+	}
+
+	bot, err := copyBot(botID)
+	if err != nil {
+		return nil, err
+	}
+	if bot.OwnerID == followerID {
+		return nil, errors.New("you cannot copy your own trades")
+	}
+	if _, err := activeUserBot(followerID, botID); err != nil {
+		return nil, err
+	}
+
+	sub := models.CopySubscription{FollowerID: followerID, LeaderID: bot.OwnerID}
+	if err := database.DB.Where("follower_id = ? AND leader_id = ?", followerID, bot.OwnerID).
+		FirstOrInit(&sub).Error; err != nil {
+		return nil, err
+	}
+	sub.BotID = botID
+	sub.StakeMode = stakeMode
+	sub.StakeValue = stakeValue
+	sub.MaxStake = maxStake
+	sub.Active = true
+	if err := database.DB.Save(&sub).Error; err != nil {
+		return nil, err
+	}
+	log.Printf("[Copy] user %d follows user %d (%s %.2f)", followerID, bot.OwnerID, stakeMode, stakeValue)
+	return &sub, nil
+}
+
+// copyBot loads a bot that offers copy trading and whose owner is an admin
+func copyBot(botID uint) (*models.Bot, error) {
+	var bot models.Bot
+	if err := database.DB.Preload("Owner").First(&bot, botID).Error; err != nil {
+		return nil, ErrNoCopyTrading
+	}
+	if !bot.CopyTrading || !strings.Contains(strings.ToLower(bot.Owner.Role), "admin") {
+		return nil, ErrNoCopyTrading
+	}
+	return &bot, nil
+}
+
+// CopyStake sizes a follower's stake for a leader trade of leaderStake
+func CopyStake(sub models.CopySubscription, leaderStake float64) float64 {
+	stake := sub.StakeValue
+	if sub.StakeMode == "multiplier" {
+		stake = leaderStake * sub.StakeValue
+	}
+	if sub.MaxStake > 0 && stake > sub.MaxStake {
+		stake = sub.MaxStake
+	}
+	if stake < minStake {
+		stake = minStake
+	}
+	return math.Round(stake*100) / 100
+}
+
+// Mirror copies source, bought with contract, to every active follower of
+// its owner in the background
+func (c *CopyTrader) Mirror(source models.Trade, contract models.DerivContractRequest) {
+	var subs []models.CopySubscription
+	if err := database.DB.Where("leader_id = ? AND active = ?", source.UserID, true).
+		Find(&subs).Error; err != nil {
+		log.Printf("[Copy] failed to load followers of user %d: %v", source.UserID, err)
+		return
+	}
+	if len(subs) == 0 {
+		return
+	}
+
+	go func() {
+		limit := c.MaxConcurrent
+		if limit <= 0 {
+			limit = 1
+		}
+		sem := make(chan struct{}, limit)
+		var wg sync.WaitGroup
+		for _, sub := range subs {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(sub models.CopySubscription) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				c.copyTo(sub, source, contract)
+			}(sub)
+		}
+		wg.Wait()
+		log.Printf("[Copy] trade %d of user %d mirrored to %d followers", source.ID, source.UserID, len(subs))
+	}()
+}
+
+// copyTo places one follower's copy of source and records the outcome
+func (c *CopyTrader) copyTo(sub models.CopySubscription, source models.Trade, contract models.DerivContractRequest) {
+	record := models.CopyTrade{
+		SubscriptionID: sub.ID,
+		LeaderID:       sub.LeaderID,
+		FollowerID:     sub.FollowerID,
+		SourceTradeID:  source.ID,
+		Stake:          CopyStake(sub, source.Stake),
+		CreatedAt:      time.Now(),
+	}
+
+	tradeID, err := c.place(sub, source, contract, record.Stake)
+	var violation *RiskViolation
+	switch {
+	case err == nil:
+		record.Status = "placed"
+		record.FollowerTradeID = &tradeID
+	case errors.Is(err, ErrNoBotAccess), errors.Is(err, ErrNoCopyTrading):
+		record.Status = "skipped"
+		record.Error = err.Error()
+		database.DB.Model(&sub).Update("active", false)
+	case errors.As(err, &violation):
+		record.Status = "blocked"
+		record.Error = violation.Reason
+	default:
+		record.Status = "failed"
+		record.Error = err.Error()
+	}
+
+	if err := database.DB.Create(&record).Error; err != nil {
+		log.Printf("[Copy] failed to record copy of trade %d for user %d: %v", source.ID, sub.FollowerID, err)
+	}
+	if record.Status != "placed" {
+		log.Printf("[Copy] trade %d not copied to user %d: %s", source.ID, sub.FollowerID, record.Error)
+	}
+}
+
+func (c *CopyTrader) place(sub models.CopySubscription, source models.Trade, contract models.DerivContractRequest, stake float64) (uint, error) {
+	bot, err := copyBot(sub.BotID)
+	if err != nil || bot.OwnerID != sub.LeaderID {
+		return 0, ErrNoCopyTrading
+	}
+	if _, err := activeUserBot(sub.FollowerID, sub.BotID); err != nil {
+		return 0, err
+	}
+
+	// Multiplier limits are amounts, so they scale with the stake
+	if source.Stake > 0 {
+		ratio := stake / source.Stake
+		contract.StopLoss = math.Round(contract.StopLoss*ratio*100) / 100
+		contract.TakeProfit = math.Round(contract.TakeProfit*ratio*100) / 100
+	}
+	contract.Amount = stake
+	contract.Basis = "stake"
+	contract.Currency = "" // the follower's account currency
+	contract.BotID = 0
+
+	if err := CheckOrder(RiskOrder{
+		UserID:   sub.FollowerID,
+		Source:   "copy",
+		Mode:     "live",
+		Contract: contract,
+		Stake:    stake,
+	}); err != nil {
+		return 0, err
+	}
+
+	var credentials models.DerivCredentials
+	if err := database.DB.Where("user_id = ? AND is_active = ?", sub.FollowerID, true).
+		First(&credentials).Error; err != nil {
+		return 0, errors.New("no Deriv token found")
+	}
+	result, err := c.deriv.PlaceTrade(credentials.APIToken, contract)
+	if err != nil {
+		return 0, err
+	}
+
+	trade := models.Trade{
+		UserID:       sub.FollowerID,
+		DerivTradeID: result.ContractID,
+		CredentialID: credentials.ID,
+		Symbol:       contract.Symbol,
+		TradeType:    contract.ContractType,
+		Stake:        stake,
+		BuyPrice:     result.BuyPrice,
+		Payout:       result.Payout,
+		Status:       "open",
+		OpenTime:     result.PurchaseTime,
+		CreatedAt:    time.Now(),
+	}
+	if err := database.DB.Create(&trade).Error; err != nil {
+		return 0, fmt.Errorf("contract %s was bought but could not be recorded: %v", result.ContractID, err)
+	}
+	c.tracker.Track(trade, credentials.APIToken)
+	return trade.ID, nil
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/keyadaniel56/algocdk/internal/models"
+	"gorm.io/gorm"
+)
+
+var ErrCurrencyNotSupported = errors.New("payments are not accepted in this currency")
+
+// countryCurrencies maps the country names DetectCountry reports to the
+// currency their users pay in
+var countryCurrencies = map[string]string{
+	"kenya":          "KES",
+	"nigeria":        "NGN",
+	"ghana":          "GHS",
+	"south africa":   "ZAR",
+	"egypt":          "EGP",
+	"rwanda":         "RWF",
+	"uganda":         "UGX",
+	"tanzania":       "TZS",
+	"côte d'ivoire":  "XOF",
+	"ivory coast":    "XOF",
+	"senegal":        "XOF",
+	"united states":  "USD",
+	"united kingdom": "GBP",
+	"canada":         "CAD",
+	"germany":        "EUR",
+	"france":         "EUR",
+	"italy":          "EUR",
+	"spain":          "EUR",
+	"netherlands":    "EUR",
+	"ireland":        "EUR",
+	"belgium":        "EUR",
+	"portugal":       "EUR",
+}
+
+// BaseCurrency is the currency bots are priced in and commissions and the
+// ledger are kept in, BASE_CURRENCY or KES
+func BaseCurrency() string {
+	if c := NormalizeCurrency(os.Getenv("BASE_CURRENCY")); c != "" {
+		return c
+	}
+	return "KES"
+}
+
+// NormalizeCurrency upper-cases a currency code
+func NormalizeCurrency(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// CurrencyForCountry is the local currency of a country, "" when unknown
+func CurrencyForCountry(country string) string {
+	return countryCurrencies[strings.ToLower(strings.TrimSpace(country))]
+}
+
+// ExchangeRateFor is how many units of currency one unit of the base
+// currency buys. Only the base currency and currencies with a rate are
+// accepted.
+func ExchangeRateFor(db *gorm.DB, currency string) (float64, error) {
+	currency = NormalizeCurrency(currency)
+	if currency == BaseCurrency() {
+		return 1, nil
+	}
+	var rate models.ExchangeRate
+	found := db.Where("currency = ?", currency).Limit(1).Find(&rate)
+	if found.Error != nil {
+		return 0, found.Error
+	}
+	if found.RowsAffected == 0 || rate.Rate <= 0 {
+		return 0, ErrCurrencyNotSupported
+	}
+	return rate.Rate, nil
+}
+
+// PaymentCurrency picks the currency user pays in: the one asked for, else
+// their preference, else their country's currency, else the base currency.
+// Only an unsupported currency asked for is an error; an unsupported
+// preference or country falls through.
+func PaymentCurrency(db *gorm.DB, user models.User, requested string) (string, error) {
+	if requested = NormalizeCurrency(requested); requested != "" {
+		if _, err := ExchangeRateFor(db, requested); err != nil {
+			return "", err
+		}
+		return requested, nil
+	}
+	for _, currency := range []string{NormalizeCurrency(user.PreferredCurrency), CurrencyForCountry(user.Country)} {
+		if currency == "" {
+			continue
+		}
+		if _, err := ExchangeRateFor(db, currency); err == nil {
+			return currency, nil
+		}
+	}
+	return BaseCurrency(), nil
+}
+
+// Price is an amount due in the base currency, in the currency it is
+// charged in
+type Price struct {
+	Currency   string  `json:"currency"`
+	Amount     float64 `json:"amount"`
+	BaseAmount float64 `json:"base_amount"`
+	Rate       float64 `json:"rate"`  // Amount per unit of BaseAmount
+	Fixed      bool    `json:"fixed"` // from the bot's price list rather than the exchange rate
+}
+
+// QuotePrice converts baseAmount into currency. When the bot has a price
+// for paymentType and planID in currency, its ratio to listBase (the base
+// price it stands for) is used instead of the exchange rate, so a prorated
+// amount is scaled the same way. botID 0 skips price lists.
+func QuotePrice(db *gorm.DB, currency string, baseAmount float64, botID uint, paymentType string, planID uint, listBase float64) (Price, error) {
+	currency = NormalizeCurrency(currency)
+	price := Price{Currency: currency, BaseAmount: roundMoney(baseAmount)}
+	if botID != 0 && listBase > 0 && currency != BaseCurrency() {
+		var listed models.BotPrice
+		found := db.Where("bot_id = ? AND payment_type = ? AND rental_plan_id = ? AND currency = ?", botID, paymentType, planID, currency).
+			Limit(1).Find(&listed)
+		if found.Error != nil {
+			return price, found.Error
+		}
+		if found.RowsAffected > 0 && listed.Amount > 0 {
+			price.Rate, price.Fixed = listed.Amount/listBase, true
+		}
+	}
+	if !price.Fixed {
+		rate, err := ExchangeRateFor(db, currency)
+		if err != nil {
+			return price, err
+		}
+		price.Rate = rate
+	}
+	price.Amount = roundMoney(baseAmount * price.Rate)
+	return price, nil
+}
+
+// TransactionCurrency is the currency transaction was charged in; older
+// transactions were all charged in the base currency
+func TransactionCurrency(transaction models.Transaction) string {
+	if transaction.Currency == "" {
+		return BaseCurrency()
+	}
+	return transaction.Currency
+}
+
+// ToBase converts an amount charged on transaction into the base currency
+// at the rate it was charged at
+func ToBase(transaction models.Transaction, charged float64) float64 {
+	if transaction.ExchangeRate <= 0 {
+		return charged
+	}
+	if charged == transaction.ChargedAmount {
+		return transaction.Amount
+	}
+	return roundMoney(charged / transaction.ExchangeRate)
+}
+
+// ToCharged converts an amount in the base currency into the currency of
+// transaction at the rate it was charged at
+func ToCharged(transaction models.Transaction, base float64) float64 {
+	if transaction.ExchangeRate <= 0 {
+		return base
+	}
+	if base == transaction.Amount {
+		return transaction.ChargedAmount
+	}
+	return roundMoney(base * transaction.ExchangeRate)
+}
+
+// ToBase converts an amount charged at this price back into the base
+// currency
+func (p Price) ToBase(charged float64) float64 {
+	if charged == p.Amount || p.Rate <= 0 {
+		return p.BaseAmount
+	}
+	return roundMoney(charged / p.Rate)
+}
+
+// NormalizeBotPrice validates a price list entry. A rent price names one of
+// the bot's plans, or 0 for its default plan.
+func NormalizeBotPrice(db *gorm.DB, price *models.BotPrice) error {
+	price.PaymentType = strings.ToLower(strings.TrimSpace(price.PaymentType))
+	price.Currency = NormalizeCurrency(price.Currency)
+	if price.PaymentType != "purchase" && price.PaymentType != "rent" {
+		return fmt.Errorf("payment_type must be purchase or rent, got %q", price.PaymentType)
+	}
+	if price.Currency == BaseCurrency() {
+		return errors.New("prices in the base currency are set on the bot itself")
+	}
+	if _, err := ExchangeRateFor(db, price.Currency); err != nil {
+		return err
+	}
+	if price.Amount <= 0 {
+		return errors.New("amount must be positive")
+	}
+	if price.PaymentType == "purchase" {
+		price.RentalPlanID = 0
+	} else if price.RentalPlanID != 0 {
+		var plans int64
+		db.Model(&models.RentalPlan{}).Where("id = ? AND bot_id = ?", price.RentalPlanID, price.BotID).Count(&plans)
+		if plans == 0 {
+			return errors.New("rental plan not found for this bot")
+		}
+	}
+	price.Amount = roundMoney(price.Amount)
+	return nil
+}
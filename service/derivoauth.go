@@ -0,0 +1,149 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	"gorm.io/gorm"
+)
+
+// derivOAuthStateTTL is how long a user has to finish logging in at Deriv
+const derivOAuthStateTTL = 10 * time.Minute
+
+// ErrOAuthStateInvalid is returned for a callback that does not match a
+// pending authorization
+var ErrOAuthStateInvalid = errors.New("deriv login expired or was not started here, please try again")
+
+// DerivOAuthAccount is one account from Deriv's OAuth redirect
+type DerivOAuthAccount struct {
+	LoginID  string
+	Token    string
+	Currency string
+}
+
+// AccountType is "demo" for virtual accounts (login IDs starting with VR)
+// and "real" otherwise
+func (a DerivOAuthAccount) AccountType() string {
+	if strings.HasPrefix(strings.ToUpper(a.LoginID), "VR") {
+		return "demo"
+	}
+	return "real"
+}
+
+// ParseDerivOAuthAccounts reads the acct1/token1/cur1, acct2/token2/cur2, ...
+// parameters of the OAuth redirect
+func ParseDerivOAuthAccounts(query url.Values) ([]DerivOAuthAccount, error) {
+	var accounts []DerivOAuthAccount
+	for i := 1; ; i++ {
+		n := strconv.Itoa(i)
+		loginID := strings.TrimSpace(query.Get("acct" + n))
+		token := strings.TrimSpace(query.Get("token" + n))
+		if loginID == "" && token == "" {
+			break
+		}
+		if loginID == "" || token == "" {
+			return nil, fmt.Errorf("account %d is missing its login ID or token", i)
+		}
+		accounts = append(accounts, DerivOAuthAccount{
+			LoginID:  loginID,
+			Token:    token,
+			Currency: strings.ToUpper(strings.TrimSpace(query.Get("cur" + n))),
+		})
+	}
+	if len(accounts) == 0 {
+		return nil, errors.New("no accounts in Deriv response")
+	}
+	return accounts, nil
+}
+
+// NewDerivOAuthState records a pending authorization for userID and returns
+// its state value
+func NewDerivOAuthState(userID uint) (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	state := models.DerivOAuthState{
+		State:     hex.EncodeToString(b),
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(derivOAuthStateTTL),
+	}
+	if err := database.DB.Create(&state).Error; err != nil {
+		return "", err
+	}
+	database.DB.Where("expires_at < ?", time.Now()).Delete(&models.DerivOAuthState{})
+	return state.State, nil
+}
+
+// ConsumeDerivOAuthState returns the user of a pending authorization and
+// deletes it, so each state works once
+func ConsumeDerivOAuthState(value string) (uint, error) {
+	if value == "" {
+		return 0, ErrOAuthStateInvalid
+	}
+	var state models.DerivOAuthState
+	if err := database.DB.Where("state = ?", value).First(&state).Error; err != nil {
+		return 0, ErrOAuthStateInvalid
+	}
+	// Of two callbacks racing with the same state only the one that deletes
+	// it goes on
+	result := database.DB.Where("state = ?", value).Delete(&models.DerivOAuthState{})
+	if result.Error != nil || result.RowsAffected != 1 {
+		return 0, ErrOAuthStateInvalid
+	}
+	if state.ExpiresAt.Before(time.Now()) {
+		return 0, ErrOAuthStateInvalid
+	}
+	return state.UserID, nil
+}
+
+// LinkDerivOAuthAccounts stores one credentials row per account, replacing
+// the token of a login ID the user already linked. The first account, the
+// one the user signed in with, becomes the active one.
+func LinkDerivOAuthAccounts(userID uint, accounts []DerivOAuthAccount) ([]models.DerivCredentials, error) {
+	var linked []models.DerivCredentials
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, account := range accounts {
+			var credentials models.DerivCredentials
+			if err := tx.Where("user_id = ? AND login_id = ?", userID, account.LoginID).
+				FirstOrInit(&credentials).Error; err != nil {
+				return err
+			}
+			credentials.UserID = userID
+			credentials.LoginID = account.LoginID
+			credentials.AccountType = account.AccountType()
+			credentials.Currency = account.Currency
+			if err := SealDerivToken(&credentials, account.Token); err != nil {
+				return err
+			}
+			if err := tx.Save(&credentials).Error; err != nil {
+				return err
+			}
+			linked = append(linked, credentials)
+		}
+
+		if err := tx.Model(&models.DerivCredentials{}).Where("user_id = ?", userID).
+			Update("is_active", false).Error; err != nil {
+			return err
+		}
+		return tx.Model(&linked[0]).Update("is_active", true).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range linked {
+		linked[i].IsActive = i == 0
+	}
+	log.Printf("[Deriv] user %d linked %d accounts through OAuth", userID, len(linked))
+	return linked, nil
+}
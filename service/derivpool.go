@@ -0,0 +1,738 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	"github.com/keyadaniel56/algocdk/internal/secrets"
+)
+
+var (
+	// ErrDerivConnectionLost is returned to callers whose request was in flight
+	// when the underlying WebSocket dropped.
+	ErrDerivConnectionLost = errors.New("deriv connection lost")
+	// ErrDerivRequestTimeout is returned when Deriv does not answer a request in time.
+	ErrDerivRequestTimeout = errors.New("deriv request timed out")
+	// ErrDerivPoolClosed is returned once the pool has been shut down.
+	ErrDerivPoolClosed = errors.New("deriv connection pool closed")
+)
+
+// DerivAPIError is an error reported by Deriv itself (bad token, invalid
+// contract parameters, ...), as opposed to a transport failure.
+type DerivAPIError struct {
+	Code    string
+	Message string
+}
+
+func (e *DerivAPIError) Error() string {
+	return fmt.Sprintf("%s - %s", e.Code, e.Message)
+}
+
+// DerivPool keeps one long-lived, authorized WebSocket session per API token
+// and multiplexes requests over it, matching responses to callers by req_id.
+// Sessions are kept alive with pings, reconnected with exponential backoff
+// while they have live subscriptions, and dropped after sitting idle.
+type DerivPool struct {
+	wsURL string
+
+	PingInterval   time.Duration
+	IdleTimeout    time.Duration
+	RequestTimeout time.Duration
+	MaxBackoff     time.Duration
+	// DialAttempts is how many times a brand-new session tries to connect
+	// before the waiting request is failed.
+	DialAttempts int
+
+	mu       sync.Mutex
+	sessions map[string]*derivSession
+	closed   bool
+	janitor  sync.Once
+	stop     chan struct{}
+}
+
+// NewDerivPool creates a pool dialing the given Deriv WebSocket URL.
+func NewDerivPool(wsURL string) *DerivPool {
+	return &DerivPool{
+		wsURL:          wsURL,
+		PingInterval:   30 * time.Second,
+		IdleTimeout:    10 * time.Minute,
+		RequestTimeout: 30 * time.Second,
+		MaxBackoff:     30 * time.Second,
+		DialAttempts:   3,
+		sessions:       make(map[string]*derivSession),
+		stop:           make(chan struct{}),
+	}
+}
+
+// SetURL changes the endpoint new sessions dial
+func (p *DerivPool) SetURL(wsURL string) {
+	p.mu.Lock()
+	p.wsURL = wsURL
+	p.mu.Unlock()
+}
+
+func (p *DerivPool) url() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.wsURL
+}
+
+// Authorize returns the cached authorize response for the token's session,
+// connecting and authorizing first if needed.
+func (p *DerivPool) Authorize(apiToken string) (*models.DerivWSResponse, error) {
+	s, err := p.session(apiToken)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.waitReady(p.RequestTimeout); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.auth, nil
+}
+
+// Call sends req on the token's session and decodes the matching response
+// into out. An empty token uses an unauthorized session, which is enough for
+// public calls such as ticks or active_symbols.
+func (p *DerivPool) Call(apiToken string, req map[string]interface{}, out interface{}) error {
+	s, err := p.session(apiToken)
+	if err != nil {
+		return err
+	}
+	raw, err := s.call(req)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// Close shuts down every session. The pool cannot be used afterwards.
+func (p *DerivPool) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.stop)
+	sessions := p.sessions
+	p.sessions = make(map[string]*derivSession)
+	p.mu.Unlock()
+
+	for _, s := range sessions {
+		s.close()
+	}
+}
+
+func (p *DerivPool) session(apiToken string) (*derivSession, error) {
+	p.janitor.Do(func() { go p.reapIdle() })
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, ErrDerivPoolClosed
+	}
+	if s, ok := p.sessions[apiToken]; ok {
+		s.touch()
+		return s, nil
+	}
+	s := newDerivSession(p, apiToken)
+	p.sessions[apiToken] = s
+	go s.run()
+	return s, nil
+}
+
+// forget removes s from the pool if it is still the registered session for its token.
+func (p *DerivPool) forget(s *derivSession) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sessions[s.token] == s {
+		delete(p.sessions, s.token)
+	}
+}
+
+func (p *DerivPool) reapIdle() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+
+		var idle []*derivSession
+		p.mu.Lock()
+		for token, s := range p.sessions {
+			if s.idleFor() > p.IdleTimeout {
+				idle = append(idle, s)
+				delete(p.sessions, token)
+			}
+		}
+		p.mu.Unlock()
+
+		for _, s := range idle {
+			log.Printf("[Deriv] closing idle session")
+			s.close()
+		}
+	}
+}
+
+// derivEnvelope holds the fields every Deriv message carries that the pool
+// needs for routing.
+type derivEnvelope struct {
+	ReqID        int64  `json:"req_id"`
+	MsgType      string `json:"msg_type"`
+	Subscription struct {
+		ID string `json:"id"`
+	} `json:"subscription"`
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type derivSession struct {
+	pool  *DerivPool
+	token string
+	reqID int64
+
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	conn     *websocket.Conn
+	ready    chan struct{}
+	connErr  error
+	auth     *models.DerivWSResponse
+	pending  map[int64]chan []byte
+	subs     map[int64]*DerivSubscription
+	lastUsed time.Time
+	closed   bool
+}
+
+func newDerivSession(p *DerivPool, token string) *derivSession {
+	return &derivSession{
+		pool:     p,
+		token:    token,
+		ready:    make(chan struct{}),
+		pending:  make(map[int64]chan []byte),
+		subs:     make(map[int64]*DerivSubscription),
+		lastUsed: time.Now(),
+	}
+}
+
+func (s *derivSession) touch() {
+	s.mu.Lock()
+	s.lastUsed = time.Now()
+	s.mu.Unlock()
+}
+
+func (s *derivSession) idleFor() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.subs) > 0 || len(s.pending) > 0 {
+		return 0
+	}
+	return time.Since(s.lastUsed)
+}
+
+func (s *derivSession) nextReqID() int64 {
+	return atomic.AddInt64(&s.reqID, 1)
+}
+
+// run owns the connection lifecycle: dial, authorize, read until the socket
+// fails, then reconnect with backoff for as long as the session is worth keeping.
+func (s *derivSession) run() {
+	// Stored tokens are sealed at rest; the plaintext only lives in this session
+	token, err := secrets.Open(s.token)
+	if err != nil {
+		s.fail(fmt.Errorf("stored Deriv token could not be decrypted: %v", err))
+		return
+	}
+
+	backoff := 500 * time.Millisecond
+	attempts := 0
+	established := false
+
+	for {
+		conn, auth, err := s.dial(token)
+		if err != nil {
+			attempts++
+			var apiErr *DerivAPIError
+			giveUp := errors.As(err, &apiErr) ||
+				(!established && attempts >= s.pool.DialAttempts) ||
+				(established && !s.hasSubscriptions())
+			if giveUp || s.isClosed() {
+				s.fail(err)
+				return
+			}
+			log.Printf("[Deriv] connect failed (attempt %d), retrying in %s: %v", attempts, backoff, err)
+			if !s.sleep(backoff) {
+				s.fail(ErrDerivPoolClosed)
+				return
+			}
+			backoff *= 2
+			if backoff > s.pool.MaxBackoff {
+				backoff = s.pool.MaxBackoff
+			}
+			continue
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conn = conn
+		s.auth = auth
+		s.connErr = nil
+		close(s.ready)
+		subs := make([]*DerivSubscription, 0, len(s.subs))
+		for _, sub := range s.subs {
+			subs = append(subs, sub)
+		}
+		s.mu.Unlock()
+
+		if established {
+			log.Printf("[Deriv] session reconnected, restoring %d subscriptions", len(subs))
+			for _, sub := range subs {
+				s.write(conn, sub.request)
+			}
+		}
+		established = true
+		attempts = 0
+		backoff = 500 * time.Millisecond
+
+		stopPing := make(chan struct{})
+		go s.ping(conn, stopPing)
+		s.readLoop(conn)
+		close(stopPing)
+
+		s.mu.Lock()
+		s.conn = nil
+		s.ready = make(chan struct{})
+		for id, ch := range s.pending {
+			close(ch)
+			delete(s.pending, id)
+		}
+		closed := s.closed
+		keep := len(s.subs) > 0
+		s.mu.Unlock()
+
+		if closed {
+			return
+		}
+		if !keep {
+			// Nothing depends on this socket; the next call opens a fresh session.
+			s.fail(ErrDerivConnectionLost)
+			return
+		}
+		log.Printf("[Deriv] session dropped, reconnecting")
+	}
+}
+
+// dial opens a socket and, for token sessions, authorizes it before any
+// other traffic is allowed through.
+func (s *derivSession) dial(token string) (*websocket.Conn, *models.DerivWSResponse, error) {
+	dialer := *websocket.DefaultDialer
+	dialer.HandshakeTimeout = 10 * time.Second
+
+	conn, _, err := dialer.Dial(s.pool.url(), nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to Deriv WebSocket: %v", err)
+	}
+
+	auth := &models.DerivWSResponse{}
+	if token == "" {
+		return conn, auth, nil
+	}
+
+	reqID := s.nextReqID()
+	conn.SetWriteDeadline(time.Now().Add(s.pool.RequestTimeout))
+	if err := conn.WriteJSON(map[string]interface{}{"authorize": token, "req_id": reqID}); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to send auth request: %v", err)
+	}
+	conn.SetWriteDeadline(time.Time{})
+
+	conn.SetReadDeadline(time.Now().Add(s.pool.RequestTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+	for {
+		_, raw, err := conn.ReadMessage()
+		if err != nil {
+			conn.Close()
+			return nil, nil, fmt.Errorf("failed to read auth response: %v", err)
+		}
+		var env derivEnvelope
+		if err := json.Unmarshal(raw, &env); err != nil || env.ReqID != reqID {
+			continue
+		}
+		if env.Error.Code != "" {
+			conn.Close()
+			return nil, nil, &DerivAPIError{Code: env.Error.Code, Message: env.Error.Message}
+		}
+		if err := json.Unmarshal(raw, auth); err != nil {
+			conn.Close()
+			return nil, nil, fmt.Errorf("failed to decode auth response: %v", err)
+		}
+		return conn, auth, nil
+	}
+}
+
+func (s *derivSession) readLoop(conn *websocket.Conn) {
+	deadline := 2*s.pool.PingInterval + s.pool.RequestTimeout
+	conn.SetReadDeadline(time.Now().Add(deadline))
+
+	for {
+		_, raw, err := conn.ReadMessage()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if !closed {
+				log.Printf("[Deriv] read error: %v", err)
+			}
+			conn.Close()
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(deadline))
+
+		var env derivEnvelope
+		if err := json.Unmarshal(raw, &env); err != nil || env.ReqID == 0 {
+			continue
+		}
+
+		s.mu.Lock()
+		if sub, ok := s.subs[env.ReqID]; ok {
+			if env.Subscription.ID != "" {
+				sub.setID(env.Subscription.ID)
+			}
+			s.mu.Unlock()
+			sub.deliver(raw)
+			continue
+		}
+		ch, ok := s.pending[env.ReqID]
+		if ok {
+			delete(s.pending, env.ReqID)
+		}
+		s.mu.Unlock()
+
+		if ok {
+			ch <- raw
+		}
+	}
+}
+
+func (s *derivSession) ping(conn *websocket.Conn, stop <-chan struct{}) {
+	ticker := time.NewTicker(s.pool.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := s.write(conn, map[string]interface{}{"ping": 1, "req_id": s.nextReqID()}); err != nil {
+				conn.Close()
+				return
+			}
+		}
+	}
+}
+
+func (s *derivSession) write(conn *websocket.Conn, req map[string]interface{}) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	conn.SetWriteDeadline(time.Now().Add(s.pool.RequestTimeout))
+	defer conn.SetWriteDeadline(time.Time{})
+	return conn.WriteJSON(req)
+}
+
+// waitReady blocks until the session is connected or has failed for good.
+func (s *derivSession) waitReady(timeout time.Duration) error {
+	s.mu.Lock()
+	ready := s.ready
+	s.mu.Unlock()
+
+	select {
+	case <-ready:
+	case <-time.After(timeout):
+		return ErrDerivRequestTimeout
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		if s.connErr != nil {
+			return s.connErr
+		}
+		return ErrDerivConnectionLost
+	}
+	return nil
+}
+
+func (s *derivSession) call(req map[string]interface{}) ([]byte, error) {
+	if err := s.waitReady(s.pool.RequestTimeout); err != nil {
+		return nil, err
+	}
+
+	reqID := s.nextReqID()
+	msg := make(map[string]interface{}, len(req)+1)
+	for k, v := range req {
+		msg[k] = v
+	}
+	msg["req_id"] = reqID
+
+	ch := make(chan []byte, 1)
+	s.mu.Lock()
+	conn := s.conn
+	if conn == nil {
+		s.mu.Unlock()
+		return nil, ErrDerivConnectionLost
+	}
+	s.pending[reqID] = ch
+	s.lastUsed = time.Now()
+	s.mu.Unlock()
+
+	if err := s.write(conn, msg); err != nil {
+		s.dropPending(reqID)
+		conn.Close()
+		return nil, fmt.Errorf("failed to send request: %v", err)
+	}
+
+	select {
+	case raw, ok := <-ch:
+		if !ok {
+			return nil, ErrDerivConnectionLost
+		}
+		return raw, nil
+	case <-time.After(s.pool.RequestTimeout):
+		s.dropPending(reqID)
+		return nil, ErrDerivRequestTimeout
+	}
+}
+
+func (s *derivSession) dropPending(reqID int64) {
+	s.mu.Lock()
+	delete(s.pending, reqID)
+	s.mu.Unlock()
+}
+
+func (s *derivSession) hasSubscriptions() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.subs) > 0
+}
+
+func (s *derivSession) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// sleep waits for d unless the pool is shut down first.
+func (s *derivSession) sleep(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-s.pool.stop:
+		return false
+	}
+}
+
+// fail marks the session dead, wakes up waiters with err and unregisters it.
+func (s *derivSession) fail(err error) {
+	s.mu.Lock()
+	s.closed = true
+	s.connErr = err
+	select {
+	case <-s.ready:
+	default:
+		close(s.ready)
+	}
+	subs := s.subs
+	s.subs = make(map[int64]*DerivSubscription)
+	s.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.finish()
+	}
+	s.pool.forget(s)
+}
+
+func (s *derivSession) close() {
+	s.mu.Lock()
+	s.closed = true
+	conn := s.conn
+	s.mu.Unlock()
+
+	if conn != nil {
+		conn.Close()
+	}
+	s.fail(ErrDerivPoolClosed)
+}
+
+// Subscribe starts a streaming request (ticks, proposal_open_contract, ...)
+// on the token's session. The initial response is returned in Initial; later
+// updates arrive on C. C is closed when the subscription ends, either through
+// Close or because the session could not be recovered.
+func (p *DerivPool) Subscribe(apiToken string, req map[string]interface{}) (*DerivSubscription, error) {
+	s, err := p.session(apiToken)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.waitReady(p.RequestTimeout); err != nil {
+		return nil, err
+	}
+
+	reqID := s.nextReqID()
+	msg := make(map[string]interface{}, len(req)+2)
+	for k, v := range req {
+		msg[k] = v
+	}
+	msg["subscribe"] = 1
+	msg["req_id"] = reqID
+
+	ch := make(chan []byte, 64)
+	first := make(chan []byte, 1)
+	sub := &DerivSubscription{
+		C:       ch,
+		session: s,
+		reqID:   reqID,
+		request: msg,
+		ch:      ch,
+		first:   first,
+	}
+
+	s.mu.Lock()
+	conn := s.conn
+	if conn == nil {
+		s.mu.Unlock()
+		return nil, ErrDerivConnectionLost
+	}
+	s.subs[reqID] = sub
+	s.lastUsed = time.Now()
+	s.mu.Unlock()
+
+	if err := s.write(conn, msg); err != nil {
+		s.removeSub(reqID)
+		conn.Close()
+		return nil, fmt.Errorf("failed to send subscription: %v", err)
+	}
+
+	select {
+	case raw, ok := <-first:
+		if !ok {
+			return nil, ErrDerivConnectionLost
+		}
+		var env derivEnvelope
+		json.Unmarshal(raw, &env)
+		if env.Error.Code != "" {
+			s.removeSub(reqID)
+			sub.finish()
+			return nil, &DerivAPIError{Code: env.Error.Code, Message: env.Error.Message}
+		}
+		sub.Initial = raw
+		return sub, nil
+	case <-time.After(p.RequestTimeout):
+		s.removeSub(reqID)
+		sub.finish()
+		return nil, ErrDerivRequestTimeout
+	}
+}
+
+func (s *derivSession) removeSub(reqID int64) {
+	s.mu.Lock()
+	delete(s.subs, reqID)
+	s.lastUsed = time.Now()
+	s.mu.Unlock()
+}
+
+// DerivSubscription is a live Deriv stream multiplexed on a pooled session.
+// It survives reconnects: the original request is replayed on the new socket.
+type DerivSubscription struct {
+	Initial []byte
+	C       <-chan []byte
+
+	session *derivSession
+	reqID   int64
+	request map[string]interface{}
+
+	mu    sync.Mutex
+	ch    chan []byte
+	first chan []byte
+	id    string
+	done  bool
+}
+
+// ID returns Deriv's current subscription id, which changes after a reconnect.
+func (sub *DerivSubscription) ID() string {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	return sub.id
+}
+
+// Close forgets the stream upstream and closes C.
+func (sub *DerivSubscription) Close() {
+	sub.session.removeSub(sub.reqID)
+	if id := sub.ID(); id != "" {
+		sub.session.call(map[string]interface{}{"forget": id})
+	}
+	sub.finish()
+}
+
+func (sub *DerivSubscription) setID(id string) {
+	sub.mu.Lock()
+	sub.id = id
+	sub.mu.Unlock()
+}
+
+func (sub *DerivSubscription) deliver(raw []byte) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if sub.done {
+		return
+	}
+	if sub.first != nil {
+		sub.first <- raw
+		sub.first = nil
+		return
+	}
+	select {
+	case sub.ch <- raw:
+	default:
+		// Slow consumer: drop the oldest update rather than stall the session.
+		select {
+		case <-sub.ch:
+		default:
+		}
+		sub.ch <- raw
+	}
+}
+
+func (sub *DerivSubscription) finish() {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if sub.done {
+		return
+	}
+	sub.done = true
+	if sub.first != nil {
+		close(sub.first)
+		sub.first = nil
+	}
+	close(sub.ch)
+}
@@ -0,0 +1,285 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// fakeDeriv is a Deriv WebSocket server. It authorizes any token but
+// "bad", answers time requests after the delay in their passthrough and
+// starts tick streams.
+type fakeDeriv struct {
+	server *httptest.Server
+
+	mu    sync.Mutex
+	conns []*fakeDerivConn
+}
+
+// fakeDerivConn is one client connection and the requests it sent
+type fakeDerivConn struct {
+	ws      *websocket.Conn
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	received []map[string]interface{}
+}
+
+func newFakeDeriv(t *testing.T) *fakeDeriv {
+	f := &fakeDeriv{}
+	upgrader := websocket.Upgrader{}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		conn := &fakeDerivConn{ws: ws}
+		f.mu.Lock()
+		f.conns = append(f.conns, conn)
+		f.mu.Unlock()
+		conn.serve()
+	}))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeDeriv) url() string {
+	return "ws" + strings.TrimPrefix(f.server.URL, "http")
+}
+
+func (f *fakeDeriv) connections() []*fakeDerivConn {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*fakeDerivConn(nil), f.conns...)
+}
+
+func (c *fakeDerivConn) serve() {
+	defer c.ws.Close()
+	for {
+		var req map[string]interface{}
+		if err := c.ws.ReadJSON(&req); err != nil {
+			return
+		}
+		c.mu.Lock()
+		c.received = append(c.received, req)
+		c.mu.Unlock()
+
+		reply := map[string]interface{}{"req_id": req["req_id"]}
+		switch {
+		case req["authorize"] != nil:
+			reply["msg_type"] = "authorize"
+			if req["authorize"] == "bad" {
+				reply["error"] = map[string]string{"code": "InvalidToken", "message": "The token is invalid."}
+			} else {
+				reply["authorize"] = map[string]interface{}{"loginid": "CR" + fmt.Sprint(req["authorize"])}
+			}
+		case req["ticks"] != nil:
+			reply["msg_type"] = "tick"
+			reply["subscription"] = map[string]string{"id": fmt.Sprintf("sub-%v", req["req_id"])}
+			reply["tick"] = map[string]interface{}{"symbol": req["ticks"], "quote": 100.0}
+		case req["time"] != nil:
+			reply["msg_type"] = "time"
+			reply["time"] = 1700000000
+			reply["passthrough"] = req["passthrough"]
+			passthrough, _ := req["passthrough"].(map[string]interface{})
+			delay, _ := passthrough["delay_ms"].(float64)
+			go func() {
+				time.Sleep(time.Duration(delay) * time.Millisecond)
+				c.send(reply)
+			}()
+			continue
+		case req["ping"] != nil:
+			reply["msg_type"] = "ping"
+			reply["ping"] = "pong"
+		default:
+			reply["error"] = map[string]string{"code": "UnrecognisedRequest", "message": "Unrecognised request."}
+		}
+		c.send(reply)
+	}
+}
+
+func (c *fakeDerivConn) send(msg interface{}) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.ws.WriteJSON(msg)
+}
+
+// requests are the requests the client sent on the connection so far
+func (c *fakeDerivConn) requests() []map[string]interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]map[string]interface{}(nil), c.received...)
+}
+
+func newTestPool(t *testing.T, f *fakeDeriv) *DerivPool {
+	pool := NewDerivPool(f.url())
+	pool.RequestTimeout = 5 * time.Second
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+// eventually fails the test unless cond holds within a few seconds
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDerivPoolSharesOneSessionPerToken(t *testing.T) {
+	fake := newFakeDeriv(t)
+	pool := newTestPool(t, fake)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 30)
+	for i := 0; i < 10; i++ {
+		for _, token := range []string{"1", "2", ""} {
+			wg.Add(1)
+			go func(token string) {
+				defer wg.Done()
+				errs <- pool.Call(token, map[string]interface{}{"time": 1}, nil)
+			}(token)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conns := fake.connections()
+	if len(conns) != 3 {
+		t.Fatalf("%d connections for 3 tokens", len(conns))
+	}
+	authorized := map[interface{}]int{}
+	for _, conn := range conns {
+		for _, req := range conn.requests() {
+			if token := req["authorize"]; token != nil {
+				authorized[token]++
+			}
+		}
+	}
+	if authorized["1"] != 1 || authorized["2"] != 1 || len(authorized) != 2 {
+		t.Errorf("authorize requests per token = %v, want one each for 1 and 2", authorized)
+	}
+
+	auth, err := pool.Authorize("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.Authorize.LoginID != "CR1" {
+		t.Errorf("cached authorization is for %q", auth.Authorize.LoginID)
+	}
+	if len(fake.connections()) != 3 {
+		t.Error("Authorize opened another connection")
+	}
+
+	var apiErr *DerivAPIError
+	if err := pool.Call("bad", map[string]interface{}{"time": 1}, nil); !errors.As(err, &apiErr) || apiErr.Code != "InvalidToken" {
+		t.Errorf("call with a rejected token: %v", err)
+	}
+}
+
+func TestDerivPoolRoutesResponsesByReqID(t *testing.T) {
+	fake := newFakeDeriv(t)
+	pool := newTestPool(t, fake)
+
+	// Later requests are answered first
+	const calls = 8
+	var wg sync.WaitGroup
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			var resp struct {
+				ReqID       int64 `json:"req_id"`
+				Passthrough struct {
+					N int `json:"n"`
+				} `json:"passthrough"`
+			}
+			passthrough := map[string]interface{}{"n": n, "delay_ms": (calls - n) * 20}
+			if err := pool.Call("1", map[string]interface{}{"time": 1, "passthrough": passthrough}, &resp); err != nil {
+				t.Error(err)
+				return
+			}
+			if resp.Passthrough.N != n {
+				t.Errorf("call %d got the response to call %d (req_id %d)", n, resp.Passthrough.N, resp.ReqID)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if conns := fake.connections(); len(conns) != 1 {
+		t.Errorf("%d connections for one token", len(conns))
+	}
+}
+
+func TestDerivPoolReauthorizesAfterReconnect(t *testing.T) {
+	fake := newFakeDeriv(t)
+	pool := newTestPool(t, fake)
+
+	sub, err := pool.Subscribe("1", map[string]interface{}{"ticks": "R_100"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	if sub.ID() == "" {
+		t.Fatal("subscription has no id")
+	}
+
+	// Drop the socket under the live subscription
+	first := fake.connections()[0]
+	first.ws.Close()
+	eventually(t, "a second connection", func() bool { return len(fake.connections()) == 2 })
+	second := fake.connections()[1]
+	eventually(t, "the subscription to be restored", func() bool { return len(second.requests()) >= 2 })
+
+	requests := second.requests()
+	if requests[0]["authorize"] != "1" {
+		t.Fatalf("first request after reconnecting was %v, want authorize", requests[0])
+	}
+	if requests[1]["ticks"] != "R_100" {
+		t.Fatalf("second request after reconnecting was %v, want the tick subscription", requests[1])
+	}
+
+	// Updates on the new socket reach the same subscription
+	select {
+	case raw := <-sub.C:
+		var tick struct {
+			Tick struct {
+				Symbol string `json:"symbol"`
+			} `json:"tick"`
+		}
+		json.Unmarshal(raw, &tick)
+		if tick.Tick.Symbol != "R_100" {
+			t.Errorf("update %s", raw)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no update after reconnecting")
+	}
+	if want := fmt.Sprintf("sub-%v", requests[1]["req_id"]); sub.ID() != want {
+		t.Errorf("subscription id is %s after reconnecting, want %s", sub.ID(), want)
+	}
+
+	if err := pool.Call("1", map[string]interface{}{"time": 1}, nil); err != nil {
+		t.Fatalf("call on the reconnected session: %v", err)
+	}
+	if len(fake.connections()) != 2 {
+		t.Error("call after reconnecting opened another connection")
+	}
+}
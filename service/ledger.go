@@ -0,0 +1,383 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Ledger accounts besides one "admin:<id>" account per admin, which holds
+// what the platform owes that admin, and one "user:<id>" account per user
+// who resold a license
+const (
+	AccountProcessor = "processor" // money collected through the payment providers
+	AccountRevenue   = "revenue"   // the platform's commission
+	AccountPayouts   = "payouts"   // withdrawals held while being paid out
+	AccountRefunds   = "refunds"   // charges that bought nothing, owed back to the payer
+)
+
+var (
+	ErrInsufficientBalance = errors.New("amount is more than the available balance")
+	ErrNoBankDetails       = errors.New("add bank details before requesting a withdrawal")
+	ErrNoPhoneNumber       = errors.New("add a phone number before requesting an M-Pesa withdrawal")
+	ErrWithdrawalNotFound  = errors.New("withdrawal not found")
+	ErrWithdrawalReviewed  = errors.New("withdrawal has already been reviewed")
+)
+
+// AdminAccount is the ledger account of what the platform owes adminID
+func AdminAccount(adminID uint) string {
+	return fmt.Sprintf("admin:%d", adminID)
+}
+
+// UserAccount is the ledger account of what the platform owes userID for
+// their license resales
+func UserAccount(userID uint) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// payeeAccount is the account the part of transaction beyond the
+// platform's commission is owed to: the seller's for a resale, else the
+// admin's. It is "" when the platform keeps everything.
+func payeeAccount(transaction models.Transaction) (account string, adminID uint) {
+	switch {
+	case transaction.SellerID != nil:
+		return UserAccount(*transaction.SellerID), 0
+	case transaction.AdminID != 0:
+		return AdminAccount(transaction.AdminID), transaction.AdminID
+	}
+	return "", 0
+}
+
+// withdrawalAccount is the account a withdrawal is paid from
+func withdrawalAccount(withdrawal models.Withdrawal) string {
+	if withdrawal.UserID != 0 {
+		return UserAccount(withdrawal.UserID)
+	}
+	return AdminAccount(withdrawal.AdminID)
+}
+
+// ledgerLeg is one side of a journal
+type ledgerLeg struct {
+	account string
+	adminID uint
+	debit   float64
+	credit  float64
+}
+
+func debit(account string, adminID uint, amount float64) ledgerLeg {
+	return ledgerLeg{account: account, adminID: adminID, debit: roundMoney(amount)}
+}
+
+func credit(account string, adminID uint, amount float64) ledgerLeg {
+	return ledgerLeg{account: account, adminID: adminID, credit: roundMoney(amount)}
+}
+
+// postJournal writes a balanced journal inside tx. The journal ID makes it
+// idempotent: posting the same journal again changes nothing.
+func postJournal(tx *gorm.DB, journalID, entryType, description string, transactionID, withdrawalID *uint, legs ...ledgerLeg) error {
+	var debits, credits float64
+	entries := make([]models.LedgerEntry, 0, len(legs))
+	for _, leg := range legs {
+		if leg.debit == 0 && leg.credit == 0 {
+			continue
+		}
+		debits += leg.debit
+		credits += leg.credit
+		entry := models.LedgerEntry{
+			JournalID:     journalID,
+			Account:       leg.account,
+			EntryType:     entryType,
+			Debit:         leg.debit,
+			Credit:        leg.credit,
+			TransactionID: transactionID,
+			WithdrawalID:  withdrawalID,
+			Description:   description,
+			CreatedAt:     time.Now(),
+		}
+		if leg.adminID != 0 {
+			adminID := leg.adminID
+			entry.AdminID = &adminID
+		}
+		entries = append(entries, entry)
+	}
+	if roundMoney(debits) != roundMoney(credits) {
+		return fmt.Errorf("journal %s does not balance: debits %.2f, credits %.2f", journalID, debits, credits)
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&entries).Error
+}
+
+// PostSettlement books a settled charge inside tx: the amount collected
+// against the platform's commission and the earnings of the admin, or of the
+// seller of a resale. When Paystack split the admin's share straight to
+// their subaccount, that share is booked as paid out at once.
+func PostSettlement(tx *gorm.DB, transaction models.Transaction) error {
+	entryType := map[string]string{"purchase": "sale", "rent": "rental"}[transaction.PaymentType]
+	if entryType == "" {
+		entryType = transaction.PaymentType
+	}
+	transactionID := transaction.ID
+	payee, adminID := payeeAccount(transaction)
+	companyShare := transaction.CompanyShare
+	if payee == "" {
+		companyShare = transaction.Amount
+	}
+
+	legs := []ledgerLeg{
+		debit(AccountProcessor, 0, transaction.Amount),
+		credit(AccountRevenue, 0, companyShare),
+	}
+	if payee != "" {
+		legs = append(legs, credit(payee, adminID, transaction.Amount-companyShare))
+	}
+	description := fmt.Sprintf("%s %s", entryType, transaction.Reference)
+	if err := postJournal(tx, "settle:"+transaction.Reference, entryType, description, &transactionID, nil, legs...); err != nil {
+		return err
+	}
+
+	if transaction.Subaccount == "" || transaction.AdminID == 0 || transaction.AdminShare <= 0 {
+		return nil
+	}
+	return postJournal(tx, "split:"+transaction.Reference, "split_payout",
+		fmt.Sprintf("paid to subaccount %s", transaction.Subaccount), &transactionID, nil,
+		debit(AdminAccount(transaction.AdminID), transaction.AdminID, transaction.AdminShare),
+		credit(AccountProcessor, 0, transaction.AdminShare))
+}
+
+// PostUnfulfilled books amount collected by a transaction that could not be
+// fulfilled inside tx as owed back to the payer
+func PostUnfulfilled(tx *gorm.DB, transaction models.Transaction, amount float64) error {
+	transactionID := transaction.ID
+	return postJournal(tx, "settle:"+transaction.Reference, "unfulfilled",
+		fmt.Sprintf("unfulfilled %s", transaction.Reference), &transactionID, nil,
+		debit(AccountProcessor, 0, amount),
+		credit(AccountRefunds, 0, amount))
+}
+
+// AccountBalance is what is owed on a liability or revenue account: its
+// credits less its debits
+func AccountBalance(db *gorm.DB, account string, before *time.Time) (float64, error) {
+	var balance float64
+	query := db.Model(&models.LedgerEntry{}).Where("account = ?", account)
+	if before != nil {
+		query = query.Where("created_at < ?", *before)
+	}
+	err := query.Select("COALESCE(SUM(credit - debit), 0)").Scan(&balance).Error
+	return roundMoney(balance), err
+}
+
+// RequestWithdrawal holds amount of the admin's balance for a payout through
+// channel, "Paystack" to their bank account or "M-Pesa" to their phone,
+// which a superadmin then approves or rejects
+func RequestWithdrawal(admin models.Admin, amount float64, channel string) (*models.Withdrawal, error) {
+	hasBank := admin.BankCode != "" && admin.AccountNumber != "" && admin.AccountName != ""
+	return requestWithdrawal(models.Withdrawal{AdminID: admin.ID}, amount, channel, hasBank, admin.PhoneNumber != 0)
+}
+
+// RequestUserWithdrawal is RequestWithdrawal for what a user's license
+// resales earned, paid to the payout details on their profile
+func RequestUserWithdrawal(user models.User, amount float64, channel string) (*models.Withdrawal, error) {
+	hasBank := user.BankCode != "" && user.AccountNumber != "" && user.AccountName != ""
+	return requestWithdrawal(models.Withdrawal{UserID: user.ID}, amount, channel, hasBank, user.PhoneNumber != "")
+}
+
+func requestWithdrawal(withdrawal models.Withdrawal, amount float64, channel string, hasBank, hasPhone bool) (*models.Withdrawal, error) {
+	amount = roundMoney(amount)
+	if amount <= 0 {
+		return nil, errors.New("amount must be positive")
+	}
+	switch strings.NewReplacer("-", "", "_", "", " ", "").Replace(strings.ToLower(channel)) {
+	case "", "paystack":
+		channel = "Paystack"
+		if !hasBank {
+			return nil, ErrNoBankDetails
+		}
+	case "mpesa":
+		channel = "M-Pesa"
+		if !hasPhone {
+			return nil, ErrNoPhoneNumber
+		}
+	default:
+		return nil, fmt.Errorf("withdrawals cannot be paid out through %q", channel)
+	}
+
+	account := withdrawalAccount(withdrawal)
+	withdrawal.Amount, withdrawal.Status, withdrawal.PayoutChannel = amount, "pending", channel
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		balance, err := AccountBalance(tx, account, nil)
+		if err != nil {
+			return err
+		}
+		if amount > balance {
+			return ErrInsufficientBalance
+		}
+		if err := tx.Create(&withdrawal).Error; err != nil {
+			return err
+		}
+		return postJournal(tx, fmt.Sprintf("withdrawal:%d", withdrawal.ID), "withdrawal",
+			fmt.Sprintf("withdrawal %d requested", withdrawal.ID), nil, &withdrawal.ID,
+			debit(account, withdrawal.AdminID, amount),
+			credit(AccountPayouts, 0, amount))
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[Ledger] %s requested withdrawal %d of %.2f through %s", account, withdrawal.ID, amount, channel)
+	return &withdrawal, nil
+}
+
+// ClaimWithdrawal moves a pending withdrawal to processing for reviewerID,
+// so only one superadmin pays it out
+func ClaimWithdrawal(withdrawalID, reviewerID uint) (*models.Withdrawal, error) {
+	now := time.Now()
+	result := database.DB.Model(&models.Withdrawal{}).
+		Where("id = ? AND status = ?", withdrawalID, "pending").
+		Updates(map[string]interface{}{"status": "processing", "reviewed_by": reviewerID, "reviewed_at": &now})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	var withdrawal models.Withdrawal
+	if err := database.DB.First(&withdrawal, withdrawalID).Error; err != nil {
+		return nil, ErrWithdrawalNotFound
+	}
+	if result.RowsAffected == 0 {
+		return &withdrawal, ErrWithdrawalReviewed
+	}
+	return &withdrawal, nil
+}
+
+// RejectWithdrawal turns down a pending withdrawal and returns the held
+// amount to the balance it came from
+func RejectWithdrawal(withdrawalID, reviewerID uint, note string) (*models.Withdrawal, error) {
+	var withdrawal models.Withdrawal
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&withdrawal, withdrawalID).Error; err != nil {
+			return ErrWithdrawalNotFound
+		}
+		now := time.Now()
+		result := tx.Model(&withdrawal).Where("status = ?", "pending").Updates(map[string]interface{}{
+			"status":      "rejected",
+			"reviewed_by": reviewerID,
+			"reviewed_at": &now,
+			"review_note": note,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrWithdrawalReviewed
+		}
+		return releaseWithdrawal(tx, withdrawal, "rejected")
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[Ledger] withdrawal %d rejected by %d", withdrawal.ID, reviewerID)
+	return &withdrawal, nil
+}
+
+// CompleteWithdrawal books a paid out withdrawal, or returns the held amount
+// to its balance when the transfer failed. Only a processing withdrawal
+// changes.
+func CompleteWithdrawal(withdrawalID uint, paid bool, reason string) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var withdrawal models.Withdrawal
+		if err := tx.First(&withdrawal, withdrawalID).Error; err != nil {
+			return ErrWithdrawalNotFound
+		}
+		if withdrawal.Status != "processing" {
+			return nil
+		}
+
+		if !paid {
+			if err := tx.Model(&withdrawal).Updates(map[string]interface{}{"status": "failed", "failure_reason": reason}).Error; err != nil {
+				return err
+			}
+			log.Printf("[Ledger] withdrawal %d failed: %s", withdrawal.ID, reason)
+			return releaseWithdrawal(tx, withdrawal, "failed")
+		}
+
+		now := time.Now()
+		if err := tx.Model(&withdrawal).Updates(map[string]interface{}{"status": "paid", "paid_at": &now}).Error; err != nil {
+			return err
+		}
+		log.Printf("[Ledger] withdrawal %d of %.2f paid to %s", withdrawal.ID, withdrawal.Amount, withdrawalAccount(withdrawal))
+		return postJournal(tx, fmt.Sprintf("withdrawal:%d:paid", withdrawal.ID), "withdrawal_paid",
+			fmt.Sprintf("withdrawal %d paid", withdrawal.ID), nil, &withdrawal.ID,
+			debit(AccountPayouts, 0, withdrawal.Amount),
+			credit(AccountProcessor, 0, withdrawal.Amount))
+	})
+}
+
+// ReverseWithdrawal returns a paid withdrawal the payout channel took back
+// to the balance it was paid from. Only a paid withdrawal changes.
+func ReverseWithdrawal(withdrawalID uint, reason string) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var withdrawal models.Withdrawal
+		if err := tx.First(&withdrawal, withdrawalID).Error; err != nil {
+			return ErrWithdrawalNotFound
+		}
+		result := tx.Model(&withdrawal).Where("status = ?", "paid").
+			Updates(map[string]interface{}{"status": "reversed", "failure_reason": reason})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		log.Printf("[Ledger] withdrawal %d of %.2f reversed: %s", withdrawal.ID, withdrawal.Amount, reason)
+		return postJournal(tx, fmt.Sprintf("withdrawal:%d:reversed", withdrawal.ID), "withdrawal_release",
+			fmt.Sprintf("withdrawal %d reversed", withdrawal.ID), nil, &withdrawal.ID,
+			debit(AccountProcessor, 0, withdrawal.Amount),
+			credit(withdrawalAccount(withdrawal), withdrawal.AdminID, withdrawal.Amount))
+	})
+}
+
+func releaseWithdrawal(tx *gorm.DB, withdrawal models.Withdrawal, why string) error {
+	return postJournal(tx, fmt.Sprintf("withdrawal:%d:release", withdrawal.ID), "withdrawal_release",
+		fmt.Sprintf("withdrawal %d %s", withdrawal.ID, why), nil, &withdrawal.ID,
+		debit(AccountPayouts, 0, withdrawal.Amount),
+		credit(withdrawalAccount(withdrawal), withdrawal.AdminID, withdrawal.Amount))
+}
+
+// LedgerStatement is an admin's account for one month
+type LedgerStatement struct {
+	Month          string               `json:"month"` // "2006-01"
+	OpeningBalance float64              `json:"opening_balance"`
+	Credits        float64              `json:"credits"`
+	Debits         float64              `json:"debits"`
+	ClosingBalance float64              `json:"closing_balance"`
+	Entries        []models.LedgerEntry `json:"entries"`
+}
+
+// AdminStatement lists the entries of adminID's account in the month
+// starting at month
+func AdminStatement(adminID uint, month time.Time) (*LedgerStatement, error) {
+	start := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, month.Location())
+	end := start.AddDate(0, 1, 0)
+	account := AdminAccount(adminID)
+
+	opening, err := AccountBalance(database.DB, account, &start)
+	if err != nil {
+		return nil, err
+	}
+	statement := &LedgerStatement{Month: start.Format("2006-01"), OpeningBalance: opening}
+	if err := database.DB.Where("account = ? AND created_at >= ? AND created_at < ?", account, start, end).
+		Order("created_at ASC, id ASC").Find(&statement.Entries).Error; err != nil {
+		return nil, err
+	}
+	for _, entry := range statement.Entries {
+		statement.Credits += entry.Credit
+		statement.Debits += entry.Debit
+	}
+	statement.Credits = roundMoney(statement.Credits)
+	statement.Debits = roundMoney(statement.Debits)
+	statement.ClosingBalance = roundMoney(opening + statement.Credits - statement.Debits)
+	return statement, nil
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	"gorm.io/gorm"
+)
+
+// LicenseHold is how long a purchase still in checkout keeps its seat, and
+// a resale in checkout its listing
+const LicenseHold = 30 * time.Minute
+
+var (
+	ErrSoldOut            = errors.New("all licenses for this bot have been sold")
+	ErrBotReserved        = errors.New("someone else is already buying this bot")
+	ErrResaleNotAllowed   = errors.New("this license cannot be resold")
+	ErrListingNotFound    = errors.New("listing not found")
+	ErrListingUnavailable = errors.New("this license is no longer for sale")
+	ErrListingReserved    = errors.New("someone else is already buying this license")
+)
+
+// LicensesIssued counts the purchase licenses granted on bot, leaving out
+// its owner
+func LicensesIssued(db *gorm.DB, bot models.Bot) (int64, error) {
+	var issued int64
+	err := db.Model(&models.UserBot{}).
+		Where("bot_id = ? AND access_type = ? AND user_id <> ?", bot.ID, "purchase", bot.OwnerID).
+		Count(&issued).Error
+	return issued, err
+}
+
+// CheckLicenseAvailable fails when a new purchase of bot cannot start: every
+// seat of a limited bot is issued or held by a checkout, or someone is
+// already buying an exclusive bot
+func CheckLicenseAvailable(bot models.Bot) error {
+	var held int64
+	if err := database.DB.Model(&models.Transaction{}).
+		Where("bot_id = ? AND payment_type = ? AND status = ? AND created_at > ?",
+			bot.ID, "purchase", "pending", time.Now().Add(-LicenseHold)).
+		Count(&held).Error; err != nil {
+		return err
+	}
+
+	if bot.ExclusiveSale {
+		if held > 0 {
+			return ErrBotReserved
+		}
+		return nil
+	}
+	if bot.MaxLicenses <= 0 {
+		return nil
+	}
+	issued, err := LicensesIssued(database.DB, bot)
+	if err != nil {
+		return err
+	}
+	if issued+held >= int64(bot.MaxLicenses) {
+		return ErrSoldOut
+	}
+	return nil
+}
+
+// ListLicenseForResale offers the user's purchased license for price. The
+// license must have been granted while the bot allowed resale.
+func ListLicenseForResale(userID, userBotID uint, price float64) (*models.LicenseListing, error) {
+	if price <= 0 {
+		return nil, errors.New("price must be positive")
+	}
+
+	var userBot models.UserBot
+	if err := database.DB.Where("id = ? AND user_id = ?", userBotID, userID).First(&userBot).Error; err != nil {
+		return nil, ErrNoBotAccess
+	}
+	if userBot.AccessType != "purchase" || !userBot.IsActive || !userBot.ResaleAllowed {
+		return nil, ErrResaleNotAllowed
+	}
+
+	var open int64
+	database.DB.Model(&models.LicenseListing{}).
+		Where("user_bot_id = ? AND status = ?", userBot.ID, "listed").Count(&open)
+	if open > 0 {
+		return nil, errors.New("this license is already listed")
+	}
+
+	listing := models.LicenseListing{
+		UserBotID: userBot.ID,
+		BotID:     userBot.BotID,
+		SellerID:  userID,
+		Price:     price,
+		Status:    "listed",
+	}
+	if err := database.DB.Create(&listing).Error; err != nil {
+		return nil, err
+	}
+	log.Printf("[Licenses] user %d listed their license of bot %d for %.2f", userID, userBot.BotID, price)
+	return &listing, nil
+}
+
+// CancelResaleListing withdraws one of the user's open listings
+func CancelResaleListing(userID, listingID uint) error {
+	result := database.DB.Model(&models.LicenseListing{}).
+		Where("id = ? AND seller_id = ? AND status = ?", listingID, userID, "listed").
+		Update("status", "cancelled")
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrListingNotFound
+	}
+	return nil
+}
+
+// OpenResaleListing returns a listing that can still be bought and that
+// no other checkout holds
+func OpenResaleListing(listingID uint) (*models.LicenseListing, error) {
+	var listing models.LicenseListing
+	if err := database.DB.First(&listing, listingID).Error; err != nil {
+		return nil, ErrListingNotFound
+	}
+	if listing.Status != "listed" {
+		return nil, ErrListingUnavailable
+	}
+
+	var held int64
+	if err := database.DB.Model(&models.Transaction{}).
+		Where("listing_id = ? AND payment_type = ? AND status = ? AND created_at > ?",
+			listing.ID, "resale", "pending", time.Now().Add(-LicenseHold)).
+		Count(&held).Error; err != nil {
+		return nil, err
+	}
+	if held > 0 {
+		return nil, ErrListingReserved
+	}
+	return &listing, nil
+}
+
+// TransferLicense completes a resale inside tx: the listed license moves to
+// the buyer of transaction, replacing any access the buyer already had
+func TransferLicense(tx *gorm.DB, transaction models.Transaction) (*models.LicenseListing, error) {
+	if transaction.ListingID == nil {
+		return nil, ErrListingNotFound
+	}
+	var listing models.LicenseListing
+	if err := tx.First(&listing, *transaction.ListingID).Error; err != nil {
+		return nil, ErrListingNotFound
+	}
+	if listing.Status != "listed" {
+		return nil, ErrListingUnavailable
+	}
+
+	if err := tx.Where("user_id = ? AND bot_id = ? AND id <> ?", transaction.UserID, listing.BotID, listing.UserBotID).
+		Delete(&models.UserBot{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Model(&models.UserBot{}).Where("id = ?", listing.UserBotID).Updates(map[string]interface{}{
+		"user_id":        transaction.UserID,
+		"transaction_id": transaction.ID,
+		"price":          transaction.Amount,
+		"purchase_date":  time.Now(),
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	if err := tx.Model(&listing).Updates(map[string]interface{}{
+		"status":         "sold",
+		"buyer_id":       transaction.UserID,
+		"transaction_id": transaction.ID,
+	}).Error; err != nil {
+		return nil, err
+	}
+	// A resold license leaves the seller's copy subscription without access
+	tx.Model(&models.CopySubscription{}).
+		Where("follower_id = ? AND bot_id = ?", listing.SellerID, listing.BotID).Update("active", false)
+
+	log.Printf("[Licenses] license of bot %d resold by user %d to user %d", listing.BotID, listing.SellerID, transaction.UserID)
+	return &listing, nil
+}
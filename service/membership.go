@@ -0,0 +1,53 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/keyadaniel56/algocdk/internal/models"
+	"gorm.io/gorm"
+)
+
+// FreeMembership is the tier every user starts on
+const FreeMembership = "freemium"
+
+var ErrTierNotOffered = errors.New("this membership tier is not offered")
+
+// MembershipPrice is the monthly price of a paid tier, configured as
+// <TIER>_MEMBERSHIP_PRICE, e.g. PREMIUM_MEMBERSHIP_PRICE
+func MembershipPrice(tier string) (float64, error) {
+	if tier == "" || strings.EqualFold(tier, FreeMembership) {
+		return 0, ErrTierNotOffered
+	}
+	price, err := strconv.ParseFloat(os.Getenv(strings.ToUpper(tier)+"_MEMBERSHIP_PRICE"), 64)
+	if err != nil || price <= 0 {
+		return 0, ErrTierNotOffered
+	}
+	return price, nil
+}
+
+// ExtendMembership puts userID on tier for days more inside tx, counted
+// from the current expiry while it has not passed
+func ExtendMembership(tx *gorm.DB, userID uint, tier string, days int) (time.Time, error) {
+	var user models.User
+	if err := tx.First(&user, userID).Error; err != nil {
+		return time.Time{}, err
+	}
+	from := time.Now()
+	if user.Membership == tier && user.SubscriptionExpiry.After(from) {
+		from = user.SubscriptionExpiry
+	}
+	expiry := from.AddDate(0, 0, days)
+	if err := tx.Model(&user).Updates(map[string]interface{}{
+		"membership":          tier,
+		"subscription_expiry": expiry,
+	}).Error; err != nil {
+		return time.Time{}, err
+	}
+	log.Printf("[Membership] user %d on %s until %s", userID, tier, expiry.Format(time.RFC3339))
+	return expiry, nil
+}
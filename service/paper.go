@@ -0,0 +1,321 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	"gorm.io/gorm"
+)
+
+// ErrInsufficientPaperBalance is returned when a paper stake exceeds the
+// virtual balance.
+var ErrInsufficientPaperBalance = errors.New("insufficient paper balance")
+
+// paperTickWindow is the span of tick history, in seconds, fetched per
+// request while following a trade. Deriv answers a range holding more ticks
+// than it sends with the latest of them, and no symbol ticks more than once
+// a second, so a window this short never drops the entry tick.
+const paperTickWindow = 3600
+
+// PaperEngine simulates fills and settlement of Deriv contracts against live
+// tick data. Stakes and payouts move a per-user virtual balance and every
+// movement is written to the paper ledger; nothing is sent to Deriv except
+// public pricing and tick history requests.
+type PaperEngine struct {
+	deriv           *DerivService
+	PollInterval    time.Duration
+	StartingBalance float64
+
+	mu     sync.Mutex
+	active map[uint]bool
+}
+
+// NewPaperEngine creates a paper engine that prices contracts through deriv.
+func NewPaperEngine(deriv *DerivService) *PaperEngine {
+	return &PaperEngine{
+		deriv:           deriv,
+		PollInterval:    2 * time.Second,
+		StartingBalance: 10000,
+		active:          make(map[uint]bool),
+	}
+}
+
+// Account returns the user's paper account, opening one funded with
+// StartingBalance on first use.
+func (e *PaperEngine) Account(userID uint) (*models.PaperAccount, error) {
+	var account models.PaperAccount
+	err := database.DB.Where("user_id = ?", userID).First(&account).Error
+	if err == nil {
+		return &account, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	account = models.PaperAccount{
+		UserID:          userID,
+		Balance:         e.StartingBalance,
+		StartingBalance: e.StartingBalance,
+		Currency:        "USD",
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&account).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.PaperLedgerEntry{
+			AccountID:    account.ID,
+			EntryType:    "deposit",
+			Amount:       account.Balance,
+			BalanceAfter: account.Balance,
+			Description:  "Opening paper balance",
+		}).Error
+	})
+	if err != nil {
+		// Lost a race with a concurrent request creating the same account
+		if lookupErr := database.DB.Where("user_id = ?", userID).First(&account).Error; lookupErr == nil {
+			return &account, nil
+		}
+		return nil, err
+	}
+	return &account, nil
+}
+
+// Reset restores the account to its starting balance. Open paper trades
+// still settle against the reset balance.
+func (e *PaperEngine) Reset(userID uint) (*models.PaperAccount, error) {
+	account, err := e.Account(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(account).Update("balance", account.StartingBalance).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.PaperLedgerEntry{
+			AccountID:    account.ID,
+			EntryType:    "reset",
+			Amount:       account.StartingBalance - account.Balance,
+			BalanceAfter: account.StartingBalance,
+			Description:  "Balance reset",
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	account.Balance = account.StartingBalance
+	return account, nil
+}
+
+// PlaceTrade opens a paper trade: the contract is priced by Deriv, the stake
+// is debited from the virtual balance and settlement starts in the
+// background. Only contracts with a fixed expiry can be paper traded.
+func (e *PaperEngine) PlaceTrade(userID uint, req models.DerivContractRequest) (*models.PaperTrade, error) {
+	if err := req.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid contract: %v", err)
+	}
+	if !req.HasFixedExpiry() {
+		return nil, fmt.Errorf("%w: %s", ErrSimulationUnsupported, req.ContractType)
+	}
+
+	account, err := e.Account(userID)
+	if err != nil {
+		return nil, err
+	}
+	req.Currency = account.Currency
+
+	// Price the contract exactly as a real buy would be priced
+	proposal, err := e.deriv.GetProposal("", req)
+	if err != nil {
+		return nil, err
+	}
+
+	trade := models.PaperTrade{
+		UserID:       userID,
+		BotID:        req.BotID,
+		Symbol:       req.Symbol,
+		TradeType:    req.ContractType,
+		Basis:        req.Basis,
+		Currency:     account.Currency,
+		Duration:     req.Duration,
+		DurationUnit: req.DurationUnit,
+		Barrier:      req.Barrier,
+		Barrier2:     req.Barrier2,
+		Prediction:   req.Prediction,
+		Stake:        proposal.AskPrice,
+		Payout:       proposal.Payout,
+		Status:       "open",
+		OpenTime:     time.Now(),
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.PaperAccount{}).
+			Where("id = ? AND balance >= ?", account.ID, trade.Stake).
+			Update("balance", gorm.Expr("balance - ?", trade.Stake))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInsufficientPaperBalance
+		}
+
+		if err := tx.Create(&trade).Error; err != nil {
+			return err
+		}
+		return e.ledger(tx, account.ID, &trade.ID, "stake", -trade.Stake,
+			fmt.Sprintf("Stake for %s %s", trade.TradeType, trade.Symbol))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	e.follow(trade)
+	return &trade, nil
+}
+
+// Resume restarts settlement of paper trades that were open when the server
+// last stopped.
+func (e *PaperEngine) Resume() {
+	var trades []models.PaperTrade
+	if err := database.DB.Where("status = ?", "open").Find(&trades).Error; err != nil {
+		log.Printf("[Paper] failed to load open paper trades: %v", err)
+		return
+	}
+	for _, trade := range trades {
+		e.follow(trade)
+	}
+	log.Printf("[Paper] resumed settlement of %d open paper trades", len(trades))
+}
+
+// follow pages through tick history from the trade's start, then polls for
+// new ticks until the trade reaches a final outcome.
+func (e *PaperEngine) follow(trade models.PaperTrade) {
+	e.mu.Lock()
+	if e.active[trade.ID] {
+		e.mu.Unlock()
+		return
+	}
+	e.active[trade.ID] = true
+	e.mu.Unlock()
+
+	go func() {
+		defer func() {
+			e.mu.Lock()
+			delete(e.active, trade.ID)
+			e.mu.Unlock()
+		}()
+
+		contract := trade.Contract()
+		start := trade.OpenTime.Unix()
+
+		// Timed contracts cannot settle before expiry unless they are
+		// path dependent, so there is no point polling much earlier.
+		if contract.DurationUnit != "t" && !settlesEarly(contract.ContractType) {
+			expiry := trade.OpenTime.Add(time.Duration(durationSeconds(contract.Duration, contract.DurationUnit)) * time.Second)
+			time.Sleep(time.Until(expiry))
+		}
+
+		var ticks []Tick
+		pipSize := 0
+		from := start
+		for {
+			to := from + paperTickWindow
+			caughtUp := to >= time.Now().Unix()
+			if caughtUp {
+				to = 0
+			}
+			page, pip, err := e.deriv.TickHistory(contract.Symbol, from, to, 5000)
+			if err != nil {
+				log.Printf("[Paper] tick history for trade %d failed: %v", trade.ID, err)
+				time.Sleep(e.PollInterval)
+				continue
+			}
+			if pip > 0 {
+				pipSize = pip
+			}
+			ticks = append(ticks, page...)
+			if !caughtUp {
+				from = to + 1
+			} else if len(page) > 0 {
+				from = page[len(page)-1].Epoch + 1
+			}
+
+			outcome, done, err := SimulateContract(contract, start, ticks, pipSize)
+			if err != nil {
+				log.Printf("[Paper] cannot settle trade %d: %v", trade.ID, err)
+				return
+			}
+			if done {
+				if err := e.settle(trade, outcome); err != nil {
+					log.Printf("[Paper] failed to settle trade %d: %v", trade.ID, err)
+					time.Sleep(e.PollInterval)
+					continue
+				}
+				return
+			}
+			if caughtUp {
+				time.Sleep(e.PollInterval)
+			}
+		}
+	}()
+}
+
+// settle records the outcome and credits the payout of a winning trade.
+func (e *PaperEngine) settle(trade models.PaperTrade, outcome *SimulatedOutcome) error {
+	status := "lost"
+	profit := -trade.Stake
+	if outcome.Won {
+		status = "won"
+		profit = trade.Payout - trade.Stake
+	}
+	closeTime := time.Unix(outcome.ExitEpoch, 0)
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.PaperTrade{}).
+			Where("id = ? AND status = ?", trade.ID, "open").
+			Updates(map[string]interface{}{
+				"status":      status,
+				"entry_spot":  outcome.EntrySpot,
+				"exit_spot":   outcome.ExitSpot,
+				"profit_loss": profit,
+				"close_time":  closeTime,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 || !outcome.Won {
+			return nil
+		}
+
+		var account models.PaperAccount
+		if err := tx.Where("user_id = ?", trade.UserID).First(&account).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&account).Update("balance", gorm.Expr("balance + ?", trade.Payout)).Error; err != nil {
+			return err
+		}
+		return e.ledger(tx, account.ID, &trade.ID, "payout", trade.Payout,
+			fmt.Sprintf("Payout for %s %s", trade.TradeType, trade.Symbol))
+	})
+}
+
+// ledger appends an entry using the balance as it stands inside tx.
+func (e *PaperEngine) ledger(tx *gorm.DB, accountID uint, tradeID *uint, entryType string, amount float64, description string) error {
+	var account models.PaperAccount
+	if err := tx.First(&account, accountID).Error; err != nil {
+		return err
+	}
+	return tx.Create(&models.PaperLedgerEntry{
+		AccountID:    accountID,
+		PaperTradeID: tradeID,
+		EntryType:    entryType,
+		Amount:       amount,
+		BalanceAfter: account.Balance,
+		Description:  description,
+	}).Error
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"github.com/keyadaniel56/algocdk/internal/models"
+)
+
+// proposalCache remembers recent proposals per API token so a buy by
+// proposal ID can be checked against what was quoted, and so one user can
+// never buy a proposal quoted for somebody else.
+type proposalCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cachedProposal
+}
+
+type cachedProposal struct {
+	apiToken  string
+	proposal  models.DerivProposal
+	expiresAt time.Time
+}
+
+func newProposalCache(ttl time.Duration) *proposalCache {
+	return &proposalCache{
+		ttl:     ttl,
+		entries: make(map[string]cachedProposal),
+	}
+}
+
+func (c *proposalCache) put(apiToken string, proposal *models.DerivProposal) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for id, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, id)
+		}
+	}
+	c.entries[proposal.ProposalID] = cachedProposal{
+		apiToken:  apiToken,
+		proposal:  *proposal,
+		expiresAt: now.Add(c.ttl),
+	}
+}
+
+// peek returns the proposal if it is still valid for apiToken, leaving it
+// in the cache.
+func (c *proposalCache) peek(apiToken, proposalID string) (*models.DerivProposal, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[proposalID]
+	if !ok || entry.apiToken != apiToken || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	proposal := entry.proposal
+	return &proposal, true
+}
+
+// take removes and returns the proposal if it is still valid for apiToken.
+func (c *proposalCache) take(apiToken, proposalID string) (*models.DerivProposal, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[proposalID]
+	if !ok || entry.apiToken != apiToken {
+		return nil, false
+	}
+	delete(c.entries, proposalID)
+	if time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	return &entry.proposal, true
+}
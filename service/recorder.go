@@ -0,0 +1,260 @@
+package services
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	"gorm.io/gorm/clause"
+)
+
+// MarketRecorder persists live ticks for a list of symbols and rolls them
+// up into candles. It listens through a TickHub, so recording shares the
+// upstream subscription with WebSocket clients. Stored data feeds the candle
+// cache and can be exported.
+type MarketRecorder struct {
+	hub           *TickHub
+	Symbols       []string
+	Granularities []int
+	FlushInterval time.Duration
+
+	// MaxTickGap is the longest silence still treated as a continuous
+	// stream. Longer gaps (reconnects, closed markets) are not claimed as
+	// recorded and the candle spanning them is discarded.
+	MaxTickGap time.Duration
+
+	// TickRetention is how long raw ticks are kept. CandleRetention does the
+	// same per granularity; granularities not listed are kept forever.
+	TickRetention   time.Duration
+	CandleRetention map[int]time.Duration
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewMarketRecorder creates a recorder for symbols with 1m, 5m and 1h
+// candles and a 7 day tick retention.
+func NewMarketRecorder(hub *TickHub, symbols []string) *MarketRecorder {
+	return &MarketRecorder{
+		hub:             hub,
+		Symbols:         symbols,
+		Granularities:   []int{60, 300, 3600},
+		FlushInterval:   5 * time.Second,
+		MaxTickGap:      30 * time.Second,
+		TickRetention:   7 * 24 * time.Hour,
+		CandleRetention: map[int]time.Duration{},
+	}
+}
+
+// Start begins recording every symbol and the hourly retention sweep.
+func (r *MarketRecorder) Start() {
+	r.stop = make(chan struct{})
+	for _, symbol := range r.Symbols {
+		r.wg.Add(1)
+		go r.record(symbol)
+	}
+	r.wg.Add(1)
+	go r.retain()
+	log.Printf("[Recorder] recording %d symbols", len(r.Symbols))
+}
+
+// Stop ends recording after flushing what has been buffered.
+func (r *MarketRecorder) Stop() {
+	if r.stop == nil {
+		return
+	}
+	close(r.stop)
+	r.wg.Wait()
+}
+
+// symbolRecording is the per-symbol state between flushes
+type symbolRecording struct {
+	symbol       string
+	pending      []models.TickRecord
+	forming      map[int]*models.Candle
+	partial      map[int]bool // forming candle started mid-bucket or spans a gap
+	closed       []models.Candle
+	segmentStart int64
+	lastEpoch    int64
+}
+
+func (r *MarketRecorder) record(symbol string) {
+	defer r.wg.Done()
+
+	ticks := make(chan MarketTick, 1024)
+	for {
+		err := r.hub.Subscribe(symbol, ticks)
+		if err == nil {
+			break
+		}
+		r.hub.Unsubscribe(symbol, ticks)
+		log.Printf("[Recorder] cannot subscribe to %s: %v", symbol, err)
+		select {
+		case <-r.stop:
+			return
+		case <-time.After(time.Minute):
+		}
+	}
+	defer r.hub.Unsubscribe(symbol, ticks)
+
+	rec := &symbolRecording{
+		symbol:  symbol,
+		forming: make(map[int]*models.Candle),
+		partial: make(map[int]bool),
+	}
+	flush := time.NewTicker(r.FlushInterval)
+	defer flush.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			r.flush(rec)
+			return
+		case tick := <-ticks:
+			r.add(rec, tick)
+		case <-flush.C:
+			r.flush(rec)
+		}
+	}
+}
+
+func (r *MarketRecorder) add(rec *symbolRecording, tick MarketTick) {
+	if tick.Epoch <= rec.lastEpoch {
+		return
+	}
+
+	gap := rec.lastEpoch > 0 && tick.Epoch-rec.lastEpoch > int64(r.MaxTickGap/time.Second)
+	if rec.lastEpoch == 0 || gap {
+		if gap {
+			r.flush(rec)
+		}
+		rec.segmentStart = tick.Epoch
+	}
+
+	rec.pending = append(rec.pending, models.TickRecord{
+		Symbol: rec.symbol,
+		Epoch:  tick.Epoch,
+		Quote:  tick.Quote,
+		Bid:    tick.Bid,
+		Ask:    tick.Ask,
+	})
+
+	for _, granularity := range r.Granularities {
+		g := int64(granularity)
+		bucket := tick.Epoch / g * g
+		c := rec.forming[granularity]
+
+		if c != nil && c.Epoch != bucket {
+			// A candle followed by a gap may be missing its last ticks
+			if !rec.partial[granularity] && !gap {
+				rec.closed = append(rec.closed, *c)
+			}
+			c = nil
+		}
+		if c == nil {
+			c = &models.Candle{
+				Symbol:      rec.symbol,
+				Granularity: granularity,
+				Epoch:       bucket,
+				Open:        tick.Quote,
+				High:        tick.Quote,
+				Low:         tick.Quote,
+				Close:       tick.Quote,
+			}
+			rec.forming[granularity] = c
+			// The first candle after a (re)start or gap is missing earlier ticks
+			rec.partial[granularity] = rec.segmentStart == tick.Epoch && tick.Epoch != bucket
+			continue
+		}
+
+		if gap {
+			rec.partial[granularity] = true
+		}
+		if tick.Quote > c.High {
+			c.High = tick.Quote
+		}
+		if tick.Quote < c.Low {
+			c.Low = tick.Quote
+		}
+		c.Close = tick.Quote
+	}
+
+	rec.lastEpoch = tick.Epoch
+}
+
+func (r *MarketRecorder) flush(rec *symbolRecording) {
+	if len(rec.pending) > 0 {
+		err := database.DB.Clauses(clause.OnConflict{DoNothing: true}).
+			CreateInBatches(&rec.pending, 200).Error
+		if err != nil {
+			log.Printf("[Recorder] failed to store %d ticks for %s: %v", len(rec.pending), rec.symbol, err)
+		} else {
+			addCoverage(rec.symbol, 0, rec.segmentStart, rec.pending[len(rec.pending)-1].Epoch)
+		}
+		rec.pending = rec.pending[:0]
+	}
+
+	if len(rec.closed) > 0 {
+		if err := saveCandles(rec.closed); err != nil {
+			log.Printf("[Recorder] failed to store candles for %s: %v", rec.symbol, err)
+		} else {
+			for _, c := range rec.closed {
+				addCoverage(rec.symbol, c.Granularity, c.Epoch, c.Epoch)
+			}
+		}
+		rec.closed = rec.closed[:0]
+	}
+}
+
+func (r *MarketRecorder) retain() {
+	defer r.wg.Done()
+
+	r.applyRetention()
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.applyRetention()
+		}
+	}
+}
+
+// applyRetention deletes ticks and candles older than their retention and
+// trims the coverage records to match.
+func (r *MarketRecorder) applyRetention() {
+	if r.TickRetention > 0 {
+		cutoff := time.Now().Add(-r.TickRetention).Unix()
+		result := database.DB.Where("epoch < ?", cutoff).Delete(&models.TickRecord{})
+		if result.Error != nil {
+			log.Printf("[Recorder] tick retention failed: %v", result.Error)
+		} else if result.RowsAffected > 0 {
+			log.Printf("[Recorder] removed %d ticks older than %s", result.RowsAffected, r.TickRetention)
+		}
+		trimCoverage(0, cutoff)
+	}
+
+	for granularity, retention := range r.CandleRetention {
+		if retention <= 0 {
+			continue
+		}
+		cutoff := time.Now().Add(-retention).Unix()
+		result := database.DB.Where("granularity = ? AND epoch < ?", granularity, cutoff).Delete(&models.Candle{})
+		if result.Error != nil {
+			log.Printf("[Recorder] candle retention for %ds failed: %v", granularity, result.Error)
+			continue
+		}
+		trimCoverage(granularity, cutoff)
+	}
+}
+
+func trimCoverage(granularity int, cutoff int64) {
+	database.DB.Where("granularity = ? AND end_epoch < ?", granularity, cutoff).Delete(&models.CandleCoverage{})
+	database.DB.Model(&models.CandleCoverage{}).
+		Where("granularity = ? AND start_epoch < ?", granularity, cutoff).
+		Update("start_epoch", cutoff)
+}
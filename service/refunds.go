@@ -0,0 +1,488 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	"gorm.io/gorm"
+)
+
+// RefundWindow is how long after paying a user may ask for a refund;
+// superadmins can refund at any time
+const RefundWindow = 14 * 24 * time.Hour
+
+var (
+	ErrRefundNotFound   = errors.New("refund not found")
+	ErrRefundReviewed   = errors.New("refund has already been reviewed")
+	ErrNotRefundable    = errors.New("only settled payments can be refunded")
+	ErrRefundTooLarge   = errors.New("amount is more than what is left to refund")
+	ErrRefundWindowOver = errors.New("the refund window for this payment has closed")
+)
+
+// RecordTransactionEvent adds a step to the history of a transaction
+func RecordTransactionEvent(db *gorm.DB, transactionID uint, event string, amount float64, actor, detail string) error {
+	return db.Create(&models.TransactionEvent{
+		TransactionID: transactionID,
+		Event:         event,
+		Amount:        roundMoney(amount),
+		Actor:         actor,
+		Detail:        detail,
+		CreatedAt:     time.Now(),
+	}).Error
+}
+
+// RefundableAmount is what is left to refund of transaction: what was paid
+// less what is refunded or being refunded
+func RefundableAmount(db *gorm.DB, transaction models.Transaction) (float64, error) {
+	var open float64
+	if err := db.Model(&models.Refund{}).
+		Where("transaction_id = ? AND status IN ?", transaction.ID, []string{"requested", "pending"}).
+		Select("COALESCE(SUM(amount), 0)").Scan(&open).Error; err != nil {
+		return 0, err
+	}
+	paid, err := paidAmount(db, transaction)
+	if err != nil {
+		return 0, err
+	}
+	return roundMoney(paid - transaction.RefundedAmount - open), nil
+}
+
+// paidAmount is what transaction collected: its price, or whatever was
+// actually paid when it could not be fulfilled
+func paidAmount(db *gorm.DB, transaction models.Transaction) (float64, error) {
+	if transaction.Status != "unfulfilled" {
+		return transaction.Amount, nil
+	}
+	var settlement models.PaymentSettlement
+	if err := db.Where("reference = ?", transaction.Reference).First(&settlement).Error; err != nil {
+		return 0, err
+	}
+	return settlement.AmountPaid, nil
+}
+
+// OpenRefund records a refund of amount of transaction, everything left
+// when amount is 0. A "requested" refund waits for a superadmin, a
+// "pending" one is sent to the payment provider straight away.
+func OpenRefund(transaction models.Transaction, amount float64, reason, source, status, actor string) (*models.Refund, error) {
+	if transaction.Status != "success" && transaction.Status != "unfulfilled" {
+		return nil, ErrNotRefundable
+	}
+	refund := models.Refund{
+		TransactionID: transaction.ID,
+		Reference:     transaction.Reference,
+		UserID:        transaction.UserID,
+		Reason:        reason,
+		Source:        source,
+		Status:        status,
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		refundable, err := RefundableAmount(tx, transaction)
+		if err != nil {
+			return err
+		}
+		refund.Amount = roundMoney(amount)
+		if refund.Amount == 0 {
+			refund.Amount = refundable
+		}
+		if refund.Amount <= 0 || refund.Amount > refundable {
+			return ErrRefundTooLarge
+		}
+		if err := tx.Create(&refund).Error; err != nil {
+			return err
+		}
+		return RecordTransactionEvent(tx, transaction.ID, "refund_"+status, refund.Amount, actor,
+			fmt.Sprintf("refund %d: %s", refund.ID, reason))
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[Refunds] refund %d of %.2f on %s %s by %s", refund.ID, refund.Amount, transaction.Reference, status, actor)
+	return &refund, nil
+}
+
+// RequestRefund asks for a refund of one of userID's payments within the
+// refund window
+func RequestRefund(userID uint, reference string, amount float64, reason string) (*models.Refund, error) {
+	var transaction models.Transaction
+	if err := database.DB.Where("reference = ? AND user_id = ?", reference, userID).First(&transaction).Error; err != nil {
+		return nil, ErrNotRefundable
+	}
+	if time.Since(transaction.CreatedAt) > RefundWindow {
+		return nil, ErrRefundWindowOver
+	}
+	return OpenRefund(transaction, amount, reason, "user", "requested", fmt.Sprintf("user:%d", userID))
+}
+
+// ClaimRefund approves a requested refund for reviewerID, moving it to
+// pending so only one superadmin sends it
+func ClaimRefund(refundID, reviewerID uint) (*models.Refund, error) {
+	return reviewRefund(refundID, reviewerID, "pending", "", "refund_approved")
+}
+
+// RejectRefund turns down a requested refund
+func RejectRefund(refundID, reviewerID uint, note string) (*models.Refund, error) {
+	return reviewRefund(refundID, reviewerID, "rejected", note, "refund_rejected")
+}
+
+func reviewRefund(refundID, reviewerID uint, status, note, event string) (*models.Refund, error) {
+	var refund models.Refund
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&refund, refundID).Error; err != nil {
+			return ErrRefundNotFound
+		}
+		result := tx.Model(&refund).Where("status = ?", "requested").Updates(map[string]interface{}{
+			"status":      status,
+			"reviewed_by": reviewerID,
+			"review_note": note,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefundReviewed
+		}
+		return RecordTransactionEvent(tx, refund.TransactionID, event, refund.Amount,
+			fmt.Sprintf("superadmin:%d", reviewerID), fmt.Sprintf("refund %d %s", refund.ID, note))
+	})
+	if err != nil {
+		return &refund, err
+	}
+	log.Printf("[Refunds] refund %d %s by %d", refund.ID, status, reviewerID)
+	return &refund, nil
+}
+
+// FailRefund records that the provider would not refund a pending refund.
+// Nothing was returned, so access and the ledger stay as they are.
+func FailRefund(refundID uint, reason string) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var refund models.Refund
+		if err := tx.First(&refund, refundID).Error; err != nil {
+			return ErrRefundNotFound
+		}
+		result := tx.Model(&refund).Where("status = ?", "pending").
+			Updates(map[string]interface{}{"status": "failed", "failure_reason": reason})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		log.Printf("[Refunds] refund %d failed: %s", refund.ID, reason)
+		return RecordTransactionEvent(tx, refund.TransactionID, "refund_failed", refund.Amount, "provider", reason)
+	})
+}
+
+// CompleteRefund applies a pending refund the provider has paid back: the
+// payer loses the access it bought, the company and admin shares are
+// reversed and the transaction is marked refunded once nothing is left.
+// Only a pending refund changes, so a repeated confirmation does nothing.
+func CompleteRefund(refundID uint, actor string) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		return completeRefund(tx, refundID, actor)
+	})
+}
+
+func completeRefund(tx *gorm.DB, refundID uint, actor string) error {
+	var refund models.Refund
+	if err := tx.First(&refund, refundID).Error; err != nil {
+		return ErrRefundNotFound
+	}
+	now := time.Now()
+	result := tx.Model(&refund).Where("status = ?", "pending").
+		Updates(map[string]interface{}{"status": "processed", "processed_at": &now})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+
+	var transaction models.Transaction
+	if err := tx.First(&transaction, refund.TransactionID).Error; err != nil {
+		return fmt.Errorf("transaction of refund %d not found", refund.ID)
+	}
+	fraction := 1.0
+	if transaction.Amount > 0 {
+		fraction = refund.Amount / transaction.Amount
+	}
+	// An unfulfilled transaction granted nothing to take back
+	if transaction.Status != "unfulfilled" {
+		if err := revokeAccess(tx, transaction, fraction); err != nil {
+			return fmt.Errorf("failed to revoke access: %w", err)
+		}
+	}
+	if err := PostRefund(tx, transaction, refund.Amount, fmt.Sprintf("refund:%d", refund.ID)); err != nil {
+		return err
+	}
+
+	paid, err := paidAmount(tx, transaction)
+	if err != nil {
+		return err
+	}
+	refunded := roundMoney(transaction.RefundedAmount + refund.Amount)
+	updates := map[string]interface{}{"refunded_amount": refunded, "updated_at": now}
+	if refunded >= paid {
+		updates["status"] = "refunded"
+		if refund.Source == "chargeback" {
+			updates["status"] = "charged_back"
+		}
+	}
+	if err := tx.Model(&transaction).Updates(updates).Error; err != nil {
+		return err
+	}
+	log.Printf("[Refunds] refund %d of %.2f on %s processed", refund.ID, refund.Amount, transaction.Reference)
+	return RecordTransactionEvent(tx, transaction.ID, "refund_processed", refund.Amount, actor,
+		fmt.Sprintf("refund %d", refund.ID))
+}
+
+// PostRefund reverses amount of a settled transaction in the ledger inside
+// tx, taking it back from the platform's commission and the earnings of the
+// admin, or of the seller of a resale, in the shares they were paid. An
+// admin paid through their subaccount ends up owing their share, which
+// comes out of later earnings. An unfulfilled transaction was only ever
+// owed back, so its refund settles that.
+func PostRefund(tx *gorm.DB, transaction models.Transaction, amount float64, journalID string) error {
+	transactionID := transaction.ID
+	if transaction.Status == "unfulfilled" {
+		return postJournal(tx, journalID, "refund", fmt.Sprintf("refund of %s", transaction.Reference), &transactionID, nil,
+			debit(AccountRefunds, 0, amount),
+			credit(AccountProcessor, 0, amount))
+	}
+	payee, adminID := payeeAccount(transaction)
+	companyShare := transaction.CompanyShare
+	if payee == "" {
+		companyShare = transaction.Amount
+	}
+	companyPart := amount
+	if transaction.Amount > 0 {
+		companyPart = roundMoney(companyShare * amount / transaction.Amount)
+	}
+
+	legs := []ledgerLeg{
+		debit(AccountRevenue, 0, companyPart),
+		credit(AccountProcessor, 0, amount),
+	}
+	if payee != "" {
+		legs = append(legs, debit(payee, adminID, amount-companyPart))
+	}
+	return postJournal(tx, journalID, "refund", fmt.Sprintf("refund of %s", transaction.Reference), &transactionID, nil, legs...)
+}
+
+// revokeAccess takes back fraction of what transaction paid for. A
+// license or membership bought outright goes only with a full refund, a
+// rental is shortened by the refunded part of its period and a membership
+// by the refunded part of its month.
+func revokeAccess(tx *gorm.DB, transaction models.Transaction, fraction float64) error {
+	full := fraction >= 0.999
+	switch transaction.PaymentType {
+	case "purchase":
+		if !full {
+			return nil
+		}
+		if err := returnExclusiveBot(tx, transaction); err != nil {
+			return err
+		}
+		return tx.Where("user_id = ? AND bot_id = ? AND transaction_id = ?", transaction.UserID, transaction.BotID, transaction.ID).
+			Delete(&models.UserBot{}).Error
+	case "resale":
+		if !full || transaction.ListingID == nil {
+			return nil
+		}
+		var listing models.LicenseListing
+		if err := tx.First(&listing, *transaction.ListingID).Error; err != nil {
+			return nil
+		}
+		// The license goes back to whoever sold it
+		if err := tx.Model(&models.UserBot{}).
+			Where("id = ? AND user_id = ? AND transaction_id = ?", listing.UserBotID, transaction.UserID, transaction.ID).
+			Updates(map[string]interface{}{"user_id": listing.SellerID, "transaction_id": nil}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&listing).Update("status", "refunded").Error
+	case "rent":
+		return shortenRental(tx, transaction, fraction)
+	case "membership":
+		return shortenMembership(tx, transaction, fraction)
+	}
+	return nil
+}
+
+// returnExclusiveBot gives an exclusively sold bot back to its seller
+func returnExclusiveBot(tx *gorm.DB, transaction models.Transaction) error {
+	var sale models.Sale
+	found := tx.Where("bot_id = ? AND buyer_id = ? AND sale_type = ?", transaction.BotID, transaction.UserID, "exclusive").
+		Order("id DESC").Limit(1).Find(&sale)
+	if found.Error != nil || found.RowsAffected == 0 {
+		return found.Error
+	}
+	result := tx.Model(&models.Bot{}).Where("id = ? AND owner_id = ?", transaction.BotID, transaction.UserID).
+		Update("owner_id", sale.SellerID)
+	if result.RowsAffected > 0 {
+		log.Printf("[Refunds] bot %d returned to user %d", transaction.BotID, sale.SellerID)
+	}
+	return result.Error
+}
+
+func shortenRental(tx *gorm.DB, transaction models.Transaction, fraction float64) error {
+	var userBot models.UserBot
+	found := tx.Where("user_id = ? AND bot_id = ? AND access_type = ?", transaction.UserID, transaction.BotID, "rent").
+		Limit(1).Find(&userBot)
+	if found.Error != nil || found.RowsAffected == 0 {
+		return found.Error
+	}
+	var bot models.Bot
+	if err := tx.First(&bot, transaction.BotID).Error; err != nil {
+		return err
+	}
+	plan := defaultRentalPlan(bot)
+	if transaction.RentalPlanID != nil {
+		tx.Limit(1).Find(&plan, *transaction.RentalPlanID)
+	}
+
+	now := time.Now()
+	if userBot.ExpiryDate == nil || plan.DurationDays == 0 {
+		// A lifetime rental has no period to shorten
+		if fraction < 0.999 {
+			return nil
+		}
+		return tx.Model(&userBot).Updates(map[string]interface{}{"is_active": false, "expiry_date": &now}).Error
+	}
+	expiry := userBot.ExpiryDate.Add(-time.Duration(float64(plan.Duration()) * fraction))
+	updates := map[string]interface{}{"expiry_date": &expiry}
+	if !expiry.After(now) {
+		updates["is_active"] = false
+	}
+	return tx.Model(&userBot).Updates(updates).Error
+}
+
+func shortenMembership(tx *gorm.DB, transaction models.Transaction, fraction float64) error {
+	var sub models.Subscription
+	if transaction.SubscriptionID == nil || tx.First(&sub, *transaction.SubscriptionID).Error != nil {
+		return nil
+	}
+	var user models.User
+	if err := tx.First(&user, transaction.UserID).Error; err != nil {
+		return err
+	}
+	expiry := user.SubscriptionExpiry.Add(-time.Duration(float64(sub.PeriodDays) * fraction * float64(24*time.Hour)))
+	updates := map[string]interface{}{"subscription_expiry": expiry}
+	if !expiry.After(time.Now()) {
+		updates["membership"] = FreeMembership
+	}
+	return tx.Model(&user).Updates(updates).Error
+}
+
+// SetAccessSuspended holds the bot access a disputed transaction paid for
+// while the dispute is open, and gives it back when it is decided in the
+// platform's favour and has not expired meanwhile
+func SetAccessSuspended(tx *gorm.DB, transaction models.Transaction, suspended bool) error {
+	if transaction.BotID == 0 {
+		return nil
+	}
+	query := tx.Model(&models.UserBot{}).Where("user_id = ? AND bot_id = ?", transaction.UserID, transaction.BotID)
+	if suspended {
+		return query.Update("is_active", false).Error
+	}
+	return query.Where("expiry_date IS NULL OR expiry_date > ?", time.Now()).Update("is_active", true).Error
+}
+
+// OpenDispute records a chargeback the payer opened on transaction and
+// suspends the access it paid for. created is false for a dispute already
+// known, whose status is just updated.
+func OpenDispute(transaction models.Transaction, providerID string, amount float64, status string) (created bool, err error) {
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var dispute models.Dispute
+		found := tx.Where("provider_id = ?", providerID).Limit(1).Find(&dispute)
+		if found.Error != nil {
+			return found.Error
+		}
+		if found.RowsAffected > 0 {
+			if err := tx.Model(&dispute).Update("status", status).Error; err != nil {
+				return err
+			}
+			return RecordTransactionEvent(tx, transaction.ID, "dispute_updated", dispute.Amount, "provider", status)
+		}
+
+		dispute = models.Dispute{
+			TransactionID: transaction.ID,
+			Reference:     transaction.Reference,
+			ProviderID:    providerID,
+			Amount:        roundMoney(amount),
+			Status:        status,
+		}
+		if err := tx.Create(&dispute).Error; err != nil {
+			return err
+		}
+		created = true
+		if err := SetAccessSuspended(tx, transaction, true); err != nil {
+			return err
+		}
+		return RecordTransactionEvent(tx, transaction.ID, "dispute_opened", dispute.Amount, "provider",
+			fmt.Sprintf("dispute %s", providerID))
+	})
+	if created {
+		log.Printf("[Refunds] dispute %s opened on %s", providerID, transaction.Reference)
+	}
+	return created, err
+}
+
+// ResolveDispute closes a dispute. When the payer won ("merchant-accepted")
+// the refunded amount is booked as a chargeback like any other refund;
+// otherwise the suspended access is restored.
+func ResolveDispute(transaction models.Transaction, providerID, resolution string, refundAmount float64) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var dispute models.Dispute
+		found := tx.Where("provider_id = ?", providerID).Limit(1).Find(&dispute)
+		if found.Error != nil {
+			return found.Error
+		}
+		if found.RowsAffected == 0 {
+			dispute = models.Dispute{TransactionID: transaction.ID, Reference: transaction.Reference, ProviderID: providerID, Amount: refundAmount}
+			if err := tx.Create(&dispute).Error; err != nil {
+				return err
+			}
+		}
+		if dispute.ResolvedAt != nil {
+			return nil
+		}
+		now := time.Now()
+		if err := tx.Model(&dispute).Updates(map[string]interface{}{
+			"status":      "resolved",
+			"resolution":  resolution,
+			"resolved_at": &now,
+		}).Error; err != nil {
+			return err
+		}
+		log.Printf("[Refunds] dispute %s on %s resolved: %s", providerID, transaction.Reference, resolution)
+		if err := RecordTransactionEvent(tx, transaction.ID, "dispute_resolved", refundAmount, "provider", resolution); err != nil {
+			return err
+		}
+
+		// Access comes back unless the chargeback takes it, as a refund would
+		if err := SetAccessSuspended(tx, transaction, false); err != nil {
+			return err
+		}
+		if resolution != "merchant-accepted" {
+			return nil
+		}
+		amount := roundMoney(refundAmount)
+		if left := roundMoney(transaction.Amount - transaction.RefundedAmount); amount <= 0 || amount > left {
+			amount = left
+		}
+		if amount <= 0 {
+			return nil
+		}
+		refund := models.Refund{
+			TransactionID: transaction.ID,
+			Reference:     transaction.Reference,
+			UserID:        transaction.UserID,
+			Amount:        amount,
+			Reason:        "chargeback " + providerID,
+			Source:        "chargeback",
+			Status:        "pending",
+			ProviderID:    providerID,
+		}
+		if err := tx.Create(&refund).Error; err != nil {
+			return err
+		}
+		return completeRefund(tx, refund.ID, "provider")
+	})
+}
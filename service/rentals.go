@@ -0,0 +1,254 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPlanNotFound      = errors.New("rental plan not found")
+	ErrLifetimeRental    = errors.New("you already have lifetime access to this bot")
+	ErrAlreadyLicensed   = errors.New("you already own a license for this bot")
+	ErrPaymentRequired   = errors.New("this plan change needs a payment")
+	ErrNothingToSwitch   = errors.New("you are already on this plan")
+	ErrRentalNotOffered  = errors.New("this bot is not offered for rent")
+	ErrRentalUnavailable = errors.New("this rental can no longer be applied")
+)
+
+// planIntervals maps the standard intervals to their length in days
+var planIntervals = map[string]int{
+	"daily":    1,
+	"weekly":   7,
+	"monthly":  30,
+	"lifetime": 0,
+}
+
+// NormalizeRentalPlan validates plan and fills DurationDays from Interval,
+// which must be a standard interval or "custom" with a positive duration
+func NormalizeRentalPlan(plan *models.RentalPlan) error {
+	plan.Interval = strings.ToLower(strings.TrimSpace(plan.Interval))
+	if plan.Interval == "custom" {
+		if plan.DurationDays <= 0 {
+			return errors.New("a custom plan needs duration_days")
+		}
+	} else {
+		days, ok := planIntervals[plan.Interval]
+		if !ok {
+			return fmt.Errorf("interval must be daily, weekly, monthly, lifetime or custom, got %q", plan.Interval)
+		}
+		plan.DurationDays = days
+	}
+	if plan.Price <= 0 {
+		return errors.New("price must be positive")
+	}
+	if strings.TrimSpace(plan.Name) == "" {
+		plan.Name = plan.Interval
+	}
+	return nil
+}
+
+// defaultRentalPlan is the plan of a bot without plans of its own: its rent
+// price for the period named by SubscriptionType, a month unless set
+func defaultRentalPlan(bot models.Bot) models.RentalPlan {
+	interval := strings.ToLower(bot.SubscriptionType)
+	days, ok := planIntervals[interval]
+	if !ok {
+		interval, days = "monthly", 30
+	}
+	return models.RentalPlan{BotID: bot.ID, Name: interval, Interval: interval, DurationDays: days, Price: bot.RentPrice, Active: true}
+}
+
+// RentalPlans returns the plans a bot can be rented on: its active plans,
+// or the default plan when it has none
+func RentalPlans(bot models.Bot) ([]models.RentalPlan, error) {
+	return rentalPlans(database.DB, bot)
+}
+
+func rentalPlans(db *gorm.DB, bot models.Bot) ([]models.RentalPlan, error) {
+	var plans []models.RentalPlan
+	if err := db.Where("bot_id = ? AND active = ?", bot.ID, true).Order("price ASC").Find(&plans).Error; err != nil {
+		return nil, err
+	}
+	if len(plans) == 0 && bot.RentPrice > 0 {
+		plans = append(plans, defaultRentalPlan(bot))
+	}
+	return plans, nil
+}
+
+// rentalPlan finds plan planID of bot; 0 picks the default plan, or the
+// only plan when the bot has exactly one
+func rentalPlan(db *gorm.DB, bot models.Bot, planID uint) (models.RentalPlan, error) {
+	plans, err := rentalPlans(db, bot)
+	if err != nil {
+		return models.RentalPlan{}, err
+	}
+	if len(plans) == 0 {
+		return models.RentalPlan{}, ErrRentalNotOffered
+	}
+	for _, plan := range plans {
+		if plan.ID == planID {
+			return plan, nil
+		}
+	}
+	if planID == 0 && len(plans) == 1 {
+		return plans[0], nil
+	}
+	return models.RentalPlan{}, ErrPlanNotFound
+}
+
+// currentPlan is the plan a rental was paid on, even if it has since been
+// retired
+func currentPlan(db *gorm.DB, bot models.Bot, userBot models.UserBot) models.RentalPlan {
+	if userBot.RentalPlanID != nil {
+		var plan models.RentalPlan
+		if err := db.First(&plan, *userBot.RentalPlanID).Error; err == nil {
+			return plan
+		}
+	}
+	return defaultRentalPlan(bot)
+}
+
+// RentalQuote is what renting a plan costs the user right now
+type RentalQuote struct {
+	Plan      models.RentalPlan `json:"plan"`
+	Kind      string            `json:"kind"`   // "new", "renewal" or "switch"
+	Credit    float64           `json:"credit"` // unused value of the current rental
+	Due       float64           `json:"due"`
+	ExpiresAt *time.Time        `json:"expires_at,omitempty"` // end of access once paid; nil never expires
+}
+
+// QuoteRental prices renting bot on planID for userID. A renewal of the
+// current plan costs the full price and extends the rental. Switching plans
+// credits the unused part of the current rental: the rest is due and a new
+// period starts, or, when the credit covers the new plan, nothing is due and
+// the credit buys proportionally more time on it.
+func QuoteRental(db *gorm.DB, userID uint, bot models.Bot, planID uint) (*RentalQuote, error) {
+	return quoteRental(db, userID, bot, planID, time.Now())
+}
+
+func quoteRental(db *gorm.DB, userID uint, bot models.Bot, planID uint, now time.Time) (*RentalQuote, error) {
+	plan, err := rentalPlan(db, bot, planID)
+	if err != nil {
+		return nil, err
+	}
+	quote := &RentalQuote{Plan: plan, Kind: "new", Due: plan.Price}
+	periodEnd := func(from time.Time, d time.Duration) *time.Time {
+		if plan.DurationDays == 0 {
+			return nil
+		}
+		end := from.Add(d)
+		return &end
+	}
+
+	var userBot models.UserBot
+	found := db.Where("user_id = ? AND bot_id = ?", userID, bot.ID).Limit(1).Find(&userBot)
+	if found.Error != nil {
+		return nil, found.Error
+	}
+	active := found.RowsAffected > 0 && userBot.IsActive &&
+		(userBot.ExpiryDate == nil || userBot.ExpiryDate.After(now))
+	if !active {
+		quote.ExpiresAt = periodEnd(now, plan.Duration())
+		return quote, nil
+	}
+	if userBot.AccessType == "purchase" {
+		return nil, ErrAlreadyLicensed
+	}
+	if userBot.ExpiryDate == nil {
+		return nil, ErrLifetimeRental
+	}
+
+	current := currentPlan(db, bot, userBot)
+	if current.ID == plan.ID {
+		quote.Kind = "renewal"
+		quote.ExpiresAt = periodEnd(*userBot.ExpiryDate, plan.Duration())
+		return quote, nil
+	}
+
+	quote.Kind = "switch"
+	paid := userBot.Price
+	if paid <= 0 {
+		paid = current.Price
+	}
+	if current.DurationDays > 0 {
+		remaining := userBot.ExpiryDate.Sub(now)
+		quote.Credit = roundMoney(paid * remaining.Hours() / current.Duration().Hours())
+	}
+	if quote.Credit < plan.Price {
+		quote.Due = roundMoney(plan.Price - quote.Credit)
+		quote.ExpiresAt = periodEnd(now, plan.Duration())
+		return quote, nil
+	}
+	quote.Due = 0
+	quote.ExpiresAt = periodEnd(now, time.Duration(float64(plan.Duration())*quote.Credit/plan.Price))
+	return quote, nil
+}
+
+// ApplyRental grants userID the rental quoted for planID inside tx, once it
+// is paid for (or costs nothing)
+func ApplyRental(tx *gorm.DB, userID uint, bot models.Bot, planID uint, transactionID *uint) (*models.UserBot, error) {
+	quote, err := quoteRental(tx, userID, bot, planID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	var userBot models.UserBot
+	if err := tx.Where("user_id = ? AND bot_id = ?", userID, bot.ID).FirstOrInit(&userBot).Error; err != nil {
+		return nil, err
+	}
+	if userBot.ID == 0 || quote.Kind == "new" {
+		userBot.PurchaseDate = time.Now()
+	}
+	userBot.UserID = userID
+	userBot.BotID = bot.ID
+	userBot.AccessType = "rent"
+	userBot.IsActive = true
+	userBot.ExpiryDate = quote.ExpiresAt
+	userBot.Price = quote.Plan.Price
+	userBot.RentalPlanID = nil
+	if quote.Plan.ID != 0 {
+		planID := quote.Plan.ID
+		userBot.RentalPlanID = &planID
+	}
+	if transactionID != nil {
+		userBot.TransactionID = transactionID
+	}
+	if err := tx.Omit("Bot").Save(&userBot).Error; err != nil {
+		return nil, err
+	}
+
+	log.Printf("[Rentals] user %d %s of bot %d on plan %q until %v", userID, quote.Kind, bot.ID, quote.Plan.Name, quote.ExpiresAt)
+	return &userBot, nil
+}
+
+// SwitchRentalPlan moves an active rental to planID when the unused credit
+// covers it, so no payment is needed
+func SwitchRentalPlan(userID uint, bot models.Bot, planID uint) (*models.UserBot, error) {
+	var userBot *models.UserBot
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		quote, err := quoteRental(tx, userID, bot, planID, time.Now())
+		if err != nil {
+			return err
+		}
+		switch {
+		case quote.Kind == "renewal":
+			return ErrNothingToSwitch
+		case quote.Kind != "switch" || quote.Due > 0:
+			return ErrPaymentRequired
+		}
+		userBot, err = ApplyRental(tx, userID, bot, planID, nil)
+		return err
+	})
+	return userBot, err
+}
+
+func roundMoney(v float64) float64 {
+	return float64(int64(v*100+0.5)) / 100
+}
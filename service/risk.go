@@ -0,0 +1,203 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	"gorm.io/gorm"
+)
+
+// RiskViolation is returned when an order breaks one of the user's risk
+// limits. Rule names the limit, e.g. "max_stake".
+type RiskViolation struct {
+	Rule   string
+	Reason string
+}
+
+func (v *RiskViolation) Error() string {
+	return "blocked by risk limits: " + v.Reason
+}
+
+// RiskOrder is an order about to be placed, as seen by the risk checks
+type RiskOrder struct {
+	UserID   uint
+	BotID    uint
+	RunID    *uint
+	Source   string // "manual", "bot" or "copy"
+	Mode     string // "live" or "paper"
+	Contract models.DerivContractRequest
+	Stake    float64
+}
+
+// UserRiskProfile returns the user-wide risk profile, creating an empty one
+// (no limits) on first use.
+func UserRiskProfile(userID uint) (*models.RiskProfile, error) {
+	var profile models.RiskProfile
+	err := database.DB.Where("user_id = ? AND bot_id IS NULL", userID).First(&profile).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		profile = models.RiskProfile{UserID: userID}
+		err = database.DB.Create(&profile).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// SetAutomationHalted engages or releases the user's kill switch
+func SetAutomationHalted(userID uint, halted bool) (*models.RiskProfile, error) {
+	profile, err := UserRiskProfile(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var haltedAt *time.Time
+	if halted {
+		now := time.Now()
+		haltedAt = &now
+	}
+	if err := database.DB.Model(profile).Updates(map[string]interface{}{
+		"automation_halted": halted,
+		"halted_at":         haltedAt,
+	}).Error; err != nil {
+		return nil, err
+	}
+	profile.AutomationHalted = halted
+	profile.HaltedAt = haltedAt
+	return profile, nil
+}
+
+// CheckOrder enforces the user's risk profile, and the bot's when the order
+// comes from a bot, before order is placed. Blocked orders are recorded as
+// models.BlockedOrder and a *RiskViolation is returned.
+func CheckOrder(order RiskOrder) error {
+	var profiles []models.RiskProfile
+	query := database.DB.Where("user_id = ? AND bot_id IS NULL", order.UserID)
+	if order.BotID != 0 {
+		query = database.DB.Where("user_id = ? AND (bot_id IS NULL OR bot_id = ?)", order.UserID, order.BotID)
+	}
+	if err := query.Find(&profiles).Error; err != nil {
+		return err
+	}
+
+	for _, profile := range profiles {
+		if violation := checkProfile(profile, order); violation != nil {
+			recordBlockedOrder(order, violation)
+			return violation
+		}
+	}
+	return nil
+}
+
+func checkProfile(profile models.RiskProfile, order RiskOrder) *RiskViolation {
+	if profile.BotID == nil && profile.AutomationHalted && order.Source != "manual" {
+		return &RiskViolation{Rule: "kill_switch", Reason: "automated trading is halted by the kill switch"}
+	}
+
+	scope := "your account"
+	if profile.BotID != nil {
+		scope = "this bot"
+	}
+
+	if profile.MaxStake > 0 && order.Stake > profile.MaxStake {
+		return &RiskViolation{
+			Rule:   "max_stake",
+			Reason: fmt.Sprintf("stake %.2f is above the %.2f limit for %s", order.Stake, profile.MaxStake, scope),
+		}
+	}
+
+	trades := riskTradeQuery(profile, order)
+
+	if profile.MaxOpenContracts > 0 {
+		var open int64
+		trades().Where("status = ?", "open").Count(&open)
+		if int(open) >= profile.MaxOpenContracts {
+			return &RiskViolation{
+				Rule:   "max_open_contracts",
+				Reason: fmt.Sprintf("%d contracts are already open, the limit for %s is %d", open, scope, profile.MaxOpenContracts),
+			}
+		}
+	}
+
+	if profile.DailyLossLimit > 0 {
+		now := time.Now().UTC()
+		dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		var pnl float64
+		trades().Where("status <> ? AND close_time >= ?", "open", dayStart).
+			Select("COALESCE(SUM(profit_loss), 0)").Row().Scan(&pnl)
+		if -pnl >= profile.DailyLossLimit {
+			return &RiskViolation{
+				Rule:   "daily_loss_limit",
+				Reason: fmt.Sprintf("today's loss of %.2f has reached the %.2f daily limit for %s", -pnl, profile.DailyLossLimit, scope),
+			}
+		}
+	}
+
+	if profile.MaxConsecutiveLosses > 0 && profile.LossCooldownMinutes > 0 {
+		var recent []struct {
+			ProfitLoss float64
+			CloseTime  *time.Time
+		}
+		trades().Where("status <> ?", "open").Order("close_time DESC").
+			Limit(profile.MaxConsecutiveLosses).Select("profit_loss, close_time").Scan(&recent)
+
+		losses := 0
+		for _, t := range recent {
+			if t.ProfitLoss >= 0 {
+				break
+			}
+			losses++
+		}
+		if losses >= profile.MaxConsecutiveLosses && recent[0].CloseTime != nil {
+			until := recent[0].CloseTime.Add(time.Duration(profile.LossCooldownMinutes) * time.Minute)
+			if time.Now().Before(until) {
+				return &RiskViolation{
+					Rule: "loss_cooldown",
+					Reason: fmt.Sprintf("%d losses in a row on %s, trading resumes at %s",
+						losses, scope, until.UTC().Format(time.RFC3339)),
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// riskTradeQuery returns a query builder over the trades the profile
+// covers: live or paper depending on the order, for one bot if the profile
+// is bot-specific.
+func riskTradeQuery(profile models.RiskProfile, order RiskOrder) func() *gorm.DB {
+	return func() *gorm.DB {
+		var model interface{} = &models.Trade{}
+		if order.Mode == "paper" {
+			model = &models.PaperTrade{}
+		}
+		query := database.DB.Model(model).Where("user_id = ?", profile.UserID)
+		if profile.BotID != nil {
+			query = query.Where("bot_id = ?", *profile.BotID)
+		}
+		return query
+	}
+}
+
+func recordBlockedOrder(order RiskOrder, violation *RiskViolation) {
+	blocked := models.BlockedOrder{
+		UserID:       order.UserID,
+		BotID:        order.BotID,
+		RunID:        order.RunID,
+		Source:       order.Source,
+		Mode:         order.Mode,
+		Symbol:       order.Contract.Symbol,
+		ContractType: order.Contract.ContractType,
+		Stake:        order.Stake,
+		Rule:         violation.Rule,
+		Reason:       violation.Reason,
+	}
+	if err := database.DB.Create(&blocked).Error; err != nil {
+		log.Printf("[Risk] failed to record blocked order for user %d: %v", order.UserID, err)
+	}
+	log.Printf("[Risk] blocked %s order for user %d: %s", order.Source, order.UserID, violation.Reason)
+}
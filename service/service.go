@@ -4,53 +4,141 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
+	"strconv"
 	"time"
 
-	"github.com/gorilla/websocket"
 	"github.com/keyadaniel56/algocdk/internal/models"
 )
 
-type DerivService struct {
-	wsURL string
+// ErrProposalNotFound is returned when buying a proposal that was never
+// quoted for the token or has already expired.
+var ErrProposalNotFound = errors.New("proposal not found or expired, request a new quote")
+
+// ErrPriceMoved is returned by BuyProposal when the quoted ask price is above
+// the highest price the caller accepts.
+var ErrPriceMoved = errors.New("ask price exceeds max_price")
+
+// DerivConfig selects the Deriv app, server, language and brand the service
+// talks to
+type DerivConfig struct {
+	AppID    string
+	Endpoint string // WebSocket endpoint without query string
+	Language string
+	Brand    string
+	OAuthURL string
+
+	// AllowedAppIDs are the app IDs uploaded bots may connect with
+	AllowedAppIDs []string
 }
 
-func NewDerivService() *DerivService {
-	return &DerivService{
-		wsURL: "wss://ws.derivws.com/websockets/v3?app_id=1089",
+// DefaultDerivConfig uses Deriv's public test app
+func DefaultDerivConfig() DerivConfig {
+	return DerivConfig{
+		AppID:         "1089",
+		Endpoint:      "wss://ws.derivws.com/websockets/v3",
+		Language:      "EN",
+		Brand:         "deriv",
+		OAuthURL:      "https://oauth.deriv.com/oauth2/authorize",
+		AllowedAppIDs: []string{"1089"},
 	}
 }
 
-// AuthenticateAndGetUserInfo authenticates with Deriv and returns user info
-func (s *DerivService) AuthenticateAndGetUserInfo(apiToken string) (*models.DerivUserInfo, error) {
-	conn, err := s.connectWebSocket()
-	if err != nil {
-		return nil, err
-	}
-	defer conn.Close()
+// WebSocketURL returns the endpoint with the app ID, language and brand set
+func (c DerivConfig) WebSocketURL() string {
+	return c.withParams(c.Endpoint)
+}
 
-	// Send authorization request
-	authReq := map[string]interface{}{
-		"authorize": apiToken,
-	}
+// AuthorizeURL returns the OAuth page that asks the user to authorize the
+// app. Deriv sends the user back to the redirect URL registered for it.
+func (c DerivConfig) AuthorizeURL() string {
+	return c.withParams(c.OAuthURL)
+}
 
-	if err := conn.WriteJSON(authReq); err != nil {
-		return nil, fmt.Errorf("failed to send auth request: %v", err)
+// AppIDAllowed reports whether a bot may connect with appID
+func (c DerivConfig) AppIDAllowed(appID string) bool {
+	if appID == c.AppID {
+		return true
+	}
+	for _, id := range c.AllowedAppIDs {
+		if id == appID {
+			return true
+		}
 	}
+	return false
+}
 
-	// Read authorization response
-	var response models.DerivWSResponse
-	if err := conn.ReadJSON(&response); err != nil {
-		return nil, fmt.Errorf("failed to read auth response: %v", err)
+func (c DerivConfig) withParams(base string) string {
+	u, err := url.Parse(base)
+	if err != nil {
+		return base
+	}
+	query := u.Query()
+	query.Set("app_id", c.AppID)
+	if c.Language != "" {
+		query.Set("l", c.Language)
+	}
+	if c.Brand != "" {
+		query.Set("brand", c.Brand)
 	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+type DerivService struct {
+	config    DerivConfig
+	pool      *DerivPool
+	proposals *proposalCache
+}
+
+func NewDerivService() *DerivService {
+	return NewDerivServiceWithConfig(DefaultDerivConfig())
+}
+
+// NewDerivServiceWithConfig creates a service for the given Deriv app and
+// server
+func NewDerivServiceWithConfig(config DerivConfig) *DerivService {
+	s := NewDerivServiceWithURL(config.WebSocketURL())
+	s.config = config
+	return s
+}
 
-	// Check for errors
-	if response.Error.Code != "" {
-		return nil, fmt.Errorf("deriv API error: %s - %s", response.Error.Code, response.Error.Message)
+// NewDerivServiceWithURL creates a service talking to the given Deriv
+// WebSocket endpoint, e.g. a local fake server.
+func NewDerivServiceWithURL(wsURL string) *DerivService {
+	return &DerivService{
+		pool:      NewDerivPool(wsURL),
+		proposals: newProposalCache(2 * time.Minute),
 	}
+}
+
+// Configure switches the service to another Deriv app or server. Sessions
+// already open keep their connection; call it at startup, before first use.
+func (s *DerivService) Configure(config DerivConfig) {
+	s.config = config
+	s.pool.SetURL(config.WebSocketURL())
+}
+
+// Config returns the Deriv app and server settings in use
+func (s *DerivService) Config() DerivConfig {
+	return s.config
+}
+
+// Pool exposes the underlying connection pool for streaming consumers.
+func (s *DerivService) Pool() *DerivPool {
+	return s.pool
+}
 
-	// Check if authorization was successful
-	if response.MsgType != "authorize" {
-		return nil, errors.New("unexpected response type")
+// Close releases every pooled Deriv connection.
+func (s *DerivService) Close() {
+	s.pool.Close()
+}
+
+// AuthenticateAndGetUserInfo authenticates with Deriv and returns user info
+func (s *DerivService) AuthenticateAndGetUserInfo(apiToken string) (*models.DerivUserInfo, error) {
+	response, err := s.authorize(apiToken)
+	if err != nil {
+		return nil, err
 	}
 
 	userInfo := &models.DerivUserInfo{
@@ -68,29 +156,10 @@ func (s *DerivService) AuthenticateAndGetUserInfo(apiToken string) (*models.Deri
 
 // GetAccountList fetches all accounts associated with the API token
 func (s *DerivService) GetAccountList(apiToken string) (*models.DerivAccountList, error) {
-	conn, err := s.connectWebSocket()
+	authResponse, err := s.authorize(apiToken)
 	if err != nil {
 		return nil, err
 	}
-	defer conn.Close()
-
-	// Authorize first to get account list
-	authReq := map[string]interface{}{
-		"authorize": apiToken,
-	}
-	if err := conn.WriteJSON(authReq); err != nil {
-		return nil, err
-	}
-
-	// Read auth response which includes account_list
-	var authResponse models.DerivWSResponse
-	if err := conn.ReadJSON(&authResponse); err != nil {
-		return nil, err
-	}
-
-	if authResponse.Error.Code != "" {
-		return nil, fmt.Errorf("auth error: %s", authResponse.Error.Message)
-	}
 
 	accountList := &models.DerivAccountList{
 		Accounts: authResponse.Authorize.AccountList,
@@ -99,37 +168,12 @@ func (s *DerivService) GetAccountList(apiToken string) (*models.DerivAccountList
 	return accountList, nil
 }
 
-// SwitchAccount switches to a different account using the same API token
-// ============================================
-// UPDATE your SwitchAccount method in service
-// ============================================
-
-// Replace the existing SwitchAccount method with this:
-
 // SwitchAccount switches to a different account using the same API token
 func (s *DerivService) SwitchAccount(apiToken, loginID string) (*models.DerivUserInfo, error) {
-	conn, err := s.connectWebSocket()
+	authResponse, err := s.authorize(apiToken)
 	if err != nil {
 		return nil, err
 	}
-	defer conn.Close()
-
-	// First authorize to get the token
-	authReq := map[string]interface{}{
-		"authorize": apiToken,
-	}
-	if err := conn.WriteJSON(authReq); err != nil {
-		return nil, err
-	}
-
-	var authResponse models.DerivWSResponse
-	if err := conn.ReadJSON(&authResponse); err != nil {
-		return nil, err
-	}
-
-	if authResponse.Error.Code != "" {
-		return nil, fmt.Errorf("auth error: %s", authResponse.Error.Message)
-	}
 
 	// Check if the requested loginID exists in account list
 	found := false
@@ -151,12 +195,9 @@ func (s *DerivService) SwitchAccount(apiToken, loginID string) (*models.DerivUse
 		"account_list": 1,
 		"loginid":      loginID,
 	}
-	if err := conn.WriteJSON(switchReq); err != nil {
-		return nil, err
-	}
 
 	var switchResponse models.DerivWSResponse
-	if err := conn.ReadJSON(&switchResponse); err != nil {
+	if err := s.pool.Call(apiToken, switchReq, &switchResponse); err != nil {
 		return nil, err
 	}
 
@@ -169,12 +210,9 @@ func (s *DerivService) SwitchAccount(apiToken, loginID string) (*models.DerivUse
 		"balance":   1,
 		"subscribe": 0,
 	}
-	if err := conn.WriteJSON(balanceReq); err != nil {
-		return nil, err
-	}
 
 	var balanceResponse models.DerivWSResponse
-	if err := conn.ReadJSON(&balanceResponse); err != nil {
+	if err := s.pool.Call(apiToken, balanceReq, &balanceResponse); err != nil {
 		return nil, err
 	}
 
@@ -201,42 +239,18 @@ func (s *DerivService) SwitchAccount(apiToken, loginID string) (*models.DerivUse
 
 // GetBalance fetches the account balance for current or specific account
 func (s *DerivService) GetBalance(apiToken string) (*models.DerivBalance, error) {
-	conn, err := s.connectWebSocket()
+	authResponse, err := s.authorize(apiToken)
 	if err != nil {
 		return nil, err
 	}
-	defer conn.Close()
 
-	// Authorize first
-	authReq := map[string]interface{}{
-		"authorize": apiToken,
-	}
-	if err := conn.WriteJSON(authReq); err != nil {
-		return nil, err
-	}
-
-	// Read auth response
-	var authResponse models.DerivWSResponse
-	if err := conn.ReadJSON(&authResponse); err != nil {
-		return nil, err
-	}
-
-	if authResponse.Error.Code != "" {
-		return nil, fmt.Errorf("auth error: %s", authResponse.Error.Message)
-	}
-
-	// Request balance
 	balanceReq := map[string]interface{}{
 		"balance":   1,
 		"subscribe": 0,
 	}
-	if err := conn.WriteJSON(balanceReq); err != nil {
-		return nil, err
-	}
 
-	// Read balance response
 	var balanceResponse models.DerivWSResponse
-	if err := conn.ReadJSON(&balanceResponse); err != nil {
+	if err := s.pool.Call(apiToken, balanceReq, &balanceResponse); err != nil {
 		return nil, err
 	}
 
@@ -258,6 +272,7 @@ func (s *DerivService) GetBalance(apiToken string) (*models.DerivBalance, error)
 
 // GetAccountDetails fetches detailed account information
 func (s *DerivService) GetAccountDetails(apiToken string) (*models.DerivAccountDetails, error) {
+	// Both calls share the same pooled, already-authorized session.
 	userInfo, err := s.AuthenticateAndGetUserInfo(apiToken)
 	if err != nil {
 		return nil, err
@@ -291,79 +306,219 @@ func (s *DerivService) ValidateToken(apiToken string) (bool, error) {
 	return true, nil
 }
 
-// PlaceTrade places a binary options trade
-func (s *DerivService) PlaceTrade(apiToken, symbol, tradeType string, stake float64, duration int) (*models.DerivTradeResult, error) {
-	conn, err := s.connectWebSocket()
+// PlaceTrade validates the contract request and buys it at market
+func (s *DerivService) PlaceTrade(apiToken string, req models.DerivContractRequest) (*models.DerivTradeResult, error) {
+	if err := req.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid contract: %v", err)
+	}
+
+	authResponse, err := s.authorize(apiToken)
 	if err != nil {
 		return nil, err
 	}
-	defer conn.Close()
 
-	// Authorize first
-	authReq := map[string]interface{}{
-		"authorize": apiToken,
+	// Buy at market. The ask price never exceeds the stake or payout amount,
+	// so the amount itself is a safe upper bound.
+	tradeReq := map[string]interface{}{
+		"buy":        1,
+		"price":      req.Amount,
+		"parameters": req.Parameters(authResponse.Authorize.Currency),
+	}
+
+	return s.buy(apiToken, tradeReq)
+}
+
+// GetProposal asks Deriv to price a contract without buying it. The returned
+// proposal ID can be bought with BuyProposal by the same API token.
+func (s *DerivService) GetProposal(apiToken string, req models.DerivContractRequest) (*models.DerivProposal, error) {
+	if err := req.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid contract: %v", err)
 	}
-	if err := conn.WriteJSON(authReq); err != nil {
+
+	authResponse, err := s.authorize(apiToken)
+	if err != nil {
 		return nil, err
 	}
 
-	var authResponse models.DerivWSResponse
-	if err := conn.ReadJSON(&authResponse); err != nil {
+	params := req.Parameters(authResponse.Authorize.Currency)
+	proposalReq := map[string]interface{}{
+		"proposal": 1,
+	}
+	for k, v := range params {
+		proposalReq[k] = v
+	}
+
+	var proposalResponse models.DerivWSResponse
+	if err := s.pool.Call(apiToken, proposalReq, &proposalResponse); err != nil {
 		return nil, err
 	}
 
-	if authResponse.Error.Code != "" {
-		return nil, fmt.Errorf("auth error: %s", authResponse.Error.Message)
+	if proposalResponse.Error.Code != "" {
+		return nil, fmt.Errorf("proposal error: %s", proposalResponse.Error.Message)
+	}
+
+	proposal := &models.DerivProposal{
+		ProposalID: proposalResponse.Proposal.ID,
+		AskPrice:   proposalResponse.Proposal.AskPrice,
+		Payout:     proposalResponse.Proposal.Payout,
+		Spot:       proposalResponse.Proposal.Spot,
+		SpotTime:   proposalResponse.Proposal.SpotTime,
+		DateStart:  proposalResponse.Proposal.DateStart,
+		Longcode:   proposalResponse.Proposal.Longcode,
+		Currency:   params["currency"].(string),
+		Contract:   req,
+	}
+
+	s.proposals.put(apiToken, proposal)
+
+	return proposal, nil
+}
+
+// PeekProposal returns a proposal quoted for apiToken that has not been
+// bought or expired yet.
+func (s *DerivService) PeekProposal(apiToken, proposalID string) (*models.DerivProposal, bool) {
+	return s.proposals.peek(apiToken, proposalID)
+}
+
+// BuyProposal buys a contract previously quoted by GetProposal. maxPrice is
+// the most the caller is willing to pay; zero means the quoted ask price.
+// The contract that was bought is returned alongside the result.
+func (s *DerivService) BuyProposal(apiToken, proposalID string, maxPrice float64) (*models.DerivTradeResult, *models.DerivContractRequest, error) {
+	proposal, ok := s.proposals.take(apiToken, proposalID)
+	if !ok {
+		return nil, nil, ErrProposalNotFound
+	}
+
+	if maxPrice <= 0 {
+		maxPrice = proposal.AskPrice
+	}
+	if proposal.AskPrice > maxPrice {
+		return nil, nil, fmt.Errorf("%w: ask price %.2f, max_price %.2f", ErrPriceMoved, proposal.AskPrice, maxPrice)
 	}
 
-	// Place the trade using buy contract
+	// Deriv rejects the buy if the price has moved above maxPrice since the quote
 	tradeReq := map[string]interface{}{
-		"buy": 1,
-		"parameters": map[string]interface{}{
-			"contract_type": tradeType,
-			"symbol":        symbol,
-			"amount":        stake,
-			"duration":      duration,
-			"duration_unit": "t", // ticks
-			"basis":         "stake",
-		},
-	}
-
-	if err := conn.WriteJSON(tradeReq); err != nil {
-		return nil, err
+		"buy":   proposalID,
+		"price": maxPrice,
 	}
 
-	// Read trade response
+	result, err := s.buy(apiToken, tradeReq)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, &proposal.Contract, nil
+}
+
+// buy sends a buy request and parses Deriv's confirmation
+func (s *DerivService) buy(apiToken string, tradeReq map[string]interface{}) (*models.DerivTradeResult, error) {
 	var tradeResponse models.DerivWSResponse
-	if err := conn.ReadJSON(&tradeResponse); err != nil {
+	if err := s.pool.Call(apiToken, tradeReq, &tradeResponse); err != nil {
 		return nil, err
 	}
 
 	if tradeResponse.Error.Code != "" {
-		return nil, fmt.Errorf("trade error: %s", tradeResponse.Error.Message)
+		return nil, fmt.Errorf("trade error: %w", &DerivAPIError{Code: tradeResponse.Error.Code, Message: tradeResponse.Error.Message})
+	}
+
+	buy := tradeResponse.Buy
+	if buy.ContractID == 0 {
+		return nil, errors.New("trade error: buy response did not include a contract id")
 	}
 
-	// For now, return simulated result since actual trade response structure may vary
 	result := &models.DerivTradeResult{
-		ContractID: fmt.Sprintf("REAL_%d", time.Now().Unix()),
-		Payout:     stake * 1.85, // Typical payout
-		Status:     "open",
+		ContractID:    strconv.FormatInt(buy.ContractID, 10),
+		TransactionID: strconv.FormatInt(buy.TransactionID, 10),
+		BuyPrice:      buy.BuyPrice,
+		Payout:        buy.Payout,
+		BalanceAfter:  buy.BalanceAfter,
+		Longcode:      buy.Longcode,
+		PurchaseTime:  time.Unix(buy.PurchaseTime, 0),
+		Status:        "open",
 	}
 
 	return result, nil
 }
 
-// connectWebSocket establishes WebSocket connection to Deriv
-func (s *DerivService) connectWebSocket() (*websocket.Conn, error) {
-	dialer := websocket.DefaultDialer
-	dialer.HandshakeTimeout = 10 * time.Second
+// TickHistory fetches raw ticks for symbol from start (epoch seconds) up to
+// end, or up to the latest tick when end is zero, together with the
+// symbol's pip size. It uses the shared public session.
+func (s *DerivService) TickHistory(symbol string, start, end int64, count int) ([]Tick, int, error) {
+	historyReq := map[string]interface{}{
+		"ticks_history": symbol,
+		"style":         "ticks",
+		"end":           "latest",
+		"count":         count,
+	}
+	if start > 0 {
+		historyReq["start"] = start
+	}
+	if end > 0 {
+		historyReq["end"] = end
+	}
 
-	conn, _, err := dialer.Dial(s.wsURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to Deriv WebSocket: %v", err)
+	var historyResponse models.DerivWSResponse
+	if err := s.pool.Call("", historyReq, &historyResponse); err != nil {
+		return nil, 0, err
+	}
+
+	if historyResponse.Error.Code != "" {
+		return nil, 0, fmt.Errorf("ticks history error: %s", historyResponse.Error.Message)
 	}
 
-	return conn, nil
+	prices := historyResponse.History.Prices
+	times := historyResponse.History.Times
+	ticks := make([]Tick, 0, len(prices))
+	for i := range prices {
+		if i < len(times) {
+			ticks = append(ticks, Tick{Epoch: times[i], Quote: prices[i]})
+		}
+	}
+
+	return ticks, int(historyResponse.PipSize), nil
+}
+
+// Candles fetches OHLC candles of granularity seconds for symbol. start and
+// end are epoch seconds; zero means no lower bound and the latest candle
+// respectively.
+func (s *DerivService) Candles(symbol string, granularity int, start, end int64, count int) ([]models.DerivCandle, error) {
+	historyReq := map[string]interface{}{
+		"ticks_history": symbol,
+		"style":         "candles",
+		"granularity":   granularity,
+		"end":           "latest",
+		"count":         count,
+	}
+	if start > 0 {
+		historyReq["start"] = start
+	}
+	if end > 0 {
+		historyReq["end"] = end
+	}
+
+	var historyResponse models.DerivWSResponse
+	if err := s.pool.Call("", historyReq, &historyResponse); err != nil {
+		return nil, err
+	}
+
+	if historyResponse.Error.Code != "" {
+		return nil, fmt.Errorf("candles error: %s", historyResponse.Error.Message)
+	}
+
+	return historyResponse.Candles, nil
+}
+
+// authorize returns the pooled session's authorize response, translating
+// Deriv rejections into the service's usual error format.
+func (s *DerivService) authorize(apiToken string) (*models.DerivWSResponse, error) {
+	response, err := s.pool.Authorize(apiToken)
+	if err != nil {
+		var apiErr *DerivAPIError
+		if errors.As(err, &apiErr) {
+			return nil, fmt.Errorf("deriv API error: %w", apiErr)
+		}
+		return nil, err
+	}
+	return response, nil
 }
 
 // Helper function to pretty print JSON for debugging
@@ -0,0 +1,258 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/keyadaniel56/algocdk/internal/indicators"
+	"github.com/keyadaniel56/algocdk/internal/models"
+)
+
+// defaultHouseEdge is the share of the fair payout Deriv keeps, used to
+// estimate payouts for backtests
+const defaultHouseEdge = 0.03
+
+// BotStrategy parses and validates the strategy definition stored on bot
+func BotStrategy(bot models.Bot) (models.StrategyDefinition, error) {
+	var def models.StrategyDefinition
+	if bot.StrategyDefinition == "" {
+		return def, errors.New("bot has no strategy definition")
+	}
+	if err := json.Unmarshal([]byte(bot.StrategyDefinition), &def); err != nil {
+		return def, fmt.Errorf("invalid strategy definition: %v", err)
+	}
+	if err := def.Validate(); err != nil {
+		return def, fmt.Errorf("invalid strategy definition: %v", err)
+	}
+	return def, nil
+}
+
+// StrategyLookback is the number of bars def needs to evaluate its entry
+// conditions, including warm-up for indicators.
+func StrategyLookback(def *models.StrategyDefinition) int {
+	n := 50
+	for _, cond := range def.Entry {
+		for _, o := range []models.StrategyOperand{cond.Left, cond.Right} {
+			need := o.Offset + 2
+			if o.Indicator != nil {
+				need += o.Indicator.Lookback()
+			}
+			if need > n {
+				n = need
+			}
+		}
+	}
+	return n
+}
+
+// EvaluateEntry reports whether every entry condition of def holds at the
+// last bar of bars. pipSize is used by last-digit operands.
+func EvaluateEntry(def *models.StrategyDefinition, bars []models.Candle, pipSize int) bool {
+	return NewStrategyEvaluator(def, bars, pipSize).EntryAt(len(bars) - 1)
+}
+
+// StrategyEvaluator evaluates a strategy's entry conditions over a fixed bar
+// series. Indicator series are computed once and reused for every bar,
+// which keeps backtests linear in the number of bars.
+type StrategyEvaluator struct {
+	def     *models.StrategyDefinition
+	bars    []models.Candle
+	pipSize int
+	series  map[string][]float64
+}
+
+// NewStrategyEvaluator prepares def for evaluation over bars
+func NewStrategyEvaluator(def *models.StrategyDefinition, bars []models.Candle, pipSize int) *StrategyEvaluator {
+	return &StrategyEvaluator{
+		def:     def,
+		bars:    bars,
+		pipSize: pipSize,
+		series:  make(map[string][]float64),
+	}
+}
+
+// EntryAt reports whether every entry condition holds at the close of bar
+// i. Only bars up to i are looked at.
+func (e *StrategyEvaluator) EntryAt(i int) bool {
+	if i < 0 || i >= len(e.bars) {
+		return false
+	}
+	for _, cond := range e.def.Entry {
+		if !e.condition(cond, i) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *StrategyEvaluator) condition(cond models.StrategyCondition, i int) bool {
+	left, ok := e.operand(cond.Left, i)
+	if !ok {
+		return false
+	}
+	right, ok := e.operand(cond.Right, i)
+	if !ok {
+		return false
+	}
+
+	switch cond.Op {
+	case ">":
+		return left > right
+	case ">=":
+		return left >= right
+	case "<":
+		return left < right
+	case "<=":
+		return left <= right
+	case "==":
+		return left == right
+	case "!=":
+		return left != right
+	case "crosses_above", "crosses_below":
+		prevLeft, ok := e.operand(cond.Left, i-1)
+		if !ok {
+			return false
+		}
+		prevRight, ok := e.operand(cond.Right, i-1)
+		if !ok {
+			return false
+		}
+		if cond.Op == "crosses_above" {
+			return prevLeft <= prevRight && left > right
+		}
+		return prevLeft >= prevRight && left < right
+	}
+	return false
+}
+
+// operand evaluates o at bar i. It returns false when there is not enough
+// history.
+func (e *StrategyEvaluator) operand(o models.StrategyOperand, i int) (float64, bool) {
+	if o.Kind == "value" {
+		return o.Value, true
+	}
+
+	bars := e.bars
+	idx := i - o.Offset
+	if idx < 0 || idx >= len(bars) {
+		return 0, false
+	}
+	bar := bars[idx]
+
+	switch o.Kind {
+	case "price":
+		switch o.Field {
+		case "open":
+			return bar.Open, true
+		case "high":
+			return bar.High, true
+		case "low":
+			return bar.Low, true
+		}
+		return bar.Close, true
+	case "change":
+		if idx < 1 {
+			return 0, false
+		}
+		return bar.Close - bars[idx-1].Close, true
+	case "last_digit":
+		return float64(indicators.LastDigit(bar.Close, e.pipSize)), true
+	case "streak":
+		// Consecutive rising (positive) or falling (negative) closes
+		streak := 0
+		for j := idx; j >= 1; j-- {
+			diff := bars[j].Close - bars[j-1].Close
+			switch {
+			case diff > 0 && streak >= 0:
+				streak++
+			case diff < 0 && streak <= 0:
+				streak--
+			default:
+				return float64(streak), true
+			}
+		}
+		return float64(streak), true
+	case "indicator":
+		if o.Indicator == nil {
+			return 0, false
+		}
+		series := e.indicator(*o.Indicator)
+		if series == nil || math.IsNaN(series[idx]) {
+			return 0, false
+		}
+		return series[idx], true
+	}
+	return 0, false
+}
+
+// indicator returns the selected output line of spec over all bars. Every
+// indicator only looks backwards, so value i equals what would have been
+// computed at the close of bar i.
+func (e *StrategyEvaluator) indicator(spec models.IndicatorSpec) []float64 {
+	key := spec.Key() + "." + spec.Output
+	if series, ok := e.series[key]; ok {
+		return series
+	}
+	lines, err := indicators.Compute(spec, e.bars)
+	var series []float64
+	if err == nil {
+		series = lines[spec.Output]
+	}
+	e.series[key] = series
+	return series
+}
+
+// DefaultPayoutRatio estimates the profit per unit of stake Deriv pays on a
+// winning contract from its probability of winning. Contracts whose odds
+// depend on barriers need an explicit payout ratio.
+func DefaultPayoutRatio(c models.DerivContractRequest) (float64, error) {
+	var p float64
+	digit := 0
+	if c.Prediction != nil {
+		digit = *c.Prediction
+	}
+
+	switch c.ContractType {
+	case "CALL", "PUT":
+		if c.Barrier != "" {
+			return 0, fmt.Errorf("set payout_ratio for %s with a barrier", c.ContractType)
+		}
+		p = 0.5
+	case "CALLE", "PUTE", "ASIANU", "ASIAND", "DIGITEVEN", "DIGITODD":
+		p = 0.5
+	case "DIGITMATCH":
+		p = 0.1
+	case "DIGITDIFF":
+		p = 0.9
+	case "DIGITOVER":
+		p = float64(9-digit) / 10
+	case "DIGITUNDER":
+		p = float64(digit) / 10
+	default:
+		return 0, fmt.Errorf("set payout_ratio for %s", c.ContractType)
+	}
+	return (1-defaultHouseEdge)/p - 1, nil
+}
+
+// NextStake applies the sizing rule. lastWon reports the outcome of the
+// previous contract and lastStake its stake (zero before the first one).
+func NextStake(sizing models.StakeSizing, balance, lastStake float64, lastWon bool) float64 {
+	var stake float64
+	switch sizing.Mode {
+	case "percent":
+		stake = balance * sizing.Percent / 100
+	case "martingale":
+		stake = sizing.Amount
+		if lastStake > 0 && !lastWon {
+			stake = lastStake * sizing.Multiplier
+		}
+	default:
+		stake = sizing.Amount
+	}
+	if sizing.MaxStake > 0 && stake > sizing.MaxStake {
+		stake = sizing.MaxStake
+	}
+	return roundTo(stake, 2)
+}
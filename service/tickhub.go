@@ -0,0 +1,197 @@
+package services
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// TickHub fans out market ticks to any number of listeners while holding a
+// single upstream subscription per symbol. The upstream stream is started
+// by the first listener of a symbol and stopped when the last one leaves.
+type TickHub struct {
+	RetryInterval time.Duration
+
+	mu     sync.Mutex
+	source MarketDataSource
+	feeds  map[string]*tickFeed
+}
+
+type tickFeed struct {
+	symbol    string
+	ready     chan struct{} // closed once the first upstream subscribe finished
+	err       error
+	stop      func()
+	listeners map[chan<- MarketTick]bool
+	last      *MarketTick
+}
+
+// NewTickHub creates a hub reading from source.
+func NewTickHub(source MarketDataSource) *TickHub {
+	return &TickHub{
+		RetryInterval: 5 * time.Second,
+		source:        source,
+		feeds:         make(map[string]*tickFeed),
+	}
+}
+
+// SetSource swaps the market data source. Feeds already running keep their
+// current upstream until their listeners leave.
+func (h *TickHub) SetSource(source MarketDataSource) {
+	h.mu.Lock()
+	h.source = source
+	h.mu.Unlock()
+}
+
+// Subscribe adds ch as a listener for symbol. Ticks are sent without
+// blocking, so a listener that falls behind misses updates rather than
+// slowing everyone else. The error of the upstream subscription, such as an
+// unknown symbol, is returned to every listener that was waiting on it.
+func (h *TickHub) Subscribe(symbol string, ch chan<- MarketTick) error {
+	h.mu.Lock()
+	feed, exists := h.feeds[symbol]
+	if !exists {
+		feed = &tickFeed{
+			symbol:    symbol,
+			ready:     make(chan struct{}),
+			listeners: make(map[chan<- MarketTick]bool),
+		}
+		h.feeds[symbol] = feed
+	}
+	feed.listeners[ch] = true
+	source := h.source
+	h.mu.Unlock()
+
+	if !exists {
+		ticks, stop, err := source.SubscribeTicks(symbol)
+		h.mu.Lock()
+		feed.err = err
+		feed.stop = stop
+		registered := h.feeds[symbol] == feed
+		if err != nil && registered {
+			delete(h.feeds, symbol)
+		}
+		h.mu.Unlock()
+		close(feed.ready)
+
+		switch {
+		case err != nil:
+		case !registered:
+			// Every listener left while the upstream was being set up
+			stop()
+		default:
+			go h.pump(feed, ticks)
+		}
+	}
+
+	<-feed.ready
+	if feed.err != nil {
+		return feed.err
+	}
+
+	// Give the new listener the latest price straight away
+	h.mu.Lock()
+	last := feed.last
+	h.mu.Unlock()
+	if last != nil {
+		select {
+		case ch <- *last:
+		default:
+		}
+	}
+	return nil
+}
+
+// Unsubscribe removes ch as a listener for symbol and stops the upstream
+// subscription if nobody else is listening.
+func (h *TickHub) Unsubscribe(symbol string, ch chan<- MarketTick) {
+	h.mu.Lock()
+	feed, ok := h.feeds[symbol]
+	if !ok {
+		h.mu.Unlock()
+		return
+	}
+	delete(feed.listeners, ch)
+	if len(feed.listeners) > 0 {
+		h.mu.Unlock()
+		return
+	}
+	delete(h.feeds, symbol)
+	stop := feed.stop
+	h.mu.Unlock()
+
+	if stop != nil {
+		stop()
+	}
+}
+
+// Latest returns the most recent tick seen for symbol, if it is being streamed.
+func (h *TickHub) Latest(symbol string) (MarketTick, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	feed, ok := h.feeds[symbol]
+	if !ok || feed.last == nil {
+		return MarketTick{}, false
+	}
+	return *feed.last, true
+}
+
+// Symbols lists the symbols that currently have an upstream subscription.
+func (h *TickHub) Symbols() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	symbols := make([]string, 0, len(h.feeds))
+	for symbol := range h.feeds {
+		symbols = append(symbols, symbol)
+	}
+	return symbols
+}
+
+// pump delivers upstream ticks to the feed's listeners and re-subscribes if
+// the upstream stream is lost while listeners remain.
+func (h *TickHub) pump(feed *tickFeed, ticks <-chan MarketTick) {
+	for {
+		for tick := range ticks {
+			h.mu.Lock()
+			t := tick
+			feed.last = &t
+			for ch := range feed.listeners {
+				select {
+				case ch <- tick:
+				default:
+				}
+			}
+			h.mu.Unlock()
+		}
+
+		// The stream ended: either it was stopped or the upstream was lost
+		for {
+			time.Sleep(h.RetryInterval)
+			h.mu.Lock()
+			if h.feeds[feed.symbol] != feed {
+				h.mu.Unlock()
+				return
+			}
+			source := h.source
+			h.mu.Unlock()
+
+			log.Printf("[TickHub] %s stream ended, resubscribing", feed.symbol)
+			next, stop, err := source.SubscribeTicks(feed.symbol)
+			if err != nil {
+				log.Printf("[TickHub] resubscribe to %s failed: %v", feed.symbol, err)
+				continue
+			}
+
+			h.mu.Lock()
+			if h.feeds[feed.symbol] != feed {
+				h.mu.Unlock()
+				stop()
+				return
+			}
+			feed.stop = stop
+			h.mu.Unlock()
+			ticks = next
+			break
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingSource counts the upstream subscriptions made to source and how
+// many of them were stopped
+type countingSource struct {
+	source MarketDataSource
+
+	mu         sync.Mutex
+	subscribed map[string]int
+	stopped    map[string]int
+}
+
+func newCountingSource(source MarketDataSource) *countingSource {
+	return &countingSource{source: source, subscribed: map[string]int{}, stopped: map[string]int{}}
+}
+
+func (s *countingSource) SubscribeTicks(symbol string) (<-chan MarketTick, func(), error) {
+	ticks, stop, err := s.source.SubscribeTicks(symbol)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.mu.Lock()
+	s.subscribed[symbol]++
+	s.mu.Unlock()
+	return ticks, func() {
+		s.mu.Lock()
+		s.stopped[symbol]++
+		s.mu.Unlock()
+		stop()
+	}, nil
+}
+
+func (s *countingSource) counts(symbol string) (subscribed, stopped int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.subscribed[symbol], s.stopped[symbol]
+}
+
+// recording is n ticks of symbol, one a second
+func recording(symbol string, n int) []MarketTick {
+	ticks := make([]MarketTick, n)
+	for i := range ticks {
+		quote := 100 + float64(i)/100
+		ticks[i] = MarketTick{Symbol: symbol, Bid: quote - 0.01, Ask: quote + 0.01, Quote: quote, Epoch: 1700000000 + int64(i), PipSize: 2}
+	}
+	return ticks
+}
+
+// nextTick waits for a tick on ch
+func nextTick(t *testing.T, ch <-chan MarketTick) MarketTick {
+	t.Helper()
+	select {
+	case tick := <-ch:
+		return tick
+	case <-time.After(5 * time.Second):
+		t.Fatal("no tick")
+		return MarketTick{}
+	}
+}
+
+func TestTickHubSharesOneUpstreamPerSymbol(t *testing.T) {
+	source := newCountingSource(&ReplayMarketSource{
+		Interval: 5 * time.Millisecond,
+		Ticks:    map[string][]MarketTick{"R_100": recording("R_100", 10000)},
+	})
+	hub := NewTickHub(source)
+	// The recording outlasts the test, so no stream is restarted
+	hub.RetryInterval = 10 * time.Millisecond
+
+	first := make(chan MarketTick, 16)
+	second := make(chan MarketTick, 16)
+	if err := hub.Subscribe("R_100", first); err != nil {
+		t.Fatal(err)
+	}
+	if tick := nextTick(t, first); tick.Symbol != "R_100" || tick.Epoch != 1700000000 {
+		t.Errorf("first tick %+v, want the start of the recording", tick)
+	}
+	if err := hub.Subscribe("R_100", second); err != nil {
+		t.Fatal(err)
+	}
+	// The latest price is handed over on joining, then the live stream
+	joined := nextTick(t, second)
+	if later := nextTick(t, second); later.Epoch <= joined.Epoch {
+		t.Errorf("tick %d after %d", later.Epoch, joined.Epoch)
+	}
+	nextTick(t, first)
+
+	if subscribed, _ := source.counts("R_100"); subscribed != 1 {
+		t.Errorf("%d upstream subscriptions for two listeners, want 1", subscribed)
+	}
+	if symbols := hub.Symbols(); len(symbols) != 1 || symbols[0] != "R_100" {
+		t.Errorf("streaming %v", symbols)
+	}
+
+	// The upstream stays up while anyone is listening
+	hub.Unsubscribe("R_100", first)
+	if _, stopped := source.counts("R_100"); stopped != 0 {
+		t.Fatal("upstream stopped with a listener left")
+	}
+	for len(second) > 0 {
+		<-second
+	}
+	nextTick(t, second)
+
+	hub.Unsubscribe("R_100", second)
+	if subscribed, stopped := source.counts("R_100"); subscribed != 1 || stopped != 1 {
+		t.Errorf("%d subscribed, %d stopped after the last listener left, want 1 and 1", subscribed, stopped)
+	}
+	if symbols := hub.Symbols(); len(symbols) != 0 {
+		t.Errorf("still streaming %v", symbols)
+	}
+	if _, ok := hub.Latest("R_100"); ok {
+		t.Error("latest price kept for a symbol nobody streams")
+	}
+
+	// A new listener starts a fresh upstream
+	third := make(chan MarketTick, 16)
+	if err := hub.Subscribe("R_100", third); err != nil {
+		t.Fatal(err)
+	}
+	defer hub.Unsubscribe("R_100", third)
+	nextTick(t, third)
+	if subscribed, _ := source.counts("R_100"); subscribed != 2 {
+		t.Errorf("%d upstream subscriptions after rejoining, want 2", subscribed)
+	}
+}
+
+func TestTickHubReturnsUpstreamError(t *testing.T) {
+	hub := NewTickHub(&ReplayMarketSource{Ticks: map[string][]MarketTick{}})
+
+	var apiErr *DerivAPIError
+	if err := hub.Subscribe("R_999", make(chan MarketTick, 1)); !errors.As(err, &apiErr) || apiErr.Code != "InvalidSymbol" {
+		t.Errorf("subscribe to an unrecorded symbol: %v", err)
+	}
+	if symbols := hub.Symbols(); len(symbols) != 0 {
+		t.Errorf("failed subscription left %v streaming", symbols)
+	}
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"errors"
+	"log"
+
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+	"github.com/keyadaniel56/algocdk/internal/secrets"
+)
+
+// SealDerivToken stores token on credentials sealed with the current key,
+// along with a masked hint for display. Without a configured key, which
+// only development allows, the token is kept in plaintext until
+// ReencryptDerivTokens runs.
+func SealDerivToken(credentials *models.DerivCredentials, token string) error {
+	sealed, keyID, err := secrets.Seal(token)
+	if errors.Is(err, secrets.ErrNoKey) {
+		sealed, keyID, err = token, "", nil
+	}
+	if err != nil {
+		return err
+	}
+	credentials.APIToken = sealed
+	credentials.KeyID = keyID
+	credentials.TokenHint = secrets.Mask(token)
+	return nil
+}
+
+// ReencryptDerivTokens seals every stored Deriv token that is in plaintext or
+// under an older key with the current key. It returns how many were updated
+// and how many could not be decrypted with the configured keys.
+func ReencryptDerivTokens() (updated, failed int, err error) {
+	current := secrets.CurrentKeyID()
+	if current == "" {
+		return 0, 0, secrets.ErrNoKey
+	}
+
+	var stale []models.DerivCredentials
+	if err := database.DB.Where("key_id IS NULL OR key_id <> ?", current).Find(&stale).Error; err != nil {
+		return 0, 0, err
+	}
+
+	for _, credentials := range stale {
+		token, err := secrets.Open(credentials.APIToken)
+		if err != nil {
+			log.Printf("[Tokens] credentials %d could not be decrypted: %v", credentials.ID, err)
+			failed++
+			continue
+		}
+		if err := SealDerivToken(&credentials, token); err != nil {
+			return updated, failed, err
+		}
+		if err := database.DB.Model(&credentials).Updates(map[string]interface{}{
+			"api_token":  credentials.APIToken,
+			"key_id":     credentials.KeyID,
+			"token_hint": credentials.TokenHint,
+		}).Error; err != nil {
+			return updated, failed, err
+		}
+		updated++
+	}
+	return updated, failed, nil
+}
@@ -0,0 +1,29 @@
+package tasks
+
+import (
+	"log"
+	"time"
+
+	"github.com/keyadaniel56/algocdk/internal/database"
+	"github.com/keyadaniel56/algocdk/internal/models"
+)
+
+// membershipGrace is how long a lapsed paid membership is kept while a late
+// renewal may still come in
+const membershipGrace = 24 * time.Hour
+
+// ExpireMemberships moves users whose paid membership ran out back to the
+// free tier. Admins keep the tier their role gives them.
+func ExpireMemberships() {
+	result := database.DB.Model(&models.User{}).
+		Where("role = ? AND membership <> ? AND subscription_expiry > ? AND subscription_expiry < ?",
+			"user", "freemium", time.Time{}, time.Now().Add(-membershipGrace)).
+		Update("membership", "freemium")
+	if result.Error != nil {
+		log.Printf("[Scheduler] Failed to expire memberships: %v", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("[Scheduler] Moved %d lapsed memberships back to freemium", result.RowsAffected)
+	}
+}
@@ -0,0 +1,16 @@
+package tasks
+
+import "time"
+
+// Start runs the expiry tasks now and then every interval in the background
+func Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			DeactivateExpiredBots()
+			ExpireMemberships()
+			<-ticker.C
+		}
+	}()
+}